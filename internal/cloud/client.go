@@ -0,0 +1,237 @@
+// Package cloud talks to the Shelly Cloud API for data that only lives in the
+// cloud, such as app scenes
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestInterval spaces out API requests; the cloud rejects accounts that
+// send more than about one request per second
+const requestInterval = time.Second
+
+// Client handles Shelly Cloud API communication
+// The server is account specific (e.g. https://shelly-42-eu.shelly.cloud) and
+// is shown together with the auth key in the app under User settings.
+type Client struct {
+	baseURL    string
+	authKey    string
+	httpClient *http.Client
+
+	mu   sync.Mutex
+	last time.Time // when the last request was sent
+}
+
+// Response is the envelope of every Shelly Cloud API response
+type Response struct {
+	IsOK   bool                       `json:"isok"`
+	Data   json.RawMessage            `json:"data"`
+	Errors map[string]json.RawMessage `json:"errors,omitempty"`
+}
+
+// Scene is a cloud scene. Raw holds the full scene definition as returned by
+// the API, so fields this tool doesn't know about survive a pull/push cycle.
+type Scene struct {
+	ID   string          `json:"-"`
+	Name string          `json:"-"`
+	Raw  json.RawMessage `json:"-"`
+}
+
+// NewClient creates a new Shelly Cloud API client
+func NewClient(server, authKey string) *Client {
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(server, "/"),
+		authKey: authKey,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// post calls an API endpoint with form parameters and returns the data field
+func (c *Client) post(ctx context.Context, path string, form url.Values) (json.RawMessage, error) {
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set("auth_key", c.authKey)
+
+	if err := c.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/"+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cloud API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var apiResp Response
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if !apiResp.IsOK {
+		return nil, fmt.Errorf("cloud API error on %s: %s", path, formatErrors(apiResp.Errors))
+	}
+
+	return apiResp.Data, nil
+}
+
+// throttle waits until the next request may be sent
+func (c *Client) throttle(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if wait := time.Until(c.last.Add(requestInterval)); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	c.last = time.Now()
+	return nil
+}
+
+// formatErrors renders the errors object of a failed response
+func formatErrors(errors map[string]json.RawMessage) string {
+	if len(errors) == 0 {
+		return "unknown error"
+	}
+	parts := make([]string, 0, len(errors))
+	for key, value := range errors {
+		parts = append(parts, fmt.Sprintf("%s: %s", key, string(value)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ListScenes retrieves all scenes of the account
+func (c *Client) ListScenes(ctx context.Context) ([]Scene, error) {
+	data, err := c.post(ctx, "scene/list", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Scenes []json.RawMessage `json:"scenes"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal scenes: %w", err)
+	}
+
+	scenes := make([]Scene, 0, len(response.Scenes))
+	for _, raw := range response.Scenes {
+		scene, err := ParseScene(raw)
+		if err != nil {
+			return nil, err
+		}
+		scenes = append(scenes, scene)
+	}
+
+	return scenes, nil
+}
+
+// SaveScene updates an existing scene, or creates it when it has no ID, and returns its ID
+func (c *Client) SaveScene(ctx context.Context, scene Scene) (string, error) {
+	form := url.Values{}
+	form.Set("scene", string(scene.Raw))
+
+	path := "scene/add"
+	if scene.ID != "" {
+		path = "scene/edit"
+		form.Set("id", scene.ID)
+	}
+
+	data, err := c.post(ctx, path, form)
+	if err != nil {
+		return "", err
+	}
+
+	if scene.ID != "" {
+		return scene.ID, nil
+	}
+	created, err := ParseScene(data)
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// DeleteScene deletes a scene
+func (c *Client) DeleteScene(ctx context.Context, sceneID string) error {
+	form := url.Values{}
+	form.Set("id", sceneID)
+	_, err := c.post(ctx, "scene/delete", form)
+	return err
+}
+
+// ParseScene extracts the ID and name from a raw scene definition
+// The API returns numeric or string IDs depending on the endpoint
+func ParseScene(raw json.RawMessage) (Scene, error) {
+	var fields struct {
+		ID   json.RawMessage `json:"id"`
+		Name string          `json:"name"`
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return Scene{}, fmt.Errorf("failed to unmarshal scene: %w", err)
+	}
+
+	id := strings.Trim(string(fields.ID), `"`)
+	if id == "null" {
+		id = ""
+	}
+
+	return Scene{
+		ID:   id,
+		Name: fields.Name,
+		Raw:  raw,
+	}, nil
+}
+
+// DeviceRPC relays an RPC call to a device connected to the account. Devices
+// are identified by their cloud ID, the lowercase MAC address without
+// separators.
+func (c *Client) DeviceRPC(ctx context.Context, cloudID, method string, params interface{}) (json.RawMessage, error) {
+	form := url.Values{}
+	form.Set("id", cloudID)
+	form.Set("method", method)
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal params: %w", err)
+		}
+		form.Set("params", string(data))
+	}
+
+	data, err := c.post(ctx, "device/rpc", form)
+	if err != nil {
+		return nil, fmt.Errorf("%s via Shelly Cloud: %w", method, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,162 @@
+// Package completion provides dynamic shell completion (bash, zsh, fish,
+// powershell) for CLI arguments and flags that name devices, tags or
+// components, read from the manifest and device folders of the repository
+package completion
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// RepoFlag is the persistent flag holding the repository path
+const RepoFlag = "repo"
+
+// repoPath returns the repository the command operates on
+func repoPath(cmd *cobra.Command) string {
+	if flag := cmd.Flag(RepoFlag); flag != nil && flag.Value.String() != "" {
+		return flag.Value.String()
+	}
+	return "."
+}
+
+// loadDevices reads the manifest without opening the git repository, so
+// completion stays fast and works in a repository with local changes
+func loadDevices(cmd *cobra.Command) []storage.Device {
+	manifest, err := storage.LoadManifest(storage.FindManifest(repoPath(cmd)))
+	if err != nil {
+		return nil
+	}
+	return manifest.Devices
+}
+
+// Devices completes device filters: device names and IDs, plus the qualified
+// tag:, vlan:, gen:, model: and firmware: filters understood by
+// SyncManager.SelectDevices.
+// Values already given as arguments are not offered again.
+func Devices(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	devices := loadDevices(cmd)
+
+	used := make(map[string]bool, len(args))
+	for _, arg := range args {
+		used[strings.ToLower(arg)] = true
+	}
+
+	seen := make(map[string]bool)
+	var completions []cobra.Completion
+	add := func(value, description string) {
+		key := strings.ToLower(value)
+		if used[key] || seen[key] || !strings.HasPrefix(key, strings.ToLower(toComplete)) {
+			return
+		}
+		seen[key] = true
+		completions = append(completions, cobra.CompletionWithDesc(value, description))
+	}
+
+	for _, device := range devices {
+		add(device.Name, device.Model)
+		add(device.DeviceID, device.Name)
+		for _, tag := range device.Tags {
+			add("tag:"+tag, "devices tagged "+tag)
+		}
+		if device.Network != "" {
+			add("vlan:"+device.Network, "devices on network "+device.Network)
+		}
+		if device.VLAN != 0 {
+			add("vlan:"+strconv.Itoa(device.VLAN), "devices on VLAN "+strconv.Itoa(device.VLAN))
+		}
+		if device.Generation != 0 {
+			add("gen:"+strconv.Itoa(device.Generation), "generation "+strconv.Itoa(device.Generation)+" devices")
+		}
+		if device.Model != "" {
+			add("model:"+device.Model, device.Model+" devices")
+		}
+		if device.Firmware != "" {
+			add("firmware:"+device.Firmware, "devices on firmware "+device.Firmware)
+		}
+	}
+
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// Tags completes the tags used in the manifest
+func Tags(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	counts := make(map[string]int)
+	for _, device := range loadDevices(cmd) {
+		for _, tag := range device.Tags {
+			counts[tag]++
+		}
+	}
+
+	var completions []cobra.Completion
+	for tag, count := range counts {
+		if strings.HasPrefix(strings.ToLower(tag), strings.ToLower(toComplete)) {
+			completions = append(completions, cobra.CompletionWithDesc(tag, strconv.Itoa(count)+" device(s)"))
+		}
+	}
+
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// Components completes component config names ("sys", "switch-0", ...) found
+// in the device folders. If devices were already given as arguments only
+// their components are offered.
+func Components(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	ds := storage.NewDeviceStorage(repoPath(cmd))
+
+	devices := loadDevices(cmd)
+	if len(args) > 0 {
+		var selected []storage.Device
+		for _, device := range devices {
+			for _, arg := range args {
+				if strings.EqualFold(arg, device.Name) || strings.EqualFold(arg, device.DeviceID) {
+					selected = append(selected, device)
+					break
+				}
+			}
+		}
+		if len(selected) > 0 {
+			devices = selected
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, device := range devices {
+		components, err := ds.ListComponentConfigs(device.Folder)
+		if err != nil {
+			continue
+		}
+		for _, component := range components {
+			counts[component]++
+		}
+	}
+
+	var completions []cobra.Completion
+	for component, count := range counts {
+		if strings.HasPrefix(component, strings.ToLower(toComplete)) {
+			completions = append(completions, cobra.CompletionWithDesc(component, strconv.Itoa(count)+" device(s)"))
+		}
+	}
+
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// RegisterDeviceFlags attaches Devices completion to the named flags of cmd
+// that exist, e.g. "device" or "filter"
+func RegisterDeviceFlags(cmd *cobra.Command, flags ...string) error {
+	for _, name := range flags {
+		if cmd.Flags().Lookup(name) == nil {
+			continue
+		}
+		if err := cmd.RegisterFlagCompletionFunc(name, Devices); err != nil {
+			return err
+		}
+	}
+	return nil
+}
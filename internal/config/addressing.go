@@ -0,0 +1,147 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+)
+
+// Addressing modes
+const (
+	// AddressingDirect dials devices at their manifest IP (default)
+	AddressingDirect = "direct"
+
+	// AddressingSubnet dials devices through a routed tunnel, e.g. a Tailscale
+	// subnet router or WireGuard peer, translating site subnets that overlap
+	// with the daemon's network via subnet_map
+	AddressingSubnet = "subnet"
+
+	// Addressing4via6 dials devices at their Tailscale 4via6 address for site_id,
+	// for sites whose subnets overlap with each other
+	Addressing4via6 = "4via6"
+
+	// AddressingHosts dials devices by host name, e.g. MagicDNS names or names
+	// resolved on the WireGuard peer
+	AddressingHosts = "hosts"
+)
+
+// Addressing describes how devices are reached from the machine running the
+// tool, e.g. a cloud-hosted daemon managing an on-prem fleet over a VPN.
+// Device IPs in the manifest stay the on-site LAN addresses.
+type Addressing struct {
+	Mode string `json:"mode,omitempty"`
+
+	// SubnetMap translates on-site subnets to the subnets routed to the
+	// site (subnet mode), e.g. "192.168.1.0/24": "10.81.1.0/24". Both sides
+	// must have the same prefix length; host bits are kept.
+	SubnetMap map[string]string `json:"subnet_map,omitempty"`
+
+	// SiteID is the Tailscale site ID advertised by the subnet router (4via6 mode)
+	SiteID uint16 `json:"site_id,omitempty"`
+
+	// Hosts maps a device ID, name or IP to the host[:port] to dial (hosts mode)
+	Hosts map[string]string `json:"hosts,omitempty"`
+
+	// HostSuffix is appended to the host label of devices missing from Hosts,
+	// e.g. "site-a.ts.net" turns Kitchen Light into kitchen-light.site-a.ts.net
+	HostSuffix string `json:"host_suffix,omitempty"`
+
+	// Tunnel carries all device connections through a jump host at the site,
+	// for sites reached without a VPN. It combines with any mode; addresses
+	// are dialled from the jump host.
+	Tunnel *Tunnel `json:"tunnel,omitempty"`
+}
+
+// Tunnel is an SSH jump host or a SOCKS5 proxy at a remote site. Set exactly
+// one of SSH and SOCKS5.
+type Tunnel struct {
+	// SSH is the jump host as [user@]host[:port]; connections are forwarded
+	// by the built-in SSH client, like ssh -D
+	SSH string `json:"ssh,omitempty"`
+
+	// IdentityFile is an unencrypted private key for SSH. Without one, keys
+	// from ssh-agent and the default ~/.ssh/id_* files are tried.
+	IdentityFile string `json:"identity_file,omitempty"`
+
+	// KnownHosts verifies the jump host's key (default ~/.ssh/known_hosts)
+	KnownHosts string `json:"known_hosts,omitempty"`
+
+	// SOCKS5 is a SOCKS5 proxy as host:port, e.g. one kept open at the site
+	// with ssh -D
+	SOCKS5 string `json:"socks5,omitempty"`
+}
+
+// GetDefaultAddressingPath returns the default addressing config path
+func GetDefaultAddressingPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".shelly-gitops", "addressing.json"), nil
+}
+
+// LoadAddressing loads and validates an addressing config, returning direct
+// addressing if the file doesn't exist
+func LoadAddressing(path string) (*Addressing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Addressing{Mode: AddressingDirect}, nil
+		}
+		return nil, fmt.Errorf("failed to read addressing config: %w", err)
+	}
+
+	var addressing Addressing
+	if err := json.Unmarshal(data, &addressing); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal addressing config: %w", err)
+	}
+	if err := addressing.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &addressing, nil
+}
+
+// Validate checks the mode and its settings
+func (a *Addressing) Validate() error {
+	switch a.Mode {
+	case "", AddressingDirect, AddressingHosts:
+	case AddressingSubnet:
+		if _, err := a.SubnetPrefixes(); err != nil {
+			return err
+		}
+	case Addressing4via6:
+		if a.SiteID == 0 {
+			return fmt.Errorf("addressing mode %s requires site_id", a.Mode)
+		}
+	default:
+		return fmt.Errorf("unknown addressing mode %q (want %s, %s, %s or %s)",
+			a.Mode, AddressingDirect, AddressingSubnet, Addressing4via6, AddressingHosts)
+	}
+	if a.Tunnel != nil && (a.Tunnel.SSH == "") == (a.Tunnel.SOCKS5 == "") {
+		return fmt.Errorf("tunnel requires exactly one of ssh and socks5")
+	}
+	return nil
+}
+
+// SubnetPrefixes parses SubnetMap into on-site and routed prefix pairs
+func (a *Addressing) SubnetPrefixes() (map[netip.Prefix]netip.Prefix, error) {
+	prefixes := make(map[netip.Prefix]netip.Prefix, len(a.SubnetMap))
+	for from, to := range a.SubnetMap {
+		fromPrefix, err := netip.ParsePrefix(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet_map entry %q: %w", from, err)
+		}
+		toPrefix, err := netip.ParsePrefix(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet_map target %q: %w", to, err)
+		}
+		if !fromPrefix.Addr().Is4() || !toPrefix.Addr().Is4() || fromPrefix.Bits() != toPrefix.Bits() {
+			return nil, fmt.Errorf("subnet_map %s -> %s must map IPv4 subnets of the same size", from, to)
+		}
+		prefixes[fromPrefix.Masked()] = toPrefix.Masked()
+	}
+	return prefixes, nil
+}
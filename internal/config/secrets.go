@@ -0,0 +1,79 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SecretStore manages secrets kept out of the Git repository
+// Secrets are exposed to templates as {{ .secrets.<name> }}
+type SecretStore struct {
+	path string
+}
+
+// NewSecretStore creates a new secret store
+func NewSecretStore(path string) *SecretStore {
+	return &SecretStore{
+		path: path,
+	}
+}
+
+// GetDefaultSecretsPath returns the default secret store path
+func GetDefaultSecretsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".shelly-gitops", "secrets.json"), nil
+}
+
+// Load loads all secrets, returning an empty map if the store doesn't exist
+func (ss *SecretStore) Load() (map[string]string, error) {
+	data, err := os.ReadFile(ss.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(map[string]string), nil
+		}
+		return nil, fmt.Errorf("failed to read secrets: %w", err)
+	}
+
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secrets: %w", err)
+	}
+
+	return secrets, nil
+}
+
+// Save writes all secrets to the store
+func (ss *SecretStore) Save(secrets map[string]string) error {
+	dir := filepath.Dir(ss.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(secrets, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+
+	// Write with restricted permissions
+	if err := os.WriteFile(ss.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets: %w", err)
+	}
+
+	return nil
+}
+
+// Set stores a single secret
+func (ss *SecretStore) Set(name, value string) error {
+	secrets, err := ss.Load()
+	if err != nil {
+		return err
+	}
+
+	secrets[name] = value
+	return ss.Save(secrets)
+}
@@ -0,0 +1,450 @@
+// Package daemon runs continuous drift detection against the device fleet
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/gitops"
+	"github.com/darkermage/shelly-git-ops/internal/profiling"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+const (
+	defaultInterval   = 15 * time.Minute
+	minReconnectDelay = 5 * time.Second
+	maxReconnectDelay = 5 * time.Minute
+)
+
+// Options configures the daemon
+type Options struct {
+	// Interval between full drift checks of every selected device
+	Interval time.Duration
+
+	// DeviceFilter selects devices to watch (see SyncManager.SelectDevices)
+	DeviceFilter []string
+
+	// Events subscribes to each device's event stream and checks a device
+	// immediately when it reports a config_changed event
+	Events bool
+
+	// AutoPull pulls and commits drifted devices instead of only reporting them
+	AutoPull bool
+
+	// Reconcile pushes the repository config back to drifted devices for
+	// these components, as types ("switch") or config files ("switch-0"),
+	// instead of only reporting them (see SyncManager.ReconcileDrift). It
+	// can't be combined with AutoPull.
+	Reconcile []string
+
+	// DriftPolicies sets what happens to drift per component type ("switch")
+	// or config file ("switch-0"): gitops.PolicyNotify (default) only
+	// reports it, gitops.PolicyAutoRevert pushes the repository config back
+	// like Reconcile, and gitops.PolicyAutoAccept pulls the device config
+	// and commits it (see SyncManager.AcceptDrift). Reconcile entries count
+	// as auto-revert. It can't be combined with AutoPull.
+	DriftPolicies gitops.DriftPolicies
+
+	// ValuesFile holds the values for templated fields pushed by Reconcile
+	// and auto-revert policies
+	ValuesFile string
+
+	// PullCommits is how pulled changes are committed: gitops.CommitSingle
+	// (default), gitops.CommitPerDevice or gitops.CommitPerArea
+	PullCommits string
+
+	// OnDrift is called for every device report that has drift or an error
+	OnDrift func(gitops.DriftReport)
+
+	// UptimeInterval polls every device's status at this interval to detect
+	// unexpected reboots, boot loops and power readings outside their
+	// expected range; zero disables status monitoring
+	UptimeInterval time.Duration
+
+	// BootLoopReboots reboots within BootLoopWindow flag a device as
+	// boot-looping (defaults: 3 within 30 minutes)
+	BootLoopReboots int
+	BootLoopWindow  time.Duration
+
+	// OnReboot is called for every detected reboot, except those the
+	// daemon caused itself, e.g. a push's reboot-if-needed or a firmware
+	// update job
+	OnReboot func(RebootEvent)
+
+	// PowerAlertPolls is how many consecutive uptime polls an output must
+	// draw power outside its device.yaml power_ranges before an alert
+	// (default 2, so start-up peaks don't alert)
+	PowerAlertPolls int
+
+	// OnPowerAlert is called when an output leaves or returns to its range
+	OnPowerAlert func(PowerAlert)
+
+	// PowerNotify lists webhook URLs receiving every PowerAlert as JSON
+	PowerNotify []string
+
+	// BackupRemote is a secondary Git remote pushed to after every commit;
+	// a failed push is retried after the next check
+	BackupRemote string
+
+	// Jobs are run on their own schedules alongside the interval checks,
+	// e.g. a nightly pull or a weekly firmware report (see LoadJobs)
+	Jobs []Job
+
+	// OnJob is called with the result of every job run
+	OnJob func(JobResult)
+
+	// DebugAddr serves pprof profiles, runtime metrics and stage timings on
+	// this address, e.g. "127.0.0.1:6060"; empty disables them
+	DebugAddr string
+
+	// MetricsAddr serves Prometheus metrics on /metrics at this address, e.g.
+	// ":9464": check and pull durations, per-device results, drift count,
+	// last sync time and device reachability; empty disables them
+	MetricsAddr string
+}
+
+// Daemon periodically checks devices for drift
+type Daemon struct {
+	sm   *gitops.SyncManager
+	opts Options
+
+	// targeted receives device IDs to check outside the regular interval
+	targeted chan string
+
+	// backupPending is set while commits haven't reached the backup remote
+	backupPending bool
+
+	// freeze is the name of the change freeze in effect at the last check
+	freeze string
+
+	// metrics are served on MetricsAddr
+	metrics *metrics
+
+	// policies are the drift policies, including Reconcile
+	policies gitops.DriftPolicies
+
+	// manifestMu serializes checks and jobs, which may change the manifest,
+	// with the uptime monitor's reads of it
+	manifestMu sync.Mutex
+}
+
+// New creates a new daemon
+func New(sm *gitops.SyncManager, opts Options) *Daemon {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.BootLoopReboots <= 0 {
+		opts.BootLoopReboots = defaultBootLoopReboots
+	}
+	if opts.BootLoopWindow <= 0 {
+		opts.BootLoopWindow = defaultBootLoopWindow
+	}
+	if opts.PowerAlertPolls <= 0 {
+		opts.PowerAlertPolls = defaultPowerAlertPolls
+	}
+
+	return &Daemon{
+		sm:       sm,
+		opts:     opts,
+		targeted: make(chan string, 64),
+		metrics:  newMetrics(),
+
+		// Bring the backup remote up to date on the first check
+		backupPending: opts.BackupRemote != "",
+	}
+}
+
+// Run checks all devices every interval and, if enabled, individual devices as
+// soon as they report a configuration change. It blocks until ctx is cancelled.
+// Scheduled jobs run in the same loop, so checks, jobs, pulls and commits
+// never overlap.
+func (d *Daemon) Run(ctx context.Context) error {
+	if !gitops.ValidCommitMode(d.opts.PullCommits) {
+		return fmt.Errorf("unknown pull commit mode %q", d.opts.PullCommits)
+	}
+	if d.opts.AutoPull && len(d.opts.Reconcile) > 0 {
+		return fmt.Errorf("AutoPull and Reconcile can't both be enabled")
+	}
+	if d.opts.AutoPull && len(d.opts.DriftPolicies) > 0 {
+		return fmt.Errorf("AutoPull and DriftPolicies can't both be enabled")
+	}
+	if err := d.opts.DriftPolicies.Validate(); err != nil {
+		return err
+	}
+	policies, err := driftPolicies(d.opts.DriftPolicies, d.opts.Reconcile)
+	if err != nil {
+		return err
+	}
+	d.policies = policies
+
+	scheduled, err := d.scheduleJobs(time.Now())
+	if err != nil {
+		return err
+	}
+
+	if d.opts.Events {
+		for _, device := range d.sm.SelectDevices(d.opts.DeviceFilter) {
+			go d.watch(ctx, device)
+		}
+	}
+	if d.opts.UptimeInterval > 0 {
+		go d.monitorUptime(ctx)
+	}
+	if d.opts.DebugAddr != "" {
+		go func() {
+			if err := profiling.Serve(ctx, d.opts.DebugAddr, d.sm); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Debug endpoints stopped: %v\n", err)
+			}
+		}()
+	}
+
+	if d.opts.MetricsAddr != "" {
+		go func() {
+			if err := d.serveMetrics(ctx, d.opts.MetricsAddr); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Metrics endpoint stopped: %v\n", err)
+			}
+		}()
+	}
+
+	d.check(ctx, d.opts.DeviceFilter)
+
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		// A nil channel never fires when there are no jobs
+		var jobTimer <-chan time.Time
+		timer := nextJobTimer(scheduled)
+		if timer != nil {
+			jobTimer = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			stopTimer(timer)
+			return nil
+		case <-ticker.C:
+			d.check(ctx, d.opts.DeviceFilter)
+		case deviceID := <-d.targeted:
+			d.check(ctx, []string{deviceID})
+		case <-jobTimer:
+			d.runDueJobs(ctx, scheduled)
+		}
+		stopTimer(timer)
+	}
+}
+
+// watch keeps an event subscription open for a device, reconnecting with backoff
+func (d *Daemon) watch(ctx context.Context, device storage.Device) {
+	delay := minReconnectDelay
+
+	for {
+		connected := time.Now()
+		err := d.sm.WatchConfigChanges(ctx, device, func() {
+			select {
+			case d.targeted <- device.DeviceID:
+			default:
+				// A check is already queued; the next full check will pick it up
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Reset the backoff after a connection that stayed up for a while
+		if time.Since(connected) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+		fmt.Fprintf(os.Stderr, "Warning: Event stream for %s lost: %v (retrying in %s)\n", device.Name, err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// check runs a drift check on the selected devices and pulls drifted ones if
+// enabled. The check is skipped while another process holds the repository lock.
+func (d *Daemon) check(ctx context.Context, deviceFilter []string) {
+	d.manifestMu.Lock()
+	defer d.manifestMu.Unlock()
+
+	release, err := d.sm.LockRepo("daemon")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Skipping drift check: %v\n", err)
+		return
+	}
+	defer release()
+	defer d.backup()
+	d.noteFreeze(time.Now())
+
+	started := time.Now()
+	reports, err := d.sm.CheckDrift(ctx, deviceFilter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Drift check failed: %v\n", err)
+		return
+	}
+	d.metrics.observeSync(operationCheck, time.Since(started), time.Now())
+
+	var drifted []string
+	for _, report := range reports {
+		d.metrics.observeDevice(report.DeviceID, operationCheck, report.Error)
+		d.metrics.setReachable(report.DeviceID, report.Error == nil)
+		if report.Error == nil {
+			d.metrics.setDrifted(report.DeviceID, report.Drifted())
+		}
+		if !report.Drifted() && report.Error == nil {
+			continue
+		}
+		if d.opts.OnDrift != nil {
+			d.opts.OnDrift(report)
+		}
+		if report.Drifted() {
+			drifted = append(drifted, report.DeviceID)
+		}
+	}
+
+	if len(d.policies) > 0 && len(drifted) > 0 {
+		resolved := make(map[string]int)
+		if revert, allowed := d.policies.Select(reports, gitops.PolicyAutoRevert); len(revert) > 0 {
+			d.reconcile(ctx, revert, allowed, resolved)
+		}
+		if accept, allowed := d.policies.Select(reports, gitops.PolicyAutoAccept); len(accept) > 0 {
+			d.accept(ctx, accept, allowed, resolved)
+		}
+		for _, report := range reports {
+			if report.Drifted() && resolved[report.DeviceID] == len(report.Components) {
+				d.metrics.setDrifted(report.DeviceID, false)
+			}
+		}
+		return
+	}
+	if !d.opts.AutoPull || len(drifted) == 0 {
+		return
+	}
+
+	started = time.Now()
+	results, err := d.sm.PullDevices(ctx, drifted)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Pull failed: %v\n", err)
+		return
+	}
+	d.metrics.observeSync(operationPull, time.Since(started), time.Now())
+	for _, result := range results {
+		d.metrics.observeDevice(result.DeviceID, operationPull, result.Error)
+		if result.Error != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to pull %s: %v\n", result.DeviceID, result.Error)
+		}
+	}
+
+	hashes, err := d.sm.CommitPulled(d.opts.PullCommits, fmt.Sprintf("Pull drifted devices: %v", drifted))
+	if len(hashes) > 0 {
+		fmt.Fprintf(os.Stderr, "Info: Committed drift from %d device(s) in %d commit(s), last %s\n", len(drifted), len(hashes), hashes[len(hashes)-1][:8])
+		d.backupPending = true
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to commit pulled changes: %v\n", err)
+	}
+}
+
+// driftPolicies adds the Reconcile allow-list to the drift policies as
+// auto-revert entries
+func driftPolicies(policies gitops.DriftPolicies, reconcile []string) (gitops.DriftPolicies, error) {
+	merged := make(gitops.DriftPolicies, len(policies)+len(reconcile))
+	for component, policy := range policies {
+		merged[component] = policy
+	}
+	for _, component := range reconcile {
+		if policy, ok := merged[component]; ok && policy != gitops.PolicyAutoRevert {
+			return nil, fmt.Errorf("%s is in Reconcile but has drift policy %s", component, policy)
+		}
+		merged[component] = gitops.PolicyAutoRevert
+	}
+	return merged, nil
+}
+
+// reconcile pushes the repository config back to the allowed components of
+// drifted devices, counting the components fixed per device in resolved
+func (d *Daemon) reconcile(ctx context.Context, reports []gitops.DriftReport, allowed []string, resolved map[string]int) {
+	started := time.Now()
+	results, err := d.sm.ReconcileDrift(ctx, reports, gitops.ReconcileOptions{
+		Components: allowed,
+		ValuesFile: d.opts.ValuesFile,
+	})
+	var freeze *gitops.FreezeError
+	if errors.As(err, &freeze) {
+		// noteFreeze has already announced the freeze
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Remediation failed: %v\n", err)
+		return
+	}
+	d.metrics.observeSync(operationReconcile, time.Since(started), time.Now())
+
+	for _, result := range results {
+		if len(result.Remediated) == 0 {
+			continue
+		}
+		d.metrics.observeDevice(result.DeviceID, operationReconcile, result.Error)
+		if result.Error != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to remediate %s: %v\n", result.DeviceName, result.Error)
+			continue
+		}
+		resolved[result.DeviceID] += len(result.Remediated)
+		fmt.Fprintf(os.Stderr, "Info: Remediated drift on %s: %s\n", result.DeviceName, strings.Join(result.Remediated, ", "))
+	}
+}
+
+// accept pulls and commits the device config of the allowed components of
+// drifted devices, counting the components accepted per device in resolved
+func (d *Daemon) accept(ctx context.Context, reports []gitops.DriftReport, allowed []string, resolved map[string]int) {
+	started := time.Now()
+	results, hash, err := d.sm.AcceptDrift(ctx, reports, allowed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Accepting drift failed: %v\n", err)
+		return
+	}
+	d.metrics.observeSync(operationAccept, time.Since(started), time.Now())
+
+	for _, result := range results {
+		if len(result.Accepted) == 0 && result.Error == nil {
+			continue
+		}
+		d.metrics.observeDevice(result.DeviceID, operationAccept, result.Error)
+		if result.Error != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to accept drift on %s: %v\n", result.DeviceName, result.Error)
+			continue
+		}
+		resolved[result.DeviceID] += len(result.Accepted)
+		fmt.Fprintf(os.Stderr, "Info: Accepted drift on %s: %s\n", result.DeviceName, strings.Join(result.Accepted, ", "))
+	}
+	if hash != "" {
+		fmt.Fprintf(os.Stderr, "Info: Committed accepted drift in %s\n", hash[:8])
+		d.backupPending = true
+	}
+}
+
+// backup pushes to the backup remote if there are commits it hasn't received
+func (d *Daemon) backup() {
+	if d.opts.BackupRemote == "" || !d.backupPending {
+		return
+	}
+	if err := d.sm.PushBackup(d.opts.BackupRemote); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Backup push failed, retrying after the next check: %v\n", err)
+		return
+	}
+	d.backupPending = false
+}
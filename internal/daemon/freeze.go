@@ -0,0 +1,27 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// noteFreeze logs when a change freeze window starts or ends. The daemon never
+// overrides a freeze, so nothing is applied to devices while one is in effect;
+// pulls and drift checks go on.
+func (d *Daemon) noteFreeze(now time.Time) {
+	window, err := d.sm.ActiveFreeze(now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to read change freeze windows: %v\n", err)
+		return
+	}
+
+	switch {
+	case window != nil && window.Name != d.freeze:
+		fmt.Fprintf(os.Stderr, "Info: Change freeze %q in effect until %s, nothing is applied to devices\n", window.Name, window.End.Local().Format("2006-01-02 15:04"))
+		d.freeze = window.Name
+	case window == nil && d.freeze != "":
+		fmt.Fprintf(os.Stderr, "Info: Change freeze %q ended\n", d.freeze)
+		d.freeze = ""
+	}
+}
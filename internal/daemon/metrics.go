@@ -0,0 +1,218 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sync operations reported in metrics
+const (
+	operationCheck     = "check"
+	operationPull      = "pull"
+	operationReconcile = "reconcile"
+	operationAccept    = "accept"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the sync duration
+// histogram
+var durationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600}
+
+// histogram is a cumulative Prometheus histogram
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// deviceResult labels the per-device sync counter
+type deviceResult struct {
+	device    string
+	operation string
+	result    string
+}
+
+// metrics collects the daemon's Prometheus metrics
+type metrics struct {
+	mu sync.Mutex
+
+	durations map[string]*histogram   // by operation
+	lastSync  map[string]time.Time    // by operation
+	results   map[deviceResult]uint64 // per device, operation and result
+	reachable map[string]bool         // by device ID
+	drifted   map[string]bool         // by device ID
+}
+
+// newMetrics creates an empty metrics collection
+func newMetrics() *metrics {
+	return &metrics{
+		durations: make(map[string]*histogram),
+		lastSync:  make(map[string]time.Time),
+		results:   make(map[deviceResult]uint64),
+		reachable: make(map[string]bool),
+		drifted:   make(map[string]bool),
+	}
+}
+
+// observeSync records a finished check or pull run
+func (m *metrics) observeSync(operation string, duration time.Duration, finished time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.durations[operation]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.durations[operation] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+	m.lastSync[operation] = finished
+}
+
+// observeDevice records the outcome of a check or pull of one device
+func (m *metrics) observeDevice(deviceID, operation string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results[deviceResult{device: deviceID, operation: operation, result: result}]++
+}
+
+// setReachable records whether a device answered its last call
+func (m *metrics) setReachable(deviceID string, reachable bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reachable[deviceID] = reachable
+}
+
+// setDrifted records whether a device differed from the repository at its
+// last check
+func (m *metrics) setDrifted(deviceID string, drifted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.drifted[deviceID] = drifted
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(m.String()))
+}
+
+// String renders the metrics in the Prometheus text exposition format
+func (m *metrics) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	b.WriteString("# HELP shelly_gitops_sync_duration_seconds Duration of drift checks and pulls.\n")
+	b.WriteString("# TYPE shelly_gitops_sync_duration_seconds histogram\n")
+	for _, operation := range sortedKeys(m.durations) {
+		h := m.durations[operation]
+		var cumulative uint64
+		for i, bound := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "shelly_gitops_sync_duration_seconds_bucket{operation=%q,le=\"%g\"} %d\n", operation, bound, cumulative)
+		}
+		fmt.Fprintf(&b, "shelly_gitops_sync_duration_seconds_bucket{operation=%q,le=\"+Inf\"} %d\n", operation, h.count)
+		fmt.Fprintf(&b, "shelly_gitops_sync_duration_seconds_sum{operation=%q} %g\n", operation, h.sum)
+		fmt.Fprintf(&b, "shelly_gitops_sync_duration_seconds_count{operation=%q} %d\n", operation, h.count)
+	}
+
+	b.WriteString("# HELP shelly_gitops_last_sync_timestamp_seconds Unix time the last drift check or pull finished.\n")
+	b.WriteString("# TYPE shelly_gitops_last_sync_timestamp_seconds gauge\n")
+	for _, operation := range sortedKeys(m.lastSync) {
+		fmt.Fprintf(&b, "shelly_gitops_last_sync_timestamp_seconds{operation=%q} %d\n", operation, m.lastSync[operation].Unix())
+	}
+
+	b.WriteString("# HELP shelly_gitops_device_syncs_total Drift checks and pulls per device by result.\n")
+	b.WriteString("# TYPE shelly_gitops_device_syncs_total counter\n")
+	keys := make([]deviceResult, 0, len(m.results))
+	for key := range m.results {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].device != keys[j].device {
+			return keys[i].device < keys[j].device
+		}
+		if keys[i].operation != keys[j].operation {
+			return keys[i].operation < keys[j].operation
+		}
+		return keys[i].result < keys[j].result
+	})
+	for _, key := range keys {
+		fmt.Fprintf(&b, "shelly_gitops_device_syncs_total{device=%q,operation=%q,result=%q} %d\n", key.device, key.operation, key.result, m.results[key])
+	}
+
+	drifted := 0
+	for _, isDrifted := range m.drifted {
+		if isDrifted {
+			drifted++
+		}
+	}
+	b.WriteString("# HELP shelly_gitops_drifted_devices Devices that differed from the repository at their last check.\n")
+	b.WriteString("# TYPE shelly_gitops_drifted_devices gauge\n")
+	fmt.Fprintf(&b, "shelly_gitops_drifted_devices %d\n", drifted)
+
+	b.WriteString("# HELP shelly_gitops_device_reachable Whether the device answered its last check or status poll.\n")
+	b.WriteString("# TYPE shelly_gitops_device_reachable gauge\n")
+	for _, device := range sortedKeys(m.reachable) {
+		value := 0
+		if m.reachable[device] {
+			value = 1
+		}
+		fmt.Fprintf(&b, "shelly_gitops_device_reachable{device=%q} %d\n", device, value)
+	}
+
+	return b.String()
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serveMetrics serves /metrics on addr until ctx is cancelled
+func (d *Daemon) serveMetrics(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", d.metrics)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
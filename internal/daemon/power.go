@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+const defaultPowerAlertPolls = 2
+
+// PowerAlert reports an output whose power left its expected range, or
+// returned to it
+type PowerAlert struct {
+	DeviceID   string    `json:"device_id"`
+	DeviceName string    `json:"device_name"`
+	Component  string    `json:"component"`
+	Power      float64   `json:"power"`
+	Min        float64   `json:"min"`
+	Max        float64   `json:"max,omitempty"`
+	Recovered  bool      `json:"recovered"`
+	At         time.Time `json:"at"`
+
+	// Text summarizes the alert for chat webhooks
+	Text string `json:"text"`
+}
+
+// powerState counts the consecutive out-of-range polls of one output
+type powerState struct {
+	outOfRange int
+	alerted    bool
+}
+
+// pollPower compares the device's metered outputs with their power_ranges
+// and alerts once an output stayed out of range for PowerAlertPolls polls,
+// and again when it is back in range. Unreachable devices are skipped.
+func (d *Daemon) pollPower(ctx context.Context, device storage.Device, states map[string]*powerState) {
+	readings, err := d.sm.CheckPower(ctx, device)
+	if err != nil {
+		return
+	}
+
+	for _, reading := range readings {
+		key := device.DeviceID + "/" + reading.Component
+		state, ok := states[key]
+		if !ok {
+			state = &powerState{}
+			states[key] = state
+		}
+
+		if reading.InRange() {
+			state.outOfRange = 0
+			if !state.alerted {
+				continue
+			}
+			state.alerted = false
+		} else {
+			state.outOfRange++
+			if state.alerted || state.outOfRange < d.opts.PowerAlertPolls {
+				continue
+			}
+			state.alerted = true
+		}
+
+		alert := PowerAlert{
+			DeviceID:   device.DeviceID,
+			DeviceName: device.Name,
+			Component:  reading.Component,
+			Power:      reading.Power,
+			Min:        reading.Range.Min,
+			Max:        reading.Range.Max,
+			Recovered:  !state.alerted,
+			At:         time.Now(),
+		}
+		d.powerAlert(ctx, alert)
+	}
+}
+
+// powerAlert logs an alert and passes it to OnPowerAlert and the PowerNotify targets
+func (d *Daemon) powerAlert(ctx context.Context, alert PowerAlert) {
+	expected := fmt.Sprintf("%gW-%gW", alert.Min, alert.Max)
+	if alert.Max == 0 {
+		expected = fmt.Sprintf("at least %gW", alert.Min)
+	}
+	if alert.Recovered {
+		alert.Text = fmt.Sprintf("%s %s is back in range: %.1fW (expected %s)", alert.DeviceName, alert.Component, alert.Power, expected)
+		fmt.Fprintf(os.Stderr, "Info: %s\n", alert.Text)
+	} else {
+		alert.Text = fmt.Sprintf("%s %s draws %.1fW, expected %s", alert.DeviceName, alert.Component, alert.Power, expected)
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", alert.Text)
+	}
+
+	if d.opts.OnPowerAlert != nil {
+		d.opts.OnPowerAlert(alert)
+	}
+	for _, target := range d.opts.PowerNotify {
+		if err := notify(ctx, target, alert); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to notify %s about %s: %v\n", target, alert.DeviceName, err)
+		}
+	}
+}
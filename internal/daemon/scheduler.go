@@ -0,0 +1,385 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/gitops"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// Job types
+const (
+	// JobPull pulls the selected devices and commits their configuration
+	JobPull = "pull"
+
+	// JobDrift reports devices that differ from the repository
+	JobDrift = "drift"
+
+	// JobFirmwareReport lists the firmware versions running per model
+	JobFirmwareReport = "firmware-report"
+)
+
+// When to notify a job's targets
+const (
+	NotifyAlways   = "always"
+	NotifyProblems = "problems"
+)
+
+const notifyTimeout = 10 * time.Second
+
+// JobsConfig lists the scheduled jobs of a daemon
+type JobsConfig struct {
+	Jobs []Job `yaml:"jobs" json:"jobs" toml:"jobs"`
+}
+
+// Job is a scheduled daemon task
+type Job struct {
+	Name string `yaml:"name" json:"name" toml:"name"`
+
+	// Schedule is a cron expression in local time, see ParseCron
+	Schedule string `yaml:"schedule" json:"schedule" toml:"schedule"`
+
+	Type string `yaml:"type" json:"type" toml:"type"`
+
+	// Devices selects the devices the job runs on (see SyncManager.SelectDevices)
+	Devices []string `yaml:"devices,omitempty" json:"devices,omitempty" toml:"devices,omitempty"`
+
+	// Notify lists webhook URLs receiving the job summary as a JSON POST with
+	// a "text" field, as accepted by Slack and Mattermost incoming webhooks
+	Notify []string `yaml:"notify,omitempty" json:"notify,omitempty" toml:"notify,omitempty"`
+
+	// NotifyOn is "always" (default) or "problems" to only notify about
+	// drift, errors and failed pulls
+	NotifyOn string `yaml:"notify_on,omitempty" json:"notify_on,omitempty" toml:"notify_on,omitempty"`
+
+	// Commit is how a pull job commits: "single" (default), "per-device" or
+	// "per-area", see gitops.CommitPulled
+	Commit string `yaml:"commit,omitempty" json:"commit,omitempty" toml:"commit,omitempty"`
+
+	schedule *CronSchedule
+}
+
+// JobResult is the outcome of one job run
+type JobResult struct {
+	Job      string    `json:"job"`
+	Type     string    `json:"type"`
+	Started  time.Time `json:"started"`
+	Text     string    `json:"text"`
+	Problems bool      `json:"problems"`
+}
+
+// GetDefaultJobsPath returns the default scheduled jobs config path
+func GetDefaultJobsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".shelly-gitops", "jobs.yaml"), nil
+}
+
+// LoadJobs loads scheduled jobs from a YAML, JSON or TOML file and validates
+// their schedules
+func LoadJobs(path string) ([]Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jobs config: %w", err)
+	}
+
+	var cfg JobsConfig
+	if err := storage.Unmarshal(storage.FormatFromPath(path), data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal jobs config: %w", err)
+	}
+
+	seen := make(map[string]bool, len(cfg.Jobs))
+	for i := range cfg.Jobs {
+		job := &cfg.Jobs[i]
+		if job.Name == "" {
+			job.Name = fmt.Sprintf("%s-%d", job.Type, i+1)
+		}
+		if seen[job.Name] {
+			return nil, fmt.Errorf("duplicate job name %q", job.Name)
+		}
+		seen[job.Name] = true
+
+		if err := job.validate(); err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.Name, err)
+		}
+	}
+
+	return cfg.Jobs, nil
+}
+
+// validate checks the job's type and notify setting and parses its schedule
+func (j *Job) validate() error {
+	switch j.Type {
+	case JobPull, JobDrift, JobFirmwareReport:
+	default:
+		return fmt.Errorf("unknown job type %q", j.Type)
+	}
+	switch j.NotifyOn {
+	case "":
+		j.NotifyOn = NotifyAlways
+	case NotifyAlways, NotifyProblems:
+	default:
+		return fmt.Errorf("unknown notify_on %q", j.NotifyOn)
+	}
+
+	if !gitops.ValidCommitMode(j.Commit) {
+		return fmt.Errorf("unknown commit mode %q", j.Commit)
+	}
+
+	schedule, err := ParseCron(j.Schedule)
+	if err != nil {
+		return err
+	}
+	j.schedule = schedule
+	return nil
+}
+
+// scheduledJob is a job with its next run time
+type scheduledJob struct {
+	job  Job
+	next time.Time
+}
+
+// scheduleJobs validates the configured jobs and computes their first run
+func (d *Daemon) scheduleJobs(now time.Time) ([]*scheduledJob, error) {
+	scheduled := make([]*scheduledJob, 0, len(d.opts.Jobs))
+	for _, job := range d.opts.Jobs {
+		if job.schedule == nil {
+			if err := job.validate(); err != nil {
+				return nil, fmt.Errorf("job %s: %w", job.Name, err)
+			}
+		}
+		scheduled = append(scheduled, &scheduledJob{job: job, next: job.schedule.Next(now)})
+	}
+	return scheduled, nil
+}
+
+// nextJobTimer returns a timer for the earliest scheduled job, or nil if
+// there are no jobs
+func nextJobTimer(scheduled []*scheduledJob) *time.Timer {
+	var earliest time.Time
+	for _, s := range scheduled {
+		if earliest.IsZero() || s.next.Before(earliest) {
+			earliest = s.next
+		}
+	}
+	if earliest.IsZero() {
+		return nil
+	}
+	return time.NewTimer(time.Until(earliest))
+}
+
+// stopTimer stops a timer returned by nextJobTimer
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+// runDueJobs runs every job whose time has come and schedules its next run.
+// Runs missed while another job or check was busy are coalesced into one.
+func (d *Daemon) runDueJobs(ctx context.Context, scheduled []*scheduledJob) {
+	now := time.Now()
+	for _, s := range scheduled {
+		if s.next.After(now) {
+			continue
+		}
+		d.runJob(ctx, s.job)
+		s.next = s.job.schedule.Next(time.Now())
+	}
+}
+
+// runJob runs a job under the repository lock and notifies its targets
+func (d *Daemon) runJob(ctx context.Context, job Job) {
+	d.manifestMu.Lock()
+	defer d.manifestMu.Unlock()
+
+	release, err := d.sm.LockRepo("job " + job.Name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Skipping job %s: %v\n", job.Name, err)
+		return
+	}
+	defer release()
+	defer d.backup()
+
+	result := JobResult{Job: job.Name, Type: job.Type, Started: time.Now()}
+	var summary string
+	switch job.Type {
+	case JobPull:
+		summary, result.Problems = d.pullJob(ctx, job)
+	case JobDrift:
+		summary, result.Problems = d.driftJob(ctx, job)
+	case JobFirmwareReport:
+		summary, result.Problems = d.firmwareReportJob(ctx, job)
+	}
+	result.Text = fmt.Sprintf("Job %s: %s", job.Name, summary)
+
+	fmt.Fprintf(os.Stderr, "Info: %s\n", result.Text)
+	if d.opts.OnJob != nil {
+		d.opts.OnJob(result)
+	}
+	if job.NotifyOn == NotifyProblems && !result.Problems {
+		return
+	}
+	for _, target := range job.Notify {
+		if err := notify(ctx, target, result); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to notify %s about job %s: %v\n", target, job.Name, err)
+		}
+	}
+}
+
+// pullJob pulls the job's devices and commits the changes
+func (d *Daemon) pullJob(ctx context.Context, job Job) (string, bool) {
+	results, err := d.sm.PullDevices(ctx, job.Devices)
+	if err != nil {
+		return fmt.Sprintf("Pull failed: %v", err), true
+	}
+
+	var lines []string
+	pulled := 0
+	for _, result := range results {
+		if result.Error != nil {
+			lines = append(lines, fmt.Sprintf("- %s: %v", result.DeviceID, result.Error))
+			continue
+		}
+		pulled++
+	}
+	problems := len(lines) > 0
+
+	hashes, err := d.sm.CommitPulled(job.Commit, fmt.Sprintf("Scheduled pull (%s)", job.Name))
+	switch {
+	case len(hashes) == 1:
+		lines = append(lines, fmt.Sprintf("Committed changes as %s", hashes[0][:8]))
+	case len(hashes) > 1:
+		lines = append(lines, fmt.Sprintf("Committed changes in %d commits, last %s", len(hashes), hashes[len(hashes)-1][:8]))
+	case err == nil:
+		lines = append(lines, "No configuration changes")
+	}
+	if len(hashes) > 0 {
+		d.backupPending = true
+	}
+	if err != nil {
+		lines = append(lines, fmt.Sprintf("Failed to commit pulled changes: %v", err))
+		problems = true
+	}
+
+	header := fmt.Sprintf("Pulled %d of %d device(s)", pulled, len(results))
+	return strings.Join(append([]string{header}, lines...), "\n"), problems
+}
+
+// driftJob checks the job's devices for drift
+func (d *Daemon) driftJob(ctx context.Context, job Job) (string, bool) {
+	reports, err := d.sm.CheckDrift(ctx, job.Devices)
+	if err != nil {
+		return fmt.Sprintf("Drift check failed: %v", err), true
+	}
+
+	var lines []string
+	for _, report := range reports {
+		switch {
+		case report.Error != nil:
+			lines = append(lines, fmt.Sprintf("- %s: %v", report.DeviceID, report.Error))
+		case report.Drifted():
+			components := make([]string, 0, len(report.Components))
+			for _, component := range report.Components {
+				components = append(components, component.Component)
+			}
+			lines = append(lines, fmt.Sprintf("- %s: %s", report.DeviceID, strings.Join(components, ", ")))
+		default:
+			continue
+		}
+		if d.opts.OnDrift != nil {
+			d.opts.OnDrift(report)
+		}
+	}
+
+	if len(lines) == 0 {
+		return fmt.Sprintf("No drift on %d device(s)", len(reports)), false
+	}
+	header := fmt.Sprintf("%d of %d device(s) drifted or failed", len(lines), len(reports))
+	return strings.Join(append([]string{header}, lines...), "\n"), true
+}
+
+// firmwareReportJob lists the firmware versions of the job's devices per model
+func (d *Daemon) firmwareReportJob(ctx context.Context, job Job) (string, bool) {
+	versions := make(map[string]map[string][]string)
+	var unreachable []string
+
+	for _, entry := range d.sm.Inventory(ctx, job.Devices) {
+		if entry.Info == nil {
+			unreachable = append(unreachable, entry.Device.Name)
+			continue
+		}
+		if versions[entry.Info.Model] == nil {
+			versions[entry.Info.Model] = make(map[string][]string)
+		}
+		versions[entry.Info.Model][entry.Info.FW] = append(versions[entry.Info.Model][entry.Info.FW], entry.Device.Name)
+	}
+
+	models := make([]string, 0, len(versions))
+	for model := range versions {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	lines := []string{"Firmware by model:"}
+	for _, model := range models {
+		firmware := make([]string, 0, len(versions[model]))
+		for fw := range versions[model] {
+			firmware = append(firmware, fw)
+		}
+		sort.Strings(firmware)
+
+		for _, fw := range firmware {
+			lines = append(lines, fmt.Sprintf("- %s %s: %d device(s)", model, fw, len(versions[model][fw])))
+		}
+		if len(firmware) > 1 {
+			lines = append(lines, fmt.Sprintf("  %s runs %d different firmware versions", model, len(firmware)))
+		}
+	}
+	if len(unreachable) > 0 {
+		sort.Strings(unreachable)
+		lines = append(lines, fmt.Sprintf("Unreachable: %s", strings.Join(unreachable, ", ")))
+	}
+
+	return strings.Join(lines, "\n"), len(unreachable) > 0
+}
+
+// notify posts a job result to a webhook URL
+func notify(ctx context.Context, target string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
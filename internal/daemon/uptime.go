@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+const (
+	defaultBootLoopReboots = 3
+	defaultBootLoopWindow  = 30 * time.Minute
+)
+
+// RebootEvent reports a device whose uptime went backwards between two polls
+type RebootEvent struct {
+	DeviceID       string
+	DeviceName     string
+	BootedAt       time.Time     // approximate, derived from the new uptime
+	PreviousUptime time.Duration // uptime at the previous poll
+	Uptime         time.Duration
+
+	// RecentReboots counts reboots within the boot loop window, including this one
+	RecentReboots int
+	BootLoop      bool
+}
+
+// uptimeState is what the uptime monitor remembers about a device
+type uptimeState struct {
+	uptime  time.Duration
+	reboots []time.Time
+}
+
+// monitorUptime polls every selected device's uptime each UptimeInterval and
+// reports reboots, and power readings outside their expected range, until
+// ctx is cancelled. It only reads device status, so it runs independently of
+// drift checks; only the device list is read between them, as a check or job
+// may change the manifest.
+func (d *Daemon) monitorUptime(ctx context.Context) {
+	states := make(map[string]*uptimeState)
+	powerStates := make(map[string]*powerState)
+
+	ticker := time.NewTicker(d.opts.UptimeInterval)
+	defer ticker.Stop()
+
+	for {
+		d.manifestMu.Lock()
+		devices := append([]storage.Device(nil), d.sm.SelectDevices(d.opts.DeviceFilter)...)
+		d.manifestMu.Unlock()
+
+		for _, device := range devices {
+			if ctx.Err() != nil {
+				return
+			}
+			d.pollUptime(ctx, device, states)
+			d.pollPower(ctx, device, powerStates)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollUptime reads one device's uptime and reports a reboot if it went backwards.
+// Unreachable devices are skipped; drift checks already report them, and so
+// are reboots the daemon caused itself (reboot-if-needed, firmware updates).
+func (d *Daemon) pollUptime(ctx context.Context, device storage.Device, states map[string]*uptimeState) {
+	uptime, err := d.sm.DeviceUptime(ctx, device)
+	d.metrics.setReachable(device.DeviceID, err == nil)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+
+	state, known := states[device.DeviceID]
+	if !known {
+		states[device.DeviceID] = &uptimeState{uptime: uptime}
+		return
+	}
+
+	previous := state.uptime
+	state.uptime = uptime
+	if uptime >= previous {
+		return
+	}
+	bootedAt := now.Add(-uptime)
+	if d.sm.InitiatedReboot(device.DeviceID, bootedAt) {
+		return
+	}
+
+	// Forget reboots that fell out of the boot loop window
+	recent := state.reboots[:0]
+	for _, at := range state.reboots {
+		if now.Sub(at) <= d.opts.BootLoopWindow {
+			recent = append(recent, at)
+		}
+	}
+	state.reboots = append(recent, now)
+
+	event := RebootEvent{
+		DeviceID:       device.DeviceID,
+		DeviceName:     device.Name,
+		BootedAt:       bootedAt,
+		PreviousUptime: previous,
+		Uptime:         uptime,
+		RecentReboots:  len(state.reboots),
+		BootLoop:       len(state.reboots) >= d.opts.BootLoopReboots,
+	}
+
+	if event.BootLoop {
+		fmt.Fprintf(os.Stderr, "Warning: %s is boot-looping: %d reboots in the last %s (check its scripts and power supply)\n",
+			device.Name, event.RecentReboots, d.opts.BootLoopWindow)
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: %s rebooted unexpectedly around %s (uptime was %s)\n",
+			device.Name, event.BootedAt.Format(time.RFC3339), previous.Round(time.Second))
+	}
+	if d.opts.OnReboot != nil {
+		d.opts.OnReboot(event)
+	}
+}
@@ -0,0 +1,159 @@
+package dashboard
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/gitops"
+)
+
+//go:embed assets
+var assets embed.FS
+
+// Handler serves the read-only fleet dashboard and its JSON API
+type Handler struct {
+	syncManager *gitops.SyncManager
+	mux         *http.ServeMux
+}
+
+// NewHandler creates a dashboard handler for the given repository
+// It can be mounted by the daemon or served standalone with Serve
+func NewHandler(sm *gitops.SyncManager) *Handler {
+	h := &Handler{
+		syncManager: sm,
+		mux:         http.NewServeMux(),
+	}
+
+	static, _ := fs.Sub(assets, "assets")
+	h.mux.Handle("/", http.FileServer(http.FS(static)))
+	h.mux.HandleFunc("/api/status", h.handleStatus)
+	h.mux.HandleFunc("/api/devices/", h.handleDeviceHistory)
+	h.mux.HandleFunc("/calendar/", h.handleCalendar)
+
+	return h
+}
+
+// ServeHTTP implements http.Handler; only GET and HEAD requests are accepted
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "dashboard is read-only", http.StatusMethodNotAllowed)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// handleStatus returns the fleet status as JSON
+func (h *Handler) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.syncManager.FleetStatus()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, status)
+}
+
+// handleDeviceHistory returns the change history of a device: /api/devices/<id>/history
+func (h *Handler) handleDeviceHistory(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/devices/")
+	deviceID, action, ok := strings.Cut(rest, "/")
+	if !ok || action != "history" || deviceID == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	history, err := h.syncManager.DeviceHistory(deviceID, 50)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, history)
+}
+
+// defaultCalendarDays is how far ahead calendar feeds reach unless ?days= is given
+const defaultCalendarDays = 30
+
+// handleCalendar serves schedule calendars: /calendar/ lists the feeds as JSON
+// and /calendar/<name>.ics returns one. ?group=device|area|fleet selects the
+// grouping (default device) and ?days= the window.
+func (h *Handler) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	group := r.URL.Query().Get("group")
+	days := defaultCalendarDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 366 {
+			http.Error(w, "days must be between 1 and 366", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	calendars, err := h.syncManager.ScheduleCalendars(time.Now(), time.Duration(days)*24*time.Hour, group)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileName := strings.TrimPrefix(r.URL.Path, "/calendar/")
+	if fileName == "" {
+		type feed struct {
+			Name   string `json:"name"`
+			URL    string `json:"url"`
+			Events int    `json:"events"`
+		}
+		feeds := make([]feed, 0, len(calendars))
+		for _, calendar := range calendars {
+			url := calendar.FileName
+			if r.URL.RawQuery != "" {
+				url += "?" + r.URL.RawQuery
+			}
+			feeds = append(feeds, feed{Name: calendar.Name, URL: url, Events: calendar.Events})
+		}
+		writeJSON(w, feeds)
+		return
+	}
+
+	for _, calendar := range calendars {
+		if calendar.FileName == fileName {
+			w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+			w.Write(calendar.Data)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// writeJSON writes v as an indented JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// Serve runs the dashboard on addr until ctx is cancelled
+func Serve(ctx context.Context, addr string, sm *gitops.SyncManager) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           NewHandler(sm),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package discovery
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// HostnameFilter matches hostnames against a list of patterns; a hostname
+// matches if any pattern matches. Matching is case-insensitive.
+type HostnameFilter struct {
+	globs   []string
+	regexps []*regexp.Regexp
+}
+
+// ParseHostnameFilter parses a comma-separated list of patterns, each either
+// a glob ("shelly*", "shelly?plus-*", "shelly[12]*") or a regular expression
+// between slashes ("/^shelly(plus|pro)/"). Regular expressions may contain
+// commas. An empty filter or "*" matches every hostname.
+func ParseHostnameFilter(filter string) (*HostnameFilter, error) {
+	f := &HostnameFilter{}
+	for _, pattern := range splitPatterns(filter) {
+		if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			re, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid hostname regex %s: %w", pattern, err)
+			}
+			f.regexps = append(f.regexps, re)
+			continue
+		}
+
+		glob := strings.ToLower(pattern)
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid hostname pattern %q: %w", pattern, err)
+		}
+		f.globs = append(f.globs, glob)
+	}
+	return f, nil
+}
+
+// Match reports whether hostname matches any of the filter's patterns
+func (f *HostnameFilter) Match(hostname string) bool {
+	if len(f.globs) == 0 && len(f.regexps) == 0 {
+		return true
+	}
+
+	lower := strings.ToLower(hostname)
+	for _, glob := range f.globs {
+		if ok, _ := path.Match(glob, lower); ok {
+			return true
+		}
+	}
+	for _, re := range f.regexps {
+		if re.MatchString(hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPatterns splits a filter at commas outside /regex/ patterns and drops
+// empty patterns
+func splitPatterns(filter string) []string {
+	var patterns []string
+	var current strings.Builder
+	inRegex := false
+
+	flush := func() {
+		if pattern := strings.TrimSpace(current.String()); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(filter); i++ {
+		c := filter[i]
+		switch {
+		case c == '\\' && inRegex && i+1 < len(filter):
+			current.WriteByte(c)
+			i++
+			current.WriteByte(filter[i])
+			continue
+		case c == '/' && strings.TrimSpace(current.String()) == "":
+			inRegex = true
+		case c == '/' && inRegex:
+			inRegex = false
+		case c == ',' && !inRegex:
+			flush()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	flush()
+
+	return patterns
+}
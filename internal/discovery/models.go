@@ -1,6 +1,10 @@
 package discovery
 
-import "time"
+import (
+	"strconv"
+	"strings"
+	"time"
+)
 
 // DeviceInfo represents discovered device information
 type DeviceInfo struct {
@@ -9,6 +13,8 @@ type DeviceInfo struct {
 	Hostname   string `json:"hostname,omitempty"`
 	DeviceType string `json:"device_type,omitempty"`
 	LastSeen   time.Time `json:"last_seen,omitempty"`
+	Network    string `json:"network,omitempty"` // Network name resolved by the provider (e.g. "IoT")
+	VLAN       int    `json:"vlan,omitempty"`    // VLAN ID of the network, 0 if untagged
 }
 
 // DHCPLease represents DHCP lease configuration
@@ -18,6 +24,24 @@ type DHCPLease struct {
 	Hostname   string `json:"hostname"`
 }
 
+// DNSRecord represents a local DNS A record
+type DNSRecord struct {
+	Name      string `json:"name"` // fully qualified host name, e.g. kitchen-light.lan
+	IPAddress string `json:"ip_address"`
+}
+
+// OnNetwork checks if the device is on the given network, matched by
+// network name (case-insensitive) or VLAN ID
+func (d *DeviceInfo) OnNetwork(network string) bool {
+	if network == "" {
+		return true
+	}
+	if strings.EqualFold(d.Network, network) {
+		return true
+	}
+	return d.VLAN != 0 && strconv.Itoa(d.VLAN) == network
+}
+
 // IsShelly checks if the device is a Shelly device based on hostname
 func (d *DeviceInfo) IsShelly() bool {
 	if len(d.Hostname) < 6 {
@@ -8,7 +8,9 @@ type Provider interface {
 	Authenticate(ctx context.Context, credentials map[string]string) error
 
 	// DiscoverDevices discovers devices on the network
-	// filterPattern can be used to filter devices (e.g., "shelly*")
+	// filterPattern can be used to filter devices by hostname: comma-separated
+	// globs and /regex/ patterns (e.g., "shelly*", "shellyplus*,/^shellypro[0-9]/"),
+	// see ParseHostnameFilter
 	DiscoverDevices(ctx context.Context, filterPattern string) ([]DeviceInfo, error)
 
 	// SetDHCPLease sets a static DHCP lease for a device
@@ -20,3 +22,9 @@ type Provider interface {
 	// Close closes any open connections
 	Close() error
 }
+
+// DNSProvider is implemented by providers that can manage local DNS records
+type DNSProvider interface {
+	// SetDNSRecord creates or updates an A record for the given host name
+	SetDNSRecord(ctx context.Context, record DNSRecord) error
+}
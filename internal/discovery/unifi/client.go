@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -18,12 +21,22 @@ type Client struct {
 	httpClient *http.Client
 	site       string
 	apiVersion string // "legacy" or "network-app"
+	csrfToken  string // sent on write calls; required by UniFi OS consoles (UDM, Cloud Key Gen2)
+
+	// tokenFunc supplies a bearer token for every request instead of a
+	// login session, see NewClientWithToken
+	tokenFunc func(ctx context.Context) (string, error)
 }
 
 // LoginRequest represents the login credentials
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+
+	// Token is the 2FA code for UniFi OS consoles; Ubic2FAToken is the same
+	// code for legacy controllers
+	Token        string `json:"token,omitempty"`
+	Ubic2FAToken string `json:"ubic_2fa_token,omitempty"`
 }
 
 // DeviceResponse represents the UniFi API device list response
@@ -47,8 +60,27 @@ type UniFiDevice struct {
 	NetworkID  string `json:"network_id"`
 }
 
-// NewClient creates a new UniFi API client
-func NewClient(baseURL, username, password string, verifySSL bool) (*Client, error) {
+// NetworkResponse represents the UniFi API network configuration response
+type NetworkResponse struct {
+	Meta struct {
+		RC string `json:"rc"`
+	} `json:"meta"`
+	Data []UniFiNetwork `json:"data"`
+}
+
+// UniFiNetwork represents a network (LAN/VLAN) configured on the controller
+type UniFiNetwork struct {
+	ID          string `json:"_id"`
+	Name        string `json:"name"`
+	Purpose     string `json:"purpose"`
+	VLAN        int    `json:"vlan"`
+	VLANEnabled bool   `json:"vlan_enabled"`
+}
+
+// NewClient creates a new UniFi API client. totp is only needed for accounts
+// with two-factor authentication: either a current 6-digit code or the
+// base32 TOTP secret, from which a code is generated for every login.
+func NewClient(baseURL, username, password, totp string, verifySSL bool) (*Client, error) {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cookie jar: %w", err)
@@ -72,20 +104,51 @@ func NewClient(baseURL, username, password string, verifySSL bool) (*Client, err
 	}
 
 	// Authenticate and detect API version
-	if err := client.login(context.Background(), username, password); err != nil {
+	if err := client.login(context.Background(), username, password, totp); err != nil {
 		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
 
 	return client, nil
 }
 
+// NewClientWithToken creates a UniFi API client that sends a bearer token
+// from tokenFunc on every request instead of logging in, for controllers
+// behind an OIDC-aware proxy. tokenFunc is called per request so short-lived
+// tokens can be renewed during a run; nothing is stored.
+func NewClientWithToken(baseURL string, tokenFunc func(ctx context.Context) (string, error), verifySSL bool) (*Client, error) {
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: !verifySSL,
+			},
+		},
+	}
+
+	return &Client{
+		baseURL:    baseURL,
+		httpClient: httpClient,
+		site:       "default",
+		apiVersion: "network-app", // token access is only offered by UniFi OS consoles
+		tokenFunc:  tokenFunc,
+	}, nil
+}
+
 // login authenticates with the UniFi controller
 // Tries multiple API endpoints to detect controller version
-func (c *Client) login(ctx context.Context, username, password string) error {
+func (c *Client) login(ctx context.Context, username, password, totp string) error {
 	loginReq := LoginRequest{
 		Username: username,
 		Password: password,
 	}
+	if totp != "" {
+		code, err := totpCode(totp, time.Now())
+		if err != nil {
+			return err
+		}
+		loginReq.Token = code
+		loginReq.Ubic2FAToken = code
+	}
 
 	body, err := json.Marshal(loginReq)
 	if err != nil {
@@ -113,7 +176,7 @@ func (c *Client) login(ctx context.Context, username, password string) error {
 
 		req.Header.Set("Content-Type", "application/json")
 
-		resp, err := c.httpClient.Do(req)
+		resp, err := c.do(req)
 		if err != nil {
 			lastErr = err
 			continue
@@ -122,10 +185,16 @@ func (c *Client) login(ctx context.Context, username, password string) error {
 
 		if resp.StatusCode == http.StatusOK {
 			c.apiVersion = endpoint.version
+			if c.csrfToken == "" {
+				c.csrfToken = c.csrfTokenFromCookie()
+			}
 			return nil
 		}
 
 		bodyBytes, _ := io.ReadAll(resp.Body)
+		if totp == "" && mfaRequired(resp.StatusCode, bodyBytes) {
+			return fmt.Errorf("controller account requires two-factor authentication; add a totp code or secret to the credentials")
+		}
 		lastErr = fmt.Errorf("login failed with status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
@@ -164,7 +233,7 @@ func (c *Client) GetClients(ctx context.Context) ([]UniFiDevice, error) {
 			continue
 		}
 
-		resp, err := c.httpClient.Do(req)
+		resp, err := c.do(req)
 		if err != nil {
 			lastErr = err
 			continue
@@ -208,9 +277,65 @@ func (c *Client) GetClients(ctx context.Context) ([]UniFiDevice, error) {
 	return nil, fmt.Errorf("all GetClients attempts failed. Last error: %w. Tried paths: %v", lastErr, paths)
 }
 
+// GetNetworks retrieves the configured networks (LANs/VLANs) from the controller
+func (c *Client) GetNetworks(ctx context.Context) ([]UniFiNetwork, error) {
+	paths := []string{
+		fmt.Sprintf("/api/s/%s/rest/networkconf", c.site),
+		fmt.Sprintf("/proxy/network/api/s/%s/rest/networkconf", c.site),
+	}
+	if c.apiVersion == "network-app" || c.apiVersion == "network-app-alt" {
+		paths[0], paths[1] = paths[1], paths[0]
+	}
+
+	var lastErr error
+	for _, path := range paths {
+		url := fmt.Sprintf("%s%s", c.baseURL, path)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		resp, err := c.do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("GET %s failed with status %d: %s", path, resp.StatusCode, string(bodyBytes))
+			continue
+		}
+
+		var networkResp NetworkResponse
+		if err := json.Unmarshal(bodyBytes, &networkResp); err != nil {
+			lastErr = fmt.Errorf("failed to parse response from %s: %w", path, err)
+			continue
+		}
+
+		if networkResp.Meta.RC != "" && networkResp.Meta.RC != "ok" {
+			lastErr = fmt.Errorf("API returned error: %s", networkResp.Meta.RC)
+			continue
+		}
+
+		return networkResp.Data, nil
+	}
+
+	return nil, fmt.Errorf("all GetNetworks attempts failed. Last error: %w. Tried paths: %v", lastErr, paths)
+}
+
 // SetStaticIP sets a static IP for a device via DHCP reservation
 func (c *Client) SetStaticIP(ctx context.Context, mac, ip, hostname string) error {
 	url := fmt.Sprintf("%s/api/s/%s/rest/user", c.baseURL, c.site)
+	if c.apiVersion == "network-app" || c.apiVersion == "network-app-alt" {
+		url = fmt.Sprintf("%s/proxy/network/api/s/%s/rest/user", c.baseURL, c.site)
+	}
 
 	payload := map[string]interface{}{
 		"mac":         mac,
@@ -231,7 +356,7 @@ func (c *Client) SetStaticIP(ctx context.Context, mac, ip, hostname string) erro
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
@@ -245,11 +370,174 @@ func (c *Client) SetStaticIP(ctx context.Context, mac, ip, hostname string) erro
 	return nil
 }
 
+// StaticDNSEntry represents a static DNS record on the controller
+// (UniFi Network Application 7.2 and newer)
+type StaticDNSEntry struct {
+	ID         string `json:"_id,omitempty"`
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	RecordType string `json:"record_type"`
+	Enabled    bool   `json:"enabled"`
+}
+
+// staticDNSPath returns the static DNS endpoint, only served by the Network Application
+func (c *Client) staticDNSPath() string {
+	return fmt.Sprintf("%s/proxy/network/v2/api/site/%s/static-dns", c.baseURL, c.site)
+}
+
+// GetStaticDNS retrieves the static DNS entries from the controller
+func (c *Client) GetStaticDNS(ctx context.Context) ([]StaticDNSEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.staticDNSPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get static DNS failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var entries []StaticDNSEntry
+	if err := json.Unmarshal(bodyBytes, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse static DNS entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// SetStaticDNS creates an A record for name, or updates the existing one
+func (c *Client) SetStaticDNS(ctx context.Context, name, ip string) error {
+	entries, err := c.GetStaticDNS(ctx)
+	if err != nil {
+		return err
+	}
+
+	entry := StaticDNSEntry{Key: name, Value: ip, RecordType: "A", Enabled: true}
+	method, url := "POST", c.staticDNSPath()
+	for _, existing := range entries {
+		if existing.RecordType == "A" && strings.EqualFold(existing.Key, name) {
+			if existing.Value == ip && existing.Enabled {
+				return nil
+			}
+			entry.ID = existing.ID
+			method, url = "PUT", url+"/"+existing.ID
+			break
+		}
+	}
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("set static DNS failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	return nil
+}
+
+// do sends req with the CSRF token on write calls and picks up the
+// refreshed token the controller returns
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.tokenFunc != nil {
+		token, err := c.tokenFunc(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain access token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if c.csrfToken != "" && req.Method != http.MethodGet {
+		req.Header.Set("X-CSRF-Token", c.csrfToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if token := resp.Header.Get("X-Updated-CSRF-Token"); token != "" {
+		c.csrfToken = token
+	} else if token := resp.Header.Get("X-CSRF-Token"); token != "" {
+		c.csrfToken = token
+	}
+
+	return resp, nil
+}
+
+// csrfTokenFromCookie reads the CSRF token from the claims of the TOKEN
+// session cookie, for consoles that don't return it as a header on login
+func (c *Client) csrfTokenFromCookie() string {
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return ""
+	}
+
+	for _, cookie := range c.httpClient.Jar.Cookies(base) {
+		if cookie.Name != "TOKEN" {
+			continue
+		}
+		parts := strings.Split(cookie.Value, ".")
+		if len(parts) != 3 {
+			return ""
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return ""
+		}
+		var claims struct {
+			CSRFToken string `json:"csrfToken"`
+		}
+		json.Unmarshal(payload, &claims)
+		return claims.CSRFToken
+	}
+
+	return ""
+}
+
+// mfaRequired reports whether a failed login asks for a 2FA code
+func mfaRequired(status int, body []byte) bool {
+	if status == 499 {
+		return true
+	}
+	lower := strings.ToLower(string(body))
+	return strings.Contains(lower, "mfa") || strings.Contains(lower, "2fa")
+}
+
 // Close closes the client connection
 func (c *Client) Close() error {
+	if c.tokenFunc != nil {
+		return nil // no session to end
+	}
+
 	// Logout
-	url := fmt.Sprintf("%s/api/logout", c.baseURL)
-	req, _ := http.NewRequest("POST", url, nil)
-	c.httpClient.Do(req)
+	logoutURL := fmt.Sprintf("%s/api/logout", c.baseURL)
+	if c.apiVersion == "network-app" || c.apiVersion == "network-app-alt" {
+		logoutURL = fmt.Sprintf("%s/api/auth/logout", c.baseURL)
+	}
+	req, _ := http.NewRequest("POST", logoutURL, nil)
+	c.do(req)
 	return nil
 }
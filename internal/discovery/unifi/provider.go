@@ -14,6 +14,7 @@ type Provider struct {
 	client        *Client
 	controllerURL string
 	verifySSL     bool
+	tokenFunc     func(ctx context.Context) (string, error)
 }
 
 // NewProvider creates a new UniFi discovery provider
@@ -24,8 +25,36 @@ func NewProvider(controllerURL string, verifySSL bool) *Provider {
 	}
 }
 
-// Authenticate authenticates with the UniFi controller
+// NewProviderWithToken creates a UniFi discovery provider that authenticates
+// with bearer tokens from tokenFunc, e.g. an oidc.TokenSource, instead of a
+// username and password
+func NewProviderWithToken(controllerURL string, tokenFunc func(ctx context.Context) (string, error), verifySSL bool) *Provider {
+	return &Provider{
+		controllerURL: controllerURL,
+		verifySSL:     verifySSL,
+		tokenFunc:     tokenFunc,
+	}
+}
+
+// Authenticate authenticates with the UniFi controller. Providers created
+// with NewProviderWithToken only read the site from credentials.
 func (p *Provider) Authenticate(ctx context.Context, credentials map[string]string) error {
+	if p.tokenFunc != nil {
+		client, err := NewClientWithToken(p.controllerURL, p.tokenFunc, p.verifySSL)
+		if err != nil {
+			return err
+		}
+		if site := credentials["site"]; site != "" {
+			client.site = site
+		}
+		// Fail early if the token is refused rather than on first use
+		if _, err := client.GetNetworks(ctx); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+		p.client = client
+		return nil
+	}
+
 	username, ok := credentials["username"]
 	if !ok {
 		return fmt.Errorf("username not provided in credentials")
@@ -42,7 +71,8 @@ func (p *Provider) Authenticate(ctx context.Context, credentials map[string]stri
 		site = "default"
 	}
 
-	client, err := NewClient(p.controllerURL, username, password, p.verifySSL)
+	// Optional 2FA: a current code or the TOTP secret for unattended logins
+	client, err := NewClient(p.controllerURL, username, password, credentials["totp"], p.verifySSL)
 	if err != nil {
 		return err
 	}
@@ -60,11 +90,24 @@ func (p *Provider) DiscoverDevices(ctx context.Context, filterPattern string) ([
 		return nil, fmt.Errorf("not authenticated, call Authenticate first")
 	}
 
+	filter, err := discovery.ParseHostnameFilter(filterPattern)
+	if err != nil {
+		return nil, err
+	}
+
 	unifiDevices, err := p.client.GetClients(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	// Resolve network IDs to names/VLANs; discovery still works without them
+	networks := make(map[string]UniFiNetwork)
+	if unifiNetworks, err := p.client.GetNetworks(ctx); err == nil {
+		for _, network := range unifiNetworks {
+			networks[network.ID] = network
+		}
+	}
+
 	var devices []discovery.DeviceInfo
 	for _, ud := range unifiDevices {
 		// Skip devices without IP
@@ -78,7 +121,7 @@ func (p *Provider) DiscoverDevices(ctx context.Context, filterPattern string) ([
 		}
 
 		// Apply filter if provided
-		if filterPattern != "" && !matchesPattern(hostname, filterPattern) {
+		if !filter.Match(hostname) {
 			continue
 		}
 
@@ -89,6 +132,13 @@ func (p *Provider) DiscoverDevices(ctx context.Context, filterPattern string) ([
 			LastSeen:   time.Unix(ud.LastSeen, 0),
 		}
 
+		if network, ok := networks[ud.NetworkID]; ok {
+			device.Network = network.Name
+			if network.VLANEnabled {
+				device.VLAN = network.VLAN
+			}
+		}
+
 		devices = append(devices, device)
 	}
 
@@ -104,6 +154,15 @@ func (p *Provider) SetDHCPLease(ctx context.Context, lease discovery.DHCPLease)
 	return p.client.SetStaticIP(ctx, lease.MACAddress, lease.IPAddress, lease.Hostname)
 }
 
+// SetDNSRecord creates or updates a static DNS entry on the controller
+func (p *Provider) SetDNSRecord(ctx context.Context, record discovery.DNSRecord) error {
+	if p.client == nil {
+		return fmt.Errorf("not authenticated, call Authenticate first")
+	}
+
+	return p.client.SetStaticDNS(ctx, record.Name, record.IPAddress)
+}
+
 // GetDeviceByMAC retrieves device information by MAC address
 func (p *Provider) GetDeviceByMAC(ctx context.Context, mac string) (*discovery.DeviceInfo, error) {
 	if p.client == nil {
@@ -131,20 +190,3 @@ func (p *Provider) Close() error {
 	}
 	return nil
 }
-
-// matchesPattern checks if hostname matches the filter pattern
-// Simple wildcard matching: "shelly*" matches "shelly-plus-1pm"
-func matchesPattern(hostname, pattern string) bool {
-	if pattern == "" || pattern == "*" {
-		return true
-	}
-
-	// Simple prefix matching for patterns like "shelly*"
-	if strings.HasSuffix(pattern, "*") {
-		prefix := strings.TrimSuffix(pattern, "*")
-		return strings.HasPrefix(strings.ToLower(hostname), strings.ToLower(prefix))
-	}
-
-	// Exact match
-	return strings.EqualFold(hostname, pattern)
-}
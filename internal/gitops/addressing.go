@@ -0,0 +1,169 @@
+package gitops
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/config"
+	"github.com/darkermage/shelly-git-ops/internal/tunnel"
+)
+
+// tailscale4via6Prefix is the /64 Tailscale routes 4via6 addresses under;
+// the site ID and IPv4 address fill the remaining 64 bits
+var tailscale4via6Prefix = [8]byte{0xfd, 0x7a, 0x11, 0x5c, 0xa1, 0xe0, 0x0b, 0x1a}
+
+// SetAddressing sets how devices are reached from this machine. The manifest
+// keeps the on-site LAN IPs; every request is translated to the address
+// routed over the tunnel, so a cloud-hosted daemon can manage an on-prem
+// fleet through a Tailscale subnet router or WireGuard peer. With a Tunnel,
+// connections are made from an SSH jump host or SOCKS5 proxy at the site
+// instead; call Close to disconnect it.
+func (sm *SyncManager) SetAddressing(addressing *config.Addressing) error {
+	if addressing == nil {
+		sm.shellyClient.SetAddressResolver(nil)
+		return sm.setTunnel(nil)
+	}
+	if err := addressing.Validate(); err != nil {
+		return err
+	}
+	if err := sm.setTunnel(addressing.Tunnel); err != nil {
+		return err
+	}
+
+	switch addressing.Mode {
+	case config.AddressingSubnet:
+		prefixes, _ := addressing.SubnetPrefixes()
+		sm.shellyClient.SetAddressResolver(func(deviceIP string) string {
+			return translateSubnet(deviceIP, prefixes)
+		})
+	case config.Addressing4via6:
+		siteID := addressing.SiteID
+		sm.shellyClient.SetAddressResolver(func(deviceIP string) string {
+			return address4via6(deviceIP, siteID)
+		})
+	case config.AddressingHosts:
+		sm.shellyClient.SetAddressResolver(func(deviceIP string) string {
+			return sm.hostAddress(deviceIP, addressing)
+		})
+	default:
+		sm.shellyClient.SetAddressResolver(nil)
+	}
+
+	return nil
+}
+
+// setTunnel routes device connections through the tunnel, replacing (and
+// closing) the previous one; nil dials devices directly
+func (sm *SyncManager) setTunnel(cfg *config.Tunnel) error {
+	var dialer tunnel.Dialer
+	if cfg != nil {
+		var err error
+		dialer, err = tunnel.Open(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to set up tunnel: %w", err)
+		}
+	}
+
+	if sm.tunnel != nil {
+		sm.tunnel.Close()
+	}
+	sm.tunnel = dialer
+	if dialer == nil {
+		sm.shellyClient.SetDialFunc(nil)
+	} else {
+		sm.shellyClient.SetDialFunc(dialer.DialContext)
+	}
+	return nil
+}
+
+// Close disconnects the site tunnel, if any. The SyncManager can't reach
+// tunnelled devices afterwards.
+func (sm *SyncManager) Close() error {
+	if sm.tunnel == nil {
+		return nil
+	}
+	err := sm.tunnel.Close()
+	sm.tunnel = nil
+	return err
+}
+
+// translateSubnet moves deviceIP from its on-site subnet to the routed one,
+// keeping the host bits. Addresses outside every mapped subnet are unchanged.
+func translateSubnet(deviceIP string, prefixes map[netip.Prefix]netip.Prefix) string {
+	addr, err := netip.ParseAddr(deviceIP)
+	if err != nil || !addr.Is4() {
+		return deviceIP
+	}
+
+	// The most specific mapped subnet wins
+	var from, to netip.Prefix
+	for candidate, routed := range prefixes {
+		if candidate.Contains(addr) && (!from.IsValid() || candidate.Bits() > from.Bits()) {
+			from, to = candidate, routed
+		}
+	}
+	if !from.IsValid() {
+		return deviceIP
+	}
+
+	ip := addr.As4()
+	routed := to.Addr().As4()
+	for i := range ip {
+		bits := from.Bits() - i*8
+		switch {
+		case bits >= 8:
+			ip[i] = routed[i]
+		case bits > 0:
+			mask := byte(0xff << (8 - bits))
+			ip[i] = routed[i]&mask | ip[i]&^mask
+		}
+	}
+	return netip.AddrFrom4(ip).String()
+}
+
+// address4via6 returns the bracketed Tailscale 4via6 address of deviceIP at
+// the given site
+func address4via6(deviceIP string, siteID uint16) string {
+	addr, err := netip.ParseAddr(deviceIP)
+	if err != nil || !addr.Is4() {
+		return deviceIP
+	}
+
+	var ip [16]byte
+	copy(ip[:8], tailscale4via6Prefix[:])
+	ip[10] = byte(siteID >> 8)
+	ip[11] = byte(siteID)
+	v4 := addr.As4()
+	copy(ip[12:], v4[:])
+
+	return "[" + netip.AddrFrom16(ip).String() + "]"
+}
+
+// hostAddress looks up the host name of the manifest device at deviceIP:
+// an entry in Hosts for its ID, name or IP, else its host label under
+// HostSuffix. Unknown devices are dialled as given.
+func (sm *SyncManager) hostAddress(deviceIP string, addressing *config.Addressing) string {
+	if host, ok := addressing.Hosts[deviceIP]; ok {
+		return host
+	}
+
+	for _, device := range sm.manifest.Devices {
+		if device.IPAddress != deviceIP {
+			continue
+		}
+		for _, key := range []string{device.DeviceID, device.Name} {
+			if host, ok := addressing.Hosts[key]; ok {
+				return host
+			}
+		}
+		if suffix := strings.Trim(addressing.HostSuffix, "."); suffix != "" {
+			if label := hostLabel(device.Name); label != "" {
+				return label + "." + suffix
+			}
+		}
+		break
+	}
+
+	return deviceIP
+}
@@ -0,0 +1,175 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// baselineIdentityFields are device-specific sys fields never copied into or out of a baseline
+var baselineIdentityFields = []string{"name", "mac", "fw_id"}
+
+// FieldChange is a single field a baseline changes relative to factory state
+type FieldChange struct {
+	Component string      `json:"component"`
+	Path      string      `json:"path"`
+	Factory   interface{} `json:"factory"`
+	Baseline  interface{} `json:"baseline"`
+}
+
+// CaptureBaseline saves a live device's component configuration as the
+// baseline for its model, so devices of the same model onboarded later start
+// from it. Device identity fields and read-only components are left out.
+func (sm *SyncManager) CaptureBaseline(ctx context.Context, deviceRef string) (string, error) {
+	device := sm.findDevice(deviceRef)
+	if device == nil {
+		return "", fmt.Errorf("device %s not found in manifest", deviceRef)
+	}
+
+	info, err := sm.CachedDeviceInfo(ctx, *device)
+	if err != nil {
+		return "", fmt.Errorf("failed to get device info: %w", err)
+	}
+
+	shellyConfig, err := sm.shellyClient.GetShellyConfig(ctx, device.IPAddress)
+	if err != nil {
+		return "", fmt.Errorf("failed to get shelly config: %w", err)
+	}
+
+	var configMap map[string]map[string]interface{}
+	if err := json.Unmarshal(shellyConfig, &configMap); err != nil {
+		return "", fmt.Errorf("failed to parse shelly config: %w", err)
+	}
+
+	for componentKey, componentConfig := range configMap {
+		if componentKey == "cloud" || strings.HasPrefix(componentKey, "script:") {
+			continue
+		}
+		if componentKey == "sys" {
+			stripIdentityFields(componentConfig)
+		}
+
+		data, err := json.Marshal(componentConfig)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal %s config: %w", componentKey, err)
+		}
+		if err := sm.deviceStorage.SaveBaselineConfig(info.Model, strings.ReplaceAll(componentKey, ":", "-"), data); err != nil {
+			return "", err
+		}
+	}
+
+	return info.Model, nil
+}
+
+// SeedFromBaseline overlays the baseline for a device's model onto its pulled
+// (factory) configs and returns the fields that changed. The changes are left
+// in the working tree so they can be reviewed, committed and pushed.
+func (sm *SyncManager) SeedFromBaseline(device storage.Device) ([]FieldChange, error) {
+	baseline, err := sm.deviceStorage.LoadBaseline(device.Model)
+	if err != nil || baseline == nil {
+		return nil, err
+	}
+
+	var changes []FieldChange
+	for component, baselineConfig := range baseline {
+		var base map[string]interface{}
+		if err := json.Unmarshal(baselineConfig, &base); err != nil {
+			return changes, fmt.Errorf("failed to parse %s baseline: %w", component, err)
+		}
+		if component == "sys" {
+			stripIdentityFields(base)
+		}
+
+		// Only seed components the device actually has
+		localConfig, err := sm.deviceStorage.LoadComponentConfig(device.Folder, component)
+		if err != nil {
+			continue
+		}
+		var factory map[string]interface{}
+		if err := json.Unmarshal(localConfig, &factory); err != nil {
+			return changes, fmt.Errorf("failed to parse %s config: %w", component, err)
+		}
+
+		seeded := overlayConfig(factory, base, component, "", &changes)
+
+		data, err := json.Marshal(seeded)
+		if err != nil {
+			return changes, fmt.Errorf("failed to marshal %s config: %w", component, err)
+		}
+		if err := sm.deviceStorage.SaveComponentConfig(device.Folder, component, data); err != nil {
+			return changes, err
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Component != changes[j].Component {
+			return changes[i].Component < changes[j].Component
+		}
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
+
+// overlayConfig returns factory with every field of base applied over it,
+// recording each field whose value changes
+func overlayConfig(factory, base map[string]interface{}, component, path string, changes *[]FieldChange) map[string]interface{} {
+	out := make(map[string]interface{}, len(factory))
+	for k, v := range factory {
+		out[k] = v
+	}
+
+	for key, baseValue := range base {
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+
+		factoryValue, exists := factory[key]
+		baseMap, baseIsMap := baseValue.(map[string]interface{})
+		factoryMap, factoryIsMap := factoryValue.(map[string]interface{})
+		if baseIsMap && factoryIsMap {
+			out[key] = overlayConfig(factoryMap, baseMap, component, fieldPath, changes)
+			continue
+		}
+
+		// Fields the device doesn't know about would be rejected on push
+		if !exists {
+			continue
+		}
+		if !reflect.DeepEqual(factoryValue, baseValue) {
+			*changes = append(*changes, FieldChange{Component: component, Path: fieldPath, Factory: factoryValue, Baseline: baseValue})
+			out[key] = baseValue
+		}
+	}
+
+	return out
+}
+
+// stripIdentityFields removes device-specific fields from a sys config
+func stripIdentityFields(sysConfig map[string]interface{}) {
+	device, ok := sysConfig["device"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, field := range baselineIdentityFields {
+		delete(device, field)
+	}
+}
+
+// printBaselineChanges reports the fields a baseline changed on a new device
+func printBaselineChanges(device storage.Device, changes []FieldChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Info: Seeded %s from %s baseline (%d field(s) differ from factory):\n", device.Name, device.Model, len(changes))
+	for _, change := range changes {
+		fmt.Fprintf(os.Stderr, "  %s %s: %v -> %v\n", change.Component, change.Path, change.Factory, change.Baseline)
+	}
+}
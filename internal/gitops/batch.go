@@ -0,0 +1,91 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// batchSetConfigMethod applies several component configs in one call on
+// firmware that advertises it
+const batchSetConfigMethod = "Shelly.SetConfig"
+
+// pendingConfig is a rendered component config waiting to be pushed
+type pendingConfig struct {
+	file      string                 // config file name without extension, e.g. "switch-0"
+	key       string                 // component key, e.g. "switch:0"
+	component string                 // RPC namespace, e.g. "Switch"
+	params    map[string]interface{} // per-component <Component>.SetConfig params
+	config    map[string]interface{}
+}
+
+// applyComponentConfigs pushes configs and returns how many were applied and
+// the components the device needs a reboot for. Devices supporting
+// Shelly.SetConfig get them all in one request, which is faster and shortens
+// the time the device runs a mix of old and new config; if that request
+// fails, the device doesn't support it or is marked serial, every component
+// is set individually.
+func (sm *SyncManager) applyComponentConfigs(ctx context.Context, device storage.Device, pending []pendingConfig) (int, []string) {
+	if len(pending) > 1 && !device.Serial && sm.supportsMethod(ctx, device, batchSetConfigMethod) {
+		configs := make(map[string]interface{}, len(pending))
+		keys := make([]string, 0, len(pending))
+		for _, p := range pending {
+			configs[p.key] = p.config
+			keys = append(keys, p.key)
+		}
+		restart, err := sm.shellyClient.ApplyConfigs(ctx, device.IPAddress, configs)
+		if err == nil {
+			if restart {
+				// The batched call doesn't tell which component asked for it
+				return len(pending), keys
+			}
+			return len(pending), nil
+		}
+		fmt.Fprintf(os.Stderr, "Warning: Batched config push to %s failed, setting components individually: %v\n", device.Name, err)
+	}
+
+	applied := 0
+	var restartRequired []string
+	for _, p := range pending {
+		restart, err := sm.shellyClient.ApplyComponentConfig(ctx, device.IPAddress, p.component, p.params)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to set %s config: %v%s\n", p.file, err, hintSuffix(err))
+			continue
+		}
+		if restart {
+			restartRequired = append(restartRequired, p.key)
+		}
+		applied++
+	}
+	return applied, restartRequired
+}
+
+// supportsMethod reports whether a device advertises an RPC method, using
+// capabilities.json when the device was interviewed and Shelly.ListMethods
+// otherwise. Answers are cached for the lifetime of the sync manager.
+func (sm *SyncManager) supportsMethod(ctx context.Context, device storage.Device, method string) bool {
+	cacheKey := device.DeviceID + "/" + method
+	if supported, ok := sm.methodSupport.Load(cacheKey); ok {
+		return supported.(bool)
+	}
+
+	var supported bool
+	if capabilities, err := sm.deviceStorage.LoadCapabilities(device.Folder); err == nil && capabilities != nil {
+		supported = capabilities.Supports(method)
+	} else if methods, err := sm.shellyClient.ListMethods(ctx, device.IPAddress); err == nil {
+		for _, m := range methods {
+			if m == method {
+				supported = true
+				break
+			}
+		}
+	} else {
+		// Don't cache a failed lookup
+		return false
+	}
+
+	sm.methodSupport.Store(cacheKey, supported)
+	return supported
+}
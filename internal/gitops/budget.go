@@ -0,0 +1,83 @@
+package gitops
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// budgetedPushConcurrency bounds parallel pushes while a failure budget is set,
+// so there are still devices left to protect when the budget runs out
+const budgetedPushConcurrency = 4
+
+// FailureBudget is the number of device failures a push tolerates before the
+// remaining devices are skipped. It is either an absolute count or a percentage
+// of the devices being pushed.
+type FailureBudget struct {
+	Count   int
+	Percent float64
+	percent bool
+}
+
+// ParseFailureBudget parses "N" or "N%"
+func ParseFailureBudget(value string) (FailureBudget, error) {
+	value = strings.TrimSpace(value)
+
+	if pct, ok := strings.CutSuffix(value, "%"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return FailureBudget{}, fmt.Errorf("invalid failure percentage %q", value)
+		}
+		return FailureBudget{Percent: percent, percent: true}, nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return FailureBudget{}, fmt.Errorf("invalid failure count %q", value)
+	}
+	return FailureBudget{Count: count}, nil
+}
+
+// allowed returns how many failures are tolerated out of total devices
+func (b FailureBudget) allowed(total int) int {
+	if b.percent {
+		return int(b.Percent * float64(total) / 100)
+	}
+	return b.Count
+}
+
+// String formats the budget the way it is parsed
+func (b FailureBudget) String() string {
+	if b.percent {
+		return strconv.FormatFloat(b.Percent, 'f', -1, 64) + "%"
+	}
+	return strconv.Itoa(b.Count)
+}
+
+// SetMaxFailures sets the failure budget for pushes; nil disables it
+func (sm *SyncManager) SetMaxFailures(budget *FailureBudget) {
+	sm.maxFailures = budget
+}
+
+// failureTracker counts device failures during a push and trips once the budget is exceeded
+type failureTracker struct {
+	mu       sync.Mutex
+	allowed  int
+	failures int
+}
+
+// record counts a failed device and reports whether this failure exceeded the budget
+func (t *failureTracker) record() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures++
+	return t.failures == t.allowed+1
+}
+
+// exceeded reports whether more devices failed than the budget allows
+func (t *failureTracker) exceeded() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failures > t.allowed
+}
@@ -0,0 +1,105 @@
+package gitops_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darkermage/shelly-git-ops/internal/gitops"
+	"github.com/darkermage/shelly-git-ops/internal/simulator"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// pulledFleet starts a simulated fleet and returns a SyncManager whose
+// repository holds a pull of it
+func pulledFleet(t *testing.T, devices int) (*gitops.SyncManager, *simulator.Fleet, string) {
+	t.Helper()
+	fleet, err := simulator.StartFleet(simulator.FleetOptions{Devices: devices, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fleet.Close() })
+
+	dir := t.TempDir()
+	repo, err := gitops.InitRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := storage.LoadManifest(storage.FindManifest(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, device := range fleet.ManifestDevices() {
+		manifest.AddDevice(device)
+	}
+	if err := manifest.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("Register simulated devices"); err != nil {
+		t.Fatal(err)
+	}
+
+	sm, err := gitops.NewSyncManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := sm.PullFromDevices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if !result.Success {
+			t.Fatalf("pull of %s failed: %v", result.DeviceID, result.Error)
+		}
+	}
+	return sm, fleet, dir
+}
+
+// breakTemplates gives every device a config whose template doesn't render
+func breakTemplates(t *testing.T, dir string, devices []storage.Device) {
+	t.Helper()
+	for _, device := range devices {
+		file := filepath.Join(dir, device.Folder, "configs", "mqtt.json")
+		if err := os.WriteFile(file, []byte(`{"enable": false, "client_id": "{{ .device.name | nosuchfunc }}"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPushFailureBudgetCountsComponentFailures(t *testing.T) {
+	sm, fleet, dir := pulledFleet(t, 8)
+	breakTemplates(t, dir, fleet.ManifestDevices())
+
+	budget, err := gitops.ParseFailureBudget("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.SetMaxFailures(&budget)
+
+	results, err := sm.PushToDevices(context.Background(), false, nil, "")
+	if err == nil || !strings.Contains(err.Error(), "push aborted") {
+		t.Fatalf("push returned %v, want the failure budget to abort it", err)
+	}
+
+	failed, skipped := 0, 0
+	for _, result := range results {
+		switch {
+		case result.Success:
+			t.Errorf("%s: push with a broken template succeeded", result.DeviceID)
+		case strings.Contains(result.Error.Error(), "failure budget exceeded"):
+			skipped++
+		case strings.Contains(result.Error.Error(), "config mqtt"):
+			failed++
+		default:
+			t.Errorf("%s: unexpected error %v", result.DeviceID, result.Error)
+		}
+	}
+	if failed < 2 || skipped == 0 {
+		t.Errorf("%d devices failed and %d were skipped, want at least 2 failed and some skipped", failed, skipped)
+	}
+}
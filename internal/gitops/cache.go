@@ -0,0 +1,180 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// defaultDeviceCacheTTL is how long cached device info and components are
+// served before the device is asked again
+const defaultDeviceCacheTTL = time.Hour
+
+// deviceCacheEntry is the cached device data, one file per device
+type deviceCacheEntry struct {
+	Info         *shelly.DeviceInfo     `json:"info,omitempty"`
+	InfoAt       time.Time              `json:"info_at,omitempty"`
+	Components   []shelly.ComponentInfo `json:"components,omitempty"`
+	ComponentsAt time.Time              `json:"components_at,omitempty"`
+}
+
+// SetDeviceCacheTTL sets how long cached device info and components stay
+// valid. Zero restores the default; a negative TTL disables the cache.
+func (sm *SyncManager) SetDeviceCacheTTL(ttl time.Duration) {
+	sm.deviceCacheTTL = ttl
+}
+
+// cacheTTL returns the effective cache TTL
+func (sm *SyncManager) cacheTTL() time.Duration {
+	if sm.deviceCacheTTL == 0 {
+		return defaultDeviceCacheTTL
+	}
+	return sm.deviceCacheTTL
+}
+
+// deviceCachePath returns the cache file of a device inside the state directory
+func (sm *SyncManager) deviceCachePath(deviceID string) string {
+	return filepath.Join(sm.StateDir(), "cache", storage.SanitizeFolderName(deviceID)+".json")
+}
+
+// loadDeviceCache reads a device's cache entry; a missing or corrupt file is an empty entry
+func (sm *SyncManager) loadDeviceCache(deviceID string) *deviceCacheEntry {
+	entry := &deviceCacheEntry{}
+	data, err := os.ReadFile(sm.deviceCachePath(deviceID))
+	if err != nil || json.Unmarshal(data, entry) != nil {
+		return &deviceCacheEntry{}
+	}
+	return entry
+}
+
+// updateDeviceCache applies update to a device's cache entry and saves it
+func (sm *SyncManager) updateDeviceCache(deviceID string, update func(*deviceCacheEntry)) {
+	if sm.cacheTTL() < 0 {
+		return
+	}
+
+	sm.cacheMu.Lock()
+	defer sm.cacheMu.Unlock()
+
+	entry := sm.loadDeviceCache(deviceID)
+	update(entry)
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return
+	}
+	path := sm.deviceCachePath(deviceID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+		os.WriteFile(path, data, 0644)
+	}
+}
+
+// InvalidateDeviceCache drops everything cached for a device
+func (sm *SyncManager) InvalidateDeviceCache(deviceID string) {
+	sm.cacheMu.Lock()
+	defer sm.cacheMu.Unlock()
+	os.Remove(sm.deviceCachePath(deviceID))
+}
+
+// CachedDeviceInfo returns Shelly.GetDeviceInfo for a device, served from the
+// cache while it is younger than the TTL. Use it where slightly stale data is
+// fine (inventory, reports); operations acting on the device should call it directly.
+func (sm *SyncManager) CachedDeviceInfo(ctx context.Context, device storage.Device) (*shelly.DeviceInfo, error) {
+	ttl := sm.cacheTTL()
+	if ttl > 0 {
+		sm.cacheMu.Lock()
+		entry := sm.loadDeviceCache(device.DeviceID)
+		sm.cacheMu.Unlock()
+		if entry.Info != nil && time.Since(entry.InfoAt) < ttl {
+			return entry.Info, nil
+		}
+	}
+
+	info, err := sm.shellyClient.GetDeviceInfo(ctx, device.IPAddress)
+	if err != nil {
+		return nil, err
+	}
+	sm.cacheDeviceInfo(device.DeviceID, info)
+	return info, nil
+}
+
+// CachedComponents returns Shelly.GetComponents for a device, served from the
+// cache while it is younger than the TTL
+func (sm *SyncManager) CachedComponents(ctx context.Context, device storage.Device) ([]shelly.ComponentInfo, error) {
+	ttl := sm.cacheTTL()
+	if ttl > 0 {
+		sm.cacheMu.Lock()
+		entry := sm.loadDeviceCache(device.DeviceID)
+		sm.cacheMu.Unlock()
+		if entry.Components != nil && time.Since(entry.ComponentsAt) < ttl {
+			return entry.Components, nil
+		}
+	}
+
+	components, err := sm.shellyClient.GetComponents(ctx, device.IPAddress)
+	if err != nil {
+		return nil, err
+	}
+	sm.cacheComponents(device.DeviceID, components)
+	return components, nil
+}
+
+// cacheDeviceInfo stores freshly fetched device info
+func (sm *SyncManager) cacheDeviceInfo(deviceID string, info *shelly.DeviceInfo) {
+	sm.updateDeviceCache(deviceID, func(entry *deviceCacheEntry) {
+		entry.Info = info
+		entry.InfoAt = time.Now()
+	})
+}
+
+// cacheComponents stores freshly fetched components
+func (sm *SyncManager) cacheComponents(deviceID string, components []shelly.ComponentInfo) {
+	sm.updateDeviceCache(deviceID, func(entry *deviceCacheEntry) {
+		entry.Components = components
+		entry.ComponentsAt = time.Now()
+	})
+}
+
+// InventoryEntry describes one device for inventory listings
+type InventoryEntry struct {
+	Device     storage.Device     `json:"device"`
+	Info       *shelly.DeviceInfo `json:"info,omitempty"`
+	Components []string           `json:"components,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// Inventory lists the selected devices with their device info and component
+// keys, using the device cache so repeated listings don't hit the devices
+func (sm *SyncManager) Inventory(ctx context.Context, deviceFilter []string) []InventoryEntry {
+	devices := sm.SelectDevices(deviceFilter)
+	inventory := make([]InventoryEntry, 0, len(devices))
+
+	for _, device := range devices {
+		entry := InventoryEntry{Device: device}
+		entry.Device.DeviceNotes = sm.DeviceNotes(device)
+
+		info, err := sm.CachedDeviceInfo(ctx, device)
+		if err != nil {
+			entry.Error = fmt.Sprintf("failed to get device info: %v", err)
+			inventory = append(inventory, entry)
+			continue
+		}
+		entry.Info = info
+
+		if components, err := sm.CachedComponents(ctx, device); err == nil {
+			for _, component := range components {
+				entry.Components = append(entry.Components, component.Key)
+			}
+		}
+
+		inventory = append(inventory, entry)
+	}
+
+	return inventory
+}
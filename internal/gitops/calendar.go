@@ -0,0 +1,212 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// Calendar groupings for ScheduleCalendars
+const (
+	CalendarPerDevice = "device" // one calendar per device
+	CalendarPerArea   = "area"   // one calendar per device area (notes field "area")
+	CalendarFleet     = "fleet"  // a single calendar for the whole fleet
+)
+
+// unassignedArea names the calendar of devices without an area
+const unassignedArea = "Unassigned"
+
+// maxCalendarEvents bounds the events exported per schedule, so a schedule
+// firing every minute doesn't produce an unusable feed
+const maxCalendarEvents = 1000
+
+// ScheduleCalendar is an iCalendar (RFC 5545) feed of upcoming schedule firings
+type ScheduleCalendar struct {
+	Name     string
+	FileName string // e.g. "kitchen.ics"
+	Events   int
+	Data     []byte
+}
+
+// calendarEvent is a single firing of a schedule
+type calendarEvent struct {
+	uid         string
+	at          time.Time
+	summary     string
+	description string
+}
+
+// ScheduleCalendars expands every enabled local schedule into events between
+// from and from+window and groups them into calendars by groupBy. Solar
+// (sunrise/sunset) schedules can't be expanded offline and are left out.
+func (sm *SyncManager) ScheduleCalendars(from time.Time, window time.Duration, groupBy string) ([]ScheduleCalendar, error) {
+	until := from.Add(window)
+	groups := make(map[string][]calendarEvent)
+
+	for _, device := range sm.manifest.Devices {
+		schedules, err := sm.deviceStorage.ListSchedules(device.Folder)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list schedules for %s: %w", device.Name, err)
+		}
+
+		var group string
+		switch groupBy {
+		case CalendarPerDevice, "":
+			group = device.Name
+		case CalendarPerArea:
+			group = sm.DeviceNotes(device).Area
+			if group == "" {
+				group = unassignedArea
+			}
+		case CalendarFleet:
+			group = "Shelly fleet"
+		default:
+			return nil, fmt.Errorf("unknown calendar grouping %q", groupBy)
+		}
+
+		loc, _ := sm.deviceLocation(device)
+		for _, schedule := range schedules {
+			if !schedule.Enable {
+				continue
+			}
+			groups[group] = append(groups[group], scheduleEvents(device, schedule, from.In(loc), until)...)
+		}
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	calendars := make([]ScheduleCalendar, 0, len(names))
+	for _, name := range names {
+		events := groups[name]
+		sort.Slice(events, func(i, j int) bool { return events[i].at.Before(events[j].at) })
+		calendars = append(calendars, ScheduleCalendar{
+			Name:     name,
+			FileName: storage.SanitizeFolderName(strings.ToLower(strings.ReplaceAll(name, " ", "-"))) + ".ics",
+			Events:   len(events),
+			Data:     renderCalendar(name, events),
+		})
+	}
+
+	return calendars, nil
+}
+
+// WriteScheduleCalendars writes the calendars of ScheduleCalendars as .ics
+// files into dir
+func (sm *SyncManager) WriteScheduleCalendars(dir string, from time.Time, window time.Duration, groupBy string) ([]ScheduleCalendar, error) {
+	calendars, err := sm.ScheduleCalendars(from, window, groupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create calendar directory: %w", err)
+	}
+	for _, calendar := range calendars {
+		if err := os.WriteFile(filepath.Join(dir, calendar.FileName), calendar.Data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write calendar %s: %w", calendar.FileName, err)
+		}
+	}
+
+	return calendars, nil
+}
+
+// scheduleEvents lists the firings of a schedule in [from, until)
+func scheduleEvents(device storage.Device, schedule *shelly.Schedule, from, until time.Time) []calendarEvent {
+	ts, err := shelly.ParseTimespec(schedule.Timespec)
+	if err != nil || ts.Solar != "" {
+		return nil
+	}
+
+	var calls []string
+	for _, call := range schedule.Calls {
+		calls = append(calls, strings.Trim(describeCall(call.Method, call.Params), "`"))
+	}
+	summary := fmt.Sprintf("%s: %s", device.Name, strings.Join(calls, ", "))
+	description := fmt.Sprintf("Schedule %d on %s, %s (%s)", schedule.ID, device.Name,
+		strings.Trim(shelly.DescribeTimespec(schedule.Timespec), "`"), schedule.Timespec)
+
+	var events []calendarEvent
+	at := from
+	for len(events) < maxCalendarEvents {
+		next, ok := ts.Next(at, until.Sub(at))
+		if !ok || !next.Before(until) {
+			break
+		}
+		events = append(events, calendarEvent{
+			uid:         fmt.Sprintf("%s-%d-%d@shelly-gitops", device.DeviceID, schedule.ID, next.Unix()),
+			at:          next,
+			summary:     summary,
+			description: description,
+		})
+		at = next
+	}
+	return events
+}
+
+// renderCalendar renders events as an iCalendar feed. Each firing is a
+// one-minute event in UTC.
+func renderCalendar(name string, events []calendarEvent) []byte {
+	var b strings.Builder
+	line := func(content string) {
+		b.WriteString(foldICalLine(content))
+		b.WriteString("\r\n")
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//shelly-gitops//schedules//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + escapeICalText(name))
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + event.uid)
+		line("DTSTAMP:" + stamp)
+		line("DTSTART:" + event.at.UTC().Format("20060102T150405Z"))
+		line("DTEND:" + event.at.Add(time.Minute).UTC().Format("20060102T150405Z"))
+		line("SUMMARY:" + escapeICalText(event.summary))
+		line("DESCRIPTION:" + escapeICalText(event.description))
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	return []byte(b.String())
+}
+
+// escapeICalText escapes a TEXT value per RFC 5545 section 3.3.11
+func escapeICalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "").Replace(s)
+}
+
+// foldICalLine splits content lines longer than 75 octets, continuing them
+// on lines starting with a space, without splitting UTF-8 sequences
+func foldICalLine(s string) string {
+	const limit = 75
+	if len(s) <= limit {
+		return s
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package gitops
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// Checksum mismatch kinds
+const (
+	ChecksumModified    = "modified"     // content changed
+	ChecksumLineEndings = "line_endings" // only line endings or byte order mark changed
+	ChecksumAdded       = "added"        // file not present at the last pull/push
+	ChecksumRemoved     = "removed"      // file deleted since the last pull/push
+)
+
+// ChecksumMismatch is a desired-state file that changed outside pull/push
+type ChecksumMismatch struct {
+	DeviceID string `json:"device_id"`
+	File     string `json:"file"` // relative to the device folder
+	Kind     string `json:"kind"`
+}
+
+// updateChecksums records the current hashes of a device folder after pull or push
+func (sm *SyncManager) updateChecksums(device storage.Device) error {
+	checksums, err := sm.deviceStorage.ComputeChecksums(device.Folder)
+	if err != nil {
+		return err
+	}
+	return sm.deviceStorage.SaveChecksums(device.Folder, checksums)
+}
+
+// VerifyChecksums compares device folders with the checksums written by the
+// last pull or push, finding edits that bypassed the tool (e.g. direct edits
+// on a network share) and line-ending or encoding changes introduced by
+// editors or Git settings. Devices without a checksums file are skipped.
+func (sm *SyncManager) VerifyChecksums(deviceFilter []string) ([]ChecksumMismatch, error) {
+	var mismatches []ChecksumMismatch
+
+	for _, device := range sm.SelectDevices(deviceFilter) {
+		recorded, err := sm.deviceStorage.LoadChecksums(device.Folder)
+		if err != nil {
+			return mismatches, fmt.Errorf("%s: %w", device.Name, err)
+		}
+		if recorded == nil {
+			continue
+		}
+
+		current, err := sm.deviceStorage.ComputeChecksums(device.Folder)
+		if err != nil {
+			return mismatches, fmt.Errorf("%s: %w", device.Name, err)
+		}
+
+		var deviceMismatches []ChecksumMismatch
+		for file, want := range recorded.Files {
+			got, ok := current.Files[file]
+			switch {
+			case !ok:
+				deviceMismatches = append(deviceMismatches, ChecksumMismatch{DeviceID: device.DeviceID, File: file, Kind: ChecksumRemoved})
+			case got.SHA256 == want.SHA256:
+			case got.Normalized == want.Normalized:
+				deviceMismatches = append(deviceMismatches, ChecksumMismatch{DeviceID: device.DeviceID, File: file, Kind: ChecksumLineEndings})
+			default:
+				deviceMismatches = append(deviceMismatches, ChecksumMismatch{DeviceID: device.DeviceID, File: file, Kind: ChecksumModified})
+			}
+		}
+		for file := range current.Files {
+			if _, ok := recorded.Files[file]; !ok {
+				deviceMismatches = append(deviceMismatches, ChecksumMismatch{DeviceID: device.DeviceID, File: file, Kind: ChecksumAdded})
+			}
+		}
+
+		sort.Slice(deviceMismatches, func(i, j int) bool { return deviceMismatches[i].File < deviceMismatches[j].File })
+		mismatches = append(mismatches, deviceMismatches...)
+	}
+
+	return mismatches, nil
+}
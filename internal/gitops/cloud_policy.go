@@ -0,0 +1,113 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// CloudViolation is a device with Shelly Cloud enabled despite the policy
+type CloudViolation struct {
+	DeviceID  string `json:"device_id"`
+	ReEnabled bool   `json:"re_enabled"` // cloud was disabled by a previous enforcement
+	Disabled  bool   `json:"disabled"`   // cloud was disabled by this run
+	Error     error  `json:"-"`
+}
+
+// cloudEnforcement records when cloud was last disabled per device
+type cloudEnforcement struct {
+	Disabled map[string]time.Time `json:"disabled"`
+}
+
+// SetRequireCloudDisabled enables the "cloud disabled everywhere" policy, which
+// makes CheckDrift report devices with cloud enabled
+func (sm *SyncManager) SetRequireCloudDisabled(enabled bool) {
+	sm.requireCloudDisabled = enabled
+}
+
+// cloudEnforcementPath returns the location of the cloud enforcement record
+func (sm *SyncManager) cloudEnforcementPath() string {
+	return filepath.Join(sm.StateDir(), "cloud-policy.json")
+}
+
+// EnforceCloudDisabled checks cloud.enable on each selected device and, unless
+// dryRun is set, disables cloud with Cloud.SetConfig where it is enabled.
+// Devices that turned cloud back on after a previous enforcement are flagged.
+func (sm *SyncManager) EnforceCloudDisabled(ctx context.Context, deviceFilter []string, dryRun bool) ([]CloudViolation, error) {
+	record := cloudEnforcement{Disabled: make(map[string]time.Time)}
+	if data, err := os.ReadFile(sm.cloudEnforcementPath()); err == nil {
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal cloud enforcement record: %w", err)
+		}
+		if record.Disabled == nil {
+			record.Disabled = make(map[string]time.Time)
+		}
+	}
+
+	var violations []CloudViolation
+	for _, device := range sm.SelectDevices(deviceFilter) {
+		enabled, err := sm.cloudEnabled(ctx, device)
+		if err != nil {
+			violations = append(violations, CloudViolation{DeviceID: device.DeviceID, Error: err})
+			continue
+		}
+		if !enabled {
+			continue
+		}
+
+		_, previouslyDisabled := record.Disabled[device.DeviceID]
+		violation := CloudViolation{DeviceID: device.DeviceID, ReEnabled: previouslyDisabled}
+
+		if !dryRun {
+			if err := sm.shellyClient.SetComponentConfig(ctx, device.IPAddress, "Cloud", map[string]interface{}{
+				"config": map[string]interface{}{"enable": false},
+			}); err != nil {
+				violation.Error = fmt.Errorf("failed to disable cloud: %w", err)
+			} else {
+				violation.Disabled = true
+				record.Disabled[device.DeviceID] = time.Now()
+			}
+		}
+
+		violations = append(violations, violation)
+	}
+
+	if dryRun {
+		return violations, nil
+	}
+
+	if err := os.MkdirAll(sm.StateDir(), 0755); err != nil {
+		return violations, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return violations, fmt.Errorf("failed to marshal cloud enforcement record: %w", err)
+	}
+	if err := os.WriteFile(sm.cloudEnforcementPath(), data, 0644); err != nil {
+		return violations, fmt.Errorf("failed to write cloud enforcement record: %w", err)
+	}
+
+	return violations, nil
+}
+
+// cloudEnabled reads cloud.enable from a device
+func (sm *SyncManager) cloudEnabled(ctx context.Context, device storage.Device) (bool, error) {
+	data, err := sm.shellyClient.GetComponentConfig(ctx, device.IPAddress, "Cloud")
+	if err != nil {
+		return false, fmt.Errorf("failed to get cloud config: %w", err)
+	}
+	return cloudConfigEnabled(data), nil
+}
+
+// cloudConfigEnabled reports whether a cloud component config has enable set
+func cloudConfigEnabled(data json.RawMessage) bool {
+	var config struct {
+		Enable bool `json:"enable"`
+	}
+	return json.Unmarshal(data, &config) == nil && config.Enable
+}
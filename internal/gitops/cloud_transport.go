@@ -0,0 +1,41 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/cloud"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// SetCloudClient sets the Shelly Cloud account that carries calls to devices
+// marked transport: cloud in the manifest, e.g. at remote sites without a VPN
+func (sm *SyncManager) SetCloudClient(client *cloud.Client) {
+	sm.cloudClient = client
+}
+
+// deviceRelay routes calls to the manifest device at deviceIP through the
+// Shelly Cloud when it is marked transport: cloud; it matches the
+// shelly.RelayResolver signature
+func (sm *SyncManager) deviceRelay(deviceIP string) shelly.RelayFunc {
+	device := sm.manifest.GetDeviceByIP(deviceIP)
+	if device == nil || device.Transport != storage.TransportCloud {
+		return nil
+	}
+
+	client := sm.cloudClient
+	cloudID := strings.ToLower(normalizeMAC(device.MACAddress))
+	name := device.Name
+	return func(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+		if client == nil {
+			return nil, fmt.Errorf("%s uses transport: cloud but no Shelly Cloud account is set (SetCloudClient)", name)
+		}
+		if cloudID == "" {
+			return nil, fmt.Errorf("%s uses transport: cloud but has no MAC address to identify it in the cloud", name)
+		}
+		return client.DeviceRPC(ctx, cloudID, method, params)
+	}
+}
@@ -0,0 +1,76 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// knownComponentTypes are the Shelly.GetConfig component types this tool was
+// written against. Anything else comes from newer firmware and is only saved
+// generically, without type-specific handling.
+var knownComponentTypes = map[string]bool{
+	// System and connectivity
+	"sys": true, "wifi": true, "eth": true, "ble": true, "cloud": true, "mqtt": true,
+	"ws": true, "matter": true, "zigbee": true, "modbus": true, "ui": true, "plugs_ui": true,
+	"ht_ui": true, "knx": true,
+	// Outputs and inputs
+	"switch": true, "input": true, "cover": true, "light": true, "rgb": true, "rgbw": true,
+	"cct": true, "rgbcct": true, "dali": true,
+	// Metering and sensors
+	"em": true, "em1": true, "emdata": true, "em1data": true, "pm1": true,
+	"temperature": true, "humidity": true, "voltmeter": true, "devicepower": true,
+	"smoke": true, "illuminance": true, "flood": true, "presence": true, "presencezone": true,
+	// Bluetooth
+	"bthome": true, "bthomedevice": true, "bthomesensor": true, "blugw": true,
+	// Managed separately (scripts folder, virtual components)
+	"script": true, "boolean": true, "number": true, "text": true, "enum": true,
+	"button": true, "group": true, "object": true,
+}
+
+// componentType returns the type of a component key, e.g. "switch" for "switch:0"
+func componentType(componentKey string) string {
+	componentType, _, _ := strings.Cut(componentKey, ":")
+	return componentType
+}
+
+// recordUnknownComponents writes the unknown component keys found on pull to
+// unknown-components.json (removing it when there are none) and warns about them
+func (sm *SyncManager) recordUnknownComponents(device storage.Device, firmware string, keys []string) error {
+	sort.Strings(keys)
+
+	var components []storage.UnknownComponent
+	for _, key := range keys {
+		components = append(components, storage.UnknownComponent{
+			Key:  key,
+			Type: componentType(key),
+			File: "configs/" + strings.ReplaceAll(key, ":", "-") + ".json",
+		})
+	}
+
+	if len(components) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s reports component(s) unknown to shelly-gitops (firmware %s): %s. They are saved under configs/ but only managed generically.\n",
+			device.Name, firmware, strings.Join(keys, ", "))
+	}
+
+	return sm.deviceStorage.SaveUnknownComponents(device.Folder, firmware, components)
+}
+
+// UnknownComponents returns, per device ID, the unknown components recorded on
+// the last pull. Devices without any are omitted.
+func (sm *SyncManager) UnknownComponents(deviceFilter []string) (map[string]*storage.UnknownComponents, error) {
+	found := make(map[string]*storage.UnknownComponents)
+	for _, device := range sm.SelectDevices(deviceFilter) {
+		unknown, err := sm.deviceStorage.LoadUnknownComponents(device.Folder)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", device.Name, err)
+		}
+		if unknown != nil && len(unknown.Components) > 0 {
+			found[device.DeviceID] = unknown
+		}
+	}
+	return found, nil
+}
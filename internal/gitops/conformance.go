@@ -0,0 +1,247 @@
+package gitops
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// CertifiedDevice is one device covered by a conformance certificate
+type CertifiedDevice struct {
+	DeviceID string `json:"device_id"`
+	Name     string `json:"name"`
+	Model    string `json:"model,omitempty"`
+	Firmware string `json:"firmware,omitempty"`
+	Folder   string `json:"folder"`
+	Digest   string `json:"digest"` // SHA-256 over the desired-state files of the device folder
+}
+
+// Certificate states that at a commit every listed device matched its
+// configuration in Git with zero drift, e.g. for the handover of a rental or
+// commercial installation. Checksum covers every other field; Signature is
+// an HMAC-SHA256 of the checksum when the certificate was issued with a key.
+type Certificate struct {
+	Commit    string            `json:"commit"`
+	Branch    string            `json:"branch,omitempty"`
+	IssuedAt  time.Time         `json:"issued_at"`
+	Devices   []CertifiedDevice `json:"devices"`
+	Checksum  string            `json:"checksum"`
+	Signature string            `json:"signature,omitempty"`
+}
+
+// IssueCertificate checks the selected devices for drift and, if none of
+// them differs from the repository, returns a sealed certificate for the
+// current commit. It fails if the working tree has uncommitted changes, a
+// device can't be checked or drifted, or a device folder was edited
+// outside pull/push. key signs the certificate; nil only checksums it.
+func (sm *SyncManager) IssueCertificate(ctx context.Context, deviceFilter []string, key []byte) (*Certificate, error) {
+	dirty, err := sm.repo.HasChanges()
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("working tree has uncommitted changes; commit them before issuing a certificate")
+	}
+	commit, err := sm.repo.HeadCommit()
+	if err != nil {
+		return nil, err
+	}
+	branch, _ := sm.repo.GetCurrentBranch()
+
+	devices := sm.SelectDevices(deviceFilter)
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no devices selected")
+	}
+
+	mismatches, err := sm.VerifyChecksums(deviceFilter)
+	if err != nil {
+		return nil, err
+	}
+	if len(mismatches) > 0 {
+		return nil, fmt.Errorf("%d file(s) changed outside pull/push, e.g. %s in %s", len(mismatches), mismatches[0].File, mismatches[0].DeviceID)
+	}
+
+	reports, err := sm.CheckDrift(ctx, deviceFilter)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, report := range reports {
+		switch {
+		case report.Error != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", report.DeviceID, report.Error))
+		case report.Drifted():
+			components := make([]string, len(report.Components))
+			for i, drift := range report.Components {
+				components[i] = fmt.Sprintf("%s (%s)", drift.Component, drift.Kind)
+			}
+			problems = append(problems, fmt.Sprintf("%s: %s", report.DeviceID, strings.Join(components, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("fleet does not match Git:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	cert := &Certificate{
+		Commit:   commit,
+		Branch:   branch,
+		IssuedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	for _, device := range devices {
+		certified := CertifiedDevice{
+			DeviceID: device.DeviceID,
+			Name:     device.Name,
+			Folder:   device.Folder,
+		}
+		info, err := sm.shellyClient.GetDeviceInfo(ctx, device.IPAddress)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to get device info: %w", device.DeviceID, err)
+		}
+		if swap := detectDeviceSwap(device, info); swap != nil {
+			return nil, swap
+		}
+		certified.Model = info.Model
+		certified.Firmware = info.FW
+
+		checksums, err := sm.deviceStorage.ComputeChecksums(device.Folder)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", device.DeviceID, err)
+		}
+		certified.Digest = folderDigest(checksums)
+
+		cert.Devices = append(cert.Devices, certified)
+	}
+	sort.Slice(cert.Devices, func(i, j int) bool { return cert.Devices[i].DeviceID < cert.Devices[j].DeviceID })
+
+	if err := cert.seal(key); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// folderDigest hashes the file list and hashes of a device folder, so the
+// same files always give the same digest regardless of order
+func folderDigest(checksums *storage.Checksums) string {
+	files := make([]string, 0, len(checksums.Files))
+	for file := range checksums.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, file := range files {
+		fmt.Fprintf(h, "%s %s\n", checksums.Files[file].Normalized, file)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// contentChecksum hashes the certificate without its checksum and signature
+func (c *Certificate) contentChecksum() (string, error) {
+	content := *c
+	content.Checksum = ""
+	content.Signature = ""
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal certificate: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// seal sets the checksum and, with a key, the signature
+func (c *Certificate) seal(key []byte) error {
+	checksum, err := c.contentChecksum()
+	if err != nil {
+		return err
+	}
+	c.Checksum = checksum
+	c.Signature = ""
+	if len(key) > 0 {
+		c.Signature = certificateSignature(checksum, key)
+	}
+	return nil
+}
+
+// certificateSignature returns the HMAC-SHA256 of checksum under key
+func certificateSignature(checksum string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(checksum))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that the certificate wasn't altered since it was issued. With
+// a key the signature must match too; a certificate issued with a key can't
+// be verified without it.
+func (c *Certificate) Verify(key []byte) error {
+	checksum, err := c.contentChecksum()
+	if err != nil {
+		return err
+	}
+	if checksum != c.Checksum {
+		return fmt.Errorf("certificate checksum mismatch: content was modified")
+	}
+	if len(key) == 0 {
+		if c.Signature != "" {
+			return fmt.Errorf("certificate is signed; a key is required to verify it")
+		}
+		return nil
+	}
+	if !hmac.Equal([]byte(c.Signature), []byte(certificateSignature(checksum, key))) {
+		return fmt.Errorf("certificate signature mismatch")
+	}
+	return nil
+}
+
+// SaveCertificate writes a certificate as indented JSON
+func SaveCertificate(path string, cert *Certificate) error {
+	data, err := json.MarshalIndent(cert, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal certificate: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return nil
+}
+
+// LoadCertificate reads a certificate written by SaveCertificate
+func LoadCertificate(path string) (*Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	var cert Certificate
+	if err := json.Unmarshal(data, &cert); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// WriteSummary writes a plain-text summary of the certificate for handover
+// documentation
+func (c *Certificate) WriteSummary(w io.Writer) {
+	fmt.Fprintf(w, "Certificate of Conformance\n\n")
+	fmt.Fprintf(w, "At commit %s", c.Commit)
+	if c.Branch != "" {
+		fmt.Fprintf(w, " (%s)", c.Branch)
+	}
+	fmt.Fprintf(w, ", checked %s, all %d device(s) below matched their configuration in Git with zero drift.\n\n",
+		c.IssuedAt.Format(time.RFC3339), len(c.Devices))
+	for _, device := range c.Devices {
+		fmt.Fprintf(w, "  %-20s %-24s %-16s %s\n", device.DeviceID, device.Name, device.Model, device.Firmware)
+	}
+	fmt.Fprintf(w, "\nChecksum:  %s\n", c.Checksum)
+	if c.Signature != "" {
+		fmt.Fprintf(w, "Signature: %s (HMAC-SHA256)\n", c.Signature)
+	}
+}
@@ -0,0 +1,133 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// DedupeResult lists the duplicate schedules and webhooks found on a device
+type DedupeResult struct {
+	DeviceID  string
+	Schedules []int // IDs of duplicate schedules (removed unless dry run)
+	Webhooks  []int // IDs of duplicate webhooks (removed unless dry run)
+	Error     error
+}
+
+// Dedupe removes schedules and webhooks that exist more than once with the
+// same content on the selected devices, e.g. left behind by a create that was
+// retried after a timeout. Of each set of duplicates, the entry whose ID is
+// in the device folder is kept, otherwise the one with the lowest ID.
+func (sm *SyncManager) Dedupe(ctx context.Context, deviceFilter []string, dryRun bool) ([]DedupeResult, error) {
+	if !dryRun {
+		release, err := sm.LockRepo("dedupe")
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	var results []DedupeResult
+	for _, device := range sm.SelectDevices(deviceFilter) {
+		result := sm.dedupeDevice(ctx, device, dryRun)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// dedupeDevice finds and removes duplicates on a single device
+func (sm *SyncManager) dedupeDevice(ctx context.Context, device storage.Device, dryRun bool) DedupeResult {
+	result := DedupeResult{DeviceID: device.DeviceID}
+
+	schedules, err := sm.shellyClient.ListSchedules(ctx, device.IPAddress)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to list schedules: %w", err)
+		return result
+	}
+	localSchedules, _ := sm.deviceStorage.ListSchedules(device.Folder)
+	tracked := make(map[int]bool, len(localSchedules))
+	for _, schedule := range localSchedules {
+		tracked[schedule.ID] = true
+	}
+	scheduleHashes := make([]string, len(schedules))
+	scheduleIDs := make([]int, len(schedules))
+	for i, schedule := range schedules {
+		scheduleHashes[i] = schedule.ContentHash()
+		scheduleIDs[i] = schedule.ID
+	}
+	result.Schedules = duplicateIDs(scheduleIDs, scheduleHashes, tracked)
+
+	webhooks, err := sm.shellyClient.ListWebhooks(ctx, device.IPAddress)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to list webhooks: %w", err)
+		return result
+	}
+	localWebhooks, _ := sm.deviceStorage.ListWebhooks(device.Folder)
+	tracked = make(map[int]bool, len(localWebhooks))
+	for _, webhook := range localWebhooks {
+		tracked[webhook.ID] = true
+	}
+	webhookHashes := make([]string, len(webhooks))
+	webhookIDs := make([]int, len(webhooks))
+	for i, webhook := range webhooks {
+		webhookHashes[i] = webhook.ContentHash()
+		webhookIDs[i] = webhook.ID
+	}
+	result.Webhooks = duplicateIDs(webhookIDs, webhookHashes, tracked)
+
+	if dryRun {
+		return result
+	}
+
+	ctx = shelly.WithTraceOperation(ctx, "dedupe")
+	for _, id := range result.Schedules {
+		if err := sm.shellyClient.DeleteSchedule(ctx, device.IPAddress, id); err != nil {
+			result.Error = fmt.Errorf("failed to delete duplicate schedule %d: %w", id, err)
+			return result
+		}
+	}
+	for _, id := range result.Webhooks {
+		if err := sm.shellyClient.DeleteWebhook(ctx, device.IPAddress, id); err != nil {
+			result.Error = fmt.Errorf("failed to delete duplicate webhook %d: %w", id, err)
+			return result
+		}
+	}
+
+	return result
+}
+
+// duplicateIDs groups ids by content hash and returns every ID but the one to
+// keep in each group: a tracked ID if there is one, otherwise the lowest
+func duplicateIDs(ids []int, hashes []string, tracked map[int]bool) []int {
+	groups := make(map[string][]int)
+	for i, hash := range hashes {
+		groups[hash] = append(groups[hash], ids[i])
+	}
+
+	var duplicates []int
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Ints(group)
+		keep := group[0]
+		for _, id := range group {
+			if tracked[id] {
+				keep = id
+				break
+			}
+		}
+		for _, id := range group {
+			if id != keep {
+				duplicates = append(duplicates, id)
+			}
+		}
+	}
+
+	sort.Ints(duplicates)
+	return duplicates
+}
@@ -0,0 +1,235 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// defaultsLayer is one manifest defaults entry that applies to a component
+// config file
+type defaultsLayer struct {
+	key   string // manifest defaults key, e.g. "switch" or "switch-0"
+	patch map[string]interface{}
+}
+
+// componentDefaults returns the manifest defaults that apply to a component
+// config file, lowest priority first: those of its type ("switch" for
+// switch-0), then those of the file itself. Values are round-tripped through
+// JSON so they compare like decoded configs.
+func (sm *SyncManager) componentDefaults(component string) []defaultsLayer {
+	return manifestDefaults(sm.manifest, component)
+}
+
+// manifestDefaults returns the defaults of a given manifest that apply to a
+// component config file, like componentDefaults
+func manifestDefaults(manifest *storage.Manifest, component string) []defaultsLayer {
+	var layers []defaultsLayer
+	keys := []string{componentFileType(component)}
+	if keys[0] != component {
+		keys = append(keys, component)
+	}
+	for _, key := range keys {
+		patch, ok := manifest.Defaults[key]
+		if !ok || len(patch) == 0 {
+			continue
+		}
+		var normalized map[string]interface{}
+		if data, err := json.Marshal(patch); err == nil {
+			json.Unmarshal(data, &normalized)
+		}
+		layers = append(layers, defaultsLayer{key: key, patch: normalized})
+	}
+	return layers
+}
+
+// componentFileType is the component type of a config file name, e.g.
+// "switch" for switch-0
+func componentFileType(component string) string {
+	if i := strings.Index(component, "-"); i > 0 {
+		return component[:i]
+	}
+	return component
+}
+
+// mergedDefaults merges the layers of componentDefaults into one patch and
+// names its source for plans, e.g. "manifest defaults (switch, switch-0)".
+// The patch is nil if there are no layers.
+func mergedDefaults(layers []defaultsLayer) (interface{}, string) {
+	if len(layers) == 0 {
+		return nil, ""
+	}
+	var merged interface{} = map[string]interface{}{}
+	keys := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		merged = MergePatch(merged, layer.patch)
+		keys = append(keys, layer.key)
+	}
+	return merged, fmt.Sprintf("manifest defaults (%s)", strings.Join(keys, ", "))
+}
+
+// InheritanceLayer is the value one layer sets for a field
+type InheritanceLayer struct {
+	Source string      `json:"source"` // e.g. "configs/switch-0.json" or "manifest defaults (switch)"
+	Value  interface{} `json:"value"`  // nil if the layer removes the field
+}
+
+// InheritedField is a config field set by manifest defaults or a device
+// patch, with every layer that sets it, lowest priority first
+type InheritedField struct {
+	Component string             `json:"component"`
+	Path      string             `json:"path"`
+	Effective interface{}        `json:"effective"` // nil if the field is removed
+	Layers    []InheritanceLayer `json:"layers"`
+}
+
+// ConfigInheritance reports, for one device, every component config field
+// that manifest defaults or a merge patch set, with the chain of layers that
+// produce the effective value: the pulled config file, the defaults of the
+// component type, the defaults of the config file, then the device's
+// configs/<component>.patch.json. Fields only in the config file are left
+// out. Values are shown before template rendering.
+func (sm *SyncManager) ConfigInheritance(deviceRef string) ([]InheritedField, error) {
+	device := sm.findDevice(deviceRef)
+	if device == nil {
+		return nil, fmt.Errorf("device %s not found in manifest", deviceRef)
+	}
+
+	components, err := sm.deviceStorage.ListComponentConfigs(device.Folder)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []InheritedField
+	for _, component := range components {
+		data, err := sm.deviceStorage.LoadComponentConfig(device.Folder, component)
+		if err != nil {
+			return nil, err
+		}
+		var config interface{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s config: %w", component, err)
+		}
+		effective, patch, err := sm.loadDesiredConfig(*device, component)
+		if err != nil {
+			return nil, err
+		}
+
+		type overlay struct {
+			source string
+			patch  interface{}
+		}
+		var layers []overlay
+		for _, layer := range sm.componentDefaults(component) {
+			layers = append(layers, overlay{fmt.Sprintf("manifest defaults (%s)", layer.key), layer.patch})
+		}
+		if patch != nil {
+			layers = append(layers, overlay{"configs/" + component + storage.ComponentPatchSuffix, patch})
+		}
+		if len(layers) == 0 {
+			continue
+		}
+
+		// Every leaf path any overlay touches
+		paths := make(map[string]bool)
+		for _, layer := range layers {
+			collectPatchPaths(layer.patch, "", paths)
+		}
+		sorted := make([]string, 0, len(paths))
+		for path := range paths {
+			sorted = append(sorted, path)
+		}
+		sort.Strings(sorted)
+
+		file := "configs/" + component + ".json"
+		for _, path := range sorted {
+			field := InheritedField{Component: component, Path: path}
+			field.Effective, _ = lookupPath(effective, path)
+			if value, ok := lookupPath(config, path); ok {
+				field.Layers = append(field.Layers, InheritanceLayer{Source: file, Value: value})
+			}
+			for _, layer := range layers {
+				if value, ok := lookupPath(layer.patch, path); ok {
+					field.Layers = append(field.Layers, InheritanceLayer{Source: layer.source, Value: value})
+				}
+			}
+			fields = append(fields, field)
+		}
+	}
+
+	return fields, nil
+}
+
+// collectPatchPaths adds the dotted path of every leaf of a merge patch,
+// including null leaves
+func collectPatchPaths(patch interface{}, prefix string, paths map[string]bool) {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		if prefix != "" {
+			paths[prefix] = true
+		}
+		return
+	}
+	for key, value := range patchMap {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			collectPatchPaths(nested, path, paths)
+			continue
+		}
+		paths[path] = true
+	}
+}
+
+// lookupPath returns the value at a dotted path. A null in a merge patch is
+// returned as a nil value that is present.
+func lookupPath(value interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// FormatInheritance renders an inheritance report for terminal output, one
+// line per layer under each field, marking the layer that wins (the last)
+func FormatInheritance(fields []InheritedField) string {
+	if len(fields) == 0 {
+		return "No fields set by manifest defaults or patches\n"
+	}
+	var b strings.Builder
+	for _, field := range fields {
+		fmt.Fprintf(&b, "%s.%s = %s\n", field.Component, field.Path, formatInheritedValue(field.Effective))
+		for i, layer := range field.Layers {
+			marker := " "
+			if i == len(field.Layers)-1 {
+				marker = "*"
+			}
+			fmt.Fprintf(&b, "  %s %s: %s\n", marker, layer.Source, formatInheritedValue(layer.Value))
+		}
+	}
+	return b.String()
+}
+
+// formatInheritedValue renders a value as compact JSON, "(removed)" for nil
+func formatInheritedValue(value interface{}) string {
+	if value == nil {
+		return "(removed)"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,61 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// SetDeviceCredentials sets the credentials for a single device, taking
+// precedence over the secret store and the credentials set with SetDeviceAuth
+func (sm *SyncManager) SetDeviceCredentials(deviceRef, username, password string) error {
+	device := sm.findDevice(deviceRef)
+	if device == nil {
+		return fmt.Errorf("device %s not found in manifest", deviceRef)
+	}
+
+	sm.credentialsMu.Lock()
+	defer sm.credentialsMu.Unlock()
+	if sm.deviceAuth == nil {
+		sm.deviceAuth = make(map[string]*shelly.AuthConfig)
+	}
+	sm.deviceAuth[device.DeviceID] = &shelly.AuthConfig{Username: username, Password: password}
+
+	return nil
+}
+
+// deviceCredentials looks up the credentials of the manifest device at
+// deviceIP: those set with SetDeviceCredentials, else the secret store
+// entries <folder>.auth.password and <folder>.auth.username. nil falls back
+// to the credentials set with SetDeviceAuth.
+func (sm *SyncManager) deviceCredentials(deviceIP string) *shelly.AuthConfig {
+	device := sm.manifest.GetDeviceByIP(deviceIP)
+	if device == nil {
+		return nil
+	}
+
+	sm.credentialsMu.Lock()
+	defer sm.credentialsMu.Unlock()
+
+	if auth, ok := sm.deviceAuth[device.DeviceID]; ok {
+		return auth
+	}
+
+	if sm.secretStore == nil {
+		return nil
+	}
+	if sm.storedSecrets == nil {
+		stored, err := sm.secretStore.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to load device credentials: %v\n", err)
+			return nil
+		}
+		sm.storedSecrets = stored
+	}
+	password, ok := sm.storedSecrets[device.Folder+".auth.password"]
+	if !ok {
+		return nil
+	}
+	return &shelly.AuthConfig{Username: sm.storedSecrets[device.Folder+".auth.username"], Password: password}
+}
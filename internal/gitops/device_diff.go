@@ -0,0 +1,264 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// identityFields are the config fields that differ between any two devices
+// by design, as "<component>.<path>" entries like volatile fields
+var identityFields = []string{
+	"*.name",
+	"sys.device.name",
+	"sys.device.mac",
+	"sys.device.fw_id",
+	"wifi.ap.ssid",
+	"wifi.sta.ip",
+	"wifi.sta1.ip",
+	"eth.ip",
+	"mqtt.client_id",
+	"mqtt.topic_prefix",
+}
+
+// DeviceDifference is one difference between two devices' configuration
+type DeviceDifference struct {
+	Component string `json:"component"` // config file, e.g. switch-0, or "script <name>"
+	Path      string `json:"path"`      // dotted path; empty for the whole component
+
+	Left  interface{} `json:"left"`
+	Right interface{} `json:"right"`
+
+	// Missing is "left" or "right" if the component or field exists on one
+	// side only
+	Missing string `json:"missing,omitempty"`
+}
+
+// DiffDevices compares the configuration of two devices in the repository,
+// component by component, to explain why they behave differently. Configs
+// are compared as a push would apply them, with manifest defaults and merge
+// patches, before template rendering; scripts are compared by name. Fields
+// that identify a device, like names, MAC and IP addresses or MQTT client
+// IDs, and volatile fields are left out.
+func (sm *SyncManager) DiffDevices(leftRef, rightRef string) ([]DeviceDifference, error) {
+	left := sm.findDevice(leftRef)
+	if left == nil {
+		return nil, fmt.Errorf("device %s not found in manifest", leftRef)
+	}
+	right := sm.findDevice(rightRef)
+	if right == nil {
+		return nil, fmt.Errorf("device %s not found in manifest", rightRef)
+	}
+	volatile, err := storage.LoadVolatileFields(sm.repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	leftComponents, err := sm.deviceStorage.ListComponentConfigs(left.Folder)
+	if err != nil {
+		return nil, err
+	}
+	rightComponents, err := sm.deviceStorage.ListComponentConfigs(right.Folder)
+	if err != nil {
+		return nil, err
+	}
+
+	onSide := [2]map[string]bool{make(map[string]bool), make(map[string]bool)}
+	for i, components := range [][]string{leftComponents, rightComponents} {
+		for _, component := range components {
+			onSide[i][component] = true
+		}
+	}
+
+	var diffs []DeviceDifference
+	for _, component := range unionSorted(leftComponents, rightComponents) {
+		// Cloud is read-only and script configs are compared as scripts
+		if component == "cloud" || strings.HasPrefix(component, "script-") {
+			continue
+		}
+		var configs [2]interface{}
+		var present [2]bool
+		for i, device := range []*storage.Device{left, right} {
+			if !onSide[i][component] {
+				continue
+			}
+			config, _, err := sm.loadDesiredConfig(*device, component)
+			if err != nil {
+				return nil, err
+			}
+			stripVolatile(volatile, component, config)
+			configs[i], present[i] = stripFields(identityFields, component, config), true
+		}
+		if !present[0] || !present[1] {
+			diffs = append(diffs, DeviceDifference{Component: component, Left: configs[0], Right: configs[1], Missing: missingSide(present)})
+			continue
+		}
+		diffDeviceFields(component, "", configs[0], configs[1], &diffs)
+	}
+
+	scriptDiffs, err := sm.diffDeviceScripts(*left, *right)
+	if err != nil {
+		return nil, err
+	}
+	return append(diffs, scriptDiffs...), nil
+}
+
+// diffDeviceFields records every leaf that differs between two configs
+func diffDeviceFields(component, path string, left, right interface{}, diffs *[]DeviceDifference) {
+	leftMap, leftIsMap := left.(map[string]interface{})
+	rightMap, rightIsMap := right.(map[string]interface{})
+	if !leftIsMap || !rightIsMap {
+		if !reflect.DeepEqual(left, right) {
+			*diffs = append(*diffs, DeviceDifference{Component: component, Path: path, Left: left, Right: right})
+		}
+		return
+	}
+
+	keys := make(map[string]bool, len(leftMap)+len(rightMap))
+	for key := range leftMap {
+		keys[key] = true
+	}
+	for key := range rightMap {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+		leftValue, inLeft := leftMap[key]
+		rightValue, inRight := rightMap[key]
+		if !inLeft || !inRight {
+			*diffs = append(*diffs, DeviceDifference{Component: component, Path: fieldPath, Left: leftValue, Right: rightValue, Missing: missingSide([2]bool{inLeft, inRight})})
+			continue
+		}
+		diffDeviceFields(component, fieldPath, leftValue, rightValue, diffs)
+	}
+}
+
+// diffDeviceScripts compares the scripts of two devices by name: their
+// presence, enable flag and code
+func (sm *SyncManager) diffDeviceScripts(left, right storage.Device) ([]DeviceDifference, error) {
+	type script struct {
+		enable bool
+		code   string
+	}
+	var scripts [2]map[string]script
+	for i, device := range []storage.Device{left, right} {
+		metas, err := sm.deviceStorage.ListScripts(device.Folder)
+		if err != nil {
+			return nil, err
+		}
+		scripts[i] = make(map[string]script, len(metas))
+		for _, meta := range metas {
+			code, err := sm.deviceStorage.LoadScript(device.Folder, meta.ID)
+			if err != nil {
+				return nil, err
+			}
+			scripts[i][meta.Name] = script{enable: meta.Enable, code: code}
+		}
+	}
+
+	names := make([]string, 0, len(scripts[0])+len(scripts[1]))
+	for _, side := range scripts {
+		for name := range side {
+			names = append(names, name)
+		}
+	}
+
+	var diffs []DeviceDifference
+	for _, name := range unionSorted(names) {
+		leftScript, inLeft := scripts[0][name]
+		rightScript, inRight := scripts[1][name]
+		component := "script " + name
+		switch {
+		case !inLeft || !inRight:
+			diffs = append(diffs, DeviceDifference{Component: component, Missing: missingSide([2]bool{inLeft, inRight})})
+		default:
+			if leftScript.enable != rightScript.enable {
+				diffs = append(diffs, DeviceDifference{Component: component, Path: "enable", Left: leftScript.enable, Right: rightScript.enable})
+			}
+			if leftScript.code != rightScript.code {
+				diffs = append(diffs, DeviceDifference{Component: component, Path: "code", Left: scriptSummary(leftScript.code), Right: scriptSummary(rightScript.code)})
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// scriptSummary describes script code by its size, as whole scripts don't
+// fit a diff line
+func scriptSummary(code string) string {
+	return fmt.Sprintf("%d lines, %d bytes", strings.Count(code, "\n")+1, len(code))
+}
+
+// missingSide names the side a component or field is missing from
+func missingSide(present [2]bool) string {
+	switch {
+	case !present[0]:
+		return "left"
+	case !present[1]:
+		return "right"
+	}
+	return ""
+}
+
+// unionSorted returns the distinct strings of the given lists, sorted
+func unionSorted(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var union []string
+	for _, list := range lists {
+		for _, s := range list {
+			if !seen[s] {
+				seen[s] = true
+				union = append(union, s)
+			}
+		}
+	}
+	sort.Strings(union)
+	return union
+}
+
+// FormatDeviceDiff renders the differences between two devices for terminal
+// output, one line per difference
+func FormatDeviceDiff(leftName, rightName string, diffs []DeviceDifference) string {
+	if len(diffs) == 0 {
+		return fmt.Sprintf("%s and %s are configured the same\n", leftName, rightName)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s <-> %s\n", leftName, rightName)
+	for _, diff := range diffs {
+		name := diff.Component
+		if diff.Path != "" {
+			name += "." + diff.Path
+		}
+		switch diff.Missing {
+		case "left":
+			fmt.Fprintf(&b, "  %s: only on %s\n", name, rightName)
+		case "right":
+			fmt.Fprintf(&b, "  %s: only on %s\n", name, leftName)
+		default:
+			fmt.Fprintf(&b, "  %s: %s <-> %s\n", name, formatDiffValue(diff.Left), formatDiffValue(diff.Right))
+		}
+	}
+	return b.String()
+}
+
+// formatDiffValue renders a value as compact JSON
+func formatDiffValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,35 @@
+package gitops
+
+import (
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// SetTimeouts sets the connect and request timeouts of calls to every device;
+// timeout and connect_timeout in the manifest override them per device
+func (sm *SyncManager) SetTimeouts(timeouts shelly.Timeouts) {
+	sm.shellyClient.SetTimeouts(timeouts)
+}
+
+// deviceTimeouts returns the manifest timeouts of the device at deviceIP; it
+// matches the shelly.TimeoutFunc signature
+func (sm *SyncManager) deviceTimeouts(deviceIP string) shelly.Timeouts {
+	device := sm.manifest.GetDeviceByIP(deviceIP)
+	if device == nil {
+		return shelly.Timeouts{}
+	}
+	// Validated when the manifest was loaded
+	request, connect, _ := device.RPCTimeouts()
+	return shelly.Timeouts{Connect: connect, Request: request}
+}
+
+// devicePacing returns the manifest pacing of the device at deviceIP; it
+// matches the shelly.PacingFunc signature
+func (sm *SyncManager) devicePacing(deviceIP string) shelly.Pacing {
+	device := sm.manifest.GetDeviceByIP(deviceIP)
+	if device == nil {
+		return shelly.Pacing{}
+	}
+	// Validated when the manifest was loaded
+	serial, delay, _ := device.CallPacing()
+	return shelly.Pacing{Serial: serial, Delay: delay}
+}
@@ -0,0 +1,23 @@
+package gitops
+
+import (
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// SetDeviceTLS sets how the certificates of devices marked https: true in the
+// manifest are verified, e.g. against the CA that signed them
+func (sm *SyncManager) SetDeviceTLS(opts shelly.TLSOptions) error {
+	config, err := shelly.NewTLSConfig(opts)
+	if err != nil {
+		return err
+	}
+	sm.shellyClient.SetTLSConfig(config)
+	return nil
+}
+
+// deviceHTTPS reports whether the manifest device at deviceIP is called over
+// HTTPS; it matches the shelly.HTTPSFunc signature
+func (sm *SyncManager) deviceHTTPS(deviceIP string) bool {
+	device := sm.manifest.GetDeviceByIP(deviceIP)
+	return device != nil && device.HTTPS
+}
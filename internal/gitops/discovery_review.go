@@ -0,0 +1,162 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/discovery"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// ProposeDiscovered is the review mode of DiscoverAndAddWithOptions: instead
+// of changing the manifest it writes discovery-proposals.yaml with the
+// devices that would be added and the manifest devices whose IP, MAC or
+// network changed, for AcceptDiscovered to apply after review. The file is
+// replaced on every run.
+func (sm *SyncManager) ProposeDiscovered(ctx context.Context, provider discovery.Provider, opts DiscoverOptions) (*storage.DiscoveryProposals, error) {
+	start := time.Now()
+	devices, err := provider.DiscoverDevices(ctx, opts.FilterPattern)
+	sm.timings.record(StageDiscovery, "DiscoverDevices", "", time.Since(start))
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+
+	proposals := &storage.DiscoveryProposals{GeneratedAt: time.Now().UTC().Truncate(time.Second)}
+	for _, deviceInfo := range devices {
+		if !deviceInfo.IsShelly() || !deviceInfo.OnNetwork(opts.Network) {
+			continue
+		}
+
+		shellyInfo, err := sm.shellyClient.GetDeviceInfo(ctx, deviceInfo.IPAddress)
+		if err != nil {
+			// Skip devices we can't communicate with
+			continue
+		}
+
+		existing := sm.manifest.GetDevice(shellyInfo.ID)
+		if existing == nil {
+			if other := sm.manifest.GetDeviceByIP(deviceInfo.IPAddress); other != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s answers as %s but the manifest has %s there; use ReplaceDevice if the hardware was swapped\n",
+					deviceInfo.IPAddress, shellyInfo.ID, other.DeviceID)
+				continue
+			}
+			proposals.Proposals = append(proposals.Proposals, storage.DiscoveryProposal{
+				ID:     shellyInfo.ID,
+				Action: storage.ProposalAdd,
+				Device: newDiscoveredDevice(deviceInfo, shellyInfo),
+			})
+			continue
+		}
+
+		updated := *existing
+		var changes []string
+		update := func(field string, current *string, discovered string) {
+			if discovered != "" && *current != discovered {
+				changes = append(changes, fmt.Sprintf("%s: %s -> %s", field, *current, discovered))
+				*current = discovered
+			}
+		}
+		update("ip_address", &updated.IPAddress, deviceInfo.IPAddress)
+		update("mac_address", &updated.MACAddress, deviceInfo.MACAddress)
+		update("network", &updated.Network, deviceInfo.Network)
+		if deviceInfo.Network != "" && updated.VLAN != deviceInfo.VLAN {
+			changes = append(changes, fmt.Sprintf("vlan: %d -> %d", updated.VLAN, deviceInfo.VLAN))
+			updated.VLAN = deviceInfo.VLAN
+		}
+		if len(changes) > 0 {
+			proposals.Proposals = append(proposals.Proposals, storage.DiscoveryProposal{
+				ID:      shellyInfo.ID,
+				Action:  storage.ProposalUpdate,
+				Device:  updated,
+				Changes: changes,
+			})
+		}
+	}
+
+	sort.Slice(proposals.Proposals, func(i, j int) bool { return proposals.Proposals[i].ID < proposals.Proposals[j].ID })
+
+	if err := storage.SaveDiscoveryProposals(sm.repoPath, proposals); err != nil {
+		return nil, err
+	}
+	return proposals, nil
+}
+
+// AcceptDiscovered applies the proposals with the given IDs from
+// discovery-proposals.yaml, or all of them if ids is empty. Added devices
+// get a folder and their initial pull like with DiscoverAndAddWithOptions;
+// updates only change the address and network fields of the manifest entry.
+// Accepted proposals are removed from the file, which is deleted once empty.
+func (sm *SyncManager) AcceptDiscovered(ctx context.Context, ids []string, opts DiscoverOptions) ([]storage.Device, error) {
+	proposals, err := storage.LoadDiscoveryProposals(sm.repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if proposals == nil || len(proposals.Proposals) == 0 {
+		return nil, fmt.Errorf("no discovery proposals to accept")
+	}
+
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[strings.ToLower(id)] = true
+	}
+	for id := range selected {
+		found := false
+		for _, proposal := range proposals.Proposals {
+			if strings.ToLower(proposal.ID) == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no discovery proposal for %s", id)
+		}
+	}
+
+	var accepted []storage.Device
+	var remaining []storage.DiscoveryProposal
+	for _, proposal := range proposals.Proposals {
+		if len(selected) > 0 && !selected[strings.ToLower(proposal.ID)] {
+			remaining = append(remaining, proposal)
+			continue
+		}
+
+		device := proposal.Device
+		switch proposal.Action {
+		case storage.ProposalAdd:
+			if sm.manifest.GetDevice(device.DeviceID) != nil {
+				return accepted, fmt.Errorf("%s is already in the manifest; run discovery again", device.DeviceID)
+			}
+			device.LastSync = time.Now()
+			sm.adoptDevice(ctx, device, opts)
+		case storage.ProposalUpdate:
+			// Only take the discovered fields; the entry may have been edited since
+			current := sm.manifest.GetDevice(device.DeviceID)
+			if current == nil {
+				return accepted, fmt.Errorf("%s is no longer in the manifest; run discovery again", device.DeviceID)
+			}
+			current.IPAddress = device.IPAddress
+			current.MACAddress = device.MACAddress
+			current.Network = device.Network
+			current.VLAN = device.VLAN
+			device = *current
+			sm.manifest.AddDevice(device)
+		default:
+			return accepted, fmt.Errorf("proposal %s has unknown action %q", proposal.ID, proposal.Action)
+		}
+		accepted = append(accepted, device)
+	}
+
+	if err := sm.manifest.Save(); err != nil {
+		return accepted, fmt.Errorf("failed to save manifest: %w", err)
+	}
+	proposals.Proposals = remaining
+	if err := storage.SaveDiscoveryProposals(sm.repoPath, proposals); err != nil {
+		return accepted, err
+	}
+
+	return accepted, nil
+}
@@ -0,0 +1,178 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// Drift kinds
+const (
+	DriftModified      = "modified"       // component differs between device and repository
+	DriftMissingLocal  = "missing_local"  // component exists on the device but not in the repository
+	DriftMissingDevice = "missing_device" // component is in the repository but not on the device
+	DriftPolicy        = "policy"         // component violates a fleet policy (e.g. cloud enabled)
+)
+
+// ComponentDrift describes a single component that differs from the repository
+type ComponentDrift struct {
+	Component string `json:"component"` // config file name, e.g. switch-0
+	Kind      string `json:"kind"`
+}
+
+// DriftReport is the result of comparing one device against the repository
+type DriftReport struct {
+	DeviceID   string           `json:"device_id"`
+	Components []ComponentDrift `json:"components,omitempty"`
+	Error      error            `json:"-"`
+}
+
+// Drifted reports whether the device differs from the repository
+func (r DriftReport) Drifted() bool {
+	return len(r.Components) > 0
+}
+
+// CheckDrift compares the live component configuration of each selected device
+// with its configs/ folder. Templated fields in local files are ignored.
+func (sm *SyncManager) CheckDrift(ctx context.Context, deviceFilter []string) ([]DriftReport, error) {
+	devices := sm.SelectDevices(deviceFilter)
+	reports := make([]DriftReport, 0, len(devices))
+
+	for _, device := range devices {
+		reports = append(reports, sm.checkDeviceDrift(ctx, device))
+	}
+
+	return reports, nil
+}
+
+// checkDeviceDrift compares a single device with its configs/ folder
+func (sm *SyncManager) checkDeviceDrift(ctx context.Context, device storage.Device) DriftReport {
+	report := DriftReport{DeviceID: device.DeviceID}
+
+	shellyConfig, err := sm.shellyClient.GetShellyConfig(ctx, device.IPAddress)
+	if err != nil {
+		report.Error = fmt.Errorf("failed to get shelly config: %w", err)
+		return report
+	}
+
+	var configMap map[string]json.RawMessage
+	if err := json.Unmarshal(shellyConfig, &configMap); err != nil {
+		report.Error = fmt.Errorf("failed to parse shelly config: %w", err)
+		return report
+	}
+
+	localComponents, err := sm.deviceStorage.ListComponentConfigs(device.Folder)
+	if err != nil {
+		report.Error = err
+		return report
+	}
+	volatile, err := storage.LoadVolatileFields(sm.repoPath)
+	if err != nil {
+		report.Error = err
+		return report
+	}
+	remaining := make(map[string]bool, len(localComponents))
+	for _, component := range localComponents {
+		remaining[component] = true
+	}
+
+	for componentKey, componentConfig := range configMap {
+		if componentKey == "cloud" && sm.requireCloudDisabled && cloudConfigEnabled(componentConfig) {
+			report.Components = append(report.Components, ComponentDrift{Component: "cloud", Kind: DriftPolicy})
+		}
+
+		// Same exclusions as pull: cloud is read-only and scripts are stored separately
+		if componentKey == "cloud" || strings.HasPrefix(componentKey, "script:") {
+			continue
+		}
+
+		filename := strings.ReplaceAll(componentKey, ":", "-")
+		if !remaining[filename] {
+			report.Components = append(report.Components, ComponentDrift{Component: filename, Kind: DriftMissingLocal})
+			continue
+		}
+		delete(remaining, filename)
+
+		// Compare what a push would apply, i.e. including the merge patch
+		localConfig, _, err := sm.loadDesiredConfig(device, filename)
+		if err != nil {
+			report.Error = err
+			return report
+		}
+
+		var remote interface{}
+		if err := json.Unmarshal(componentConfig, &remote); err != nil {
+			report.Error = fmt.Errorf("failed to parse device %s config: %w", componentKey, err)
+			return report
+		}
+
+		// Fields the device changes on its own aren't drift
+		stripVolatile(volatile, filename, localConfig)
+		remote = stripVolatile(volatile, filename, remote)
+		if !reflect.DeepEqual(localConfig, PreserveTemplates(localConfig, remote)) {
+			report.Components = append(report.Components, ComponentDrift{Component: filename, Kind: DriftModified})
+		}
+	}
+
+	for component := range remaining {
+		report.Components = append(report.Components, ComponentDrift{Component: component, Kind: DriftMissingDevice})
+	}
+
+	sort.Slice(report.Components, func(i, j int) bool {
+		return report.Components[i].Component < report.Components[j].Component
+	})
+
+	return report
+}
+
+// WatchConfigChanges subscribes to a device's event stream and calls onChange
+// whenever the device reports a config_changed event. It returns when ctx is
+// cancelled or the connection drops; callers are expected to reconnect.
+func (sm *SyncManager) WatchConfigChanges(ctx context.Context, device storage.Device, onChange func()) error {
+	return sm.shellyClient.SubscribeEvents(ctx, device.IPAddress, func(n shelly.Notification) {
+		events, err := n.Events()
+		if err != nil {
+			return
+		}
+		for _, event := range events {
+			if event.Event == "config_changed" {
+				onChange()
+				return
+			}
+		}
+	})
+}
+
+// CommitAll stages and commits every change in the working tree
+// It returns an empty hash if there was nothing to commit
+func (sm *SyncManager) CommitAll(message string) (string, error) {
+	hasChanges, err := sm.repo.HasChanges()
+	if err != nil {
+		return "", fmt.Errorf("failed to check repository status: %w", err)
+	}
+	if !hasChanges {
+		return "", nil
+	}
+
+	if err := sm.repo.AddAll(); err != nil {
+		return "", err
+	}
+	return sm.repo.Commit(message)
+}
+
+// PushBackup pushes all branches and tags to a secondary remote (e.g. a
+// self-hosted Gitea mirror), so the configuration history survives the loss
+// of the primary hosting provider. The remote must already be configured
+// (git remote add backup <url>).
+func (sm *SyncManager) PushBackup(remoteName string) error {
+	if !sm.repo.HasRemote(remoteName) {
+		return fmt.Errorf("backup remote %q is not configured; add it with 'git remote add %s <url>'", remoteName, remoteName)
+	}
+	return sm.repo.PushAll(remoteName)
+}
@@ -0,0 +1,202 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// Drift policies, what to do when a component drifts
+const (
+	PolicyNotify     = "notify"      // only report it (default)
+	PolicyAutoRevert = "auto-revert" // push the repository config back
+	PolicyAutoAccept = "auto-accept" // pull the device config and commit it
+)
+
+// DriftPolicies maps component types ("switch") or config files ("switch-0")
+// to a drift policy. A config file entry takes precedence over its type;
+// components without an entry get PolicyNotify.
+type DriftPolicies map[string]string
+
+// Validate checks that every entry names a known policy
+func (p DriftPolicies) Validate() error {
+	for component, policy := range p {
+		switch policy {
+		case PolicyNotify, PolicyAutoRevert, PolicyAutoAccept:
+		default:
+			return fmt.Errorf("unknown drift policy %q for %s (want %s, %s or %s)", policy, component, PolicyNotify, PolicyAutoRevert, PolicyAutoAccept)
+		}
+	}
+	return nil
+}
+
+// For returns the policy of a config file
+func (p DriftPolicies) For(component string) string {
+	if policy, ok := p[component]; ok {
+		return policy
+	}
+	if policy, ok := p[componentFileType(component)]; ok {
+		return policy
+	}
+	return PolicyNotify
+}
+
+// Select narrows drift reports to the components with the given policy and
+// returns them with the policy's entries, the allow-list for ReconcileDrift
+// or AcceptDrift. Reports left without components are dropped.
+func (p DriftPolicies) Select(reports []DriftReport, policy string) ([]DriftReport, []string) {
+	var allowed []string
+	for component, entry := range p {
+		if entry == policy {
+			allowed = append(allowed, component)
+		}
+	}
+	sort.Strings(allowed)
+
+	var selected []DriftReport
+	for _, report := range reports {
+		narrowed := DriftReport{DeviceID: report.DeviceID}
+		for _, drift := range report.Components {
+			if p.For(drift.Component) == policy {
+				narrowed.Components = append(narrowed.Components, drift)
+			}
+		}
+		if narrowed.Drifted() {
+			selected = append(selected, narrowed)
+		}
+	}
+	return selected, allowed
+}
+
+// AcceptResult is the outcome of accepting the drift of one device
+type AcceptResult struct {
+	DeviceID   string
+	DeviceName string
+
+	// Accepted lists the config files updated from the device
+	Accepted []string
+
+	// Skipped is the drift left alone: components outside the allow-list,
+	// components missing on the device, and components whose desired config
+	// also comes from manifest defaults or a merge patch, which the device
+	// config can't simply replace
+	Skipped []ComponentDrift
+
+	Error error
+}
+
+// AcceptDrift is the opposite of ReconcileDrift: it saves the device config
+// of the drifted components on the allow-list (component types or config
+// files) into their config files, like a pull of just those components, and
+// commits them. Components new on the device are added. It returns the
+// results of the drifted devices and the commit hash ("" if nothing changed).
+func (sm *SyncManager) AcceptDrift(ctx context.Context, reports []DriftReport, components []string) ([]AcceptResult, string, error) {
+	if len(components) == 0 {
+		return nil, "", fmt.Errorf("no components are allowed to be accepted")
+	}
+
+	release, err := sm.LockRepo("accept")
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	sm.redactionRules, err = storage.LoadRedactionRules(sm.repoPath)
+	if err != nil {
+		return nil, "", err
+	}
+	sm.volatileFields, err = storage.LoadVolatileFields(sm.repoPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var results []AcceptResult
+	var changed []string
+	for _, report := range reports {
+		if !report.Drifted() {
+			continue
+		}
+		device := sm.findDevice(report.DeviceID)
+		if device == nil {
+			continue
+		}
+
+		result := AcceptResult{DeviceID: device.DeviceID, DeviceName: device.Name}
+		var accept []string
+		for _, drift := range report.Components {
+			if (drift.Kind == DriftModified || drift.Kind == DriftMissingLocal) &&
+				remediationAllowed(drift.Component, components) && !sm.hasConfigOverlays(*device, drift.Component) {
+				accept = append(accept, drift.Component)
+				continue
+			}
+			result.Skipped = append(result.Skipped, drift)
+		}
+
+		if len(accept) > 0 {
+			result.Accepted, result.Error = sm.acceptDeviceConfigs(ctx, *device, accept)
+			for _, component := range result.Accepted {
+				changed = append(changed, path.Join(device.Folder, "configs", component+".json"))
+			}
+		}
+		results = append(results, result)
+	}
+
+	if len(changed) == 0 {
+		return results, "", nil
+	}
+	if err := sm.repo.StagePaths(changed); err != nil {
+		return results, "", err
+	}
+	hash, err := sm.repo.Commit(fmt.Sprintf("Accept drift in %d component config(s)", len(changed)))
+	if err != nil {
+		return results, "", err
+	}
+	return results, hash, nil
+}
+
+// hasConfigOverlays reports whether manifest defaults or a merge patch apply
+// to a component config file
+func (sm *SyncManager) hasConfigOverlays(device storage.Device, component string) bool {
+	if len(sm.componentDefaults(component)) > 0 {
+		return true
+	}
+	_, patch, err := sm.loadDesiredConfig(device, component)
+	return err != nil || patch != nil
+}
+
+// acceptDeviceConfigs saves the device config of the given components and
+// returns those saved
+func (sm *SyncManager) acceptDeviceConfigs(ctx context.Context, device storage.Device, components []string) ([]string, error) {
+	defer sm.InvalidateDeviceCache(device.DeviceID)
+
+	shellyConfig, err := sm.shellyClient.GetShellyConfig(ctx, device.IPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shelly config: %w", err)
+	}
+	var configMap map[string]json.RawMessage
+	if err := json.Unmarshal(shellyConfig, &configMap); err != nil {
+		return nil, fmt.Errorf("failed to parse shelly config: %w", err)
+	}
+	keys := make(map[string]string, len(configMap))
+	for componentKey := range configMap {
+		keys[strings.ReplaceAll(componentKey, ":", "-")] = componentKey
+	}
+
+	var accepted []string
+	for _, component := range components {
+		componentKey, ok := keys[component]
+		if !ok {
+			return accepted, fmt.Errorf("component %s is no longer on the device", component)
+		}
+		if _, err := sm.savePulledConfig(device, componentKey, configMap[componentKey]); err != nil {
+			return accepted, err
+		}
+		accepted = append(accepted, component)
+	}
+	return accepted, nil
+}
@@ -0,0 +1,76 @@
+package gitops
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// SelectDevices returns the manifest devices matching any of the given filters
+// An empty filter list selects all devices. Each filter is either a device ID or
+// name (case-insensitive), or a qualified match:
+//
+//	vlan:<name|id>     devices on the given network name or VLAN ID
+//	network:<name|id>  same as vlan:
+//	tag:<name>         devices carrying the given manifest tag
+//	area:<name>        devices whose manifest area matches (case-insensitive)
+//	gen:<n>            devices of the given generation
+//	model:<model>      devices of the given model, e.g. SNSW-001X16EU
+//	app:<app>          devices of the given app type, e.g. Plus1PM
+//	firmware:<version> devices running the given firmware version
+//
+// Generation, app and firmware come from the last pull, so no device is
+// contacted.
+func (sm *SyncManager) SelectDevices(filters []string) []storage.Device {
+	if len(filters) == 0 {
+		return sm.manifest.Devices
+	}
+
+	var selected []storage.Device
+	for _, device := range sm.manifest.Devices {
+		for _, filter := range filters {
+			if matchesDeviceFilter(device, filter) {
+				selected = append(selected, device)
+				break
+			}
+		}
+	}
+
+	return selected
+}
+
+// matchesDeviceFilter checks a single device against a single filter
+func matchesDeviceFilter(device storage.Device, filter string) bool {
+	if key, value, ok := strings.Cut(filter, ":"); ok {
+		switch strings.ToLower(key) {
+		case "vlan", "network":
+			return strings.EqualFold(device.Network, value) ||
+				(device.VLAN != 0 && strconv.Itoa(device.VLAN) == value)
+		case "tag":
+			return device.HasTag(value)
+		case "area":
+			return device.Area != "" && strings.EqualFold(device.Area, value)
+		case "gen":
+			return device.Generation != 0 && strconv.Itoa(device.Generation) == value
+		case "model":
+			return device.Model != "" && strings.EqualFold(device.Model, value)
+		case "app":
+			return device.App != "" && strings.EqualFold(device.App, value)
+		case "firmware":
+			return device.Firmware != "" && strings.TrimPrefix(value, "v") == strings.TrimPrefix(device.Firmware, "v")
+		}
+	}
+
+	return strings.EqualFold(device.DeviceID, filter) || strings.EqualFold(device.Name, filter)
+}
+
+// findDevice returns the manifest device whose ID or name matches deviceRef (case-insensitive)
+func (sm *SyncManager) findDevice(deviceRef string) *storage.Device {
+	for i, device := range sm.manifest.Devices {
+		if strings.EqualFold(device.DeviceID, deviceRef) || strings.EqualFold(device.Name, deviceRef) {
+			return &sm.manifest.Devices[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// Firmware rollout defaults, used for fields the manifest's firmware_rollout
+// leaves out
+const (
+	defaultFirmwareChannel       = "stable"
+	defaultFirmwareCanary        = 1
+	defaultFirmwareVerifyMinutes = 15
+	defaultFirmwareBatchSize     = "25%"
+	defaultFirmwareUpdateTimeout = 10 * time.Minute
+)
+
+// FirmwareRolloutOptions configures a staged firmware update
+type FirmwareRolloutOptions struct {
+	Policy        *storage.FirmwarePolicy // nil uses the manifest's firmware_rollout (or the defaults)
+	DeviceFilter  []string
+	DryRun        bool          // plan the batches without updating
+	CheckInterval time.Duration // probe interval while devices update and during the canary gate
+	UpdateTimeout time.Duration // how long a device may take to come back on the new firmware (default 10m)
+
+	// OnBatch is called after each batch was updated and, for the canary
+	// batch, verified
+	OnBatch func(FirmwareBatchResult)
+}
+
+// FirmwareUpdateResult is the outcome of updating one device
+type FirmwareUpdateResult struct {
+	DeviceID string
+	Name     string
+	From     string
+	To       string
+	Error    error
+}
+
+// FirmwareBatchResult is the outcome of updating one batch of devices
+type FirmwareBatchResult struct {
+	Batch   string // "canary" or "batch N"
+	Updates []FirmwareUpdateResult
+	Error   error // why the rollout halted at this batch
+}
+
+// firmwareTarget is a device with the version it is updated to
+type firmwareTarget struct {
+	device  storage.Device
+	from    string
+	version string
+}
+
+// FirmwareRollout updates the firmware of the selected devices from the
+// policy's channel. Devices already running the newest version are left
+// alone. The canary devices go first and must all update and then stay
+// reachable without rebooting for the verify time; the remaining devices are
+// updated in batches, and the rollout halts after the batch in which more
+// devices failed than max_failures allows. Like a push, it fails during a
+// change freeze unless overridden.
+func (sm *SyncManager) FirmwareRollout(ctx context.Context, opts FirmwareRolloutOptions) ([]FirmwareBatchResult, error) {
+	policy := opts.Policy
+	if policy == nil {
+		policy = sm.manifest.Firmware
+	}
+	channel, batchSize, budget, err := resolveFirmwarePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	canaries := defaultFirmwareCanary
+	verifyMinutes := defaultFirmwareVerifyMinutes
+	var canaryTags []string
+	if policy != nil {
+		if policy.Canary > 0 {
+			canaries = policy.Canary
+		}
+		if policy.VerifyMinutes > 0 {
+			verifyMinutes = policy.VerifyMinutes
+		}
+		canaryTags = policy.CanaryTags
+	}
+	interval := opts.CheckInterval
+	if interval <= 0 {
+		interval = defaultRolloutCheckInterval
+	}
+	updateTimeout := opts.UpdateTimeout
+	if updateTimeout <= 0 {
+		updateTimeout = defaultFirmwareUpdateTimeout
+	}
+
+	if !opts.DryRun {
+		release, err := sm.LockRepo("firmware")
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		if err := sm.checkFreeze(); err != nil {
+			return nil, err
+		}
+	}
+
+	targets := sm.firmwareTargets(ctx, sm.SelectDevices(opts.DeviceFilter), channel, canaryTags)
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	if canaries > len(targets) {
+		canaries = len(targets)
+	}
+	batches := [][]firmwareTarget{targets[:canaries]}
+	rest := targets[canaries:]
+	perBatch := ringQuota(batchSize, len(rest))
+	if perBatch <= 0 {
+		perBatch = len(rest)
+	}
+	for len(rest) > 0 {
+		n := perBatch
+		if n > len(rest) {
+			n = len(rest)
+		}
+		batches = append(batches, rest[:n])
+		rest = rest[n:]
+	}
+
+	failures := &failureTracker{allowed: budget.allowed(len(targets))}
+	var completed []FirmwareBatchResult
+	for i, batch := range batches {
+		result := FirmwareBatchResult{Batch: "canary"}
+		if i > 0 {
+			result.Batch = fmt.Sprintf("batch %d", i)
+		}
+		result.Updates = sm.updateFirmwareBatch(ctx, batch, channel, opts.DryRun, updateTimeout, interval)
+
+		var failed []string
+		for _, update := range result.Updates {
+			if update.Error != nil {
+				failed = append(failed, update.Name)
+				failures.record()
+			}
+		}
+
+		switch {
+		case i == 0 && len(failed) > 0:
+			result.Error = fmt.Errorf("canary update failed on %s", strings.Join(failed, ", "))
+		case failures.exceeded():
+			result.Error = fmt.Errorf("%d devices failed to update, more than the %s allowed", failures.failures, budget)
+		case i == 0 && !opts.DryRun && len(batches) > 1:
+			devices := make([]storage.Device, 0, len(batch))
+			for _, target := range batch {
+				devices = append(devices, target.device)
+			}
+			if err := sm.waitRingHealthy(ctx, devices, time.Duration(verifyMinutes)*time.Minute, interval); err != nil {
+				result.Error = fmt.Errorf("canary: %w", err)
+			}
+		}
+
+		completed = append(completed, result)
+		if opts.OnBatch != nil {
+			opts.OnBatch(result)
+		}
+		if result.Error != nil {
+			return completed, fmt.Errorf("firmware rollout halted: %w", result.Error)
+		}
+	}
+
+	return completed, nil
+}
+
+// resolveFirmwarePolicy validates policy and fills in its defaults
+func resolveFirmwarePolicy(policy *storage.FirmwarePolicy) (string, FailureBudget, FailureBudget, error) {
+	channel, batchSize, maxFailures := defaultFirmwareChannel, defaultFirmwareBatchSize, "0"
+	if policy != nil {
+		if policy.Channel != "" {
+			channel = policy.Channel
+		}
+		if policy.BatchSize != "" {
+			batchSize = policy.BatchSize
+		}
+		if policy.MaxFailures != "" {
+			maxFailures = policy.MaxFailures
+		}
+	}
+
+	if channel != "stable" && channel != "beta" {
+		return "", FailureBudget{}, FailureBudget{}, fmt.Errorf("firmware_rollout: unknown channel %q; use stable or beta", channel)
+	}
+	size, err := ParseFailureBudget(batchSize)
+	if err != nil {
+		return "", FailureBudget{}, FailureBudget{}, fmt.Errorf("firmware_rollout: invalid batch_size %q", batchSize)
+	}
+	budget, err := ParseFailureBudget(maxFailures)
+	if err != nil {
+		return "", FailureBudget{}, FailureBudget{}, fmt.Errorf("firmware_rollout: %w", err)
+	}
+	return channel, size, budget, nil
+}
+
+// firmwareTargets asks each device for updates on channel and returns those
+// with one, devices tagged with a canary tag first, then by device ID.
+// Devices that can't be asked are skipped with a warning.
+func (sm *SyncManager) firmwareTargets(ctx context.Context, devices []storage.Device, channel string, canaryTags []string) []firmwareTarget {
+	var mu sync.Mutex
+	var targets []firmwareTarget
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(sm.parallelism())
+	for _, device := range devices {
+		device := device
+		g.Go(func() error {
+			info, err := sm.shellyClient.GetDeviceInfo(gctx, device.IPAddress)
+			var updates map[string]shelly.FirmwareVersion
+			if err == nil {
+				updates, err = sm.shellyClient.CheckForUpdate(gctx, device.IPAddress)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Skipping %s: failed to check for firmware updates: %v\n", device.Name, err)
+				return nil
+			}
+			if update, ok := updates[channel]; ok && update.Version != "" {
+				mu.Lock()
+				targets = append(targets, firmwareTarget{device: device, from: info.Ver, version: update.Version})
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	isCanary := func(device storage.Device) bool {
+		for _, tag := range canaryTags {
+			if device.HasTag(tag) {
+				return true
+			}
+		}
+		return false
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		ci, cj := isCanary(targets[i].device), isCanary(targets[j].device)
+		if ci != cj {
+			return ci
+		}
+		return targets[i].device.DeviceID < targets[j].device.DeviceID
+	})
+	return targets
+}
+
+// updateFirmwareBatch updates the devices of a batch in parallel
+func (sm *SyncManager) updateFirmwareBatch(ctx context.Context, batch []firmwareTarget, channel string, dryRun bool, timeout, interval time.Duration) []FirmwareUpdateResult {
+	results := make([]FirmwareUpdateResult, len(batch))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(sm.parallelism())
+	for i, target := range batch {
+		i, target := i, target
+		results[i] = FirmwareUpdateResult{
+			DeviceID: target.device.DeviceID,
+			Name:     target.device.Name,
+			From:     target.from,
+			To:       target.version,
+		}
+		if dryRun {
+			continue
+		}
+		g.Go(func() error {
+			results[i].Error = sm.updateFirmware(gctx, target, channel, timeout, interval)
+			return nil
+		})
+	}
+	g.Wait()
+
+	return results
+}
+
+// updateFirmware starts the update of a device and waits until it reports
+// the target version
+func (sm *SyncManager) updateFirmware(ctx context.Context, target firmwareTarget, channel string, timeout, interval time.Duration) error {
+	deviceIP := target.device.IPAddress
+	sm.noteReboot(target.device.DeviceID, timeout)
+	if err := sm.shellyClient.Update(ctx, deviceIP, channel); err != nil {
+		return fmt.Errorf("failed to start update: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	running := target.from
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		// The device is unreachable while it reboots into the new firmware
+		if info, err := sm.shellyClient.GetDeviceInfo(ctx, deviceIP); err == nil {
+			running = info.Ver
+			if running == target.version {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("still running %s instead of %s after %s", running, target.version, timeout)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// FreezeError is returned by a push during a change freeze window
+type FreezeError struct {
+	Window storage.FreezeWindow
+}
+
+// Error implements error
+func (e *FreezeError) Error() string {
+	msg := fmt.Sprintf("change freeze %q in effect until %s", e.Window.Name, e.Window.End.Local().Format("2006-01-02 15:04"))
+	if e.Window.Reason != "" {
+		msg += " (" + e.Window.Reason + ")"
+	}
+	return msg + "; override the freeze to push anyway"
+}
+
+// ActiveFreeze returns the freeze window of freeze.yaml or freeze.ics that
+// contains t, or nil if changes may be applied
+func (sm *SyncManager) ActiveFreeze(t time.Time) (*storage.FreezeWindow, error) {
+	windows, err := storage.LoadFreezeWindows(sm.repoPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, window := range windows {
+		if window.Contains(t) {
+			return &window, nil
+		}
+	}
+	return nil, nil
+}
+
+// SetFreezeOverride lets pushes go ahead during a change freeze. Scheduled
+// and automatic runs should never set it.
+func (sm *SyncManager) SetFreezeOverride(override bool) {
+	sm.freezeOverride = override
+}
+
+// checkFreeze fails a push during a change freeze unless it was overridden
+func (sm *SyncManager) checkFreeze() error {
+	window, err := sm.ActiveFreeze(time.Now())
+	if err != nil || window == nil {
+		return err
+	}
+	if sm.freezeOverride {
+		fmt.Fprintf(os.Stderr, "Warning: Pushing during change freeze %q (until %s), as overridden\n", window.Name, window.End.Local().Format("2006-01-02 15:04"))
+		return nil
+	}
+	return &FreezeError{Window: *window}
+}
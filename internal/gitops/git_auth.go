@@ -0,0 +1,17 @@
+package gitops
+
+import "context"
+
+// SetGitTokenSource authenticates pushes to HTTPS remotes (backups, update
+// branches, proposals) with short-lived tokens from tokenFunc, e.g. the
+// AccessToken of an oidc.TokenSource, sent as the password of username.
+// Tokens are fetched per push and only held in memory.
+func (sm *SyncManager) SetGitTokenSource(username string, tokenFunc func(ctx context.Context) (string, error)) {
+	if tokenFunc == nil {
+		sm.repo.SetTokenAuth(username, nil)
+		return
+	}
+	sm.repo.SetTokenAuth(username, func() (string, error) {
+		return tokenFunc(context.Background())
+	})
+}
@@ -0,0 +1,385 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+	"golang.org/x/sync/errgroup"
+)
+
+// DeviceImpact is what a push would change on one device
+type DeviceImpact struct {
+	DeviceID   string
+	DeviceName string
+	Changes    []string // e.g. "config switch-0", "script 1", "schedule 2", "webhook 1", "kvs key mode"
+	Deletions  []string // schedules, webhooks and KVS keys the push would delete
+	Error      error    // the device couldn't be read
+}
+
+// Changed reports whether the push would change the device at all
+func (d DeviceImpact) Changed() bool {
+	return len(d.Changes) > 0 || len(d.Deletions) > 0
+}
+
+// PushImpact is what a push would change across the fleet, read from the
+// devices before anything is pushed
+type PushImpact struct {
+	Devices   []DeviceImpact
+	FleetSize int // devices in the manifest
+}
+
+// ChangedDevices returns the devices the push would change
+func (p *PushImpact) ChangedDevices() []DeviceImpact {
+	var changed []DeviceImpact
+	for _, device := range p.Devices {
+		if device.Changed() {
+			changed = append(changed, device)
+		}
+	}
+	return changed
+}
+
+// Deletions counts the deletions on all devices
+func (p *PushImpact) Deletions() int {
+	deletions := 0
+	for _, device := range p.Devices {
+		deletions += len(device.Deletions)
+	}
+	return deletions
+}
+
+// ChangedPercent is the share of the fleet the push would change
+func (p *PushImpact) ChangedPercent() float64 {
+	if p.FleetSize == 0 {
+		return 0
+	}
+	return float64(len(p.ChangedDevices())) * 100 / float64(p.FleetSize)
+}
+
+// GuardrailError is returned by a push that exceeds the manifest's
+// guardrails, before any device is changed
+type GuardrailError struct {
+	Reason string
+	Impact *PushImpact
+
+	// Confirmable is set when only confirm_percent was exceeded: the push
+	// goes ahead after SetConfirmed(true)
+	Confirmable bool
+}
+
+func (e *GuardrailError) Error() string {
+	return "push blocked by guardrails: " + e.Reason
+}
+
+// SetConfirmed confirms pushes that change more of the fleet than the
+// manifest's confirm_percent, like answering --yes. It does not lift
+// max_devices or max_deletions. Scheduled and automatic runs should never
+// set it.
+func (sm *SyncManager) SetConfirmed(confirmed bool) {
+	sm.pushConfirmed = confirmed
+}
+
+// PreviewPush reads the selected devices and reports what a push would
+// change and delete on each, without changing anything. Component configs,
+// scripts, schedules, webhooks and KVS data are compared.
+func (sm *SyncManager) PreviewPush(ctx context.Context, deviceFilter []string, valuesFile string) (*PushImpact, error) {
+	values, err := LoadValuesFile(valuesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load values file: %w", err)
+	}
+	if err := sm.addSecretsToValues(values); err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+	if err := sm.addLibraryPins(values); err != nil {
+		return nil, err
+	}
+	return sm.pushImpact(ctx, sm.SelectDevices(deviceFilter), values)
+}
+
+// checkGuardrails previews a push to devices and fails if it exceeds the
+// manifest's guardrails
+func (sm *SyncManager) checkGuardrails(ctx context.Context, devices []storage.Device, values Values) error {
+	limits := sm.manifest.Guardrails
+	if limits == nil || (limits.MaxDevices <= 0 && limits.MaxDeletions <= 0 && limits.ConfirmPercent <= 0) {
+		return nil
+	}
+
+	impact, err := sm.pushImpact(ctx, devices, values)
+	if err != nil {
+		return err
+	}
+	changed := len(impact.ChangedDevices())
+
+	if limits.MaxDevices > 0 && changed > limits.MaxDevices {
+		return &GuardrailError{
+			Reason: fmt.Sprintf("push would change %d devices, more than max_devices (%d)", changed, limits.MaxDevices),
+			Impact: impact,
+		}
+	}
+	if deletions := impact.Deletions(); limits.MaxDeletions > 0 && deletions > limits.MaxDeletions {
+		return &GuardrailError{
+			Reason: fmt.Sprintf("push would delete %d schedules, webhooks and KVS keys, more than max_deletions (%d)", deletions, limits.MaxDeletions),
+			Impact: impact,
+		}
+	}
+	if percent := impact.ChangedPercent(); limits.ConfirmPercent > 0 && percent > limits.ConfirmPercent && !sm.pushConfirmed {
+		return &GuardrailError{
+			Reason:      fmt.Sprintf("push would change %d of %d devices (%.0f%%), more than confirm_percent (%g%%) without confirmation", changed, impact.FleetSize, percent, limits.ConfirmPercent),
+			Impact:      impact,
+			Confirmable: true,
+		}
+	}
+	return nil
+}
+
+// pushImpact reads what a push would change on each device, in parallel
+func (sm *SyncManager) pushImpact(ctx context.Context, devices []storage.Device, values Values) (*PushImpact, error) {
+	rewrite, err := webhookHostRewriteFrom(values)
+	if err != nil {
+		return nil, err
+	}
+
+	allDevices := make(map[string]DeviceContext)
+	for _, device := range sm.manifest.Devices {
+		allDevices[device.DeviceID] = deviceContextFor(device)
+	}
+
+	impact := &PushImpact{Devices: make([]DeviceImpact, len(devices)), FleetSize: len(sm.manifest.Devices)}
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(sm.pushConcurrency(false))
+	for i, device := range devices {
+		i, device := i, device
+		g.Go(func() error {
+			templateContext := CreateTemplateContext(values, deviceContextFor(device), allDevices)
+			impact.Devices[i] = sm.deviceImpact(ctx, device, templateContext, rewrite)
+			return nil
+		})
+	}
+	g.Wait()
+
+	return impact, nil
+}
+
+// deviceImpact compares one device with its folder the way push would
+func (sm *SyncManager) deviceImpact(ctx context.Context, device storage.Device, templateContext map[string]interface{}, rewrite *webhookHostRewrite) DeviceImpact {
+	impact := DeviceImpact{DeviceID: device.DeviceID, DeviceName: device.Name}
+
+	fields, err := sm.planDevice(ctx, device, templateContext, "values")
+	if err != nil {
+		impact.Error = err
+		return impact
+	}
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		if !seen[field.Component] {
+			seen[field.Component] = true
+			impact.Changes = append(impact.Changes, "config "+field.Component)
+		}
+	}
+
+	if err := sm.scriptImpact(ctx, device, templateContext, &impact); err != nil {
+		impact.Error = err
+		return impact
+	}
+	if err := sm.scheduleImpact(ctx, device, &impact); err != nil {
+		impact.Error = err
+		return impact
+	}
+	if err := sm.webhookImpact(ctx, device, rewrite, &impact); err != nil {
+		impact.Error = err
+		return impact
+	}
+	if err := sm.kvsImpact(ctx, device, templateContext, &impact); err != nil {
+		impact.Error = err
+	}
+	return impact
+}
+
+// scriptImpact records scripts whose code would be uploaded because it
+// differs from the device's, or that would be created
+func (sm *SyncManager) scriptImpact(ctx context.Context, device storage.Device, templateContext map[string]interface{}, impact *DeviceImpact) error {
+	scripts, err := sm.deviceStorage.ListScripts(device.Folder)
+	if err != nil || len(scripts) == 0 {
+		return nil
+	}
+	deviceScripts, err := sm.shellyClient.ListScripts(ctx, device.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to list scripts: %w", err)
+	}
+	onDevice := make(map[int]shelly.Script, len(deviceScripts))
+	for _, script := range deviceScripts {
+		onDevice[script.ID] = script
+	}
+
+	for _, script := range scripts {
+		existing, ok := onDevice[script.ID]
+		if !ok {
+			impact.Changes = append(impact.Changes, fmt.Sprintf("script %d", script.ID))
+			continue
+		}
+		code, err := sm.deviceStorage.LoadScript(device.Folder, script.ID)
+		if err != nil {
+			continue
+		}
+		if script.Templated {
+			if code, err = RenderTemplate(code, templateContext); err != nil {
+				continue
+			}
+		}
+		deviceCode, err := sm.shellyClient.GetScriptCode(ctx, device.IPAddress, script.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get script %d code: %w", script.ID, err)
+		}
+		if deviceCode != code || existing.Name != script.Name || existing.Enable != script.Enable {
+			impact.Changes = append(impact.Changes, fmt.Sprintf("script %d", script.ID))
+		}
+	}
+	return nil
+}
+
+// scheduleImpact records schedules push would create, update or delete
+func (sm *SyncManager) scheduleImpact(ctx context.Context, device storage.Device, impact *DeviceImpact) error {
+	local, err := sm.deviceStorage.ListSchedules(device.Folder)
+	if err != nil {
+		local = []*shelly.Schedule{}
+	}
+	remote, err := sm.shellyClient.ListSchedules(ctx, device.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	onDevice := make(map[int]shelly.Schedule, len(remote))
+	for _, schedule := range remote {
+		onDevice[schedule.ID] = schedule
+	}
+	localIDs := make(map[int]bool, len(local))
+	created := make(map[string]bool) // content of local schedules missing on the device
+	for _, schedule := range local {
+		localIDs[schedule.ID] = true
+		existing, ok := onDevice[schedule.ID]
+		if !ok {
+			created[schedule.ContentHash()] = true
+		}
+		if !ok || !shelly.SchedulesEqual(*schedule, existing) {
+			impact.Changes = append(impact.Changes, fmt.Sprintf("schedule %d", schedule.ID))
+		}
+	}
+	for _, schedule := range remote {
+		// Push adopts device schedules identical to one it would create
+		if !localIDs[schedule.ID] && !created[schedule.ContentHash()] {
+			impact.Deletions = append(impact.Deletions, fmt.Sprintf("schedule %d", schedule.ID))
+		}
+	}
+	return nil
+}
+
+// webhookImpact records webhooks push would create, update or delete
+func (sm *SyncManager) webhookImpact(ctx context.Context, device storage.Device, rewrite *webhookHostRewrite, impact *DeviceImpact) error {
+	local, err := sm.deviceStorage.ListWebhooks(device.Folder)
+	if err != nil {
+		local = []*shelly.Webhook{}
+	}
+	remote, err := sm.shellyClient.ListWebhooks(ctx, device.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to list webhooks: %w", err)
+	}
+
+	onDevice := make(map[int]shelly.Webhook, len(remote))
+	for _, webhook := range remote {
+		onDevice[webhook.ID] = webhook
+	}
+	localIDs := make(map[int]bool, len(local))
+	created := make(map[string]bool)
+	for _, webhook := range local {
+		if rewrite != nil {
+			rewrite.apply(webhook)
+		}
+		localIDs[webhook.ID] = true
+		existing, ok := onDevice[webhook.ID]
+		if !ok {
+			created[webhook.ContentHash()] = true
+		}
+		if !ok || !shelly.WebhooksEqual(*webhook, existing) {
+			impact.Changes = append(impact.Changes, fmt.Sprintf("webhook %d", webhook.ID))
+		}
+	}
+	for _, webhook := range remote {
+		if !localIDs[webhook.ID] && !created[webhook.ContentHash()] {
+			impact.Deletions = append(impact.Deletions, fmt.Sprintf("webhook %d", webhook.ID))
+		}
+	}
+	return nil
+}
+
+// kvsImpact records KVS keys push would set or delete. Like push, it leaves
+// devices alone whose kvs/data.json is missing or empty.
+func (sm *SyncManager) kvsImpact(ctx context.Context, device storage.Device, templateContext map[string]interface{}, impact *DeviceImpact) error {
+	local, err := sm.deviceStorage.LoadKVS(device.Folder)
+	if err != nil || len(local) == 0 {
+		return nil
+	}
+	remote, err := sm.shellyClient.GetKVS(ctx, device.IPAddress)
+	if err != nil {
+		// Push treats devices without KVS support as empty too
+		remote = map[string]interface{}{}
+	}
+
+	for key, value := range local {
+		rendered, _, err := RenderKVSValue(value, templateContext)
+		if err != nil {
+			continue
+		}
+		if !kvsValuesEqual(rendered, remote[key]) {
+			impact.Changes = append(impact.Changes, "kvs key "+key)
+		}
+	}
+	for key := range remote {
+		if _, ok := local[key]; !ok {
+			impact.Deletions = append(impact.Deletions, "kvs key "+key)
+		}
+	}
+	return nil
+}
+
+// kvsValuesEqual compares KVS values as JSON, so numbers compare equal
+// whatever Go type they were decoded or rendered as
+func kvsValuesEqual(a, b interface{}) bool {
+	normalize := func(value interface{}) interface{} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return value
+		}
+		var decoded interface{}
+		json.Unmarshal(data, &decoded)
+		return decoded
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// FormatPushImpact renders a push preview for terminal output
+func FormatPushImpact(impact *PushImpact) string {
+	var b strings.Builder
+	changed := impact.ChangedDevices()
+	fmt.Fprintf(&b, "Push would change %d of %d devices (%.0f%%) and delete %d item(s)\n", len(changed), impact.FleetSize, impact.ChangedPercent(), impact.Deletions())
+	for _, device := range impact.Devices {
+		switch {
+		case device.Error != nil:
+			fmt.Fprintf(&b, "  %s: unknown (%v)\n", device.DeviceName, device.Error)
+		case device.Changed():
+			fmt.Fprintf(&b, "  %s: %s", device.DeviceName, strings.Join(device.Changes, ", "))
+			if len(device.Deletions) > 0 {
+				if len(device.Changes) > 0 {
+					b.WriteString("; ")
+				}
+				fmt.Fprintf(&b, "delete %s", strings.Join(device.Deletions, ", "))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
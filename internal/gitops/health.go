@@ -0,0 +1,232 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// Thresholds for flagging a device as chronically slow or flaky
+const (
+	healthSmoothing  = 0.1  // weight of the newest sample in the rolling averages
+	healthMinSamples = 10   // samples required before a device can be flagged
+	slowLatencyMs    = 2000 // rolling average latency above which a device is slow
+	flakyErrorRate   = 0.25 // rolling error rate above which a device is flaky
+)
+
+// DeviceHealth holds rolling RPC latency and error statistics for a device
+type DeviceHealth struct {
+	DeviceID     string    `json:"device_id"`
+	Calls        int       `json:"calls"`
+	Errors       int       `json:"errors"`
+	AvgLatencyMs float64   `json:"avg_latency_ms"`
+	ErrorRate    float64   `json:"error_rate"`
+	LastCall     time.Time `json:"last_call"`
+}
+
+// Slow reports whether the device's rolling latency exceeds the slow threshold
+func (h *DeviceHealth) Slow() bool {
+	return h.Calls >= healthMinSamples && h.AvgLatencyMs > slowLatencyMs
+}
+
+// Flaky reports whether the device's rolling error rate exceeds the flaky threshold
+func (h *DeviceHealth) Flaky() bool {
+	return h.Calls >= healthMinSamples && h.ErrorRate > flakyErrorRate
+}
+
+// Degraded reports whether the device is slow or flaky
+func (h *DeviceHealth) Degraded() bool {
+	return h.Slow() || h.Flaky()
+}
+
+// HealthTracker records per-device RPC health and persists it between runs
+type HealthTracker struct {
+	path    string
+	mu      sync.Mutex
+	byIP    map[string]string
+	Devices map[string]*DeviceHealth `json:"devices"`
+}
+
+// LoadHealthTracker loads persisted device health, returning an empty tracker if none exists
+func LoadHealthTracker(path string) (*HealthTracker, error) {
+	tracker := &HealthTracker{
+		path:    path,
+		byIP:    make(map[string]string),
+		Devices: make(map[string]*DeviceHealth),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return tracker, nil
+		}
+		return nil, fmt.Errorf("failed to read device health: %w", err)
+	}
+
+	if err := json.Unmarshal(data, tracker); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device health: %w", err)
+	}
+	if tracker.Devices == nil {
+		tracker.Devices = make(map[string]*DeviceHealth)
+	}
+
+	return tracker, nil
+}
+
+// SetDevices updates the IP to device ID mapping used to attribute RPC calls
+func (t *HealthTracker) SetDevices(devices []storage.Device) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.byIP = make(map[string]string, len(devices))
+	for _, device := range devices {
+		t.byIP[device.IPAddress] = device.DeviceID
+	}
+}
+
+// Observe records an RPC call; it matches the shelly.CallObserver signature
+func (t *HealthTracker) Observe(deviceIP, method string, duration time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	deviceID, ok := t.byIP[deviceIP]
+	if !ok {
+		return
+	}
+
+	h, ok := t.Devices[deviceID]
+	if !ok {
+		h = &DeviceHealth{DeviceID: deviceID}
+		t.Devices[deviceID] = h
+	}
+
+	latency := float64(duration.Milliseconds())
+	failed := 0.0
+	if err != nil {
+		failed = 1.0
+		h.Errors++
+	}
+
+	if h.Calls == 0 {
+		h.AvgLatencyMs = latency
+		h.ErrorRate = failed
+	} else {
+		h.AvgLatencyMs += healthSmoothing * (latency - h.AvgLatencyMs)
+		h.ErrorRate += healthSmoothing * (failed - h.ErrorRate)
+	}
+	h.Calls++
+	h.LastCall = time.Now()
+}
+
+// Get returns a copy of the health record for a device, if any
+func (t *HealthTracker) Get(deviceID string) (DeviceHealth, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.Devices[deviceID]
+	if !ok {
+		return DeviceHealth{}, false
+	}
+	return *h, true
+}
+
+// All returns copies of all health records sorted by device ID
+func (t *HealthTracker) All() []DeviceHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	all := make([]DeviceHealth, 0, len(t.Devices))
+	for _, h := range t.Devices {
+		all = append(all, *h)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].DeviceID < all[j].DeviceID })
+
+	return all
+}
+
+// Prune drops health records for devices keep rejects and returns how many were removed
+func (t *HealthTracker) Prune(keep func(deviceID string) bool) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	removed := 0
+	for deviceID := range t.Devices {
+		if !keep(deviceID) {
+			delete(t.Devices, deviceID)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Save persists the tracker
+func (t *HealthTracker) Save() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal device health: %w", err)
+	}
+
+	if err := os.WriteFile(t.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write device health: %w", err)
+	}
+
+	return nil
+}
+
+// SetQuarantineDegraded controls whether devices flagged as chronically slow or
+// flaky are skipped by pull and push so they don't dominate total sync time
+func (sm *SyncManager) SetQuarantineDegraded(enabled bool) {
+	sm.quarantineDegraded = enabled
+}
+
+// DeviceHealth returns the rolling RPC health of all tracked devices
+func (sm *SyncManager) DeviceHealth() []DeviceHealth {
+	return sm.health.All()
+}
+
+// beginHealthTracking prepares the health tracker for an operation on devices
+// and splits off quarantined devices when quarantine is enabled
+func (sm *SyncManager) beginHealthTracking(devices []storage.Device) ([]storage.Device, []SyncResult) {
+	sm.health.SetDevices(sm.manifest.Devices)
+
+	if !sm.quarantineDegraded {
+		return devices, nil
+	}
+
+	var active []storage.Device
+	var skipped []SyncResult
+	for _, device := range devices {
+		if h, ok := sm.health.Get(device.DeviceID); ok && h.Degraded() {
+			skipped = append(skipped, SyncResult{
+				DeviceID: device.DeviceID,
+				Error: fmt.Errorf("quarantined: avg latency %.0fms, error rate %.0f%% over %d calls",
+					h.AvgLatencyMs, h.ErrorRate*100, h.Calls),
+			})
+			continue
+		}
+		active = append(active, device)
+	}
+
+	return active, skipped
+}
+
+// endHealthTracking persists health statistics gathered during an operation
+func (sm *SyncManager) endHealthTracking() {
+	if err := sm.health.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to save device health: %v\n", err)
+	}
+}
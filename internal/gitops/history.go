@@ -0,0 +1,295 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// DesiredState is the effective configuration of a device at a given commit
+type DesiredState struct {
+	Commit     string
+	CommitTime time.Time
+	Device     storage.Device
+	Configs    map[string]json.RawMessage // component file name (e.g. "switch-0") -> rendered config
+	Scripts    map[string]string          // script file name -> code
+	KVS        map[string]interface{}     // rendered KVS values
+	Schedules  []shelly.Schedule
+	Webhooks   []shelly.Webhook
+}
+
+// ResolveCommit resolves a revision (hash, branch, tag, HEAD~N) to a commit
+func (r *Repository) ResolveCommit(rev string) (*object.Commit, error) {
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve revision %s: %w", rev, err)
+	}
+
+	commit, err := r.repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", hash, err)
+	}
+
+	return commit, nil
+}
+
+// CommitBefore returns the most recent commit on HEAD made at or before the given time
+func (r *Repository) CommitBefore(t time.Time) (*object.Commit, error) {
+	iter, err := r.repo.Log(&git.LogOptions{Until: &t})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get log: %w", err)
+	}
+	defer iter.Close()
+
+	commit, err := iter.Next()
+	if err != nil {
+		return nil, fmt.Errorf("no commit found before %s", t.Format(time.RFC3339))
+	}
+
+	return commit, nil
+}
+
+// ReadFileAt reads a file from the tree of the given commit
+func (r *Repository) ReadFileAt(commit *object.Commit, filePath string) ([]byte, error) {
+	file, err := commit.File(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s at %s: %w", filePath, commit.Hash, err)
+	}
+
+	reader, err := file.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s at %s: %w", filePath, commit.Hash, err)
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// ListDirAt lists file names directly inside a directory in the tree of the given commit
+// Returns an empty list if the directory does not exist
+func (r *Repository) ListDirAt(commit *object.Commit, dirPath string) ([]string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree: %w", err)
+	}
+
+	subtree, err := tree.Tree(dirPath)
+	if err != nil {
+		if err == object.ErrDirectoryNotFound {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", dirPath, err)
+	}
+
+	var names []string
+	for _, entry := range subtree.Entries {
+		if entry.Mode.IsFile() {
+			names = append(names, entry.Name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// DesiredStateAt renders the effective desired state of a device at a revision
+// without checking it out. deviceRef matches a device ID or name (case-insensitive).
+// Component configs get the manifest defaults and merge patches of that
+// revision, like a push; their templates and KVS templates are rendered with
+// the given values.
+func (sm *SyncManager) DesiredStateAt(rev, deviceRef string, values Values) (*DesiredState, error) {
+	commit, err := sm.repo.ResolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	return sm.desiredStateAtCommit(commit, deviceRef, values)
+}
+
+// DesiredStateAtTime renders the effective desired state of a device as of a point in time
+func (sm *SyncManager) DesiredStateAtTime(t time.Time, deviceRef string, values Values) (*DesiredState, error) {
+	commit, err := sm.repo.CommitBefore(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return sm.desiredStateAtCommit(commit, deviceRef, values)
+}
+
+func (sm *SyncManager) desiredStateAtCommit(commit *object.Commit, deviceRef string, values Values) (*DesiredState, error) {
+	manifest, err := sm.manifestAt(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	var device *storage.Device
+	for i, d := range manifest.Devices {
+		if strings.EqualFold(d.DeviceID, deviceRef) || strings.EqualFold(d.Name, deviceRef) {
+			device = &manifest.Devices[i]
+			break
+		}
+	}
+	if device == nil {
+		return nil, fmt.Errorf("device %s not found in manifest at %s", deviceRef, commit.Hash)
+	}
+
+	state := &DesiredState{
+		Commit:     commit.Hash.String(),
+		CommitTime: commit.Committer.When,
+		Device:     *device,
+		Configs:    make(map[string]json.RawMessage),
+		Scripts:    make(map[string]string),
+		KVS:        make(map[string]interface{}),
+	}
+
+	allDevices := make(map[string]DeviceContext)
+	for _, d := range manifest.Devices {
+		allDevices[d.DeviceID] = deviceContextFor(d)
+	}
+	templateContext := CreateTemplateContext(values, deviceContextFor(*device), allDevices)
+
+	// Component configs, with the manifest defaults and merge patches of
+	// that commit applied and templates rendered, as a push would send them
+	configFiles, err := sm.repo.ListDirAt(commit, path.Join(device.Folder, "configs"))
+	if err != nil {
+		return nil, err
+	}
+	hasFile := make(map[string]bool, len(configFiles))
+	for _, name := range configFiles {
+		hasFile[name] = true
+	}
+	for _, name := range configFiles {
+		if !strings.HasSuffix(name, ".json") || strings.HasSuffix(name, storage.ComponentPatchSuffix) {
+			continue
+		}
+		component := strings.TrimSuffix(name, ".json")
+		data, err := sm.repo.ReadFileAt(commit, path.Join(device.Folder, "configs", name))
+		if err != nil {
+			return nil, err
+		}
+		var patchData []byte
+		if patchName := component + storage.ComponentPatchSuffix; hasFile[patchName] {
+			patchData, err = sm.repo.ReadFileAt(commit, path.Join(device.Folder, "configs", patchName))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		config, _, err := desiredConfig(component, data, patchData, manifestDefaults(manifest, component))
+		if err != nil {
+			return nil, err
+		}
+		rendered, _, err := RenderConfigTemplates(config, templateContext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render templates in config %s: %w", component, err)
+		}
+		renderedData, err := json.Marshal(rendered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal config %s: %w", component, err)
+		}
+		state.Configs[component] = json.RawMessage(renderedData)
+	}
+
+	// Scripts
+	scriptFiles, err := sm.repo.ListDirAt(commit, path.Join(device.Folder, "scripts"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range scriptFiles {
+		if !strings.HasSuffix(name, ".js") {
+			continue
+		}
+		data, err := sm.repo.ReadFileAt(commit, path.Join(device.Folder, "scripts", name))
+		if err != nil {
+			return nil, err
+		}
+		state.Scripts[name] = string(data)
+	}
+
+	// Schedules and webhooks
+	scheduleFiles, err := sm.repo.ListDirAt(commit, path.Join(device.Folder, "schedules"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range scheduleFiles {
+		data, err := sm.repo.ReadFileAt(commit, path.Join(device.Folder, "schedules", name))
+		if err != nil {
+			return nil, err
+		}
+		var schedule shelly.Schedule
+		if err := json.Unmarshal(data, &schedule); err != nil {
+			return nil, fmt.Errorf("failed to parse schedule %s: %w", name, err)
+		}
+		state.Schedules = append(state.Schedules, schedule)
+	}
+
+	webhookFiles, err := sm.repo.ListDirAt(commit, path.Join(device.Folder, "webhooks"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range webhookFiles {
+		data, err := sm.repo.ReadFileAt(commit, path.Join(device.Folder, "webhooks", name))
+		if err != nil {
+			return nil, err
+		}
+		var webhook shelly.Webhook
+		if err := json.Unmarshal(data, &webhook); err != nil {
+			return nil, fmt.Errorf("failed to parse webhook %s: %w", name, err)
+		}
+		state.Webhooks = append(state.Webhooks, webhook)
+	}
+
+	// KVS, rendered against the manifest as it was at that commit
+	kvsData, err := sm.repo.ReadFileAt(commit, path.Join(device.Folder, "kvs", "data.json"))
+	if err == nil {
+		var kvs map[string]interface{}
+		if err := json.Unmarshal(kvsData, &kvs); err != nil {
+			return nil, fmt.Errorf("failed to parse KVS data: %w", err)
+		}
+
+		for key, value := range kvs {
+			rendered, _, err := RenderKVSValue(value, templateContext)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render KVS key %s: %w", key, err)
+			}
+			state.KVS[key] = rendered
+		}
+	}
+
+	return state, nil
+}
+
+// manifestAt reads and parses the manifest as it was at the given commit
+func (sm *SyncManager) manifestAt(commit *object.Commit) (*storage.Manifest, error) {
+	for _, name := range storage.ManifestFileNames() {
+		data, err := sm.repo.ReadFileAt(commit, name)
+		if err != nil {
+			continue
+		}
+		return storage.ParseManifest(data, storage.FormatFromPath(name))
+	}
+
+	return nil, fmt.Errorf("no manifest found at %s", commit.Hash)
+}
+
+// deviceContextFor builds the template device context for a manifest device
+func deviceContextFor(device storage.Device) DeviceContext {
+	return DeviceContext{
+		DeviceID:   device.DeviceID,
+		Name:       device.Name,
+		Model:      device.Model,
+		IPAddress:  device.IPAddress,
+		MACAddress: device.MACAddress,
+		Folder:     device.Folder,
+	}
+}
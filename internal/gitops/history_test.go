@@ -0,0 +1,88 @@
+package gitops
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+func TestDesiredStateAtRendersConfigsLikePush(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := InitRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := storage.LoadManifest(storage.FindManifest(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.AddDevice(storage.Device{DeviceID: "shellyplus1-aabbcc", Name: "Porch", Folder: "porch"})
+	manifest.Defaults = map[string]map[string]interface{}{
+		"switch": {"auto_off": true, "initial_state": "off"},
+	}
+	if err := manifest.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile := func(name, content string) {
+		t.Helper()
+		filePath := filepath.Join(dir, "porch", "configs", name)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("switch-0.json", `{"id": 0, "name": "{{ .device.name }} light", "auto_off_delay": "{{ .Values.delay | int }}", "initial_state": "on"}`)
+	writeFile("switch-0"+storage.ComponentPatchSuffix, `{"initial_state": "restore_last"}`)
+
+	if err := repo.AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := repo.Commit("Templated porch switch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Later changes must not leak into the state at the first commit
+	writeFile("switch-0.json", `{"id": 0, "name": "changed", "auto_off_delay": 1}`)
+	if err := repo.AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("Change porch switch"); err != nil {
+		t.Fatal(err)
+	}
+
+	sm, err := NewSyncManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := sm.DesiredStateAt(hash, "Porch", Values{"delay": "30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := state.Configs["switch-0.patch"]; ok {
+		t.Errorf("merge patch returned as a config of its own")
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(state.Configs["switch-0"], &config); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"id":             float64(0),
+		"name":           "Porch light",
+		"auto_off":       true,           // manifest defaults
+		"auto_off_delay": float64(30),    // template with "| int"
+		"initial_state":  "restore_last", // merge patch over defaults
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("switch-0 at %s:\n got %v\nwant %v", hash, config, want)
+	}
+}
@@ -0,0 +1,147 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/darkermage/shelly-git-ops/internal/homeassistant"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// HomeAssistantImportOptions controls an import from Home Assistant
+type HomeAssistantImportOptions struct {
+	DeviceFilter []string // devices to match (see SelectDevices); empty for all
+	DryRun       bool     // only report the matches
+
+	// Rename renames devices whose Home Assistant name differs, as BulkRename
+	// does: manifest, folder and the name on the device
+	Rename bool
+}
+
+// HomeAssistantMatch is a manifest device and the Home Assistant device it
+// matched, if any
+type HomeAssistantMatch struct {
+	DeviceID   string
+	DeviceName string
+	MatchedBy  string // "mac" or "ip"; empty if no Home Assistant device matched
+
+	HADeviceID string
+	Name       string // Home Assistant name
+	Area       string // Home Assistant area, of the device or its entities
+	Entities   map[string]string
+
+	AreaChanged bool // the device's area differs and is updated unless DryRun
+	Renamed     bool
+	Error       error
+}
+
+// ImportHomeAssistant matches manifest devices to Home Assistant devices by
+// MAC address, or by the IP address of their configuration URL, and stores
+// the Home Assistant name, area and entity names in each device.yaml. The
+// area becomes the device's area, so commits, calendars and reports group
+// devices the way Home Assistant dashboards do; with Rename, device names
+// follow Home Assistant too. Changes are left uncommitted.
+func (sm *SyncManager) ImportHomeAssistant(ctx context.Context, client *homeassistant.Client, opts HomeAssistantImportOptions) ([]HomeAssistantMatch, error) {
+	registry, err := client.LoadRegistry(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Home Assistant registry: %w", err)
+	}
+
+	byMAC := make(map[string]homeassistant.Device)
+	byIP := make(map[string]homeassistant.Device)
+	for _, haDevice := range registry.Devices {
+		if mac := haDevice.MAC(); mac != "" {
+			byMAC[normalizeMAC(mac)] = haDevice
+		}
+		if host := haDevice.Host(); net.ParseIP(host) != nil {
+			byIP[host] = haDevice
+		}
+	}
+
+	var matches []HomeAssistantMatch
+	renames := make(map[string]string)
+	for _, device := range sm.SelectDevices(opts.DeviceFilter) {
+		match := HomeAssistantMatch{DeviceID: device.DeviceID, DeviceName: device.Name}
+
+		haDevice, ok := byMAC[normalizeMAC(device.MACAddress)]
+		match.MatchedBy = "mac"
+		if !ok {
+			haDevice, ok = byIP[device.IPAddress]
+			match.MatchedBy = "ip"
+		}
+		if !ok {
+			match.MatchedBy = ""
+			matches = append(matches, match)
+			continue
+		}
+
+		match.HADeviceID = haDevice.ID
+		match.Name = haDevice.DisplayName()
+		match.Area = registry.AreaName(haDevice.AreaID)
+		match.Entities = make(map[string]string)
+		for _, entity := range registry.Entities {
+			if entity.DeviceID != haDevice.ID || entity.DisabledBy != "" {
+				continue
+			}
+			match.Entities[entity.EntityID] = entity.DisplayName()
+			// Devices without an area are often placed through their entities
+			if match.Area == "" && entity.AreaID != "" {
+				match.Area = registry.AreaName(entity.AreaID)
+			}
+		}
+
+		match.AreaChanged = match.Area != "" && match.Area != sm.DeviceNotes(device).Area
+		if opts.Rename && match.Name != "" && match.Name != device.Name {
+			renames[device.DeviceID] = match.Name
+		}
+
+		if !opts.DryRun {
+			match.Error = sm.saveHomeAssistantDevice(device, match)
+		}
+		matches = append(matches, match)
+	}
+
+	if len(renames) > 0 && !opts.DryRun {
+		results, err := sm.BulkRename(ctx, renames, false)
+		if err != nil {
+			return matches, err
+		}
+		renamed := make(map[string]error, len(results))
+		for _, result := range results {
+			renamed[result.DeviceID] = result.Error
+		}
+		for i := range matches {
+			if err, ok := renamed[matches[i].DeviceID]; ok {
+				if err != nil {
+					matches[i].Error = fmt.Errorf("failed to rename: %w", err)
+				} else {
+					matches[i].Renamed = true
+				}
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].DeviceName < matches[j].DeviceName })
+	return matches, nil
+}
+
+// saveHomeAssistantDevice records a match in the device's device.yaml
+func (sm *SyncManager) saveHomeAssistantDevice(device storage.Device, match HomeAssistantMatch) error {
+	metadata, err := sm.deviceStorage.LoadDeviceMetadata(device.Folder)
+	if err != nil {
+		return fmt.Errorf("device has not been pulled yet: %w", err)
+	}
+
+	metadata.HomeAssistant = &storage.HomeAssistantDevice{
+		DeviceID: match.HADeviceID,
+		Name:     match.Name,
+		Area:     match.Area,
+		Entities: match.Entities,
+	}
+	if match.Area != "" {
+		metadata.Area = match.Area
+	}
+	return sm.deviceStorage.SaveDeviceMetadata(device.Folder, *metadata)
+}
@@ -0,0 +1,137 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/discovery"
+)
+
+// Host export formats for RenderHosts
+const (
+	HostsFormatHosts   = "hosts"   // /etc/hosts lines
+	HostsFormatDnsmasq = "dnsmasq" // dnsmasq host-record directives
+)
+
+// HostEntry maps a device to the host name it is exported under
+type HostEntry struct {
+	DeviceID  string `json:"device_id"`
+	Name      string `json:"name"`
+	Hostname  string `json:"hostname"` // DNS label derived from the device name
+	IPAddress string `json:"ip_address"`
+}
+
+// FQDN returns the host name qualified with domain, or the bare host name
+// if domain is empty
+func (e HostEntry) FQDN(domain string) string {
+	domain = strings.Trim(domain, ".")
+	if domain == "" {
+		return e.Hostname
+	}
+	return e.Hostname + "." + domain
+}
+
+// HostEntries lists the selected devices that have an IP address with a host
+// name derived from their name. Names that map to the same host name are
+// disambiguated with the end of the device ID.
+func (sm *SyncManager) HostEntries(deviceFilter []string) []HostEntry {
+	var entries []HostEntry
+	used := make(map[string]int)
+	for _, device := range sm.SelectDevices(deviceFilter) {
+		if device.IPAddress == "" {
+			continue
+		}
+		hostname := hostLabel(device.Name)
+		if hostname == "" {
+			hostname = hostLabel(device.DeviceID)
+		}
+		used[hostname]++
+		entries = append(entries, HostEntry{
+			DeviceID:  device.DeviceID,
+			Name:      device.Name,
+			Hostname:  hostname,
+			IPAddress: device.IPAddress,
+		})
+	}
+
+	for i, entry := range entries {
+		if used[entry.Hostname] > 1 {
+			suffix := hostLabel(entry.DeviceID)
+			if len(suffix) > 6 {
+				suffix = suffix[len(suffix)-6:]
+			}
+			entries[i].Hostname = strings.Trim(entry.Hostname+"-"+suffix, "-")
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Hostname < entries[j].Hostname })
+	return entries
+}
+
+// hostLabel turns a device name into a DNS label: lowercase letters, digits
+// and single hyphens, at most 63 characters
+func hostLabel(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			hyphen = false
+		} else if !hyphen && b.Len() > 0 {
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+
+	label := strings.TrimRight(b.String(), "-")
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+	return label
+}
+
+// RenderHosts renders entries as a hosts file or dnsmasq configuration. With
+// a domain, each device resolves both by its qualified and its bare host name.
+func RenderHosts(entries []HostEntry, format, domain string) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("# Shelly fleet, generated by shelly-gitops from the manifest. Do not edit.\n")
+
+	for _, entry := range entries {
+		names := []string{entry.FQDN(domain)}
+		if names[0] != entry.Hostname {
+			names = append(names, entry.Hostname)
+		}
+
+		switch format {
+		case HostsFormatHosts, "":
+			fmt.Fprintf(&b, "%s\t%s\t# %s\n", entry.IPAddress, strings.Join(names, " "), entry.Name)
+		case HostsFormatDnsmasq:
+			fmt.Fprintf(&b, "host-record=%s,%s\n", strings.Join(names, ","), entry.IPAddress)
+		default:
+			return nil, fmt.Errorf("unknown hosts format %q", format)
+		}
+	}
+
+	return []byte(b.String()), nil
+}
+
+// PushDNSRecords creates or updates a DNS A record for every selected device on
+// a provider that manages local DNS (e.g. UniFi static DNS). Dry runs only
+// return the records that would be set.
+func (sm *SyncManager) PushDNSRecords(ctx context.Context, provider discovery.DNSProvider, deviceFilter []string, domain string, dryRun bool) ([]HostEntry, error) {
+	entries := sm.HostEntries(deviceFilter)
+	if dryRun {
+		return entries, nil
+	}
+
+	for i, entry := range entries {
+		record := discovery.DNSRecord{Name: entry.FQDN(domain), IPAddress: entry.IPAddress}
+		if err := provider.SetDNSRecord(ctx, record); err != nil {
+			return entries[:i], fmt.Errorf("failed to set DNS record for %s: %w", entry.Name, err)
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,137 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Identify defaults
+const (
+	defaultIdentifyBlinks   = 5
+	defaultIdentifyInterval = time.Second
+	identifyRestoreTimeout  = 10 * time.Second
+)
+
+// identifyNamespaces are the output types Identify can blink, by component
+// type, with their RPC namespace
+var identifyNamespaces = map[string]string{
+	"switch": "Switch",
+	"light":  "Light",
+	"rgb":    "RGB",
+	"rgbw":   "RGBW",
+}
+
+// IdentifyOptions controls how Identify blinks a device
+type IdentifyOptions struct {
+	Component string        // output to blink, e.g. "switch:1"; the device's first switch or light if empty
+	Blinks    int           // on/off cycles (default 5)
+	Interval  time.Duration // time between toggles (default 1s)
+}
+
+// Identify blinks an output of a device so a technician can find it among
+// identical devices in a panel: the output (and whatever it drives, often a
+// relay LED) is toggled on and off, then set back to the state it had. The
+// state is restored even when ctx is cancelled midway. Covers are never
+// moved; devices without a switch or light output can't be identified.
+func (sm *SyncManager) Identify(ctx context.Context, deviceRef string, opts IdentifyOptions) error {
+	device := sm.findDevice(deviceRef)
+	if device == nil {
+		return fmt.Errorf("device %s not found in manifest", deviceRef)
+	}
+	if opts.Blinks <= 0 {
+		opts.Blinks = defaultIdentifyBlinks
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultIdentifyInterval
+	}
+
+	component := opts.Component
+	if component == "" {
+		var err error
+		if component, err = sm.identifyOutput(ctx, device.IPAddress); err != nil {
+			return fmt.Errorf("%s: %w", device.Name, err)
+		}
+	}
+	kind, idStr, _ := strings.Cut(component, ":")
+	namespace, ok := identifyNamespaces[kind]
+	id, err := strconv.Atoi(idStr)
+	if !ok || err != nil {
+		return fmt.Errorf("can't blink %s; use a switch, light, rgb or rgbw output such as switch:0", component)
+	}
+
+	result, err := sm.shellyClient.Call(ctx, device.IPAddress, namespace+".GetStatus", map[string]interface{}{"id": id})
+	if err != nil {
+		return fmt.Errorf("failed to read %s state: %w", component, err)
+	}
+	var status struct {
+		Output bool `json:"output"`
+	}
+	if err := json.Unmarshal(result, &status); err != nil {
+		return fmt.Errorf("failed to parse %s status: %w", component, err)
+	}
+
+	set := func(ctx context.Context, on bool) error {
+		_, err := sm.shellyClient.Call(ctx, device.IPAddress, namespace+".Set", map[string]interface{}{"id": id, "on": on})
+		return err
+	}
+
+	var blinkErr error
+	state := status.Output
+blink:
+	for i := 0; i < opts.Blinks*2; i++ {
+		state = !state
+		if blinkErr = set(ctx, state); blinkErr != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			blinkErr = ctx.Err()
+			break blink
+		case <-time.After(opts.Interval):
+		}
+	}
+
+	// Put the output back as found, whatever happened above
+	restoreCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), identifyRestoreTimeout)
+	defer cancel()
+	if err := set(restoreCtx, status.Output); err != nil {
+		return fmt.Errorf("failed to restore %s of %s to %s: %w", component, device.Name, onOff(status.Output), err)
+	}
+	if blinkErr != nil {
+		return fmt.Errorf("failed to blink %s of %s: %w", component, device.Name, blinkErr)
+	}
+	return nil
+}
+
+// identifyOutput picks the first output of the device Identify can blink
+func (sm *SyncManager) identifyOutput(ctx context.Context, deviceIP string) (string, error) {
+	result, err := sm.shellyClient.GetStatus(ctx, deviceIP)
+	if err != nil {
+		return "", fmt.Errorf("failed to get status: %w", err)
+	}
+	var status map[string]json.RawMessage
+	if err := json.Unmarshal(result, &status); err != nil {
+		return "", fmt.Errorf("failed to parse status: %w", err)
+	}
+
+	for _, kind := range []string{"switch", "light", "rgbw", "rgb"} {
+		for id := 0; id < 16; id++ {
+			if key := fmt.Sprintf("%s:%d", kind, id); status[key] != nil {
+				return key, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no switch or light output to blink")
+}
+
+// onOff names an output state
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
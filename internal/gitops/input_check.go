@@ -0,0 +1,349 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+const (
+	// defaultInputStepTimeout is how long TestInputs waits for the user to
+	// operate an input
+	defaultInputStepTimeout = 30 * time.Second
+
+	// inputSettleTime is how long events are still collected after the first
+	// one, so releases and output changes are captured too
+	inputSettleTime = 2 * time.Second
+)
+
+// inputWebhookEvents maps observed input events and states to the webhook
+// events they trigger
+var inputWebhookEvents = map[string]string{
+	"single_push": "input.button_push",
+	"double_push": "input.button_doublepush",
+	"triple_push": "input.button_triplepush",
+	"long_push":   "input.button_longpush",
+	"on":          "input.toggle_on",
+	"off":         "input.toggle_off",
+}
+
+// InputTestStep is one input the user is asked to operate
+type InputTestStep struct {
+	Component string           // e.g. input:0
+	Name      string           // input name from its config, if any
+	Type      string           // button, switch or analog, from configs/input-N.json
+	Switch    string           // switch:N paired with the input, empty if none
+	InMode    string           // in_mode of the paired switch
+	Webhooks  []shelly.Webhook // webhooks in Git bound to this input
+}
+
+// Instruction tells the user what to do for the step
+func (s InputTestStep) Instruction() string {
+	label := s.Component
+	if s.Name != "" {
+		label = fmt.Sprintf("%s (%s)", s.Component, s.Name)
+	}
+	switch s.Type {
+	case "button":
+		return fmt.Sprintf("Press the button on %s once", label)
+	case "switch":
+		return fmt.Sprintf("Flip the switch on %s", label)
+	default:
+		return fmt.Sprintf("Operate %s", label)
+	}
+}
+
+// InputTestResult is the outcome of one input test step
+type InputTestResult struct {
+	Step          InputTestStep
+	Events        []string // events and state changes observed, e.g. single_push, on
+	Webhooks      []string // webhook events from Git triggered by the observed events
+	OutputChanged bool     // the paired switch output changed
+	Problems      []string
+}
+
+// Passed reports whether the input behaved as configured in Git
+func (r InputTestResult) Passed() bool {
+	return len(r.Problems) == 0
+}
+
+// InputTestOptions configures TestInputs
+type InputTestOptions struct {
+	Components  []string      // inputs to test, e.g. input:0; all if empty
+	StepTimeout time.Duration // how long to wait for each input (default 30s)
+	Out         io.Writer     // where prompts are written (default stdout)
+}
+
+// PlanInputTest lists the inputs of a device from its local configs, with
+// the switch each one drives and the webhooks bound to it in Git
+func (sm *SyncManager) PlanInputTest(deviceRef string) (*storage.Device, []InputTestStep, error) {
+	device := sm.findDevice(deviceRef)
+	if device == nil {
+		return nil, nil, fmt.Errorf("device %s not found in manifest", deviceRef)
+	}
+
+	components, err := sm.deviceStorage.ListComponentConfigs(device.Folder)
+	if err != nil {
+		return nil, nil, err
+	}
+	webhooks, _ := sm.deviceStorage.ListWebhooks(device.Folder)
+
+	var steps []InputTestStep
+	for _, component := range components {
+		id, ok := strings.CutPrefix(component, "input-")
+		if !ok {
+			continue
+		}
+
+		var input struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		}
+		if data, err := sm.deviceStorage.LoadComponentConfig(device.Folder, component); err == nil {
+			json.Unmarshal(data, &input)
+		}
+		step := InputTestStep{Component: "input:" + id, Name: input.Name, Type: input.Type}
+
+		// Inputs drive the switch with the same ID unless it is detached
+		var sw struct {
+			InMode string `json:"in_mode"`
+		}
+		if data, err := sm.deviceStorage.LoadComponentConfig(device.Folder, "switch-"+id); err == nil && json.Unmarshal(data, &sw) == nil {
+			step.Switch = "switch:" + id
+			step.InMode = sw.InMode
+		}
+
+		cid, _ := strconv.Atoi(id)
+		for _, webhook := range webhooks {
+			if webhook.CID == cid && strings.HasPrefix(webhook.Event, "input.") {
+				step.Webhooks = append(step.Webhooks, *webhook)
+			}
+		}
+
+		steps = append(steps, step)
+	}
+
+	sort.Slice(steps, func(i, j int) bool { return steps[i].Component < steps[j].Component })
+	return device, steps, nil
+}
+
+// TestInputs is an acceptance test for wiring work: it subscribes to the
+// device's events and, input by input, prompts the user to press the button
+// or flip the switch. Each input must report events matching its configured
+// type, drive its paired switch unless detached, and every webhook in Git
+// bound to the triggered events must be present on the device.
+func (sm *SyncManager) TestInputs(ctx context.Context, deviceRef string, opts InputTestOptions) ([]InputTestResult, error) {
+	device, steps, err := sm.PlanInputTest(deviceRef)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Components) > 0 {
+		selected := steps[:0]
+		for _, step := range steps {
+			for _, component := range opts.Components {
+				if strings.EqualFold(step.Component, component) {
+					selected = append(selected, step)
+					break
+				}
+			}
+		}
+		steps = selected
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("%s has no inputs to test", device.Name)
+	}
+	if opts.StepTimeout <= 0 {
+		opts.StepTimeout = defaultInputStepTimeout
+	}
+	out := opts.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	deviceWebhooks, err := sm.shellyClient.ListWebhooks(ctx, device.IPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device webhooks: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	notifications := make(chan shelly.Notification, 64)
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- sm.shellyClient.SubscribeEvents(ctx, device.IPAddress, func(n shelly.Notification) {
+			select {
+			case notifications <- n:
+			default:
+			}
+		})
+	}()
+
+	var results []InputTestResult
+	for i, step := range steps {
+		fmt.Fprintf(out, "[%d/%d] %s (waiting %s)\n", i+1, len(steps), step.Instruction(), opts.StepTimeout)
+
+		// Ignore anything that happened before the prompt
+		for len(notifications) > 0 {
+			<-notifications
+		}
+
+		result := InputTestResult{Step: step}
+		deadline := time.After(opts.StepTimeout)
+		var settle <-chan time.Time
+	collect:
+		for {
+			select {
+			case <-ctx.Done():
+				return results, ctx.Err()
+			case err := <-streamErr:
+				return results, fmt.Errorf("event stream lost: %w", err)
+			case <-deadline:
+				break collect
+			case <-settle:
+				break collect
+			case n := <-notifications:
+				if recordInputNotification(&result, n) && settle == nil {
+					settle = time.After(inputSettleTime)
+				}
+			}
+		}
+
+		verifyInputResult(&result, deviceWebhooks, opts.StepTimeout)
+		if result.Passed() {
+			fmt.Fprintf(out, "  ok: %s\n", strings.Join(result.Events, ", "))
+		} else {
+			for _, problem := range result.Problems {
+				fmt.Fprintf(out, "  FAIL: %s\n", problem)
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// recordInputNotification adds what a notification says about the step's
+// input and switch to result, and reports whether the input itself was seen
+func recordInputNotification(result *InputTestResult, n shelly.Notification) bool {
+	step := result.Step
+	seen := false
+
+	events, _ := n.Events()
+	for _, event := range events {
+		component := event.Component
+		if event.ID != nil && !strings.Contains(component, ":") {
+			component = fmt.Sprintf("%s:%d", component, *event.ID)
+		}
+		if component == step.Component {
+			result.Events = append(result.Events, event.Event)
+			seen = true
+		}
+	}
+
+	if n.Method == "NotifyStatus" {
+		var status map[string]json.RawMessage
+		if json.Unmarshal(n.Params, &status) != nil {
+			return seen
+		}
+		if data, ok := status[step.Component]; ok {
+			var input struct {
+				State   *bool    `json:"state"`
+				Percent *float64 `json:"percent"`
+			}
+			if json.Unmarshal(data, &input) == nil {
+				switch {
+				case input.State != nil && *input.State:
+					result.Events = append(result.Events, "on")
+					seen = true
+				case input.State != nil:
+					result.Events = append(result.Events, "off")
+					seen = true
+				case input.Percent != nil:
+					result.Events = append(result.Events, fmt.Sprintf("%.0f%%", *input.Percent))
+					seen = true
+				}
+			}
+		}
+		if data, ok := status[step.Switch]; ok && step.Switch != "" {
+			var sw struct {
+				Output *bool `json:"output"`
+			}
+			if json.Unmarshal(data, &sw) == nil && sw.Output != nil {
+				result.OutputChanged = true
+			}
+		}
+	}
+
+	return seen
+}
+
+// verifyInputResult compares what was observed with the configuration in Git
+func verifyInputResult(result *InputTestResult, deviceWebhooks []shelly.Webhook, timeout time.Duration) {
+	step := result.Step
+	if len(result.Events) == 0 {
+		result.Problems = append(result.Problems, fmt.Sprintf("no events from %s within %s; check the wiring", step.Component, timeout))
+		return
+	}
+
+	pushed, toggled := false, false
+	for _, event := range result.Events {
+		switch event {
+		case "on", "off":
+			toggled = true
+		case "btn_down", "btn_up", "single_push", "double_push", "triple_push", "long_push":
+			pushed = true
+		}
+	}
+	switch {
+	case step.Type == "button" && toggled && !pushed:
+		result.Problems = append(result.Problems, fmt.Sprintf("%s is configured as a button but reported switch states; is a toggle switch wired to it?", step.Component))
+	case step.Type == "switch" && pushed && !toggled:
+		result.Problems = append(result.Problems, fmt.Sprintf("%s is configured as a switch but reported button presses; is a push button wired to it?", step.Component))
+	}
+
+	if step.Switch != "" {
+		detached := step.InMode == "detached"
+		if detached && result.OutputChanged {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s changed although its in_mode is detached", step.Switch))
+		} else if !detached && !result.OutputChanged {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s did not change (in_mode %q)", step.Switch, step.InMode))
+		}
+	}
+
+	fired := make(map[string]bool)
+	for _, event := range result.Events {
+		if webhookEvent, ok := inputWebhookEvents[event]; ok {
+			fired[webhookEvent] = true
+		}
+	}
+	for _, webhook := range step.Webhooks {
+		if !webhook.Enable || !fired[webhook.Event] {
+			continue
+		}
+		label := webhook.Event
+		if webhook.Name != "" {
+			label = fmt.Sprintf("%s (%s)", webhook.Event, webhook.Name)
+		}
+		result.Webhooks = append(result.Webhooks, label)
+
+		present := false
+		for _, deviceWebhook := range deviceWebhooks {
+			if deviceWebhook.CID == webhook.CID && deviceWebhook.Event == webhook.Event && deviceWebhook.Enable {
+				present = true
+				break
+			}
+		}
+		if !present {
+			result.Problems = append(result.Problems, fmt.Sprintf("webhook %s is in Git but not enabled on the device; push first", label))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// InterviewDevice dumps a device's full RPC surface (methods, device info,
+// components and status) into capabilities.json in its folder. Individual
+// calls that fail are recorded in the document instead of aborting, so
+// devices with partial RPC support can still be inspected.
+func (sm *SyncManager) InterviewDevice(ctx context.Context, deviceRef string) (*storage.DeviceCapabilities, error) {
+	device := sm.findDevice(deviceRef)
+	if device == nil {
+		return nil, fmt.Errorf("device %s not found in manifest", deviceRef)
+	}
+
+	capabilities := &storage.DeviceCapabilities{
+		InterviewedAt: time.Now(),
+		Namespaces:    make(map[string][]string),
+		Errors:        make(map[string]string),
+	}
+
+	methods, err := sm.shellyClient.ListMethods(ctx, device.IPAddress)
+	if err != nil {
+		// Without the method list the device is most likely unreachable
+		return nil, fmt.Errorf("failed to list methods: %w", err)
+	}
+	sort.Strings(methods)
+	capabilities.Methods = methods
+
+	for _, method := range methods {
+		namespace, name, ok := strings.Cut(method, ".")
+		if !ok {
+			continue
+		}
+		capabilities.Namespaces[namespace] = append(capabilities.Namespaces[namespace], name)
+	}
+
+	if info, err := sm.shellyClient.Call(ctx, device.IPAddress, "Shelly.GetDeviceInfo", nil); err != nil {
+		capabilities.Errors["Shelly.GetDeviceInfo"] = err.Error()
+	} else {
+		capabilities.DeviceInfo = info
+	}
+
+	if components, err := sm.shellyClient.GetComponents(ctx, device.IPAddress); err != nil {
+		capabilities.Errors["Shelly.GetComponents"] = err.Error()
+	} else {
+		for _, component := range components {
+			componentType, _, _ := strings.Cut(component.Key, ":")
+			capabilities.Components = append(capabilities.Components, storage.ComponentCapability{
+				Key:       component.Key,
+				Type:      componentType,
+				HasConfig: len(component.Config) > 0 && string(component.Config) != "null",
+				HasStatus: len(component.Status) > 0 && string(component.Status) != "null",
+			})
+		}
+	}
+
+	if status, err := sm.shellyClient.GetStatus(ctx, device.IPAddress); err != nil {
+		capabilities.Errors["Shelly.GetStatus"] = err.Error()
+	} else if err := json.Unmarshal(status, &capabilities.Status); err != nil {
+		capabilities.Errors["Shelly.GetStatus"] = fmt.Sprintf("failed to parse status: %v", err)
+	}
+
+	if err := sm.deviceStorage.CreateDeviceFolder(device.Folder); err != nil {
+		return capabilities, fmt.Errorf("failed to create device folder: %w", err)
+	}
+	if err := sm.deviceStorage.SaveCapabilities(device.Folder, capabilities); err != nil {
+		return capabilities, err
+	}
+
+	return capabilities, nil
+}
@@ -0,0 +1,232 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/discovery"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// IP plan actions
+const (
+	IPActionReserve = "reserve" // reserve the device's current address
+	IPActionMove    = "move"    // reserve a new address; the device moves on its next DHCP renewal
+	IPActionSkip    = "skip"    // no reservation possible, see Reason
+)
+
+// IPAssignment is the planned static address of one device
+type IPAssignment struct {
+	DeviceID   string `json:"device_id"`
+	Name       string `json:"name"`
+	MACAddress string `json:"mac_address,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+	Pool       string `json:"pool,omitempty"`
+	CurrentIP  string `json:"current_ip,omitempty"`
+	DesiredIP  string `json:"desired_ip,omitempty"`
+	Action     string `json:"action"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// IPPlanOptions controls ApplyIPPlan
+type IPPlanOptions struct {
+	// Reboot restarts moved devices so they take their new address right
+	// away, and updates their manifest address. Without it the manifest keeps
+	// the current address until discovery sees the device at the new one.
+	Reboot bool
+}
+
+// PlanStaticIPs computes a static address for every selected device from the
+// manifest's ip_pools. A device whose current address lies in its pool keeps
+// it; the others get the lowest free address of their pool, skipping every
+// address used by a manifest device. Devices matching no pool are left out.
+func (sm *SyncManager) PlanStaticIPs(deviceFilter []string) ([]IPAssignment, error) {
+	pools := sm.manifest.IPPools
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("the manifest defines no ip_pools")
+	}
+
+	poolAddresses := make([][]netip.Addr, len(pools))
+	for i, pool := range pools {
+		addresses, err := pool.Addresses()
+		if err != nil {
+			return nil, err
+		}
+		poolAddresses[i] = addresses
+	}
+
+	// Addresses of devices outside the selection stay taken
+	used := make(map[netip.Addr]string)
+	for _, device := range sm.manifest.Devices {
+		if addr, err := netip.ParseAddr(device.IPAddress); err == nil {
+			used[addr] = device.DeviceID
+		}
+	}
+
+	selected := append([]storage.Device(nil), sm.SelectDevices(deviceFilter)...)
+	sort.SliceStable(selected, func(i, j int) bool {
+		return strings.ToLower(selected[i].Name) < strings.ToLower(selected[j].Name)
+	})
+
+	members := make([][]storage.Device, len(pools))
+	for _, device := range selected {
+		// Match on the area from device.yaml too
+		withNotes := device
+		withNotes.DeviceNotes = sm.DeviceNotes(device)
+		for i, pool := range pools {
+			if poolMatches(withNotes, pool) {
+				members[i] = append(members[i], device)
+				break
+			}
+		}
+	}
+
+	var plan []IPAssignment
+	for i, pool := range pools {
+		inPool := make(map[netip.Addr]bool, len(poolAddresses[i]))
+		for _, addr := range poolAddresses[i] {
+			inPool[addr] = true
+		}
+
+		// Keep current addresses first so adding a device never moves another
+		var moving []storage.Device
+		for _, device := range members[i] {
+			if device.MACAddress == "" {
+				assignment := newIPAssignment(device, pool.Name, netip.Addr{}, IPActionSkip)
+				assignment.Reason = "no MAC address in the manifest"
+				plan = append(plan, assignment)
+				continue
+			}
+			if device.Transport == storage.TransportCloud {
+				assignment := newIPAssignment(device, pool.Name, netip.Addr{}, IPActionSkip)
+				assignment.Reason = "reached through Shelly Cloud, not on this network"
+				plan = append(plan, assignment)
+				continue
+			}
+			addr, err := netip.ParseAddr(device.IPAddress)
+			if err == nil && inPool[addr] && used[addr] == device.DeviceID {
+				plan = append(plan, newIPAssignment(device, pool.Name, addr, IPActionReserve))
+				continue
+			}
+			moving = append(moving, device)
+		}
+
+		next := 0
+		for _, device := range moving {
+			for next < len(poolAddresses[i]) && used[poolAddresses[i][next]] != "" {
+				next++
+			}
+			if next == len(poolAddresses[i]) {
+				assignment := newIPAssignment(device, pool.Name, netip.Addr{}, IPActionSkip)
+				assignment.Reason = fmt.Sprintf("pool %s is exhausted", pool.Name)
+				plan = append(plan, assignment)
+				continue
+			}
+
+			// The current address stays taken: the device holds it until it renews
+			addr := poolAddresses[i][next]
+			used[addr] = device.DeviceID
+			plan = append(plan, newIPAssignment(device, pool.Name, addr, IPActionMove))
+		}
+	}
+
+	sort.SliceStable(plan, func(i, j int) bool {
+		a, errA := netip.ParseAddr(plan[i].DesiredIP)
+		b, errB := netip.ParseAddr(plan[j].DesiredIP)
+		if errA != nil || errB != nil {
+			return errB != nil && errA == nil
+		}
+		return a.Less(b)
+	})
+	return plan, nil
+}
+
+// poolMatches reports whether a device belongs to a pool
+func poolMatches(device storage.Device, pool storage.IPPool) bool {
+	if len(pool.Devices) == 0 {
+		return true
+	}
+	for _, filter := range pool.Devices {
+		if matchesDeviceFilter(device, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// newIPAssignment creates the plan entry for a device
+func newIPAssignment(device storage.Device, pool string, addr netip.Addr, action string) IPAssignment {
+	hostname := hostLabel(device.Name)
+	if hostname == "" {
+		hostname = hostLabel(device.DeviceID)
+	}
+
+	assignment := IPAssignment{
+		DeviceID:   device.DeviceID,
+		Name:       device.Name,
+		MACAddress: device.MACAddress,
+		Hostname:   hostname,
+		Pool:       pool,
+		CurrentIP:  device.IPAddress,
+		Action:     action,
+	}
+	if addr.IsValid() {
+		assignment.DesiredIP = addr.String()
+	}
+	return assignment
+}
+
+// ApplyIPPlan creates or updates a DHCP reservation on the provider for every
+// assignment that isn't skipped. Reservations are applied in plan order and
+// the first failure stops the run; the applied assignments are returned.
+func (sm *SyncManager) ApplyIPPlan(ctx context.Context, provider discovery.Provider, plan []IPAssignment, opts IPPlanOptions) ([]IPAssignment, error) {
+	var applied []IPAssignment
+	manifestChanged := false
+
+	for _, assignment := range plan {
+		if assignment.Action == IPActionSkip {
+			continue
+		}
+
+		lease := discovery.DHCPLease{
+			MACAddress: assignment.MACAddress,
+			IPAddress:  assignment.DesiredIP,
+			Hostname:   assignment.Hostname,
+		}
+		if err := provider.SetDHCPLease(ctx, lease); err != nil {
+			return applied, fmt.Errorf("failed to reserve %s for %s: %w", assignment.DesiredIP, assignment.Name, err)
+		}
+		applied = append(applied, assignment)
+
+		if assignment.Action != IPActionMove {
+			continue
+		}
+		if !opts.Reboot {
+			fmt.Fprintf(os.Stderr, "Info: %s moves from %s to %s on its next DHCP renewal\n", assignment.Name, assignment.CurrentIP, assignment.DesiredIP)
+			continue
+		}
+
+		sm.noteReboot(assignment.DeviceID, defaultRebootTimeout)
+		if err := sm.shellyClient.Reboot(ctx, assignment.CurrentIP); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to reboot %s onto %s: %v%s\n", assignment.Name, assignment.DesiredIP, err, hintSuffix(err))
+			continue
+		}
+		if device := sm.manifest.GetDevice(assignment.DeviceID); device != nil {
+			device.IPAddress = assignment.DesiredIP
+			sm.manifest.AddDevice(*device)
+			sm.InvalidateDeviceCache(device.DeviceID)
+			manifestChanged = true
+		}
+	}
+
+	if manifestChanged {
+		if err := sm.manifest.Save(); err != nil {
+			return applied, fmt.Errorf("failed to save manifest: %w", err)
+		}
+	}
+	return applied, nil
+}
@@ -0,0 +1,160 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Journal entry statuses
+const (
+	JournalInProgress = "in_progress"
+	JournalComplete   = "complete"
+	JournalFailed     = "failed"
+)
+
+// JournalEntry records the state of the last mutating operation on a device
+type JournalEntry struct {
+	DeviceID    string     `json:"device_id"`
+	Operation   string     `json:"operation"`
+	Commit      string     `json:"commit,omitempty"`
+	Status      string     `json:"status"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Journal persists per-device operation entries so interrupted runs can be detected
+type Journal struct {
+	path    string
+	mu      sync.Mutex
+	Entries map[string]JournalEntry `json:"entries"`
+}
+
+// LoadJournal loads the journal from path, returning an empty journal if it doesn't exist
+func LoadJournal(path string) (*Journal, error) {
+	journal := &Journal{
+		path:    path,
+		Entries: make(map[string]JournalEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return journal, nil
+		}
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	if err := json.Unmarshal(data, journal); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal journal: %w", err)
+	}
+	if journal.Entries == nil {
+		journal.Entries = make(map[string]JournalEntry)
+	}
+
+	return journal, nil
+}
+
+// Begin records that an operation is about to mutate a device
+func (j *Journal) Begin(deviceID, operation, commit string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Entries[deviceID] = JournalEntry{
+		DeviceID:  deviceID,
+		Operation: operation,
+		Commit:    commit,
+		Status:    JournalInProgress,
+		StartedAt: time.Now(),
+	}
+
+	return j.saveLocked()
+}
+
+// Complete marks the device's current operation as finished, successfully or not
+func (j *Journal) Complete(deviceID string, opErr error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.Entries[deviceID]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	entry.CompletedAt = &now
+	entry.Status = JournalComplete
+	entry.Error = ""
+	if opErr != nil {
+		entry.Status = JournalFailed
+		entry.Error = opErr.Error()
+	}
+	j.Entries[deviceID] = entry
+
+	return j.saveLocked()
+}
+
+// Pending returns entries that were interrupted or failed, oldest first
+func (j *Journal) Pending() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var pending []JournalEntry
+	for _, entry := range j.Entries {
+		if entry.Status != JournalComplete {
+			pending = append(pending, entry)
+		}
+	}
+
+	sort.Slice(pending, func(a, b int) bool {
+		return pending[a].StartedAt.Before(pending[b].StartedAt)
+	})
+
+	return pending
+}
+
+// saveLocked writes the journal atomically; the caller must hold j.mu
+func (j *Journal) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal: %w", err)
+	}
+
+	tmpPath := j.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return fmt.Errorf("failed to replace journal: %w", err)
+	}
+
+	return nil
+}
+
+// Prune drops entries for devices keep rejects and returns how many were removed
+func (j *Journal) Prune(keep func(deviceID string) bool) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	removed := 0
+	for deviceID := range j.Entries {
+		if !keep(deviceID) {
+			delete(j.Entries, deviceID)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	return removed, j.saveLocked()
+}
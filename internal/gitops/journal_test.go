@@ -0,0 +1,43 @@
+package gitops_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darkermage/shelly-git-ops/internal/gitops"
+)
+
+func TestPushJournalRetriesDevicesWithFailedComponents(t *testing.T) {
+	sm, fleet, dir := pulledFleet(t, 2)
+	devices := fleet.ManifestDevices()
+	broken := filepath.Join(dir, devices[0].Folder, "configs", "mqtt.json")
+	original, err := os.ReadFile(broken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	breakTemplates(t, dir, devices[:1])
+
+	if _, err := sm.PushToDevices(context.Background(), false, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := sm.InterruptedDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].DeviceID != devices[0].DeviceID || pending[0].Status != gitops.JournalFailed {
+		t.Fatalf("pending journal entries %+v, want %s failed", pending, devices[0].DeviceID)
+	}
+
+	// Once every component is applied, the device is complete
+	if err := os.WriteFile(broken, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.PushToDevices(context.Background(), false, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err = sm.InterruptedDevices(); err != nil || len(pending) != 0 {
+		t.Fatalf("pending journal entries %+v (%v) after a clean push, want none", pending, err)
+	}
+}
@@ -0,0 +1,64 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// ExportKVS writes a device's kvs/data.json to path as dotenv, YAML or JSON,
+// chosen by the file name (see storage.KVSFormatFromPath)
+func (sm *SyncManager) ExportKVS(deviceRef, path string) error {
+	device := sm.findDevice(deviceRef)
+	if device == nil {
+		return fmt.Errorf("device %s not found in manifest", deviceRef)
+	}
+
+	kvs, err := sm.deviceStorage.LoadKVS(device.Folder)
+	if err != nil {
+		return err
+	}
+	data, err := storage.MarshalKVS(storage.KVSFormatFromPath(path), kvs)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// ImportKVS reads a dotenv, YAML or JSON file into a device's kvs/data.json
+// and returns how many keys it set. Keys missing from the file are kept
+// unless replace is set. Push to apply the result to the device.
+func (sm *SyncManager) ImportKVS(deviceRef, path string, replace bool) (int, error) {
+	device := sm.findDevice(deviceRef)
+	if device == nil {
+		return 0, fmt.Errorf("device %s not found in manifest", deviceRef)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	imported, err := storage.UnmarshalKVS(storage.KVSFormatFromPath(path), data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	kvs := make(map[string]interface{})
+	if !replace {
+		if kvs, err = sm.deviceStorage.LoadKVS(device.Folder); err != nil {
+			return 0, err
+		}
+	}
+	for key, value := range imported {
+		kvs[key] = value
+	}
+
+	if err := sm.deviceStorage.SaveKVS(device.Folder, kvs); err != nil {
+		return 0, err
+	}
+	return len(imported), nil
+}
@@ -0,0 +1,96 @@
+package gitops
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// kvsCallPattern matches Shelly.call("KVS.<Method>", {key: "<key>" ...}) in script code
+var kvsCallPattern = regexp.MustCompile(`Shelly\.call\(\s*["']KVS\.(Get|Set|Delete)["']\s*,\s*\{[^}]*?["']?key["']?\s*:\s*["']([^"']+)["']`)
+
+// ScriptKVSReport lists the KVS keys a script depends on
+type ScriptKVSReport struct {
+	DeviceID    string
+	DeviceName  string
+	ScriptID    int
+	ScriptName  string
+	Reads       []string
+	Writes      []string
+	Deletes     []string
+	MissingKeys []string // keys read by the script that are absent from kvs/data.json
+}
+
+// ExtractKVSKeys returns the KVS keys read, written and deleted by script code
+// Only calls with a literal key are detected; computed keys are not visible statically.
+func ExtractKVSKeys(code string) (reads, writes, deletes []string) {
+	seen := make(map[string]bool)
+	for _, match := range kvsCallPattern.FindAllStringSubmatch(code, -1) {
+		method, key := match[1], match[2]
+		if seen[method+":"+key] {
+			continue
+		}
+		seen[method+":"+key] = true
+
+		switch method {
+		case "Get":
+			reads = append(reads, key)
+		case "Set":
+			writes = append(writes, key)
+		case "Delete":
+			deletes = append(deletes, key)
+		}
+	}
+
+	sort.Strings(reads)
+	sort.Strings(writes)
+	sort.Strings(deletes)
+	return reads, writes, deletes
+}
+
+// KVSDependencies reports which KVS keys each script in the fleet depends on,
+// flagging keys a script reads that are not present in the device's kvs/data.json
+func (sm *SyncManager) KVSDependencies(deviceFilter []string) ([]ScriptKVSReport, error) {
+	var reports []ScriptKVSReport
+
+	for _, device := range sm.SelectDevices(deviceFilter) {
+		scripts, err := sm.deviceStorage.ListScripts(device.Folder)
+		if err != nil {
+			// No scripts folder - nothing to analyze
+			continue
+		}
+
+		kvs, err := sm.deviceStorage.LoadKVS(device.Folder)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load KVS for %s: %w", device.Name, err)
+		}
+
+		sort.Slice(scripts, func(i, j int) bool { return scripts[i].ID < scripts[j].ID })
+		for _, script := range scripts {
+			code, err := sm.deviceStorage.LoadScript(device.Folder, script.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load script %d for %s: %w", script.ID, device.Name, err)
+			}
+
+			report := ScriptKVSReport{
+				DeviceID:   device.DeviceID,
+				DeviceName: device.Name,
+				ScriptID:   script.ID,
+				ScriptName: script.Name,
+			}
+			report.Reads, report.Writes, report.Deletes = ExtractKVSKeys(code)
+
+			for _, key := range report.Reads {
+				if _, ok := kvs[key]; !ok {
+					report.MissingKeys = append(report.MissingKeys, key)
+				}
+			}
+
+			if len(report.Reads) > 0 || len(report.Writes) > 0 || len(report.Deletes) > 0 {
+				reports = append(reports, report)
+			}
+		}
+	}
+
+	return reports, nil
+}
@@ -0,0 +1,263 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// lockHeartbeatInterval is how often a held lock is refreshed
+	lockHeartbeatInterval = 30 * time.Second
+
+	// staleLockAge is how long a lock may go without a heartbeat before it is
+	// considered abandoned, e.g. by a killed process
+	staleLockAge = 2 * time.Minute
+)
+
+// LockInfo describes the process holding the repository lock
+type LockInfo struct {
+	PID        int       `json:"pid"`
+	Host       string    `json:"host"`
+	Operation  string    `json:"operation"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	Heartbeat  time.Time `json:"heartbeat"`
+}
+
+// Stale reports whether the holder stopped refreshing the lock
+func (l *LockInfo) Stale() bool {
+	return time.Since(l.Heartbeat) > staleLockAge
+}
+
+// lockPath returns the location of the repository lock file
+func (sm *SyncManager) lockPath() string {
+	return filepath.Join(sm.StateDir(), "lock.json")
+}
+
+// LockRepo takes the advisory repository lock for operation, so concurrent
+// invocations (e.g. cron and a manual run) can't interleave writes to the
+// repository and devices. The lock is refreshed in the background until the
+// returned release function is called. Locks whose heartbeat is older than
+// two minutes are taken over, as are unreadable lock files not modified for
+// as long. Calls nest within one SyncManager: pull and push take the lock
+// themselves, and callers may hold it around them.
+func (sm *SyncManager) LockRepo(operation string) (func(), error) {
+	sm.lockMu.Lock()
+	defer sm.lockMu.Unlock()
+
+	if sm.lockDepth > 0 {
+		sm.lockDepth++
+		return sm.releaseLock, nil
+	}
+
+	if err := os.MkdirAll(sm.StateDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	now := time.Now()
+	info := LockInfo{PID: os.Getpid(), Host: host, Operation: operation, AcquiredAt: now, Heartbeat: now}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal lock: %w", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := sm.createLock(data)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		holder, readErr := sm.ReadLock()
+		if readErr != nil {
+			return nil, readErr
+		}
+		if (holder != nil && !holder.Stale()) || attempt > 0 {
+			return nil, fmt.Errorf("repository is locked by %s", describeLock(holder))
+		}
+		if holder != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Taking over stale lock held by %s\n", describeLock(holder))
+			if err := sm.removeStaleLock(holder); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sm.lockDepth = 1
+	sm.lockInfo = info
+	sm.lockStop = make(chan struct{})
+	go sm.heartbeatLock(info, sm.lockStop)
+
+	return sm.releaseLock, nil
+}
+
+// createLock creates the lock file with data, failing with an os.IsExist
+// error if it already exists. The data is written to a temporary file first
+// and hard-linked into place, so the lock file is never seen empty or half
+// written.
+func (sm *SyncManager) createLock(data []byte) error {
+	tmp, err := os.CreateTemp(sm.StateDir(), "lock-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create lock: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write lock: %w", err)
+	}
+	err = os.Link(tmp.Name(), sm.lockPath())
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create lock: %w", err)
+	}
+	return err
+}
+
+// removeStaleLock removes the lock file if it still is the stale lock read
+// before. Another process may have taken the same lock over and created its
+// own in the meantime, so the file is renamed aside first, which only one
+// process can do, and put back unless it is the stale lock.
+func (sm *SyncManager) removeStaleLock(stale *LockInfo) error {
+	aside := fmt.Sprintf("%s.%d-%d.stale", sm.lockPath(), os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(sm.lockPath(), aside); err != nil {
+		if os.IsNotExist(err) {
+			return nil // already removed by another process taking it over
+		}
+		return fmt.Errorf("failed to remove stale lock: %w", err)
+	}
+	defer os.Remove(aside)
+
+	moved, err := readLockFile(aside)
+	if err == nil && moved.heldBy(*stale) && moved.Heartbeat.Equal(stale.Heartbeat) {
+		return nil
+	}
+	// Put back the lock of the process that took over first; if yet another
+	// process locked meanwhile, that one keeps the lock
+	if err := os.Link(aside, sm.lockPath()); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to restore lock: %w", err)
+	}
+	return nil
+}
+
+// releaseLock undoes one LockRepo call and removes the lock file when the
+// outermost holder releases it
+func (sm *SyncManager) releaseLock() {
+	sm.lockMu.Lock()
+	defer sm.lockMu.Unlock()
+
+	if sm.lockDepth == 0 {
+		return
+	}
+	sm.lockDepth--
+	if sm.lockDepth > 0 {
+		return
+	}
+
+	close(sm.lockStop)
+	sm.lockStop = nil
+	if holder, err := sm.ReadLock(); err == nil && holder.heldBy(sm.lockInfo) {
+		os.Remove(sm.lockPath())
+	}
+}
+
+// heartbeatLock refreshes the lock file until stop is closed. If another
+// process took the lock over in the meantime it is left alone.
+func (sm *SyncManager) heartbeatLock(info LockInfo, stop chan struct{}) {
+	ticker := time.NewTicker(lockHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		sm.lockMu.Lock()
+		holder, err := sm.ReadLock()
+		if err == nil && holder.heldBy(info) {
+			info.Heartbeat = time.Now()
+			if data, err := json.MarshalIndent(info, "", "  "); err == nil {
+				tmpPath := sm.lockPath() + ".tmp"
+				if os.WriteFile(tmpPath, data, 0644) == nil {
+					os.Rename(tmpPath, sm.lockPath())
+				}
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Repository lock for %s was taken over by another process\n", info.Operation)
+		}
+		sm.lockMu.Unlock()
+	}
+}
+
+// ReadLock returns the current lock holder, or nil if the repository isn't locked
+func (sm *SyncManager) ReadLock() (*LockInfo, error) {
+	return readLockFile(sm.lockPath())
+}
+
+// readLockFile reads the lock file at path, see ReadLock
+func readLockFile(path string) (*LockInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read lock: %w", err)
+	}
+
+	var info LockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		// A corrupt lock can't be refreshed by anyone, so it counts as held
+		// until it has gone unmodified for as long as a stale heartbeat
+		unknown := &LockInfo{Operation: "unknown"}
+		if stat, err := os.Stat(path); err == nil {
+			unknown.Heartbeat = stat.ModTime()
+		} else {
+			unknown.Heartbeat = time.Now()
+		}
+		return unknown, nil
+	}
+	return &info, nil
+}
+
+// heldBy reports whether the lock is the one taken as info, by the same
+// process on the same host at the same time
+func (l *LockInfo) heldBy(info LockInfo) bool {
+	return l != nil && l.PID == info.PID && l.Host == info.Host && l.AcquiredAt.Equal(info.AcquiredAt)
+}
+
+// ForceUnlock removes the repository lock regardless of its holder and returns
+// who held it (nil if it wasn't locked). Only use it for locks left behind by a
+// process that is known to be gone.
+func (sm *SyncManager) ForceUnlock() (*LockInfo, error) {
+	holder, err := sm.ReadLock()
+	if err != nil || holder == nil {
+		return nil, err
+	}
+	if err := os.Remove(sm.lockPath()); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove lock: %w", err)
+	}
+	return holder, nil
+}
+
+// describeLock renders a lock holder for error messages
+func describeLock(info *LockInfo) string {
+	if info == nil {
+		return "another process"
+	}
+	if info.PID == 0 {
+		return fmt.Sprintf("an unreadable lock file (last modified %s ago; use --force-unlock if its holder is gone)",
+			time.Since(info.Heartbeat).Round(time.Second))
+	}
+	return fmt.Sprintf("%s (pid %d on %s, since %s, last heartbeat %s ago; use --force-unlock if it is gone)",
+		info.Operation, info.PID, info.Host, info.AcquiredAt.Format(time.RFC3339),
+		time.Since(info.Heartbeat).Round(time.Second))
+}
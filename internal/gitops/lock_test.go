@@ -0,0 +1,110 @@
+package gitops
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockContenders returns SyncManagers on one repository, standing in for
+// processes competing for its lock, whose lock file is stale
+func lockContenders(t *testing.T, count int) []*SyncManager {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := InitRepository(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	managers := make([]*SyncManager, count)
+	for i := range managers {
+		sm, err := NewSyncManager(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		managers[i] = sm
+	}
+	if err := os.MkdirAll(managers[0].StateDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeStaleLock(t, managers[0])
+	return managers
+}
+
+// writeStaleLock leaves a lock behind as a killed process would
+func writeStaleLock(t *testing.T, sm *SyncManager) {
+	t.Helper()
+	abandoned := time.Now().Add(-time.Hour)
+	data, err := json.Marshal(LockInfo{PID: 1, Host: "gone", Operation: "push", AcquiredAt: abandoned, Heartbeat: abandoned})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sm.lockPath(), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleLockTakeoverKeepsTheWinnersLock(t *testing.T) {
+	managers := lockContenders(t, 2)
+	a, b := managers[0], managers[1]
+
+	// Both see the stale lock, then b takes it over before a removes it
+	stale, err := a.ReadLock()
+	if err != nil || stale == nil || !stale.Stale() {
+		t.Fatalf("ReadLock() = %v, %v; want the stale lock", stale, err)
+	}
+	release, err := b.LockRepo("push")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	if err := a.removeStaleLock(stale); err != nil {
+		t.Fatal(err)
+	}
+	if holder, err := a.ReadLock(); err != nil || !holder.heldBy(b.lockInfo) {
+		t.Fatalf("lock after the late takeover is %v (%v), want the winner's", holder, err)
+	}
+	if _, err := a.LockRepo("pull"); err == nil {
+		t.Fatal("second process took over the lock too")
+	}
+}
+
+func TestStaleLockIsTakenOverByOneProcess(t *testing.T) {
+	const contenders = 8
+	managers := lockContenders(t, contenders)
+
+	for round := 0; round < 50; round++ {
+		if round > 0 {
+			writeStaleLock(t, managers[0])
+		}
+
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		releases := make([]func(), contenders)
+		for i, sm := range managers {
+			wg.Add(1)
+			go func(i int, sm *SyncManager) {
+				defer wg.Done()
+				<-start
+				if release, err := sm.LockRepo("push"); err == nil {
+					releases[i] = release
+				}
+			}(i, sm)
+		}
+		close(start)
+		wg.Wait()
+
+		held := 0
+		for _, release := range releases {
+			if release != nil {
+				held++
+				release()
+			}
+		}
+		if held != 1 {
+			t.Fatalf("round %d: %d processes took over the stale lock, want exactly 1", round, held)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// MaintenanceOptions selects which maintenance tasks to run
+type MaintenanceOptions struct {
+	DryRun       bool // only report what would be removed
+	PruneFolders bool // remove folders of devices no longer in the manifest
+	CompactState bool // drop local journal and health records of removed devices
+	Housekeep    bool // repack and prune git objects
+}
+
+// MaintenanceResult reports what maintenance changed
+type MaintenanceResult struct {
+	PrunedFolders  []string
+	JournalEntries int // journal entries removed
+	HealthRecords  int // health records removed
+	Housekept      bool
+}
+
+// OrphanedFolders returns top-level folders that contain a device.yaml but
+// don't belong to any device in the manifest
+func (sm *SyncManager) OrphanedFolders() ([]string, error) {
+	entries, err := os.ReadDir(sm.repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository: %w", err)
+	}
+
+	known := make(map[string]bool, len(sm.manifest.Devices))
+	for _, device := range sm.manifest.Devices {
+		known[device.Folder] = true
+	}
+
+	var orphaned []string
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == ".git" || known[entry.Name()] {
+			continue
+		}
+		if _, err := sm.deviceStorage.LoadDeviceMetadata(entry.Name()); err != nil {
+			continue // not a device folder
+		}
+		orphaned = append(orphaned, entry.Name())
+	}
+	sort.Strings(orphaned)
+
+	return orphaned, nil
+}
+
+// Maintain keeps long-lived fleet repositories from growing unbounded.
+// Removed folders are left as working tree changes for the caller to commit.
+func (sm *SyncManager) Maintain(opts MaintenanceOptions) (*MaintenanceResult, error) {
+	result := &MaintenanceResult{}
+
+	if opts.PruneFolders {
+		orphaned, err := sm.OrphanedFolders()
+		if err != nil {
+			return result, err
+		}
+		for _, folder := range orphaned {
+			if !opts.DryRun {
+				if err := sm.deviceStorage.RemoveDevice(folder); err != nil {
+					return result, fmt.Errorf("failed to remove %s: %w", folder, err)
+				}
+			}
+			result.PrunedFolders = append(result.PrunedFolders, folder)
+		}
+	}
+
+	if opts.CompactState {
+		inManifest := func(deviceID string) bool {
+			return sm.manifest.GetDevice(deviceID) != nil
+		}
+
+		journal, err := LoadJournal(sm.journalPath())
+		if err != nil {
+			return result, err
+		}
+		if opts.DryRun {
+			for deviceID := range journal.Entries {
+				if !inManifest(deviceID) {
+					result.JournalEntries++
+				}
+			}
+			for _, h := range sm.health.All() {
+				if !inManifest(h.DeviceID) {
+					result.HealthRecords++
+				}
+			}
+		} else {
+			if result.JournalEntries, err = journal.Prune(inManifest); err != nil {
+				return result, err
+			}
+			if result.HealthRecords = sm.health.Prune(inManifest); result.HealthRecords > 0 {
+				if err := sm.health.Save(); err != nil {
+					return result, err
+				}
+			}
+			// The device cache is rebuilt on demand, so it is simply dropped
+			if err := os.RemoveAll(filepath.Join(sm.StateDir(), "cache")); err != nil {
+				return result, fmt.Errorf("failed to clear device cache: %w", err)
+			}
+		}
+	}
+
+	if opts.Housekeep && !opts.DryRun {
+		if err := sm.repo.Housekeep(); err != nil {
+			return result, err
+		}
+		result.Housekept = true
+	}
+
+	return result, nil
+}
@@ -0,0 +1,366 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// Component remap actions
+const (
+	RemapKeep = "keep" // the new model has the same component
+	RemapMove = "move" // the stored config moves to another component of the same type
+	RemapAdd  = "add"  // only the new model has the component; its config starts from a template
+	RemapDrop = "drop" // the new model has no matching component; the stored config is removed
+)
+
+// ComponentRemap maps one stored component onto the new model
+type ComponentRemap struct {
+	From   string `json:"from,omitempty"` // component key in the device folder
+	To     string `json:"to,omitempty"`   // component key on the new model
+	Action string `json:"action"`
+	Source string `json:"source,omitempty"` // template of an added component
+}
+
+// ModelRemapPlan translates a device folder written for one model to the
+// components of the model now installed in its place
+type ModelRemapPlan struct {
+	DeviceID   string           `json:"device_id"`
+	Name       string           `json:"name"`
+	FromModel  string           `json:"from_model"`
+	ToModel    string           `json:"to_model"`
+	Components []ComponentRemap `json:"components"`
+
+	templates map[string]json.RawMessage // configs of added components by key
+}
+
+// ModelRemapOptions controls PlanModelRemap
+type ModelRemapOptions struct {
+	// Map overrides the automatic pairing of stored components with the new
+	// model's, e.g. {"switch:0": "switch:1"}. An empty target drops the
+	// stored component.
+	Map map[string]string
+}
+
+// PlanModelRemap pairs the components stored for a device with those of the
+// model that now answers at its address, after ReplaceDevice adopted
+// hardware of a different model (e.g. a Plus 1 replaced by a Plus 2PM).
+// Components the new model has too are kept, the others move to a free
+// component of the same type or are dropped, and components only the new
+// model has are added from its baseline (baselines/<model>/), or from the
+// device's current config when there is none. Nothing is written until
+// ApplyModelRemap.
+func (sm *SyncManager) PlanModelRemap(ctx context.Context, deviceID string, opts ModelRemapOptions) (*ModelRemapPlan, error) {
+	device := sm.manifest.GetDevice(deviceID)
+	if device == nil {
+		return nil, fmt.Errorf("device %s not found in manifest", deviceID)
+	}
+
+	info, err := sm.shellyClient.GetDeviceInfo(ctx, device.IPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device info: %w%s", err, hintSuffix(err))
+	}
+	if swap := detectDeviceSwap(*device, info); swap != nil {
+		return nil, fmt.Errorf("%w; adopt the new hardware with ReplaceDevice first", swap)
+	}
+
+	plan := &ModelRemapPlan{
+		DeviceID:  device.DeviceID,
+		Name:      device.Name,
+		FromModel: device.Model,
+		ToModel:   info.Model,
+		templates: make(map[string]json.RawMessage),
+	}
+	if metadata, err := sm.deviceStorage.LoadDeviceMetadata(device.Folder); err == nil && metadata.Model != "" {
+		plan.FromModel = metadata.Model
+	}
+
+	data, err := sm.shellyClient.GetShellyConfig(ctx, device.IPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device config: %w%s", err, hintSuffix(err))
+	}
+	var live map[string]json.RawMessage
+	if err := json.Unmarshal(data, &live); err != nil {
+		return nil, fmt.Errorf("failed to parse device config: %w", err)
+	}
+	for key := range live {
+		if !remappable(key) {
+			delete(live, key)
+		}
+	}
+
+	files, err := sm.deviceStorage.ListComponentConfigs(device.Folder)
+	if err != nil {
+		return nil, err
+	}
+	var stored []string
+	for _, file := range files {
+		if key := strings.Replace(file, "-", ":", 1); remappable(key) {
+			stored = append(stored, key)
+		}
+	}
+	sort.Slice(stored, func(i, j int) bool { return componentLess(stored[i], stored[j]) })
+
+	claimed := make(map[string]bool)
+	paired := make(map[string]string)
+	for from, to := range opts.Map {
+		if to == "" {
+			paired[from] = ""
+			continue
+		}
+		if _, ok := live[to]; !ok {
+			return nil, fmt.Errorf("%s has no component %s", info.Model, to)
+		}
+		if claimed[to] {
+			return nil, fmt.Errorf("component %s is mapped more than once", to)
+		}
+		paired[from] = to
+		claimed[to] = true
+	}
+
+	// Same key first, so a free component of the type is only taken when needed
+	for _, from := range stored {
+		if _, ok := paired[from]; ok {
+			continue
+		}
+		if _, ok := live[from]; ok && !claimed[from] {
+			paired[from] = from
+			claimed[from] = true
+		}
+	}
+
+	for _, from := range stored {
+		to, ok := paired[from]
+		if !ok {
+			to = freeComponent(live, claimed, componentType(from))
+			if to != "" {
+				claimed[to] = true
+			}
+		}
+
+		switch {
+		case to == "":
+			plan.Components = append(plan.Components, ComponentRemap{From: from, Action: RemapDrop})
+		case to == from:
+			plan.Components = append(plan.Components, ComponentRemap{From: from, To: to, Action: RemapKeep})
+		default:
+			plan.Components = append(plan.Components, ComponentRemap{From: from, To: to, Action: RemapMove})
+		}
+	}
+
+	baseline, _ := sm.deviceStorage.LoadBaseline(info.Model)
+	for key, config := range live {
+		if claimed[key] {
+			continue
+		}
+		remap := ComponentRemap{To: key, Action: RemapAdd, Source: "device defaults"}
+		if template, ok := baseline[strings.ReplaceAll(key, ":", "-")]; ok {
+			config = template
+			remap.Source = fmt.Sprintf("baseline %s", strings.ToLower(info.Model))
+		}
+		plan.templates[key] = config
+		plan.Components = append(plan.Components, remap)
+	}
+
+	sort.SliceStable(plan.Components, func(i, j int) bool {
+		return componentLess(remapKey(plan.Components[i]), remapKey(plan.Components[j]))
+	})
+	return plan, nil
+}
+
+// ApplyModelRemap rewrites the device folder according to the plan: moved
+// configs and their merge patches are renamed with their id updated, dropped
+// ones are removed and added ones written from their template. The device
+// metadata takes the new model. Review the result, then push.
+func (sm *SyncManager) ApplyModelRemap(plan *ModelRemapPlan) error {
+	device := sm.manifest.GetDevice(plan.DeviceID)
+	if device == nil {
+		return fmt.Errorf("device %s not found in manifest", plan.DeviceID)
+	}
+
+	// Read every moved config before writing, so components can swap places
+	type movedConfig struct {
+		to     string
+		config json.RawMessage
+		patch  json.RawMessage
+	}
+	var moved []movedConfig
+	for _, remap := range plan.Components {
+		if remap.Action != RemapMove {
+			continue
+		}
+		file := strings.ReplaceAll(remap.From, ":", "-")
+		config, err := sm.deviceStorage.LoadComponentConfig(device.Folder, file)
+		if err != nil {
+			return err
+		}
+		config, err = withComponentID(config, remap.To)
+		if err != nil {
+			return fmt.Errorf("failed to remap %s: %w", remap.From, err)
+		}
+		patch, err := sm.deviceStorage.LoadComponentPatch(device.Folder, file)
+		if err != nil {
+			return err
+		}
+		moved = append(moved, movedConfig{to: remap.To, config: config, patch: patch})
+	}
+
+	for _, remap := range plan.Components {
+		if remap.Action == RemapMove || remap.Action == RemapDrop {
+			if err := sm.deviceStorage.DeleteComponentConfig(device.Folder, strings.ReplaceAll(remap.From, ":", "-")); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, m := range moved {
+		file := strings.ReplaceAll(m.to, ":", "-")
+		if err := sm.deviceStorage.SaveComponentConfig(device.Folder, file, m.config); err != nil {
+			return err
+		}
+		if m.patch != nil {
+			if err := sm.deviceStorage.SaveComponentPatch(device.Folder, file, m.patch); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, remap := range plan.Components {
+		if remap.Action != RemapAdd {
+			continue
+		}
+		if err := sm.deviceStorage.SaveComponentConfig(device.Folder, strings.ReplaceAll(remap.To, ":", "-"), plan.templates[remap.To]); err != nil {
+			return err
+		}
+	}
+
+	metadata, err := sm.deviceStorage.LoadDeviceMetadata(device.Folder)
+	if err != nil {
+		return fmt.Errorf("failed to load metadata: %w", err)
+	}
+	metadata.Model = plan.ToModel
+	if err := sm.deviceStorage.SaveDeviceMetadata(device.Folder, *metadata); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+
+	if device.Model != plan.ToModel {
+		device.Model = plan.ToModel
+		sm.manifest.AddDevice(*device)
+		if err := sm.manifest.Save(); err != nil {
+			return fmt.Errorf("failed to update manifest: %w", err)
+		}
+	}
+	sm.InvalidateDeviceCache(device.DeviceID)
+	return nil
+}
+
+// String renders the plan as one line per component
+func (p *ModelRemapPlan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s -> %s\n", p.Name, p.FromModel, p.ToModel)
+	for _, remap := range p.Components {
+		switch remap.Action {
+		case RemapKeep:
+			fmt.Fprintf(&b, "  keep  %s\n", remap.From)
+		case RemapMove:
+			fmt.Fprintf(&b, "  move  %s -> %s\n", remap.From, remap.To)
+		case RemapAdd:
+			fmt.Fprintf(&b, "  add   %s (from %s)\n", remap.To, remap.Source)
+		case RemapDrop:
+			fmt.Fprintf(&b, "  drop  %s (not on %s)\n", remap.From, p.ToModel)
+		}
+	}
+	return b.String()
+}
+
+// remappable reports whether a component's config follows the hardware
+// model; cloud, scripts and virtual components are handled elsewhere
+func remappable(key string) bool {
+	componentType := componentType(key)
+	return componentType != "cloud" && componentType != "script" && !isVirtualComponentType(componentType)
+}
+
+// freeComponent returns the lowest unclaimed component of a type
+func freeComponent(live map[string]json.RawMessage, claimed map[string]bool, componentType string) string {
+	var free []string
+	for key := range live {
+		if !claimed[key] && strings.HasPrefix(key, componentType+":") {
+			free = append(free, key)
+		}
+	}
+	if len(free) == 0 {
+		return ""
+	}
+	sort.Slice(free, func(i, j int) bool { return componentLess(free[i], free[j]) })
+	return free[0]
+}
+
+// componentLess orders component keys by type, then numerically by id
+func componentLess(a, b string) bool {
+	typeA, idA, _ := strings.Cut(a, ":")
+	typeB, idB, _ := strings.Cut(b, ":")
+	if typeA != typeB {
+		return typeA < typeB
+	}
+	numA, errA := strconv.Atoi(idA)
+	numB, errB := strconv.Atoi(idB)
+	if errA == nil && errB == nil {
+		return numA < numB
+	}
+	return idA < idB
+}
+
+// remapKey returns the key a plan entry is sorted by
+func remapKey(remap ComponentRemap) string {
+	if remap.From != "" {
+		return remap.From
+	}
+	return remap.To
+}
+
+// withComponentID sets the id field of a component config to the id of key
+func withComponentID(config json.RawMessage, key string) (json.RawMessage, error) {
+	_, idStr, ok := strings.Cut(key, ":")
+	if !ok {
+		return config, nil
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return config, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(config, &fields); err != nil {
+		return nil, err
+	}
+	if _, ok := fields["id"]; !ok {
+		return config, nil
+	}
+	fields["id"] = id
+	return json.Marshal(fields)
+}
+
+// checkModelRemapped fails a push onto hardware of a different model than the
+// device folder was written for
+func checkModelRemapped(device storage.Device, metadata *storage.DeviceMetadata, model string) error {
+	if metadata == nil || metadata.Model == "" || model == "" || strings.EqualFold(metadata.Model, model) {
+		return nil
+	}
+	return fmt.Errorf("%s is now a %s but its folder holds %s configs; map them with PlanModelRemap and ApplyModelRemap before pushing",
+		device.Name, model, metadata.Model)
+}
+
+// printModelChange points at the remap step after a replacement changed the model
+func printModelChange(device storage.Device, previousModel string) {
+	if previousModel == "" || strings.EqualFold(previousModel, device.Model) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Info: %s changed model from %s to %s; map its configs with PlanModelRemap before pushing\n",
+		device.Name, previousModel, device.Model)
+}
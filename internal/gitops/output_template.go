@@ -0,0 +1,104 @@
+package gitops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// outputTemplateDir is the repository-level folder of custom output templates
+const outputTemplateDir = "output-templates"
+
+// Outputs that can be rendered with a custom template, by template name
+const (
+	OutputStatus = "status" // *FleetStatus
+	OutputPlan   = "plan"   // []DevicePlan
+	OutputSync   = "sync"   // SyncSummary
+)
+
+// outputTemplateFuncs are available in output templates on top of the
+// config template functions
+var outputTemplateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// SyncSummary is the data of the sync output template: the results of one
+// pull or push
+type SyncSummary struct {
+	Operation string // "pull" or "push"
+	Results   []SyncResult
+	Succeeded int
+	Failed    int
+}
+
+// NewSyncSummary counts the results of a pull or push for the sync template
+func NewSyncSummary(operation string, results []SyncResult) SyncSummary {
+	summary := SyncSummary{Operation: operation, Results: results}
+	for _, result := range results {
+		if result.Success {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+	}
+	return summary
+}
+
+// RenderOutput renders data with the custom output template name (OutputStatus,
+// OutputPlan or OutputSync) from output-templates/<name>.tmpl, so a team can
+// match its own reporting format. It returns false if the repository defines
+// no such template, in which case the caller uses the built-in format, e.g.
+// FormatPlan. Templates are Go templates over the structured results, with the
+// config template functions plus json, join, upper and lower.
+func (sm *SyncManager) RenderOutput(name string, data interface{}) (string, bool, error) {
+	tmpl, err := sm.loadOutputTemplate(name)
+	if err != nil || tmpl == nil {
+		return "", false, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", true, fmt.Errorf("failed to render %s output template: %w", name, err)
+	}
+	return buf.String(), true, nil
+}
+
+// loadOutputTemplate parses an output template, returning nil if it doesn't
+// exist
+func (sm *SyncManager) loadOutputTemplate(name string) (*template.Template, error) {
+	path := filepath.Join(sm.repoPath, outputTemplateDir, name+".tmpl")
+	text, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s output template: %w", name, err)
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).Funcs(outputTemplateFuncs).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s output template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// checkOutputTemplates returns the syntax errors of the output templates
+func (sm *SyncManager) checkOutputTemplates() []ValidationIssue {
+	var issues []ValidationIssue
+	for _, name := range []string{OutputStatus, OutputPlan, OutputSync} {
+		if _, err := sm.loadOutputTemplate(name); err != nil {
+			issues = append(issues, ValidationIssue{File: outputTemplateDir + "/" + name + ".tmpl", Message: err.Error()})
+		}
+	}
+	return issues
+}
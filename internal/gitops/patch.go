@@ -0,0 +1,79 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// MergePatch applies a JSON merge patch (RFC 7396) to target and returns the
+// result: objects are merged recursively, null removes a key and any other
+// value replaces the target value. target is not modified.
+func MergePatch(target, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetMap, ok := target.(map[string]interface{})
+	result := make(map[string]interface{}, len(targetMap)+len(patchMap))
+	if ok {
+		for key, value := range targetMap {
+			result[key] = value
+		}
+	}
+
+	for key, value := range patchMap {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		result[key] = MergePatch(result[key], value)
+	}
+
+	return result
+}
+
+// loadDesiredConfig loads a component config with the manifest defaults for
+// it and then its merge patch (configs/<component>.patch.json) applied, before
+// template rendering. It also returns the parsed patch, nil if the component
+// has none.
+func (sm *SyncManager) loadDesiredConfig(device storage.Device, component string) (map[string]interface{}, interface{}, error) {
+	data, err := sm.deviceStorage.LoadComponentConfig(device.Folder, component)
+	if err != nil {
+		return nil, nil, err
+	}
+	patchData, err := sm.deviceStorage.LoadComponentPatch(device.Folder, component)
+	if err != nil {
+		return nil, nil, err
+	}
+	return desiredConfig(component, data, patchData, sm.componentDefaults(component))
+}
+
+// desiredConfig applies defaults and then a merge patch (nil if there is
+// none) to the content of a component config file, as loadDesiredConfig does
+// for the working tree
+func desiredConfig(component string, data, patchData []byte, defaults []defaultsLayer) (map[string]interface{}, interface{}, error) {
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s config: %w", component, err)
+	}
+
+	if merged, _ := mergedDefaults(defaults); merged != nil {
+		config = MergePatch(config, merged).(map[string]interface{})
+	}
+
+	if patchData == nil {
+		return config, nil, nil
+	}
+	var patch interface{}
+	if err := json.Unmarshal(patchData, &patch); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s%s: %w", component, storage.ComponentPatchSuffix, err)
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return nil, nil, fmt.Errorf("%s%s must be a JSON object", component, storage.ComponentPatchSuffix)
+	}
+
+	return MergePatch(config, patch).(map[string]interface{}), patch, nil
+}
@@ -0,0 +1,302 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/darkermage/shelly-git-ops/internal/secrets"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// FieldPlan is a single config field a push would change on a device,
+// annotated with where its desired value comes from
+type FieldPlan struct {
+	Component string      `json:"component"` // config file name, e.g. switch-0
+	Path      string      `json:"path"`      // dotted path inside the component config
+	Current   interface{} `json:"current"`
+	Desired   interface{} `json:"desired"`
+	Source    string      `json:"source"`
+}
+
+// DevicePlan lists the field changes a push would make on one device
+type DevicePlan struct {
+	DeviceID   string      `json:"device_id"`
+	DeviceName string      `json:"device_name"`
+	Fields     []FieldPlan `json:"fields,omitempty"`
+	Error      error       `json:"-"`
+}
+
+// PlanPush compares the rendered local component configs of each selected
+// device with its live config and lists every field a push would change.
+// Each field is annotated with its provenance: a literal in the config file,
+// manifest defaults, a merge patch, a model baseline, or a template and the
+// values, secret or device keys it reads. Secret values are redacted.
+func (sm *SyncManager) PlanPush(ctx context.Context, deviceFilter []string, valuesFile string) ([]DevicePlan, error) {
+	values, err := LoadValuesFile(valuesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load values file: %w", err)
+	}
+	if err := sm.addSecretsToValues(values); err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+
+	allDevices := make(map[string]DeviceContext)
+	for _, device := range sm.manifest.Devices {
+		allDevices[device.DeviceID] = deviceContextFor(device)
+	}
+
+	valuesName := "values"
+	if valuesFile != "" {
+		valuesName = filepath.Base(valuesFile)
+	}
+
+	var plans []DevicePlan
+	for _, device := range sm.SelectDevices(deviceFilter) {
+		plan := DevicePlan{DeviceID: device.DeviceID, DeviceName: device.Name}
+		templateContext := CreateTemplateContext(values, deviceContextFor(device), allDevices)
+		plan.Fields, plan.Error = sm.planDevice(ctx, device, templateContext, valuesName)
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// planDevice diffs one device's rendered local configs against its live config
+func (sm *SyncManager) planDevice(ctx context.Context, device storage.Device, templateContext map[string]interface{}, valuesName string) ([]FieldPlan, error) {
+	liveConfig, err := sm.shellyClient.GetShellyConfig(ctx, device.IPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shelly config: %w", err)
+	}
+	var live map[string]interface{}
+	if err := json.Unmarshal(liveConfig, &live); err != nil {
+		return nil, fmt.Errorf("failed to parse shelly config: %w", err)
+	}
+
+	components, err := sm.deviceStorage.ListComponentConfigs(device.Folder)
+	if err != nil {
+		return nil, err
+	}
+	baseline, _ := sm.deviceStorage.LoadBaseline(device.Model)
+
+	var fields []FieldPlan
+	for _, component := range components {
+		// Same exclusions as push
+		if component == "cloud" || strings.HasPrefix(component, "script-") {
+			continue
+		}
+
+		raw, patch, err := sm.loadDesiredConfig(device, component)
+		if err != nil {
+			return nil, err
+		}
+
+		rendered, _, err := RenderConfigTemplates(raw, templateContext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s config: %w", component, err)
+		}
+		// Round-trip so typed template output compares like decoded JSON
+		var desired interface{}
+		if data, err := json.Marshal(rendered); err == nil {
+			json.Unmarshal(data, &desired)
+		}
+
+		var base interface{}
+		if baseData, ok := baseline[component]; ok {
+			json.Unmarshal(baseData, &base)
+		}
+
+		defaults, defaultsName := mergedDefaults(sm.componentDefaults(component))
+
+		source := provenance{
+			file:       "configs/" + component + ".json",
+			patchFile:  "configs/" + component + storage.ComponentPatchSuffix,
+			defaults:   defaultsName,
+			model:      device.Model,
+			valuesName: valuesName,
+		}
+		current := live[strings.Replace(component, "-", ":", 1)]
+		diffPlanFields(component, "", raw, desired, current, base, defaults, patch, source, &fields)
+	}
+
+	return fields, nil
+}
+
+// provenance names the layers a desired value can come from
+type provenance struct {
+	file       string
+	patchFile  string
+	defaults   string
+	model      string
+	valuesName string
+}
+
+// diffPlanFields records every leaf of desired that differs from current
+func diffPlanFields(component, path string, raw, desired, current, base, defaults, patch interface{}, source provenance, fields *[]FieldPlan) {
+	if desiredMap, ok := desired.(map[string]interface{}); ok {
+		rawMap, _ := raw.(map[string]interface{})
+		currentMap, _ := current.(map[string]interface{})
+		baseMap, _ := base.(map[string]interface{})
+		defaultsMap, _ := defaults.(map[string]interface{})
+		patchMap, _ := patch.(map[string]interface{})
+
+		keys := make([]string, 0, len(desiredMap))
+		for key := range desiredMap {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			diffPlanFields(component, fieldPath, rawMap[key], desiredMap[key], currentMap[key], baseMap[key], defaultsMap[key], patchMap[key], source, fields)
+		}
+		return
+	}
+
+	if reflect.DeepEqual(desired, current) {
+		return
+	}
+
+	field := FieldPlan{
+		Component: component,
+		Path:      path,
+		Current:   current,
+		Desired:   desired,
+		Source:    source.file,
+	}
+	if patch != nil {
+		field.Source = source.patchFile
+	} else if defaults != nil {
+		field.Source = source.defaults
+	}
+
+	if tmpl, ok := raw.(string); ok && IsTemplated(tmpl) {
+		refs := templateReferences(tmpl)
+		field.Source = fmt.Sprintf("template in %s", field.Source)
+		if len(refs) > 0 {
+			var described []string
+			for _, ref := range refs {
+				described = append(described, describeReference(ref, source.valuesName))
+				if strings.HasPrefix(ref, "secrets.") {
+					field.Desired = redactPlanValue(desired)
+					field.Current = redactPlanValue(current)
+				}
+			}
+			field.Source += ": " + strings.Join(described, ", ")
+		}
+	} else if patch == nil && defaults == nil && base != nil && reflect.DeepEqual(raw, base) {
+		field.Source = fmt.Sprintf("baseline %s (%s)", source.model, source.file)
+	}
+
+	*fields = append(*fields, field)
+}
+
+// templateReferences lists the dotted fields a template reads, e.g.
+// "Values.mqtt.server" for {{ .Values.mqtt.server }}
+func templateReferences(tmpl string) []string {
+	tree, err := template.New("ref").Funcs(templateFuncs).Parse(tmpl)
+	if err != nil || tree.Tree == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var refs []string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				for _, arg := range cmd.Args {
+					walk(arg)
+				}
+			}
+		case *parse.FieldNode:
+			ref := strings.Join(n.Ident, ".")
+			if !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+	walk(tree.Tree.Root)
+
+	return refs
+}
+
+// describeReference renders a template reference as the layer it reads from
+func describeReference(ref, valuesName string) string {
+	ref = strings.TrimPrefix(ref, "Values.")
+	switch {
+	case strings.HasPrefix(ref, "secrets."):
+		return fmt.Sprintf("secret %q", strings.TrimPrefix(ref, "secrets."))
+	case strings.HasPrefix(ref, "device."):
+		return fmt.Sprintf("device field %q", strings.TrimPrefix(ref, "device."))
+	case strings.HasPrefix(ref, "devices."):
+		return fmt.Sprintf("device %q", strings.TrimPrefix(ref, "devices."))
+	default:
+		return fmt.Sprintf("%s key %q", valuesName, ref)
+	}
+}
+
+// redactPlanValue masks a string value that came from the secret store
+func redactPlanValue(value interface{}) interface{} {
+	if s, ok := value.(string); ok && s != "" {
+		return secrets.Redact(s)
+	}
+	return value
+}
+
+// FormatPlan renders plans as text, one line per changed field with its source
+func FormatPlan(plans []DevicePlan) string {
+	var b strings.Builder
+	for _, plan := range plans {
+		if plan.Error != nil {
+			fmt.Fprintf(&b, "%s (%s): error: %v\n", plan.DeviceName, plan.DeviceID, plan.Error)
+			continue
+		}
+		if len(plan.Fields) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "%s (%s)\n", plan.DeviceName, plan.DeviceID)
+		for _, field := range plan.Fields {
+			current, _ := json.Marshal(field.Current)
+			desired, _ := json.Marshal(field.Desired)
+			fmt.Fprintf(&b, "  %s.%s: %s -> %s  [%s]\n", field.Component, field.Path, current, desired, field.Source)
+		}
+	}
+	return b.String()
+}
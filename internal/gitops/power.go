@@ -0,0 +1,66 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// PowerReading is the active power of an output with an expected range
+type PowerReading struct {
+	Component string             `json:"component"`
+	Power     float64            `json:"power"`
+	Range     storage.PowerRange `json:"range"`
+}
+
+// InRange reports whether the reading lies within its expected range
+func (r PowerReading) InRange() bool {
+	return r.Range.Contains(r.Power)
+}
+
+// CheckPower reads the active power of every output the device's device.yaml
+// declares a power_ranges entry for. Outputs that are switched off are left
+// out, as is a device without power ranges, which costs no RPC call.
+func (sm *SyncManager) CheckPower(ctx context.Context, device storage.Device) ([]PowerReading, error) {
+	metadata, err := sm.deviceStorage.LoadDeviceMetadata(device.Folder)
+	if err != nil || len(metadata.PowerRanges) == 0 {
+		return nil, nil
+	}
+
+	result, err := sm.shellyClient.GetStatus(ctx, device.IPAddress)
+	if err != nil {
+		return nil, err
+	}
+	var status map[string]json.RawMessage
+	if err := json.Unmarshal(result, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse status: %w", err)
+	}
+
+	var readings []PowerReading
+	for component, expected := range metadata.PowerRanges {
+		raw, ok := status[component]
+		if !ok {
+			return nil, fmt.Errorf("power_ranges names %s, which %s doesn't have", component, device.Name)
+		}
+		var output struct {
+			Output *bool    `json:"output"`
+			APower *float64 `json:"apower"`
+		}
+		if err := json.Unmarshal(raw, &output); err != nil {
+			return nil, fmt.Errorf("failed to parse %s status: %w", component, err)
+		}
+		if output.APower == nil {
+			return nil, fmt.Errorf("%s of %s doesn't meter power", component, device.Name)
+		}
+		if output.Output != nil && !*output.Output {
+			continue
+		}
+		readings = append(readings, PowerReading{Component: component, Power: *output.APower, Range: expected})
+	}
+
+	sort.Slice(readings, func(i, j int) bool { return readings[i].Component < readings[j].Component })
+	return readings, nil
+}
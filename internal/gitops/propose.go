@@ -0,0 +1,144 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ProposeOptions controls a branch-per-change proposal
+type ProposeOptions struct {
+	Description  string       // Human description of the change, used for branch name and commit message
+	BranchPrefix string       // Prefix for the branch name (default "change/")
+	Pull         bool         // Pull current device state onto the branch before committing
+	Edit         func() error // Optional callback applying edits to the working tree
+	Push         bool         // Push the branch to the remote after committing
+	Remote       string       // Remote name used when Push is set (default "origin")
+	AllowSecrets bool         // Commit even if the secret scanner reports findings
+}
+
+// ProposeResult describes the outcome of a proposal
+type ProposeResult struct {
+	Branch      string
+	BaseBranch  string
+	CommitHash  string
+	Committed   bool
+	Pushed      bool
+	PullResults []SyncResult
+}
+
+var branchSlugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// BranchNameFromDescription builds a git-safe branch name from a change description
+func BranchNameFromDescription(prefix, description string) string {
+	if prefix == "" {
+		prefix = "change/"
+	}
+
+	slug := branchSlugPattern.ReplaceAllString(strings.ToLower(description), "-")
+	slug = strings.Trim(slug, "-")
+	if len(slug) > 50 {
+		slug = strings.Trim(slug[:50], "-")
+	}
+	if slug == "" {
+		slug = "update"
+	}
+
+	return prefix + slug
+}
+
+// Propose creates a branch for a change, applies it (pull and/or edits), commits
+// and optionally pushes the branch, leaving the repository on the new branch
+func (sm *SyncManager) Propose(ctx context.Context, opts ProposeOptions) (*ProposeResult, error) {
+	if strings.TrimSpace(opts.Description) == "" {
+		return nil, fmt.Errorf("a change description is required")
+	}
+
+	hasChanges, err := sm.repo.HasChanges()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check repository status: %w", err)
+	}
+	if hasChanges {
+		return nil, fmt.Errorf("cannot propose: working tree has uncommitted changes. Please commit or stash your changes first")
+	}
+
+	baseBranch, err := sm.repo.GetCurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProposeResult{
+		Branch:     BranchNameFromDescription(opts.BranchPrefix, opts.Description),
+		BaseBranch: baseBranch,
+	}
+
+	if sm.repo.BranchExists(result.Branch) {
+		return nil, fmt.Errorf("branch %s already exists", result.Branch)
+	}
+	if err := sm.repo.CreateBranch(result.Branch); err != nil {
+		return nil, err
+	}
+	if err := sm.repo.CheckoutBranch(result.Branch); err != nil {
+		return nil, err
+	}
+
+	if opts.Pull {
+		pullResults, err := sm.PullFromDevices(ctx)
+		result.PullResults = pullResults
+		if err != nil {
+			return result, fmt.Errorf("pull failed: %w", err)
+		}
+		if err := sm.manifest.Save(); err != nil {
+			return result, fmt.Errorf("failed to save manifest: %w", err)
+		}
+	}
+
+	if opts.Edit != nil {
+		if err := opts.Edit(); err != nil {
+			return result, fmt.Errorf("failed to apply edits: %w", err)
+		}
+	}
+
+	hasChanges, err = sm.repo.HasChanges()
+	if err != nil {
+		return result, fmt.Errorf("failed to check repository status: %w", err)
+	}
+	if !hasChanges {
+		return result, nil
+	}
+
+	if !opts.AllowSecrets {
+		findings, err := sm.ScanSecrets(nil)
+		if err != nil {
+			return result, err
+		}
+		if len(findings) > 0 {
+			lines := make([]string, len(findings))
+			for i, finding := range findings {
+				lines[i] = "  " + finding.String()
+			}
+			return result, fmt.Errorf("refusing to commit: %d plaintext secret(s) found:\n%s\nRedact them into the secret store or allow secrets explicitly",
+				len(findings), strings.Join(lines, "\n"))
+		}
+	}
+
+	if err := sm.repo.AddAll(); err != nil {
+		return result, err
+	}
+	hash, err := sm.repo.Commit(opts.Description)
+	if err != nil {
+		return result, err
+	}
+	result.CommitHash = hash
+	result.Committed = true
+
+	if opts.Push {
+		if err := sm.repo.PushBranch(opts.Remote, result.Branch); err != nil {
+			return result, err
+		}
+		result.Pushed = true
+	}
+
+	return result, nil
+}
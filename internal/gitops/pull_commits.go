@@ -0,0 +1,265 @@
+package gitops
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/go-git/go-git/v5"
+)
+
+// Pull commit modes
+const (
+	CommitSingle    = "single"     // one commit for the whole pull
+	CommitPerDevice = "per-device" // one commit per changed device
+	CommitPerArea   = "per-area"   // one commit per area of the changed devices
+)
+
+// maxSummaryParts is how many changed parts a commit subject names
+const maxSummaryParts = 5
+
+// ValidCommitMode reports whether mode is a pull commit mode; empty means CommitSingle
+func ValidCommitMode(mode string) bool {
+	switch mode {
+	case "", CommitSingle, CommitPerDevice, CommitPerArea:
+		return true
+	}
+	return false
+}
+
+// commitGroup is the set of changed paths committed together
+type commitGroup struct {
+	name    string
+	devices []storage.Device
+	paths   []string
+}
+
+// CommitPulled commits the working tree changes left by PullDevices and
+// returns the commit hashes, none if nothing changed. CommitSingle commits
+// everything with message; CommitPerDevice and CommitPerArea commit each
+// changed device, or each area, on its own with a subject naming the changed
+// components, so a pull over a drifted fleet yields reviewable history.
+// Changes outside device folders (such as manifest.yaml) are committed last
+// with message.
+func (sm *SyncManager) CommitPulled(mode, message string) ([]string, error) {
+	if !ValidCommitMode(mode) {
+		return nil, fmt.Errorf("unknown commit mode %q", mode)
+	}
+	if mode == "" || mode == CommitSingle {
+		hash, err := sm.CommitAll(message)
+		if err != nil || hash == "" {
+			return nil, err
+		}
+		return []string{hash}, nil
+	}
+
+	// Pull stages folder renames; start from a clean index so each commit
+	// holds only its own group
+	if err := sm.repo.Unstage(); err != nil {
+		return nil, err
+	}
+	status, err := sm.repo.GetStatus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	groups := make(map[string]*commitGroup)
+	var rest []string
+	for file, fileStatus := range status {
+		if fileStatus.Worktree == git.Unmodified && fileStatus.Staging == git.Unmodified {
+			continue
+		}
+		device := sm.deviceForPath(file)
+		if device == nil {
+			rest = append(rest, file)
+			continue
+		}
+
+		key := device.DeviceID
+		if mode == CommitPerArea {
+			key = sm.DeviceNotes(*device).Area
+			if key == "" {
+				key = unassignedArea
+			}
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &commitGroup{name: key}
+			groups[key] = group
+		}
+		if !containsDevice(group.devices, device.DeviceID) {
+			group.devices = append(group.devices, *device)
+		}
+		group.paths = append(group.paths, file)
+	}
+
+	ordered := make([]*commitGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Strings(group.paths)
+		sort.Slice(group.devices, func(i, j int) bool { return group.devices[i].Name < group.devices[j].Name })
+		ordered = append(ordered, group)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return groupLabel(ordered[i], mode) < groupLabel(ordered[j], mode) })
+
+	var hashes []string
+	for _, group := range ordered {
+		if err := sm.repo.StagePaths(group.paths); err != nil {
+			return hashes, err
+		}
+		hash, err := sm.repo.Commit(groupCommitMessage(message, mode, group, status))
+		if err != nil {
+			return hashes, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if len(rest) > 0 {
+		sort.Strings(rest)
+		if err := sm.repo.StagePaths(rest); err != nil {
+			return hashes, err
+		}
+		hash, err := sm.repo.Commit(message)
+		if err != nil {
+			return hashes, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, nil
+}
+
+// deviceForPath returns the manifest device whose folder holds a repository
+// path. A folder left behind by a rename on pull is matched by the device ID
+// it ends with, so its removal is committed with the device.
+func (sm *SyncManager) deviceForPath(file string) *storage.Device {
+	folder, _, ok := strings.Cut(file, "/")
+	if !ok {
+		return nil
+	}
+	for i, device := range sm.manifest.Devices {
+		if device.Folder == folder {
+			return &sm.manifest.Devices[i]
+		}
+	}
+	for i, device := range sm.manifest.Devices {
+		if device.DeviceID != "" && deviceOwnsRenamed(device, file) {
+			return &sm.manifest.Devices[i]
+		}
+	}
+	return nil
+}
+
+// containsDevice reports whether devices holds deviceID
+func containsDevice(devices []storage.Device, deviceID string) bool {
+	for _, device := range devices {
+		if device.DeviceID == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// groupLabel names a commit group in its subject
+func groupLabel(group *commitGroup, mode string) string {
+	if mode == CommitPerArea {
+		return group.name
+	}
+	return group.devices[0].Name
+}
+
+// groupCommitMessage renders the commit message of a group: a subject naming
+// the device (or area) and what changed, and a body listing every file
+func groupCommitMessage(message, mode string, group *commitGroup, status git.Status) string {
+	var subject string
+	if mode == CommitPerArea {
+		subject = fmt.Sprintf("%s: %s (%d device(s))", message, group.name, len(group.devices))
+	} else {
+		subject = fmt.Sprintf("%s: %s (%s)", message, group.devices[0].Name, summarizeChanges(group.devices[0], group.paths))
+	}
+
+	var b strings.Builder
+	b.WriteString(subject)
+	b.WriteString("\n")
+	for _, device := range group.devices {
+		b.WriteString("\n")
+		if mode == CommitPerArea {
+			fmt.Fprintf(&b, "%s: %s\n", device.Name, summarizeChanges(device, group.paths))
+		}
+		for _, file := range group.paths {
+			if strings.HasPrefix(file, device.Folder+"/") || deviceOwnsRenamed(device, file) {
+				fmt.Fprintf(&b, "  %s %s\n", changeLetter(status[file]), file)
+			}
+		}
+	}
+	return b.String()
+}
+
+// deviceOwnsRenamed reports whether file lies in a folder the device was
+// renamed away from
+func deviceOwnsRenamed(device storage.Device, file string) bool {
+	folder, _, _ := strings.Cut(file, "/")
+	return folder != device.Folder && strings.HasSuffix(strings.ToLower(folder), "-"+strings.ToLower(device.DeviceID))
+}
+
+// summarizeChanges names the parts of a device folder that changed, e.g.
+// "wifi, switch-0, scripts"
+func summarizeChanges(device storage.Device, files []string) string {
+	var parts []string
+	seen := make(map[string]bool)
+	add := func(part string) {
+		if !seen[part] {
+			seen[part] = true
+			parts = append(parts, part)
+		}
+	}
+
+	renamed := false
+	for _, file := range files {
+		rel, ok := strings.CutPrefix(file, device.Folder+"/")
+		if !ok {
+			if deviceOwnsRenamed(device, file) {
+				renamed = true
+			}
+			continue
+		}
+		dir, name, nested := strings.Cut(rel, "/")
+		switch {
+		case !nested:
+			// metadata, README and checksums only change alongside the rest
+			continue
+		case dir == "configs":
+			add(strings.TrimSuffix(strings.TrimSuffix(name, ".json"), ".patch"))
+		default:
+			add(dir)
+		}
+	}
+	if renamed {
+		parts = append([]string{"renamed"}, parts...)
+	}
+
+	switch {
+	case len(parts) == 0:
+		return "metadata"
+	case len(parts) > maxSummaryParts:
+		return fmt.Sprintf("%s, +%d more", strings.Join(parts[:maxSummaryParts], ", "), len(parts)-maxSummaryParts)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// changeLetter renders a file status like git status --short
+func changeLetter(fileStatus *git.FileStatus) string {
+	code := fileStatus.Worktree
+	if code == git.Unmodified {
+		code = fileStatus.Staging
+	}
+	switch code {
+	case git.Untracked, git.Added:
+		return "A"
+	case git.Deleted:
+		return "D"
+	case git.Renamed:
+		return "R"
+	}
+	return "M"
+}
@@ -0,0 +1,275 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// MergeConflict is a field (or, for files that aren't JSON, a whole file)
+// that was changed both on the device and locally since the last commit. The
+// local value is kept.
+type MergeConflict struct {
+	File   string      // path in the repository, e.g. "kitchen/configs/switch-0.json"
+	Path   string      // dotted field path; empty for the whole file
+	Local  interface{} // nil if removed locally or not JSON
+	Device interface{} // nil if removed on the device or not JSON
+}
+
+// SetPullMerge makes pulls merge device state into the working tree instead
+// of overwriting it. Each pulled file is merged three ways against its
+// version at HEAD, the last synced state: fields the device changed since
+// then are updated, and everything else keeps its local value, so
+// uncommitted local edits survive the pull. Fields changed on both sides are
+// kept local and reported in SyncResult.Conflicts. Pulls in merge mode are
+// allowed with uncommitted changes.
+func (sm *SyncManager) SetPullMerge(merge bool) {
+	sm.pullMerge = merge
+}
+
+// mergeDeviceState pulls a device like pullDeviceState, then merges what it
+// wrote with the local files from before the pull
+func (sm *SyncManager) mergeDeviceState(ctx context.Context, base *object.Commit, device storage.Device, deviceInfo *shelly.DeviceInfo) SyncResult {
+	local, err := sm.snapshotDeviceFolder(device.Folder)
+	if err != nil {
+		return SyncResult{DeviceID: device.DeviceID, Error: err}
+	}
+
+	// Merge even after a failed pull, which may have overwritten some files
+	result := sm.pullDeviceState(ctx, device, deviceInfo)
+	conflicts, err := sm.mergePulledFolder(base, device.Folder, local)
+	result.Conflicts = conflicts
+	if err != nil {
+		result.Success = false
+		result.Error = fmt.Errorf("failed to merge pulled state: %w", err)
+		return result
+	}
+	if len(conflicts) > 0 && result.Success {
+		result.Message += fmt.Sprintf(", kept %d conflicting local change(s)", len(conflicts))
+	}
+	return result
+}
+
+// snapshotDeviceFolder reads every file in a device folder, keyed by its
+// slash-separated path in the folder
+func (sm *SyncManager) snapshotDeviceFolder(folder string) (map[string][]byte, error) {
+	root := sm.deviceStorage.GetDevicePath(folder)
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device folder %s: %w", folder, err)
+	}
+	return files, nil
+}
+
+// mergePulledFolder merges the files a pull wrote into a device folder with
+// the local files from before the pull (local), using their versions at base
+// (HEAD before the pull; nil if the repository has no commits) as the common
+// ancestor, and writes the result back
+func (sm *SyncManager) mergePulledFolder(base *object.Commit, folder string, local map[string][]byte) ([]MergeConflict, error) {
+	pulled, err := sm.snapshotDeviceFolder(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(pulled))
+	for name := range pulled {
+		names = append(names, name)
+	}
+	for name := range local {
+		if _, ok := pulled[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	root := sm.deviceStorage.GetDevicePath(folder)
+	var conflicts []MergeConflict
+	for _, name := range names {
+		ours, hasOurs := local[name]
+		theirs, hasTheirs := pulled[name]
+		if !hasTheirs || (hasOurs && bytes.Equal(ours, theirs)) {
+			continue // not written by the pull, or nothing to merge
+		}
+
+		repoPath := path.Join(filepath.ToSlash(folder), name)
+		var ancestor []byte
+		hasBase := false
+		if base != nil {
+			if data, err := sm.repo.ReadFileAt(base, repoPath); err == nil {
+				ancestor, hasBase = data, true
+			}
+		}
+
+		merged, keep, fileConflicts := mergeFile(repoPath, ancestor, hasBase, ours, hasOurs, theirs)
+		conflicts = append(conflicts, fileConflicts...)
+
+		filePath := filepath.Join(root, filepath.FromSlash(name))
+		switch {
+		case !keep:
+			// Deleted locally and unchanged on the device
+			if err := os.Remove(filePath); err != nil {
+				return conflicts, fmt.Errorf("failed to remove %s: %w", repoPath, err)
+			}
+		case !bytes.Equal(merged, theirs):
+			if err := os.WriteFile(filePath, merged, 0644); err != nil {
+				return conflicts, fmt.Errorf("failed to write merged %s: %w", repoPath, err)
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// mergeFile merges one file three ways and returns its content, whether the
+// file is kept at all, and the conflicts. JSON objects are merged field by
+// field; anything else as a whole.
+func mergeFile(repoPath string, base []byte, hasBase bool, ours []byte, hasOurs bool, theirs []byte) ([]byte, bool, []MergeConflict) {
+	if !hasOurs {
+		if hasBase && bytes.Equal(base, theirs) {
+			return nil, false, nil
+		}
+		if hasBase {
+			// Deleted locally but changed on the device: keep the deletion
+			return nil, false, []MergeConflict{{File: repoPath}}
+		}
+		return theirs, true, nil // new on the device
+	}
+
+	var baseValue, oursValue, theirsValue interface{}
+	if json.Unmarshal(ours, &oursValue) == nil && json.Unmarshal(theirs, &theirsValue) == nil &&
+		(!hasBase || json.Unmarshal(base, &baseValue) == nil) {
+		merged, conflicts := mergeValues("", jsonValue{baseValue, hasBase}, jsonValue{oursValue, true}, jsonValue{theirsValue, true})
+		for i := range conflicts {
+			conflicts[i].File = repoPath
+		}
+		if reflect.DeepEqual(merged.value, oursValue) {
+			return ours, true, conflicts
+		}
+		if reflect.DeepEqual(merged.value, theirsValue) {
+			return theirs, true, conflicts
+		}
+		data, err := json.MarshalIndent(merged.value, "", "  ")
+		if err == nil {
+			return data, true, conflicts
+		}
+	}
+
+	switch {
+	case hasBase && bytes.Equal(base, theirs):
+		return ours, true, nil
+	case hasBase && bytes.Equal(base, ours):
+		return theirs, true, nil
+	default:
+		return ours, true, []MergeConflict{{File: repoPath}}
+	}
+}
+
+// jsonValue is a decoded JSON value that may be absent, e.g. a field missing
+// from one side of a merge
+type jsonValue struct {
+	value   interface{}
+	present bool
+}
+
+func (v jsonValue) equal(other jsonValue) bool {
+	return v.present == other.present && reflect.DeepEqual(v.value, other.value)
+}
+
+// mergeValues merges a JSON value three ways: a side that left the base
+// unchanged takes the other side's value, objects changed on both sides are
+// merged key by key, and any other change on both sides is a conflict that
+// keeps ours. Arrays are merged as a whole.
+func mergeValues(fieldPath string, base, ours, theirs jsonValue) (jsonValue, []MergeConflict) {
+	switch {
+	case ours.equal(theirs), base.equal(theirs):
+		return ours, nil
+	case base.equal(ours):
+		return theirs, nil
+	}
+
+	oursMap, oursIsMap := ours.value.(map[string]interface{})
+	theirsMap, theirsIsMap := theirs.value.(map[string]interface{})
+	if !ours.present || !theirs.present || !oursIsMap || !theirsIsMap {
+		return ours, []MergeConflict{{Path: fieldPath, Local: ours.value, Device: theirs.value}}
+	}
+	baseMap, _ := base.value.(map[string]interface{})
+
+	keys := make(map[string]bool)
+	for _, m := range []map[string]interface{}{baseMap, oursMap, theirsMap} {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	merged := make(map[string]interface{}, len(keys))
+	var conflicts []MergeConflict
+	for _, key := range sorted {
+		child := key
+		if fieldPath != "" {
+			child = fieldPath + "." + key
+		}
+		value, childConflicts := mergeValues(child, fieldOf(baseMap, key), fieldOf(oursMap, key), fieldOf(theirsMap, key))
+		conflicts = append(conflicts, childConflicts...)
+		if value.present {
+			merged[key] = value.value
+		}
+	}
+	return jsonValue{merged, true}, conflicts
+}
+
+// fieldOf returns a field of a JSON object, absent if m is nil or lacks it
+func fieldOf(m map[string]interface{}, key string) jsonValue {
+	value, ok := m[key]
+	return jsonValue{value, ok}
+}
+
+// FormatMergeConflicts renders merge conflicts for terminal output
+func FormatMergeConflicts(conflicts []MergeConflict) string {
+	var b strings.Builder
+	for _, conflict := range conflicts {
+		if conflict.Path == "" {
+			fmt.Fprintf(&b, "%s: changed locally and on the device, kept local file\n", conflict.File)
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s: local %s, device %s (kept local)\n", conflict.File, conflict.Path,
+			formatInheritedValue(conflict.Local), formatInheritedValue(conflict.Device))
+	}
+	return b.String()
+}
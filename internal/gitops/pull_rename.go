@@ -0,0 +1,133 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+	"golang.org/x/sync/errgroup"
+)
+
+// pullTarget is a device ready for the parallel phase of a pull
+type pullTarget struct {
+	index  int // position in the pull's results
+	device storage.Device
+	info   *shelly.DeviceInfo
+}
+
+// preparePull fetches the device info and uptime of every device in
+// parallel, then settles names one device at a time: a device renamed on the
+// device itself gets its folder moved on disk and in the git index (like git
+// mv, so history follows it) before anything is written into it. The manifest
+// is saved once, with the devices' generation, app, firmware and uptime
+// refreshed. Devices that can't be pulled get their result in results and are
+// left out of the returned targets.
+func (sm *SyncManager) preparePull(ctx context.Context, devices []storage.Device, results []SyncResult) ([]pullTarget, error) {
+	infos := make([]*shelly.DeviceInfo, len(devices))
+	uptimes := make([]*time.Duration, len(devices)) // nil if it couldn't be read
+	errs := make([]error, len(devices))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(sm.pullConcurrency())
+	for i, device := range devices {
+		i, device := i, device
+		g.Go(func() error {
+			opCtx := shelly.WithTraceOperation(gctx, "pull")
+			infos[i], errs[i] = sm.shellyClient.GetDeviceInfo(opCtx, device.IPAddress)
+			if errs[i] == nil {
+				if uptime, err := sm.DeviceUptime(opCtx, device); err == nil {
+					uptimes[i] = &uptime
+				}
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	var targets []pullTarget
+	renamed := false // or otherwise changed in the manifest
+	for i, device := range devices {
+		results[i] = SyncResult{DeviceID: device.DeviceID}
+		if errs[i] != nil {
+			results[i].Error = fmt.Errorf("failed to get device info: %w", errs[i])
+			continue
+		}
+
+		// Never overwrite a device's files with the state of a different device
+		if swap := detectDeviceSwap(device, infos[i]); swap != nil {
+			alertDeviceSwap(swap)
+			results[i].Error = swap
+			continue
+		}
+		sm.cacheDeviceInfo(device.DeviceID, infos[i])
+
+		changed, err := sm.renamePulledDevice(&device, infos[i].Name)
+		if err != nil {
+			results[i].Error = err
+			continue
+		}
+		renamed = renamed || changed
+		if refreshDeviceFacts(&device, infos[i], uptimes[i]) {
+			sm.manifest.AddDevice(device)
+			renamed = true
+		}
+		targets = append(targets, pullTarget{index: i, device: device, info: infos[i]})
+	}
+
+	if renamed {
+		if err := sm.manifest.Save(); err != nil {
+			return nil, fmt.Errorf("failed to update manifest: %w", err)
+		}
+	}
+	return targets, nil
+}
+
+// refreshDeviceFacts copies the generation, app and firmware version from the
+// device info into a manifest device, along with the uptime unless it is nil
+// and the model if the device has none, and reports whether anything changed.
+// A model that differs is left to PlanModelRemap.
+func refreshDeviceFacts(device *storage.Device, info *shelly.DeviceInfo, uptime *time.Duration) bool {
+	model := device.Model
+	if model == "" {
+		model = info.Model
+	}
+	seconds := device.Uptime
+	if uptime != nil {
+		seconds = int64(uptime.Seconds())
+	}
+	if device.Generation == info.Gen && device.App == info.App && device.Firmware == info.Ver && device.Model == model && device.Uptime == seconds {
+		return false
+	}
+	device.Generation = info.Gen
+	device.App = info.App
+	device.Firmware = info.Ver
+	device.Model = model
+	device.Uptime = seconds
+	return true
+}
+
+// renamePulledDevice takes over the name set on the device, moving its
+// folder to match, and reports whether the manifest entry changed. An empty
+// name keeps the manifest name.
+func (sm *SyncManager) renamePulledDevice(device *storage.Device, name string) (bool, error) {
+	if name == "" || name == device.Name {
+		return false, nil
+	}
+
+	newFolder := storage.DeviceFolderName(name, device.DeviceID)
+	if device.Folder != newFolder && sm.deviceStorage.DeviceExists(device.Folder) {
+		if err := sm.deviceStorage.RenameDeviceFolder(device.Folder, newFolder); err != nil {
+			return false, fmt.Errorf("failed to rename device folder: %w", err)
+		}
+		if err := sm.repo.StageMove(device.Folder, newFolder); err != nil {
+			return false, fmt.Errorf("failed to stage device folder rename: %w", err)
+		}
+	}
+
+	device.Name = name
+	device.Folder = newFolder
+	sm.manifest.AddDevice(*device)
+	return true, nil
+}
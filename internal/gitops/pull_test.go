@@ -0,0 +1,39 @@
+package gitops_test
+
+import (
+	"testing"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+func TestPullStoresDeviceFacts(t *testing.T) {
+	_, fleet, dir := pulledFleet(t, 2)
+
+	manifest, err := storage.LoadManifest(storage.FindManifest(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := storage.NewDeviceStorage(dir)
+	for _, registered := range fleet.ManifestDevices() {
+		device := manifest.GetDevice(registered.DeviceID)
+		if device == nil {
+			t.Fatalf("%s missing from the manifest", registered.DeviceID)
+		}
+		if device.Generation != 2 || device.App == "" || device.Firmware != "1.2.0" {
+			t.Errorf("%s has gen %d, app %q, firmware %q; want 2, the model's app, 1.2.0", device.DeviceID, device.Generation, device.App, device.Firmware)
+		}
+		// The simulated devices have been up for about an hour
+		if device.Uptime < 3600 || device.Uptime > 3700 {
+			t.Errorf("%s has uptime %d in the manifest, want about 3600", device.DeviceID, device.Uptime)
+		}
+
+		metadata, err := ds.LoadDeviceMetadata(device.Folder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.Generation != 2 || metadata.App != device.App || metadata.Uptime != device.Uptime {
+			t.Errorf("%s device.yaml has gen %d, app %q, uptime %d; want the manifest's %d, %q, %d",
+				device.DeviceID, metadata.Generation, metadata.App, metadata.Uptime, device.Generation, device.App, device.Uptime)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// PushSnapshot is the component config a device had before the last push
+// that changed it
+type PushSnapshot struct {
+	DeviceID string    `json:"device_id"`
+	TakenAt  time.Time `json:"taken_at"`
+	Commit   string    `json:"commit"` // HEAD at the time of the push
+
+	// Configs by config file name, e.g. "switch-0"
+	Configs map[string]map[string]interface{} `json:"configs"`
+}
+
+// pushSnapshotPath returns the snapshot file of a device inside the state
+// directory
+func (sm *SyncManager) pushSnapshotPath(deviceID string) string {
+	return filepath.Join(sm.StateDir(), "snapshots", storage.SanitizeFolderName(deviceID)+".json")
+}
+
+// capturePushSnapshot reads the component configs of a device before a push.
+// Cloud and script configs are left out, as push leaves them alone.
+func (sm *SyncManager) capturePushSnapshot(ctx context.Context, device storage.Device) (*PushSnapshot, error) {
+	configs, err := sm.deviceComponentConfigs(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &PushSnapshot{DeviceID: device.DeviceID, TakenAt: time.Now(), Configs: configs}
+	snapshot.Commit, _ = sm.repo.HeadCommit()
+	return snapshot, nil
+}
+
+// deviceComponentConfigs reads the pushable component configs of a device,
+// by config file name
+func (sm *SyncManager) deviceComponentConfigs(ctx context.Context, device storage.Device) (map[string]map[string]interface{}, error) {
+	data, err := sm.shellyClient.GetShellyConfig(ctx, device.IPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shelly config: %w", err)
+	}
+	var live map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &live); err != nil {
+		return nil, fmt.Errorf("failed to parse shelly config: %w", err)
+	}
+
+	configs := make(map[string]map[string]interface{}, len(live))
+	for componentKey, config := range live {
+		if componentKey == "cloud" || strings.HasPrefix(componentKey, "script:") {
+			continue
+		}
+		configs[strings.ReplaceAll(componentKey, ":", "-")] = config
+	}
+	return configs, nil
+}
+
+// savePushSnapshot keeps a snapshot taken before a push if the push changed
+// the device's config. A push that changed nothing leaves the previous
+// snapshot in place, so rollback still undoes the last effective push.
+func (sm *SyncManager) savePushSnapshot(ctx context.Context, device storage.Device, snapshot *PushSnapshot) error {
+	after, err := sm.deviceComponentConfigs(ctx, device)
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(after, snapshot.Configs) {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal push snapshot: %w", err)
+	}
+	path := sm.pushSnapshotPath(device.DeviceID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write push snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace push snapshot: %w", err)
+	}
+	return nil
+}
+
+// LastPushSnapshot returns the snapshot taken before the last push that
+// changed a device, or nil if there is none. deviceRef matches a device ID or
+// name (case-insensitive).
+func (sm *SyncManager) LastPushSnapshot(deviceRef string) (*PushSnapshot, error) {
+	device := sm.findDevice(deviceRef)
+	if device == nil {
+		return nil, fmt.Errorf("device %s not found in manifest", deviceRef)
+	}
+	data, err := os.ReadFile(sm.pushSnapshotPath(device.DeviceID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read push snapshot: %w", err)
+	}
+	var snapshot PushSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse push snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// RollbackPush re-applies the component configs a device had before its last
+// push that changed it, e.g. when the bad change is already committed and a
+// git revert would take longer. Only components the snapshot holds are
+// pushed; scripts, schedules, webhooks and KVS are left alone. The device
+// then drifts from the repository until the change is reverted in Git and
+// pushed, or pulled. The same safeguards as a push apply: the repository
+// lock, change freezes, device swap detection and rollback points for network
+// changes.
+func (sm *SyncManager) RollbackPush(ctx context.Context, deviceRef string) (SyncResult, error) {
+	release, err := sm.LockRepo("rollback")
+	if err != nil {
+		return SyncResult{}, err
+	}
+	defer release()
+
+	if err := sm.checkFreeze(); err != nil {
+		return SyncResult{}, err
+	}
+
+	snapshot, err := sm.LastPushSnapshot(deviceRef)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	if snapshot == nil {
+		return SyncResult{}, fmt.Errorf("no push snapshot recorded for %s", deviceRef)
+	}
+	device := sm.findDevice(snapshot.DeviceID)
+
+	result := SyncResult{DeviceID: device.DeviceID}
+	ctx = shelly.WithTraceOperation(ctx, "rollback")
+
+	// The snapshot belongs to the hardware it was taken from
+	if info, err := sm.shellyClient.GetDeviceInfo(ctx, device.IPAddress); err == nil {
+		if swap := detectDeviceSwap(*device, info); swap != nil {
+			alertDeviceSwap(swap)
+			result.Error = swap
+			return result, nil
+		}
+	}
+	defer sm.InvalidateDeviceCache(device.DeviceID)
+
+	components := make([]string, 0, len(snapshot.Configs))
+	for component := range snapshot.Configs {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+
+	var pending []pendingConfig
+	for _, component := range components {
+		pending = append(pending, newPendingConfig(component, snapshot.Configs[component]))
+	}
+
+	// Network changes can cut the device off, so let it restore itself
+	rollback := sm.armRollbackPoint(ctx, *device, pending)
+	applied, restartRequired := sm.applyComponentConfigs(ctx, *device, pending)
+	result.RestartRequired = restartRequired
+	if rollback != nil {
+		if err := sm.confirmRollbackPoint(ctx, *device, rollback); err != nil {
+			result.Error = err
+			return result, nil
+		}
+	}
+	if applied < len(pending) {
+		result.Error = fmt.Errorf("applied %d of %d component configs", applied, len(pending))
+		return result, nil
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf("restored %d config(s) from before the push of %s", applied, snapshot.TakenAt.Format(time.RFC3339))
+	return result, nil
+}
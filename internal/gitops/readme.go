@@ -0,0 +1,228 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// deviceReadmeHeader marks README.md files written by GenerateDeviceReadme
+const deviceReadmeHeader = "<!-- Generated by shelly-gitops on pull. Do not edit, changes will be overwritten. -->"
+
+// GenerateDeviceReadme writes a README.md into the device folder summarizing
+// the device from its local files, so the repository is browsable without
+// reading JSON. A README.md not written by this tool is left untouched.
+func (sm *SyncManager) GenerateDeviceReadme(device storage.Device) error {
+	readmePath := filepath.Join(sm.deviceStorage.GetDevicePath(device.Folder), "README.md")
+
+	if existing, err := os.ReadFile(readmePath); err == nil && !strings.HasPrefix(string(existing), deviceReadmeHeader) {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n# %s\n\n", deviceReadmeHeader, device.Name)
+
+	model, firmware := device.Model, ""
+	if metadata, err := sm.deviceStorage.LoadDeviceMetadata(device.Folder); err == nil {
+		if metadata.Model != "" {
+			model = metadata.Model
+		}
+		firmware = metadata.Firmware
+	}
+
+	b.WriteString("| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Device ID | `%s` |\n", device.DeviceID)
+	fmt.Fprintf(&b, "| Model | %s |\n", model)
+	if firmware != "" {
+		fmt.Fprintf(&b, "| Firmware | %s |\n", firmware)
+	}
+	fmt.Fprintf(&b, "| IP address | %s |\n", device.IPAddress)
+	if device.Network != "" {
+		fmt.Fprintf(&b, "| Network | %s |\n", device.Network)
+	}
+	if location := sm.deviceLocationName(device); location != "" {
+		fmt.Fprintf(&b, "| Location | %s |\n", location)
+	}
+	notes := sm.DeviceNotes(device)
+	if notes.Owner != "" {
+		fmt.Fprintf(&b, "| Owner | %s |\n", notes.Owner)
+	}
+	if notes.InstalledAt != "" {
+		fmt.Fprintf(&b, "| Installed | %s |\n", notes.InstalledAt)
+	}
+	if notes.Circuit != "" {
+		fmt.Fprintf(&b, "| Circuit | %s |\n", notes.Circuit)
+	}
+	if notes.Notes != "" {
+		fmt.Fprintf(&b, "\n## Notes\n\n%s\n", strings.TrimSpace(notes.Notes))
+	}
+
+	if components, err := sm.deviceStorage.ListComponentConfigs(device.Folder); err == nil && len(components) > 0 {
+		sort.Strings(components)
+		b.WriteString("\n## Components\n\n")
+		for _, component := range components {
+			if name := sm.componentName(device, component); name != "" {
+				fmt.Fprintf(&b, "- `%s` - %s\n", component, name)
+			} else {
+				fmt.Fprintf(&b, "- `%s`\n", component)
+			}
+		}
+	}
+
+	if scripts, err := sm.deviceStorage.ListScripts(device.Folder); err == nil && len(scripts) > 0 {
+		sort.Slice(scripts, func(i, j int) bool { return scripts[i].ID < scripts[j].ID })
+		b.WriteString("\n## Scripts\n\n")
+		for _, script := range scripts {
+			state := "enabled"
+			if !script.Enable {
+				state = "disabled"
+			}
+			fmt.Fprintf(&b, "- **%s** (`scripts/script-%d.js`, %s)", script.Name, script.ID, state)
+			if code, err := sm.deviceStorage.LoadScript(device.Folder, script.ID); err == nil {
+				if summary := leadingComment(code); summary != "" {
+					fmt.Fprintf(&b, ": %s", summary)
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if schedules, err := sm.deviceStorage.ListSchedules(device.Folder); err == nil && len(schedules) > 0 {
+		sort.Slice(schedules, func(i, j int) bool { return schedules[i].ID < schedules[j].ID })
+		b.WriteString("\n## Schedules\n\n")
+		for _, schedule := range schedules {
+			var calls []string
+			for _, call := range schedule.Calls {
+				calls = append(calls, describeCall(call.Method, call.Params))
+			}
+			state := ""
+			if !schedule.Enable {
+				state = " (disabled)"
+			}
+			fmt.Fprintf(&b, "- %s: %s%s\n", upperFirst(shelly.DescribeTimespec(schedule.Timespec)), strings.Join(calls, ", "), state)
+		}
+	}
+
+	return os.WriteFile(readmePath, []byte(b.String()), 0644)
+}
+
+// deviceLocationName returns the timezone and coordinates from sys.json, if set
+func (sm *SyncManager) deviceLocationName(device storage.Device) string {
+	data, err := sm.deviceStorage.LoadComponentConfig(device.Folder, "sys")
+	if err != nil {
+		return ""
+	}
+
+	var sys struct {
+		Location struct {
+			TZ  string   `json:"tz"`
+			Lat *float64 `json:"lat"`
+			Lon *float64 `json:"lon"`
+		} `json:"location"`
+	}
+	if json.Unmarshal(data, &sys) != nil {
+		return ""
+	}
+
+	location := sys.Location.TZ
+	if sys.Location.Lat != nil && sys.Location.Lon != nil {
+		location = strings.TrimSpace(fmt.Sprintf("%s (%.4f, %.4f)", location, *sys.Location.Lat, *sys.Location.Lon))
+	}
+	return location
+}
+
+// componentName returns the user-assigned name of a component, if any
+func (sm *SyncManager) componentName(device storage.Device, component string) string {
+	data, err := sm.deviceStorage.LoadComponentConfig(device.Folder, component)
+	if err != nil {
+		return ""
+	}
+
+	var config struct {
+		Name *string `json:"name"`
+	}
+	if json.Unmarshal(data, &config) != nil || config.Name == nil {
+		return ""
+	}
+	return *config.Name
+}
+
+// leadingComment returns the first paragraph of a script's leading comment
+func leadingComment(code string) string {
+	var lines []string
+	inBlock := false
+
+	for _, line := range strings.Split(code, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case inBlock:
+			end := strings.Contains(line, "*/")
+			line = strings.TrimSpace(strings.TrimPrefix(strings.Split(line, "*/")[0], "*"))
+			if line == "" && len(lines) > 0 {
+				return strings.Join(lines, " ")
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			if end {
+				return strings.Join(lines, " ")
+			}
+		case strings.HasPrefix(line, "/*"):
+			inBlock = true
+			rest := strings.TrimPrefix(line, "/*")
+			end := strings.Contains(rest, "*/")
+			rest = strings.TrimSpace(strings.TrimPrefix(strings.Split(rest, "*/")[0], "*"))
+			if rest != "" {
+				lines = append(lines, rest)
+			}
+			if end {
+				return strings.Join(lines, " ")
+			}
+		case strings.HasPrefix(line, "//"):
+			text := strings.TrimSpace(strings.TrimPrefix(line, "//"))
+			if text == "" && len(lines) > 0 {
+				return strings.Join(lines, " ")
+			}
+			if text != "" {
+				lines = append(lines, text)
+			}
+		case line == "" && len(lines) == 0:
+			continue
+		default:
+			return strings.Join(lines, " ")
+		}
+	}
+
+	return strings.Join(lines, " ")
+}
+
+// describeCall renders an RPC call as "Method(key=value, ...)"
+func describeCall(method string, params map[string]interface{}) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value, _ := json.Marshal(params[key])
+		args = append(args, fmt.Sprintf("%s=%s", key, value))
+	}
+	return fmt.Sprintf("`%s(%s)`", method, strings.Join(args, ", "))
+}
+
+// upperFirst capitalizes the first letter of a sentence
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,102 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// Reboot-after-push defaults
+const (
+	defaultRebootInterval = 10 * time.Second
+	defaultRebootTimeout  = 2 * time.Minute
+	rebootPollInterval    = 3 * time.Second
+)
+
+// RebootOptions controls the reboots after a push
+type RebootOptions struct {
+	Interval time.Duration // pause after a device is back before rebooting the next (default 10s)
+	Timeout  time.Duration // how long a device may take to answer again (default 2m)
+}
+
+// SetRebootIfNeeded makes pushes reboot the devices that reported a pushed
+// setting (eth, a profile switch) needs a reboot to take effect; nil
+// disables it. Devices are rebooted one at a time in push order, each only
+// after the previous one answers again, so a fleet never goes dark at once.
+func (sm *SyncManager) SetRebootIfNeeded(opts *RebootOptions) {
+	sm.rebootIfNeeded = opts
+}
+
+// rebootPushed reboots the successfully pushed devices whose results ask for
+// it. A device that doesn't come back stops the remaining reboots.
+func (sm *SyncManager) rebootPushed(ctx context.Context, devices []storage.Device, results []SyncResult) {
+	interval := sm.rebootIfNeeded.Interval
+	if interval <= 0 {
+		interval = defaultRebootInterval
+	}
+	timeout := sm.rebootIfNeeded.Timeout
+	if timeout <= 0 {
+		timeout = defaultRebootTimeout
+	}
+
+	rebooted := 0
+	for i, device := range devices {
+		result := &results[i]
+		if len(result.RestartRequired) == 0 {
+			continue
+		}
+		if !result.Success {
+			fmt.Fprintf(os.Stderr, "Warning: Not rebooting %s as its push failed; it still needs a reboot for %s\n", device.Name, strings.Join(result.RestartRequired, ", "))
+			continue
+		}
+
+		if rebooted > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "Info: Rebooting %s for %s\n", device.Name, strings.Join(result.RestartRequired, ", "))
+		if err := sm.rebootAndWait(ctx, device, timeout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v%s; not rebooting the remaining devices\n", err, hintSuffix(err))
+			result.Message += "; reboot failed"
+			return
+		}
+		result.Rebooted = true
+		result.Message += "; rebooted"
+		rebooted++
+	}
+}
+
+// rebootAndWait reboots a device and waits until it answers again after
+// coming back up
+func (sm *SyncManager) rebootAndWait(ctx context.Context, device storage.Device, timeout time.Duration) error {
+	before, err := sm.DeviceUptime(ctx, device)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s before rebooting: %w", device.Name, err)
+	}
+	sm.noteReboot(device.DeviceID, timeout)
+	if err := sm.shellyClient.Reboot(ctx, device.IPAddress); err != nil {
+		return fmt.Errorf("failed to reboot %s: %w", device.Name, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rebootPollInterval):
+		}
+		// Unreachable while restarting; a lower uptime means it is back
+		if uptime, err := sm.DeviceUptime(ctx, device); err == nil && uptime < before {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s did not come back within %s of rebooting", device.Name, timeout)
+}
@@ -0,0 +1,201 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// ReconcileOptions controls automatic drift remediation
+type ReconcileOptions struct {
+	DeviceFilter []string // devices to check (see SelectDevices); empty for all
+
+	// Components is the allow-list of components safe to push back
+	// automatically, as component types ("switch") or config files
+	// ("switch-0"). Drift in any other component is only reported.
+	Components []string
+
+	ValuesFile string // values for templated fields, as for PushToDevices
+	DryRun     bool   // only report what would be remediated
+}
+
+// ReconcileResult is the outcome of remediating one drifted device
+type ReconcileResult struct {
+	DeviceID   string
+	DeviceName string
+
+	// Remediated lists the config files pushed back to the device (or that
+	// would be, with DryRun)
+	Remediated []string
+
+	// Skipped is the drift left alone: components outside the allow-list, and
+	// components missing on either side, which a config push can't fix
+	Skipped []ComponentDrift
+
+	RestartRequired []string // components the device needs a reboot for
+	Error           error
+}
+
+// Reconcile checks the selected devices for drift and pushes the repository
+// config back to every drifted component on the allow-list. It is the
+// opposite of the daemon's AutoPull: the repository wins. See ReconcileDrift.
+func (sm *SyncManager) Reconcile(ctx context.Context, opts ReconcileOptions) ([]ReconcileResult, error) {
+	reports, err := sm.CheckDrift(ctx, opts.DeviceFilter)
+	if err != nil {
+		return nil, err
+	}
+	return sm.ReconcileDrift(ctx, reports, opts)
+}
+
+// ReconcileDrift pushes the repository config back to the drifted components
+// of existing drift reports that are on the allow-list, and checks each
+// remediated device again afterwards. Only the component configs are pushed,
+// not scripts, schedules or KVS, and the same safeguards as a push apply: the
+// repository lock, change freezes, device swap detection and rollback points
+// for network changes. Devices without drift are left out of the results.
+func (sm *SyncManager) ReconcileDrift(ctx context.Context, reports []DriftReport, opts ReconcileOptions) ([]ReconcileResult, error) {
+	if len(opts.Components) == 0 {
+		return nil, fmt.Errorf("no components are allowed to be remediated")
+	}
+
+	if !opts.DryRun {
+		release, err := sm.LockRepo("reconcile")
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		if err := sm.checkFreeze(); err != nil {
+			return nil, err
+		}
+	}
+
+	values, err := LoadValuesFile(opts.ValuesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load values file: %w", err)
+	}
+	if err := sm.addSecretsToValues(values); err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+
+	allDevices := make(map[string]DeviceContext)
+	for _, device := range sm.manifest.Devices {
+		allDevices[device.DeviceID] = deviceContextFor(device)
+	}
+
+	var results []ReconcileResult
+	for _, report := range reports {
+		if !report.Drifted() {
+			continue
+		}
+		device := sm.findDevice(report.DeviceID)
+		if device == nil {
+			continue
+		}
+
+		result := ReconcileResult{DeviceID: device.DeviceID, DeviceName: device.Name}
+		var components []string
+		for _, drift := range report.Components {
+			if drift.Kind == DriftModified && remediationAllowed(drift.Component, opts.Components) {
+				components = append(components, drift.Component)
+				continue
+			}
+			result.Skipped = append(result.Skipped, drift)
+		}
+
+		if len(components) > 0 {
+			if opts.DryRun {
+				result.Remediated = components
+			} else {
+				templateContext := CreateTemplateContext(values, deviceContextFor(*device), allDevices)
+				result.Remediated, result.RestartRequired, result.Error = sm.remediateDevice(shelly.WithTraceOperation(ctx, "reconcile"), *device, components, templateContext)
+				if result.Error == nil {
+					result.Error = sm.verifyRemediated(ctx, *device, result.Remediated)
+				}
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// remediationAllowed reports whether a config file matches an allow-list
+// entry, by file name or component type
+func remediationAllowed(component string, allowed []string) bool {
+	// Same exclusions as push
+	if component == "cloud" || strings.HasPrefix(component, "script-") {
+		return false
+	}
+	for _, entry := range allowed {
+		if entry == component || entry == componentFileType(component) {
+			return true
+		}
+	}
+	return false
+}
+
+// remediateDevice pushes the desired config of the given components to one
+// device and returns the components applied and those needing a reboot
+func (sm *SyncManager) remediateDevice(ctx context.Context, device storage.Device, components []string, templateContext map[string]interface{}) ([]string, []string, error) {
+	// Don't push a device's configuration onto different hardware
+	if info, err := sm.shellyClient.GetDeviceInfo(ctx, device.IPAddress); err == nil {
+		if swap := detectDeviceSwap(device, info); swap != nil {
+			alertDeviceSwap(swap)
+			return nil, nil, swap
+		}
+	}
+	defer sm.InvalidateDeviceCache(device.DeviceID)
+
+	var pending []pendingConfig
+	for _, component := range components {
+		rawConfig, _, err := sm.loadDesiredConfig(device, component)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load config %s: %w", component, err)
+		}
+		rendered, _, err := RenderConfigTemplates(rawConfig, templateContext)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to render templates in config %s: %w", component, err)
+		}
+		pending = append(pending, newPendingConfig(component, rendered.(map[string]interface{})))
+	}
+
+	// Network changes can cut the device off, so let it restore itself
+	rollback := sm.armRollbackPoint(ctx, device, pending)
+	applied, restartRequired := sm.applyComponentConfigs(ctx, device, pending)
+	if rollback != nil {
+		if err := sm.confirmRollbackPoint(ctx, device, rollback); err != nil {
+			return nil, restartRequired, err
+		}
+	}
+	if applied < len(pending) {
+		return components, restartRequired, fmt.Errorf("applied %d of %d component configs", applied, len(pending))
+	}
+	return components, restartRequired, nil
+}
+
+// verifyRemediated checks a device again and reports components that are
+// still drifted, e.g. because the device rejected or normalized a value
+func (sm *SyncManager) verifyRemediated(ctx context.Context, device storage.Device, components []string) error {
+	report := sm.checkDeviceDrift(ctx, device)
+	if report.Error != nil {
+		return fmt.Errorf("failed to verify remediation: %w", report.Error)
+	}
+	remediated := make(map[string]bool, len(components))
+	for _, component := range components {
+		remediated[component] = true
+	}
+	var still []string
+	for _, drift := range report.Components {
+		if remediated[drift.Component] {
+			still = append(still, drift.Component)
+		}
+	}
+	if len(still) > 0 {
+		return fmt.Errorf("still drifted after remediation: %s", strings.Join(still, ", "))
+	}
+	return nil
+}
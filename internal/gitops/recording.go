@@ -0,0 +1,61 @@
+package gitops
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// defaultFixtureDir is where fixtures are recorded when no directory is given
+func (sm *SyncManager) defaultFixtureDir() string {
+	return filepath.Join(sm.StateDir(), "fixtures")
+}
+
+// StartRecording saves every RPC response of this run, secrets redacted, as
+// fixtures in dir (one JSON file per device), e.g. during a pull of the real
+// fleet. An empty dir records to .git/shelly-gitops/fixtures. It returns the
+// directory used.
+func (sm *SyncManager) StartRecording(dir string) (string, error) {
+	if dir == "" {
+		dir = sm.defaultFixtureDir()
+	}
+	sm.StopRecording()
+
+	recorder, err := shelly.NewRecorder(dir, sm.shellyClient.Transport())
+	if err != nil {
+		return "", err
+	}
+	sm.liveTransport = sm.shellyClient.Transport()
+	sm.shellyClient.SetTransport(recorder)
+	return dir, nil
+}
+
+// StartReplay answers every RPC call from the fixtures in dir instead of the
+// devices, so template changes and refactors can be tried offline against
+// the fleet's recorded state, e.g. with PlanPush, CheckDrift or a pull into a
+// scratch branch. Calls that weren't recorded fail as if the device were
+// unreachable. An empty dir replays .git/shelly-gitops/fixtures.
+func (sm *SyncManager) StartReplay(dir string) (string, error) {
+	if dir == "" {
+		dir = sm.defaultFixtureDir()
+	}
+
+	replayer, err := shelly.NewReplayer(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to replay fixtures: %w", err)
+	}
+	sm.StopRecording()
+	sm.liveTransport = sm.shellyClient.Transport()
+	sm.shellyClient.SetTransport(replayer)
+	return dir, nil
+}
+
+// StopRecording ends recording or replay and calls the devices again
+func (sm *SyncManager) StopRecording() {
+	if sm.liveTransport == nil {
+		return
+	}
+	sm.shellyClient.SetTransport(sm.liveTransport)
+	sm.liveTransport = nil
+}
@@ -0,0 +1,100 @@
+package gitops
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// redactComponent applies the redaction rules to a pulled component config.
+// Redacted values are returned keyed by secret name so they can be moved to the
+// secret store; values that are already templates are left alone.
+func redactComponent(rules *storage.RedactionRules, folder, component string, config interface{}) (interface{}, map[string]string) {
+	if rules == nil {
+		return config, nil
+	}
+
+	configMap, ok := config.(map[string]interface{})
+	if !ok {
+		return config, nil
+	}
+
+	var captured map[string]string
+	for _, rule := range rules.Rules {
+		pattern, fieldPath, ok := strings.Cut(rule.Path, ".")
+		if !ok {
+			continue
+		}
+		if matched, _ := path.Match(pattern, component); !matched {
+			continue
+		}
+
+		keys := strings.Split(fieldPath, ".")
+		parent := configMap
+		for _, key := range keys[:len(keys)-1] {
+			next, ok := parent[key].(map[string]interface{})
+			if !ok {
+				parent = nil
+				break
+			}
+			parent = next
+		}
+		leaf := keys[len(keys)-1]
+		if parent == nil {
+			continue
+		}
+		value, exists := parent[leaf]
+		if !exists {
+			continue
+		}
+
+		if rule.Action == storage.RedactDrop {
+			delete(parent, leaf)
+			continue
+		}
+
+		if s, ok := value.(string); ok && IsTemplated(s) {
+			continue
+		}
+
+		// Same naming scheme as RedactSecrets so both end up with one entry per field
+		name := fmt.Sprintf("%s.configs.%s.%s", folder, component, fieldPath)
+		placeholder := rule.Placeholder
+		if placeholder == "" {
+			placeholder = fmt.Sprintf(`{{ index .secrets "%s" }}`, name)
+		}
+		parent[leaf] = placeholder
+
+		if s, ok := value.(string); ok && s != "" {
+			if captured == nil {
+				captured = make(map[string]string)
+			}
+			captured[name] = s
+		}
+	}
+
+	return configMap, captured
+}
+
+// storeRedactedSecrets moves values captured by redaction into the secret store
+// Without a secret store the values are discarded and push has to get them
+// from a values file through custom placeholders.
+func (sm *SyncManager) storeRedactedSecrets(captured map[string]string) error {
+	if len(captured) == 0 || sm.secretStore == nil {
+		return nil
+	}
+
+	sm.secretsMu.Lock()
+	defer sm.secretsMu.Unlock()
+
+	stored, err := sm.secretStore.Load()
+	if err != nil {
+		return err
+	}
+	for name, value := range captured {
+		stored[name] = value
+	}
+	return sm.secretStore.Save(stored)
+}
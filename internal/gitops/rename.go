@@ -0,0 +1,202 @@
+package gitops
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// RenameResult is the outcome of renaming a single device
+type RenameResult struct {
+	DeviceID  string
+	OldName   string
+	NewName   string
+	OldFolder string
+	NewFolder string
+	Error     error
+}
+
+// LoadRenameMapping loads an "old name or device ID -> new name" mapping from a
+// two-column CSV file (an optional "old,new" header is skipped) or from a
+// YAML, JSON or TOML map
+func LoadRenameMapping(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rename mapping: %w", err)
+	}
+
+	mapping := make(map[string]string)
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		reader := csv.NewReader(strings.NewReader(string(data)))
+		reader.FieldsPerRecord = 2
+		reader.TrimLeadingSpace = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse rename mapping: %w", err)
+		}
+		for i, record := range records {
+			if i == 0 && strings.EqualFold(record[0], "old") && strings.EqualFold(record[1], "new") {
+				continue
+			}
+			mapping[strings.TrimSpace(record[0])] = strings.TrimSpace(record[1])
+		}
+		return mapping, nil
+	}
+
+	if err := storage.Unmarshal(storage.FormatFromPath(path), data, &mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse rename mapping: %w", err)
+	}
+	return mapping, nil
+}
+
+// BulkRename renames devices according to mapping in one batch: the manifest
+// entry, the device folder (staged like git mv), device.yaml, configs/sys.json
+// and, unless dryRun is set, the name on the device via Sys.SetConfig. Changes
+// are left staged/uncommitted for review. Nothing is renamed if an entry isn't
+// found, two entries name the same device or a target folder is in use.
+func (sm *SyncManager) BulkRename(ctx context.Context, mapping map[string]string, dryRun bool) ([]RenameResult, error) {
+	var results []RenameResult
+
+	// Resolve and check every entry before touching a device, so a typo or a
+	// collision doesn't leave a half-renamed fleet
+	type rename struct {
+		device    *storage.Device
+		newName   string
+		newFolder string
+	}
+	var renames []rename
+	refs := make([]string, 0, len(mapping))
+	for ref := range mapping {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	renamedBy := make(map[string]string) // device ID -> mapping entry
+	folderFor := make(map[string]string) // new folder -> mapping entry
+	for _, ref := range refs {
+		newName := mapping[ref]
+		device := sm.findDevice(ref)
+		if device == nil {
+			return nil, fmt.Errorf("device %s not found in manifest", ref)
+		}
+		if strings.TrimSpace(newName) == "" {
+			return nil, fmt.Errorf("empty new name for %s", ref)
+		}
+		if other, ok := renamedBy[device.DeviceID]; ok {
+			return nil, fmt.Errorf("%s and %s are both %s", other, ref, device.DeviceID)
+		}
+		renamedBy[device.DeviceID] = ref
+
+		newFolder := storage.DeviceFolderName(newName, device.DeviceID)
+		if other, ok := folderFor[newFolder]; ok {
+			return nil, fmt.Errorf("%s and %s would both be renamed to folder %s", other, ref, newFolder)
+		}
+		folderFor[newFolder] = ref
+		if newFolder != device.Folder {
+			if owner := sm.deviceInFolder(newFolder); owner != nil {
+				return nil, fmt.Errorf("cannot rename %s: folder %s belongs to %s", ref, newFolder, owner.Name)
+			}
+			if sm.deviceStorage.DeviceExists(newFolder) {
+				return nil, fmt.Errorf("cannot rename %s: folder %s already exists", ref, newFolder)
+			}
+		}
+		renames = append(renames, rename{device: device, newName: newName, newFolder: newFolder})
+	}
+	sort.Slice(renames, func(i, j int) bool { return renames[i].device.Name < renames[j].device.Name })
+
+	for _, r := range renames {
+		device := r.device
+		result := RenameResult{
+			DeviceID:  device.DeviceID,
+			OldName:   device.Name,
+			NewName:   r.newName,
+			OldFolder: device.Folder,
+			NewFolder: r.newFolder,
+		}
+
+		if dryRun {
+			results = append(results, result)
+			continue
+		}
+
+		if err := sm.renameDevice(ctx, device, r.newName, result.NewFolder); err != nil {
+			result.Error = err
+		}
+		results = append(results, result)
+	}
+
+	if dryRun {
+		return results, nil
+	}
+
+	if err := sm.manifest.Save(); err != nil {
+		return results, fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	return results, nil
+}
+
+// deviceInFolder returns the manifest device stored in folder, or nil
+func (sm *SyncManager) deviceInFolder(folder string) *storage.Device {
+	for i, device := range sm.manifest.Devices {
+		if device.Folder == folder {
+			return &sm.manifest.Devices[i]
+		}
+	}
+	return nil
+}
+
+// renameDevice applies a single rename; device points into the manifest. The
+// repository is renamed first, so a device that can't be reached still gets
+// its new name on the next push.
+func (sm *SyncManager) renameDevice(ctx context.Context, device *storage.Device, newName, newFolder string) error {
+	if device.Folder != newFolder && sm.deviceStorage.DeviceExists(device.Folder) {
+		if err := sm.deviceStorage.RenameDeviceFolder(device.Folder, newFolder); err != nil {
+			return err
+		}
+		if err := sm.repo.StageMove(device.Folder, newFolder); err != nil {
+			return err
+		}
+	}
+	device.Name = newName
+	device.Folder = newFolder
+
+	if metadata, err := sm.deviceStorage.LoadDeviceMetadata(newFolder); err == nil {
+		metadata.Name = newName
+		if err := sm.deviceStorage.SaveDeviceMetadata(newFolder, *metadata); err != nil {
+			return err
+		}
+	}
+
+	if data, err := sm.deviceStorage.LoadComponentConfig(newFolder, "sys"); err == nil {
+		var sys map[string]interface{}
+		if err := json.Unmarshal(data, &sys); err != nil {
+			return fmt.Errorf("failed to parse sys config: %w", err)
+		}
+		if deviceSection, ok := sys["device"].(map[string]interface{}); ok {
+			deviceSection["name"] = newName
+			updated, err := json.Marshal(sys)
+			if err != nil {
+				return fmt.Errorf("failed to marshal sys config: %w", err)
+			}
+			if err := sm.deviceStorage.SaveComponentConfig(newFolder, "sys", updated); err != nil {
+				return err
+			}
+		}
+	}
+
+	sysConfig := map[string]interface{}{
+		"device": map[string]interface{}{"name": newName},
+	}
+	if err := sm.shellyClient.SetComponentConfig(ctx, device.IPAddress, "Sys", map[string]interface{}{"config": sysConfig}); err != nil {
+		return fmt.Errorf("renamed in the repository, but failed to set name on device (push to retry): %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package gitops
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+func TestBulkRenameRejectsCollisionsBeforeTouchingDevices(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"id": 1, "result": {"restart_required": false}}`))
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	dir := t.TempDir()
+	if _, err := InitRepository(dir); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := storage.LoadManifest(storage.FindManifest(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, device := range []storage.Device{
+		{DeviceID: "shellyplus1-aaaaaa", Name: "Porch", Folder: "porch-shellyplus1-aaaaaa", IPAddress: addr},
+		{DeviceID: "shellyplus1-bbbbbb", Name: "Shed", Folder: "shed-shellyplus1-bbbbbb", IPAddress: addr},
+	} {
+		manifest.AddDevice(device)
+		if err := os.MkdirAll(filepath.Join(dir, device.Folder, "configs"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := manifest.Save(); err != nil {
+		t.Fatal(err)
+	}
+	// Left over from an earlier device, not in the manifest
+	if err := os.MkdirAll(filepath.Join(dir, "garden-shellyplus1-bbbbbb"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sm, err := NewSyncManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mappings := []struct {
+		mapping map[string]string
+		want    string
+	}{
+		{map[string]string{"Porch": "Front door", "shellyplus1-aaaaaa": "Back door"}, "are both shellyplus1-aaaaaa"},
+		{map[string]string{"Porch": "Front door", "Shed": "Garden"}, "folder garden-shellyplus1-bbbbbb already exists"},
+	}
+	for _, m := range mappings {
+		_, err := sm.BulkRename(context.Background(), m.mapping, false)
+		if err == nil || !strings.Contains(err.Error(), m.want) {
+			t.Errorf("BulkRename(%v) returned %v, want %q", m.mapping, err, m.want)
+		}
+	}
+
+	if n := calls.Load(); n != 0 {
+		t.Errorf("rejected renames made %d device calls", n)
+	}
+	for _, device := range sm.manifest.Devices {
+		if device.Name != "Porch" && device.Name != "Shed" {
+			t.Errorf("rejected renames renamed %s to %s", device.DeviceID, device.Name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "porch-shellyplus1-aaaaaa")); err != nil {
+		t.Errorf("rejected renames moved a folder: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/terminal"
+)
+
+// RenderOptions controls how RenderPlan and RenderDrift lay out their output
+// for a terminal
+type RenderOptions struct {
+	Color bool // ANSI colors, see terminal.ColorEnabled
+
+	// Collapse shows each device as a single summary line, except the devices
+	// listed in Expand (by ID or name), which are shown in full
+	Collapse bool
+	Expand   []string
+}
+
+// expanded reports whether a device section is shown in full
+func (o RenderOptions) expanded(deviceID, name string) bool {
+	if !o.Collapse {
+		return true
+	}
+	for _, ref := range o.Expand {
+		if ref == deviceID || ref == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderPlan renders plans as one section per device with the old and new
+// value of each field as a highlighted JSON diff. Use FormatPlan for plain
+// one-line-per-field text.
+func RenderPlan(plans []DevicePlan, opts RenderOptions) string {
+	style := func(s, text string) string { return terminal.Style(opts.Color, s, text) }
+
+	var b strings.Builder
+	for _, plan := range plans {
+		if plan.Error != nil {
+			fmt.Fprintf(&b, "%s %s %s\n", style(terminal.Red, "✗"), style(terminal.Bold, plan.DeviceName), style(terminal.Dim, "("+plan.DeviceID+")"))
+			fmt.Fprintf(&b, "    %s\n", style(terminal.Red, "error: "+plan.Error.Error()))
+			continue
+		}
+		if len(plan.Fields) == 0 {
+			continue
+		}
+
+		components := make(map[string]int)
+		var order []string
+		for _, field := range plan.Fields {
+			if components[field.Component] == 0 {
+				order = append(order, field.Component)
+			}
+			components[field.Component]++
+		}
+
+		if !opts.expanded(plan.DeviceID, plan.DeviceName) {
+			summary := make([]string, len(order))
+			for i, component := range order {
+				summary[i] = fmt.Sprintf("%s (%d)", component, components[component])
+			}
+			fmt.Fprintf(&b, "▸ %s %s  %s\n", style(terminal.Bold, plan.DeviceName), style(terminal.Dim, "("+plan.DeviceID+")"),
+				style(terminal.Yellow, plural(len(plan.Fields), "change")+": "+strings.Join(summary, ", ")))
+			continue
+		}
+
+		fmt.Fprintf(&b, "▾ %s %s  %s\n", style(terminal.Bold, plan.DeviceName), style(terminal.Dim, "("+plan.DeviceID+")"),
+			style(terminal.Yellow, plural(len(plan.Fields), "change")+" in "+plural(len(order), "component")))
+		for _, component := range order {
+			fmt.Fprintf(&b, "  %s\n", style(terminal.Cyan, component))
+			for _, field := range plan.Fields {
+				if field.Component != component {
+					continue
+				}
+				fmt.Fprintf(&b, "    %s  %s\n", style(terminal.Bold, field.Path), style(terminal.Dim, "["+field.Source+"]"))
+				writeJSONDiff(&b, "      ", field.Current, field.Desired, opts.Color)
+			}
+		}
+	}
+
+	if b.Len() == 0 {
+		return "No changes.\n"
+	}
+	return b.String()
+}
+
+// RenderDrift renders drift reports as one section per drifted device,
+// listing its components by kind of drift
+func RenderDrift(reports []DriftReport, opts RenderOptions) string {
+	style := func(s, text string) string { return terminal.Style(opts.Color, s, text) }
+	kindStyle := map[string]string{
+		DriftModified:      terminal.Yellow,
+		DriftMissingLocal:  terminal.Green,
+		DriftMissingDevice: terminal.Red,
+		DriftPolicy:        terminal.Magenta,
+	}
+
+	var b strings.Builder
+	for _, report := range reports {
+		if report.Error != nil {
+			fmt.Fprintf(&b, "%s %s\n    %s\n", style(terminal.Red, "✗"), style(terminal.Bold, report.DeviceID), style(terminal.Red, "error: "+report.Error.Error()))
+			continue
+		}
+		if !report.Drifted() {
+			continue
+		}
+
+		if !opts.expanded(report.DeviceID, "") {
+			kinds := make(map[string]int)
+			for _, component := range report.Components {
+				kinds[component.Kind]++
+			}
+			names := make([]string, 0, len(kinds))
+			for kind := range kinds {
+				names = append(names, kind)
+			}
+			sort.Strings(names)
+			summary := make([]string, len(names))
+			for i, kind := range names {
+				summary[i] = style(kindStyle[kind], fmt.Sprintf("%d %s", kinds[kind], kind))
+			}
+			fmt.Fprintf(&b, "▸ %s  %s\n", style(terminal.Bold, report.DeviceID), strings.Join(summary, ", "))
+			continue
+		}
+
+		fmt.Fprintf(&b, "▾ %s  %s\n", style(terminal.Bold, report.DeviceID), style(terminal.Yellow, plural(len(report.Components), "drifted component")))
+		for _, component := range report.Components {
+			fmt.Fprintf(&b, "    %-24s %s\n", component.Component, style(kindStyle[component.Kind], component.Kind))
+		}
+	}
+
+	if b.Len() == 0 {
+		return "No drift.\n"
+	}
+	return b.String()
+}
+
+// writeJSONDiff writes the old value as "-" lines and the new one as "+"
+// lines, pretty-printed and highlighted
+func writeJSONDiff(b *strings.Builder, indent string, current, desired interface{}, color bool) {
+	for _, side := range []struct {
+		sign  string
+		style string
+		value interface{}
+	}{{"-", terminal.Red, current}, {"+", terminal.Green, desired}} {
+		data, err := json.MarshalIndent(side.value, "", "  ")
+		if err != nil {
+			data = []byte(fmt.Sprint(side.value))
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			fmt.Fprintf(b, "%s%s %s\n", indent, terminal.Style(color, side.style, side.sign), highlightJSON(line, color))
+		}
+	}
+}
+
+// highlightJSON colors the tokens of a line of indented JSON: keys, strings,
+// numbers and literals
+func highlightJSON(line string, color bool) string {
+	if !color {
+		return line
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(line) {
+				end++
+			}
+			token := line[i:end]
+			if strings.HasPrefix(strings.TrimLeft(line[end:], " "), ":") {
+				b.WriteString(terminal.Style(true, terminal.Blue, token))
+			} else {
+				b.WriteString(terminal.Style(true, terminal.Green, token))
+			}
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(line) && strings.IndexByte("0123456789.eE+-", line[end]) >= 0 {
+				end++
+			}
+			b.WriteString(terminal.Style(true, terminal.Yellow, line[i:end]))
+			i = end
+		case strings.HasPrefix(line[i:], "true"), strings.HasPrefix(line[i:], "null"):
+			b.WriteString(terminal.Style(true, terminal.Magenta, line[i:i+4]))
+			i += 4
+		case strings.HasPrefix(line[i:], "false"):
+			b.WriteString(terminal.Style(true, terminal.Magenta, line[i:i+5]))
+			i += 5
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// plural formats a count with its noun
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
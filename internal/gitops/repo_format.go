@@ -0,0 +1,70 @@
+package gitops
+
+import (
+	"fmt"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// repoFormatUpgrades migrate a repository from the format they are keyed by
+// to the next one
+var repoFormatUpgrades = map[int]func(repoPath string) error{}
+
+// RepoFormatError is returned when the repository's layout version doesn't
+// match the one this build uses
+type RepoFormatError struct {
+	Repo      int // format recorded in repo-format.yaml
+	Supported int // storage.RepoFormat
+}
+
+// Error implements error, telling how to get the tool and repository back in line
+func (e *RepoFormatError) Error() string {
+	if e.Repo > e.Supported {
+		return fmt.Sprintf("repository format %d is newer than format %d supported by this build; "+
+			"upgrade shelly-git-ops on this machine before using the repository", e.Repo, e.Supported)
+	}
+	return fmt.Sprintf("repository format %d is older than format %d used by this build; "+
+		"commit your changes, run UpgradeRepoFormat and commit the result, "+
+		"then upgrade shelly-git-ops on every other machine using the repository", e.Repo, e.Supported)
+}
+
+// checkRepoFormat refuses repositories whose layout this build would
+// misread or silently rewrite in its own
+func checkRepoFormat(repoPath string) error {
+	format, err := storage.LoadRepoFormat(repoPath)
+	if err != nil {
+		return err
+	}
+	if format != storage.RepoFormat {
+		return &RepoFormatError{Repo: format, Supported: storage.RepoFormat}
+	}
+	return nil
+}
+
+// UpgradeRepoFormat migrates the repository at repoPath to the layout of this
+// build one format at a time and records it in repo-format.yaml. The changes
+// are left uncommitted for review. It returns the format the repository had.
+func UpgradeRepoFormat(repoPath string) (int, error) {
+	format, err := storage.LoadRepoFormat(repoPath)
+	if err != nil {
+		return 0, err
+	}
+	if format > storage.RepoFormat {
+		return format, &RepoFormatError{Repo: format, Supported: storage.RepoFormat}
+	}
+
+	for from := format; from < storage.RepoFormat; from++ {
+		upgrade, ok := repoFormatUpgrades[from]
+		if !ok {
+			return format, fmt.Errorf("no upgrade from repository format %d", from)
+		}
+		if err := upgrade(repoPath); err != nil {
+			return format, fmt.Errorf("failed to upgrade repository format %d to %d: %w", from, from+1, err)
+		}
+		if err := storage.WriteRepoFormat(repoPath, from+1); err != nil {
+			return format, err
+		}
+	}
+
+	return format, storage.WriteRepoFormat(repoPath, storage.RepoFormat)
+}
@@ -2,17 +2,67 @@ package gitops
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
 )
 
 // Repository wraps git operations
 type Repository struct {
-	repo *git.Repository
-	path string
+	repo     *git.Repository
+	path     string
+	observer func(op string, duration time.Duration)
+	auth     func() (transport.AuthMethod, error)
+}
+
+// SetObserver registers a callback invoked after the slower git operations
+// (status, add, commit, push, checkout, log) with their duration
+func (r *Repository) SetObserver(observer func(op string, duration time.Duration)) {
+	r.observer = observer
+}
+
+// observe reports an operation started at start; use with defer
+func (r *Repository) observe(op string, start time.Time) {
+	if r.observer != nil {
+		r.observer(op, time.Since(start))
+	}
+}
+
+// SetTokenAuth authenticates pushes over HTTPS with a token from tokenFunc
+// as the password of username (e.g. "x-access-token" for GitHub, "oauth2"
+// for GitLab). tokenFunc is called per push so short-lived tokens can be
+// renewed; nil restores the default credentials of the remote.
+func (r *Repository) SetTokenAuth(username string, tokenFunc func() (string, error)) {
+	if tokenFunc == nil {
+		r.auth = nil
+		return
+	}
+	r.auth = func() (transport.AuthMethod, error) {
+		token, err := tokenFunc()
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain access token: %w", err)
+		}
+		return &githttp.BasicAuth{Username: username, Password: token}, nil
+	}
+}
+
+// pushAuth returns the authentication for a push, nil for the default
+func (r *Repository) pushAuth() (transport.AuthMethod, error) {
+	if r.auth == nil {
+		return nil, nil
+	}
+	return r.auth()
 }
 
 // OpenRepository opens a git repository
@@ -28,12 +78,16 @@ func OpenRepository(path string) (*Repository, error) {
 	}, nil
 }
 
-// InitRepository initializes a new git repository
+// InitRepository initializes a new git repository in the current repository
+// format
 func InitRepository(path string) (*Repository, error) {
 	repo, err := git.PlainInit(path, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize repository: %w", err)
 	}
+	if err := storage.WriteRepoFormat(path, storage.RepoFormat); err != nil {
+		return nil, err
+	}
 
 	return &Repository{
 		repo: repo,
@@ -51,6 +105,16 @@ func (r *Repository) GetCurrentBranch() (string, error) {
 	return head.Name().Short(), nil
 }
 
+// HeadCommit returns the hash of the commit HEAD points to
+func (r *Repository) HeadCommit() (string, error) {
+	head, err := r.repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	return head.Hash().String(), nil
+}
+
 // CreateBranch creates a new branch
 func (r *Repository) CreateBranch(branchName string) error {
 	head, err := r.repo.Head()
@@ -70,6 +134,8 @@ func (r *Repository) CreateBranch(branchName string) error {
 
 // CheckoutBranch checks out a branch
 func (r *Repository) CheckoutBranch(branchName string) error {
+	defer r.observe("checkout", time.Now())
+
 	w, err := r.repo.Worktree()
 	if err != nil {
 		return fmt.Errorf("failed to get worktree: %w", err)
@@ -88,6 +154,67 @@ func (r *Repository) CheckoutBranch(branchName string) error {
 	return nil
 }
 
+// PushBranch pushes a local branch to the given remote
+// If remoteName is empty, "origin" is used
+func (r *Repository) PushBranch(remoteName, branchName string) error {
+	defer r.observe("push", time.Now())
+
+	if remoteName == "" {
+		remoteName = "origin"
+	}
+
+	auth, err := r.pushAuth()
+	if err != nil {
+		return err
+	}
+
+	refName := plumbing.NewBranchReferenceName(branchName)
+	refSpec := config.RefSpec(fmt.Sprintf("%s:%s", refName, refName))
+
+	err = r.repo.Push(&git.PushOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []config.RefSpec{refSpec},
+		Auth:       auth,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to push branch %s to %s: %w", branchName, remoteName, err)
+	}
+
+	return nil
+}
+
+// HasRemote checks if a remote is configured
+func (r *Repository) HasRemote(remoteName string) bool {
+	_, err := r.repo.Remote(remoteName)
+	return err == nil
+}
+
+// PushAll pushes every local branch and tag to the given remote, e.g. a
+// backup mirror. The push is not forced, so a remote that diverged is
+// reported instead of overwritten.
+func (r *Repository) PushAll(remoteName string) error {
+	defer r.observe("push", time.Now())
+
+	auth, err := r.pushAuth()
+	if err != nil {
+		return err
+	}
+
+	err = r.repo.Push(&git.PushOptions{
+		RemoteName: remoteName,
+		RefSpecs: []config.RefSpec{
+			"refs/heads/*:refs/heads/*",
+			"refs/tags/*:refs/tags/*",
+		},
+		Auth: auth,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to push to %s: %w", remoteName, err)
+	}
+
+	return nil
+}
+
 // BranchExists checks if a branch exists
 func (r *Repository) BranchExists(branchName string) bool {
 	refName := plumbing.NewBranchReferenceName(branchName)
@@ -97,6 +224,8 @@ func (r *Repository) BranchExists(branchName string) bool {
 
 // AddAll adds all changes to the staging area
 func (r *Repository) AddAll() error {
+	defer r.observe("add", time.Now())
+
 	w, err := r.repo.Worktree()
 	if err != nil {
 		return fmt.Errorf("failed to get worktree: %w", err)
@@ -109,8 +238,34 @@ func (r *Repository) AddAll() error {
 	return nil
 }
 
+// StagePaths stages the given repository-relative paths, including deletions
+func (r *Repository) StagePaths(paths []string) error {
+	defer r.observe("add", time.Now())
+
+	w, err := r.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	for _, path := range paths {
+		if _, err := os.Lstat(filepath.Join(r.path, filepath.FromSlash(path))); os.IsNotExist(err) {
+			if _, err := w.Remove(path); err != nil {
+				return fmt.Errorf("failed to stage removal of %s: %w", path, err)
+			}
+			continue
+		}
+		if _, err := w.Add(path); err != nil {
+			return fmt.Errorf("failed to add %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
 // Commit creates a commit with the given message
 func (r *Repository) Commit(message string) (string, error) {
+	defer r.observe("commit", time.Now())
+
 	w, err := r.repo.Worktree()
 	if err != nil {
 		return "", fmt.Errorf("failed to get worktree: %w", err)
@@ -132,6 +287,8 @@ func (r *Repository) Commit(message string) (string, error) {
 
 // HasChanges checks if there are uncommitted changes
 func (r *Repository) HasChanges() (bool, error) {
+	defer r.observe("status", time.Now())
+
 	w, err := r.repo.Worktree()
 	if err != nil {
 		return false, fmt.Errorf("failed to get worktree: %w", err)
@@ -147,6 +304,8 @@ func (r *Repository) HasChanges() (bool, error) {
 
 // GetStatus returns the current repository status
 func (r *Repository) GetStatus() (git.Status, error) {
+	defer r.observe("status", time.Now())
+
 	w, err := r.repo.Worktree()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get worktree: %w", err)
@@ -164,6 +323,8 @@ func (r *Repository) Merge(branchName string) error {
 
 // GetLog retrieves commit history
 func (r *Repository) GetLog(maxCount int) ([]*object.Commit, error) {
+	defer r.observe("log", time.Now())
+
 	iter, err := r.repo.Log(&git.LogOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get log: %w", err)
@@ -187,6 +348,33 @@ func (r *Repository) GetLog(maxCount int) ([]*object.Commit, error) {
 	return commits, nil
 }
 
+// GetPathLog retrieves the commits touching files under pathPrefix, newest first
+func (r *Repository) GetPathLog(pathPrefix string, maxCount int) ([]*object.Commit, error) {
+	defer r.observe("log", time.Now())
+
+	prefix := strings.TrimSuffix(pathPrefix, "/") + "/"
+	iter, err := r.repo.Log(&git.LogOptions{
+		PathFilter: func(path string) bool {
+			return strings.HasPrefix(path, prefix)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get log: %w", err)
+	}
+	defer iter.Close()
+
+	var commits []*object.Commit
+	for maxCount <= 0 || len(commits) < maxCount {
+		commit, err := iter.Next()
+		if err != nil {
+			break
+		}
+		commits = append(commits, commit)
+	}
+
+	return commits, nil
+}
+
 // GetDiffFiles returns list of changed files between two branches
 func (r *Repository) GetDiffFiles(fromBranch, toBranch string) ([]string, error) {
 	// Get references for both branches
@@ -241,3 +429,72 @@ func (r *Repository) GetDiffFiles(fromBranch, toBranch string) ([]string, error)
 
 	return changedFiles, nil
 }
+
+// Housekeep packs loose objects and removes unreachable ones, similar to git gc
+func (r *Repository) Housekeep() error {
+	if err := r.repo.RepackObjects(&git.RepackConfig{}); err != nil && err != git.ErrPackedObjectsNotSupported {
+		return fmt.Errorf("failed to repack objects: %w", err)
+	}
+
+	err := r.repo.Prune(git.PruneOptions{
+		// Keep recently written objects in case another process is still using them
+		OnlyObjectsOlderThan: time.Now().Add(-2 * time.Hour),
+		Handler:              r.repo.DeleteObject,
+	})
+	if err != nil && err != git.ErrLooseObjectsNotSupported {
+		return fmt.Errorf("failed to prune objects: %w", err)
+	}
+
+	return nil
+}
+
+// Unstage resets the index to HEAD, keeping the working tree, like git reset
+func (r *Repository) Unstage() error {
+	head, err := r.repo.Head()
+	if err != nil {
+		// Nothing is committed yet, so there is nothing to reset to
+		return nil
+	}
+
+	w, err := r.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.MixedReset}); err != nil {
+		return fmt.Errorf("failed to reset index: %w", err)
+	}
+	return nil
+}
+
+// StageMove stages a folder rename done on disk: index entries under oldDir
+// are removed and the contents of newDir are added, like git mv
+func (r *Repository) StageMove(oldDir, newDir string) error {
+	w, err := r.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	idx, err := r.repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	prefix := strings.TrimSuffix(oldDir, "/") + "/"
+	var kept []*index.Entry
+	for _, entry := range idx.Entries {
+		if !strings.HasPrefix(entry.Name, prefix) {
+			kept = append(kept, entry)
+		}
+	}
+	idx.Entries = kept
+
+	if err := r.repo.Storer.SetIndex(idx); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	if err := w.AddWithOptions(&git.AddOptions{Path: newDir}); err != nil {
+		return fmt.Errorf("failed to add %s: %w", newDir, err)
+	}
+
+	return nil
+}
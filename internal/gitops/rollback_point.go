@@ -0,0 +1,251 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+const (
+	// rollbackScriptName is the device script holding a rollback point
+	rollbackScriptName = "gitops-rollback"
+
+	defaultRollbackWindow = 5 * time.Minute
+	rollbackPollInterval  = 5 * time.Second
+
+	// rollbackSettleDelay lets the device apply network changes, which it
+	// does after answering the SetConfig call, before it is polled
+	rollbackSettleDelay = 10 * time.Second
+)
+
+// networkComponents can cut a device off the network when pushed with a bad
+// value, so changes to them are pushed behind a rollback point
+var networkComponents = map[string]bool{"wifi": true, "eth": true, "sys": true}
+
+// rollbackPoint is an armed rollback script on a device
+type rollbackPoint struct {
+	scriptID int
+	addrs    []string // addresses the device may answer on after the push
+	expires  time.Time
+}
+
+// SetRollbackWindow sets how long a device waits for a network config push to
+// be confirmed before restoring its previous config. A negative window
+// disables rollback points; zero restores the default of 5 minutes.
+func (sm *SyncManager) SetRollbackWindow(window time.Duration) {
+	sm.rollbackWindow = window
+}
+
+// rollbackWindowOrDefault returns the configured rollback window
+func (sm *SyncManager) rollbackWindowOrDefault() time.Duration {
+	if sm.rollbackWindow == 0 {
+		return defaultRollbackWindow
+	}
+	return sm.rollbackWindow
+}
+
+// armRollbackPoint installs a script on the device that restores the current
+// config of the network components about to change and reboots, unless
+// confirmRollbackPoint removes it first. It returns nil when no network
+// component changes, rollback points are disabled or the device has no
+// scripting; failing to arm one only logs a warning.
+func (sm *SyncManager) armRollbackPoint(ctx context.Context, device storage.Device, pending []pendingConfig) *rollbackPoint {
+	window := sm.rollbackWindowOrDefault()
+	if window < 0 {
+		return nil
+	}
+
+	var risky []pendingConfig
+	for _, p := range pending {
+		if networkComponents[p.key] {
+			risky = append(risky, p)
+		}
+	}
+	if len(risky) == 0 || !sm.supportsMethod(ctx, device, "Script.Create") {
+		return nil
+	}
+
+	current, err := sm.shellyClient.GetShellyConfig(ctx, device.IPAddress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: No rollback point for %s, failed to read its config: %v\n", device.Name, err)
+		return nil
+	}
+	var configs map[string]interface{}
+	if err := json.Unmarshal(current, &configs); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: No rollback point for %s, failed to parse its config: %v\n", device.Name, err)
+		return nil
+	}
+
+	type restoreCall struct {
+		Method string                 `json:"method"`
+		Params map[string]interface{} `json:"params"`
+	}
+	var restore []restoreCall
+	addrs := []string{device.IPAddress}
+	for _, p := range risky {
+		// Compare as JSON values, rendered templates may yield Go ints
+		var desired interface{}
+		if data, err := json.Marshal(p.config); err == nil {
+			json.Unmarshal(data, &desired)
+		}
+
+		previous, ok := configs[p.key].(map[string]interface{})
+		if !ok || !changesConfig(previous, desired) {
+			continue
+		}
+		restore = append(restore, restoreCall{
+			Method: p.component + ".SetConfig",
+			Params: map[string]interface{}{"config": previous},
+		})
+		if ip := staticIP(p.key, p.config); ip != "" && ip != device.IPAddress {
+			addrs = append(addrs, ip)
+		}
+	}
+	if len(restore) == 0 {
+		return nil
+	}
+
+	// Leftovers of an interrupted push would restore an older config
+	if scripts, err := sm.shellyClient.ListScripts(ctx, device.IPAddress); err == nil {
+		for _, script := range scripts {
+			if script.Name == rollbackScriptName {
+				sm.shellyClient.StopScript(ctx, device.IPAddress, script.ID)
+				sm.shellyClient.DeleteScript(ctx, device.IPAddress, script.ID)
+			}
+		}
+	}
+
+	calls, err := json.Marshal(restore)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: No rollback point for %s: %v\n", device.Name, err)
+		return nil
+	}
+
+	scriptID, err := sm.shellyClient.CreateScript(ctx, device.IPAddress, rollbackScriptName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: No rollback point for %s, failed to create script: %v\n", device.Name, err)
+		return nil
+	}
+	point := &rollbackPoint{scriptID: scriptID, addrs: addrs, expires: time.Now().Add(window)}
+
+	code := rollbackScript(scriptID, string(calls), window)
+	if err := sm.shellyClient.PutScriptCode(ctx, device.IPAddress, scriptID, code, false); err == nil {
+		// Enabled so the timer also runs after the device reboots
+		if err = sm.shellyClient.SetScriptConfig(ctx, device.IPAddress, scriptID, rollbackScriptName, true); err == nil {
+			err = sm.shellyClient.StartScript(ctx, device.IPAddress, scriptID)
+		}
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "Info: Armed a %s rollback point on %s\n", window, device.Name)
+			return point
+		}
+		fmt.Fprintf(os.Stderr, "Warning: No rollback point for %s, failed to start script: %v\n", device.Name, err)
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: No rollback point for %s, failed to upload script: %v\n", device.Name, err)
+	}
+	sm.shellyClient.DeleteScript(ctx, device.IPAddress, scriptID)
+	return nil
+}
+
+// confirmRollbackPoint waits for the device to answer after the push and
+// removes the rollback script. A device that stays unreachable keeps it and
+// restores its previous config when the window runs out.
+func (sm *SyncManager) confirmRollbackPoint(ctx context.Context, device storage.Device, point *rollbackPoint) error {
+	// Leave the device time to run the rollback before giving up
+	deadline := point.expires.Add(-rollbackPollInterval * 2)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(rollbackSettleDelay):
+	}
+
+	for {
+		for _, addr := range point.addrs {
+			if _, err := sm.shellyClient.GetDeviceInfo(ctx, addr); err != nil {
+				continue
+			}
+			sm.shellyClient.StopScript(ctx, addr, point.scriptID)
+			if err := sm.shellyClient.DeleteScript(ctx, addr, point.scriptID); err != nil {
+				return fmt.Errorf("failed to remove rollback point, the device will restore its previous network config at %s: %w",
+					point.expires.Format(time.Kitchen), err)
+			}
+			if addr != device.IPAddress {
+				fmt.Fprintf(os.Stderr, "Info: %s now answers on %s; update its manifest address\n", device.Name, addr)
+			}
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("device unreachable after network config push; it restores its previous config at %s",
+				point.expires.Format(time.Kitchen))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rollbackPollInterval):
+		}
+	}
+}
+
+// changesConfig reports whether setting desired on a component whose config
+// is current changes any field. Fields missing from desired keep their value.
+func changesConfig(current, desired interface{}) bool {
+	desiredMap, ok := desired.(map[string]interface{})
+	if !ok {
+		return !reflect.DeepEqual(current, desired)
+	}
+	currentMap, _ := current.(map[string]interface{})
+	for key, value := range desiredMap {
+		if changesConfig(currentMap[key], value) {
+			return true
+		}
+	}
+	return false
+}
+
+// staticIP returns the static IPv4 address a wifi or eth config assigns
+func staticIP(key string, config map[string]interface{}) string {
+	var iface map[string]interface{}
+	switch key {
+	case "wifi":
+		iface, _ = config["sta"].(map[string]interface{})
+	case "eth":
+		iface = config
+	}
+	if mode, _ := iface["ipv4mode"].(string); mode != "static" {
+		return ""
+	}
+	ip, _ := iface["ip"].(string)
+	return ip
+}
+
+// rollbackScript renders the mJS rollback script: after the window it
+// applies the restore calls one by one, disables itself so the restored
+// device doesn't loop, and reboots
+func rollbackScript(scriptID int, calls string, window time.Duration) string {
+	return fmt.Sprintf(`// Installed by shelly-gitops before a network config push. Restores the
+// previous config unless the push is confirmed and this script removed.
+let restore = %s;
+
+function apply(i) {
+  if (i >= restore.length) {
+    Shelly.call("Script.SetConfig", {id: %d, config: {enable: false}}, function () {
+      Shelly.call("Shelly.Reboot", {});
+    });
+    return;
+  }
+  Shelly.call(restore[i].method, restore[i].params, function () {
+    apply(i + 1);
+  });
+}
+
+Timer.set(%d, false, function () {
+  apply(0);
+});
+`, calls, scriptID, window.Milliseconds())
+}
@@ -0,0 +1,278 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// defaultRolloutCheckInterval is how often ring devices are probed while a
+// promotion gate is open
+const defaultRolloutCheckInterval = 30 * time.Second
+
+// RolloutStage is a ring with the devices assigned to it
+type RolloutStage struct {
+	Ring    string
+	Devices []storage.Device
+}
+
+// RolloutOptions configures a staged push
+type RolloutOptions struct {
+	Config        *storage.RolloutConfig // nil loads rollout.yaml (or the default rings)
+	DeviceFilter  []string
+	DryRun        bool
+	ValuesFile    string
+	CheckInterval time.Duration // probe interval during promotion gates
+
+	// OnStage is called after each ring was pushed and, unless it was the
+	// last one, its promotion gate passed or failed
+	OnStage func(RolloutStageResult)
+}
+
+// RolloutStageResult is the outcome of pushing one ring
+type RolloutStageResult struct {
+	Ring     string
+	Results  []SyncResult
+	Promoted bool  // the gate passed and the next ring may be pushed
+	Error    error // why the rollout halted at this ring
+}
+
+// PlanRollout assigns the selected devices to the rings of config. Tagged
+// devices go to the first ring naming one of their tags, then sized rings are
+// filled in order from the remaining devices, sorted by device ID. Rings
+// without tags or size, and the last ring, take whatever is left.
+func (sm *SyncManager) PlanRollout(config *storage.RolloutConfig, deviceFilter []string) ([]RolloutStage, error) {
+	devices := append([]storage.Device(nil), sm.SelectDevices(deviceFilter)...)
+	sort.Slice(devices, func(i, j int) bool { return devices[i].DeviceID < devices[j].DeviceID })
+
+	stages := make([]RolloutStage, len(config.Rings))
+	assigned := make(map[string]bool, len(devices))
+
+	for i, ring := range config.Rings {
+		stages[i].Ring = ring.Name
+		for _, device := range devices {
+			if assigned[device.DeviceID] {
+				continue
+			}
+			for _, tag := range ring.Tags {
+				if device.HasTag(tag) {
+					stages[i].Devices = append(stages[i].Devices, device)
+					assigned[device.DeviceID] = true
+					break
+				}
+			}
+		}
+	}
+
+	for i, ring := range config.Rings {
+		quota := len(devices)
+		if ring.Size != "" {
+			size, err := ParseFailureBudget(ring.Size)
+			if err != nil {
+				return nil, fmt.Errorf("ring %s: invalid size %q", ring.Name, ring.Size)
+			}
+			quota = ringQuota(size, len(devices))
+		} else if len(ring.Tags) > 0 && i < len(config.Rings)-1 {
+			continue
+		}
+
+		for _, device := range devices {
+			if quota <= 0 && i < len(config.Rings)-1 {
+				break
+			}
+			if assigned[device.DeviceID] {
+				continue
+			}
+			stages[i].Devices = append(stages[i].Devices, device)
+			assigned[device.DeviceID] = true
+			quota--
+		}
+	}
+
+	return stages, nil
+}
+
+// ringQuota returns how many devices a sized ring takes out of total; a
+// non-zero percentage always yields at least one device
+func ringQuota(size FailureBudget, total int) int {
+	if !size.percent {
+		return size.Count
+	}
+	if size.Percent <= 0 {
+		return 0
+	}
+	return int(math.Max(1, math.Ceil(size.Percent*float64(total)/100)))
+}
+
+// Rollout pushes the selected devices ring by ring. After each ring (except
+// the last) every ring device must stay reachable without rebooting for the
+// configured healthy time before the next ring is pushed. A failed push or a
+// failed gate halts the rollout. Dry runs skip the gates.
+func (sm *SyncManager) Rollout(ctx context.Context, opts RolloutOptions) ([]RolloutStageResult, error) {
+	config := opts.Config
+	if config == nil {
+		var err error
+		config, err = storage.LoadRolloutConfig(sm.repoPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	interval := opts.CheckInterval
+	if interval <= 0 {
+		interval = defaultRolloutCheckInterval
+	}
+
+	stages, err := sm.PlanRollout(config, opts.DeviceFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	var completed []RolloutStageResult
+	for i, stage := range stages {
+		if len(stage.Devices) == 0 {
+			continue
+		}
+
+		ids := make([]string, 0, len(stage.Devices))
+		for _, device := range stage.Devices {
+			ids = append(ids, device.DeviceID)
+		}
+
+		stageResult := RolloutStageResult{Ring: stage.Ring}
+		stageResult.Results, err = sm.PushToDevices(ctx, opts.DryRun, ids, opts.ValuesFile)
+		if err != nil {
+			return completed, fmt.Errorf("ring %s: %w", stage.Ring, err)
+		}
+
+		var failed []string
+		for _, result := range stageResult.Results {
+			if !result.Success {
+				failed = append(failed, result.DeviceID)
+			}
+		}
+
+		switch {
+		case len(failed) > 0:
+			stageResult.Error = fmt.Errorf("ring %s: push failed on %s", stage.Ring, strings.Join(failed, ", "))
+		case opts.DryRun || i == len(stages)-1:
+			stageResult.Promoted = true
+		default:
+			healthyFor := time.Duration(config.HealthyMinutes) * time.Minute
+			if err := sm.waitRingHealthy(ctx, stage.Devices, healthyFor, interval); err != nil {
+				stageResult.Error = fmt.Errorf("ring %s: %w", stage.Ring, err)
+			} else {
+				stageResult.Promoted = true
+			}
+		}
+
+		completed = append(completed, stageResult)
+		if opts.OnStage != nil {
+			opts.OnStage(stageResult)
+		}
+		if stageResult.Error != nil {
+			return completed, fmt.Errorf("rollout halted: %w", stageResult.Error)
+		}
+	}
+
+	return completed, nil
+}
+
+// waitRingHealthy probes devices every interval for duration and fails as
+// soon as one is unreachable or has rebooted since the gate opened
+func (sm *SyncManager) waitRingHealthy(ctx context.Context, devices []storage.Device, duration, interval time.Duration) error {
+	uptimes := make(map[string]time.Duration, len(devices))
+	probe := func() error {
+		for _, device := range devices {
+			uptime, err := sm.DeviceUptime(ctx, device)
+			if err != nil {
+				return fmt.Errorf("%s unhealthy: %w", device.Name, err)
+			}
+			if previous, ok := uptimes[device.DeviceID]; ok && uptime < previous {
+				return fmt.Errorf("%s rebooted during the promotion gate", device.Name)
+			}
+			uptimes[device.DeviceID] = uptime
+		}
+		return nil
+	}
+
+	if err := probe(); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(duration)
+	for time.Now().Before(deadline) {
+		wait := interval
+		if remaining := time.Until(deadline); remaining < wait {
+			wait = remaining
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		if err := probe(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeviceUptime returns the device uptime reported by Shelly.GetStatus (sys.uptime)
+func (sm *SyncManager) DeviceUptime(ctx context.Context, device storage.Device) (time.Duration, error) {
+	result, err := sm.shellyClient.GetStatus(ctx, device.IPAddress)
+	if err != nil {
+		return 0, err
+	}
+
+	var status struct {
+		Sys struct {
+			Uptime float64 `json:"uptime"`
+		} `json:"sys"`
+	}
+	if err := json.Unmarshal(result, &status); err != nil {
+		return 0, fmt.Errorf("failed to parse status: %w", err)
+	}
+	return time.Duration(status.Sys.Uptime * float64(time.Second)), nil
+}
+
+// rebootSlack widens the window in which a device's boot counts as a reboot
+// this process started, as boot times derived from uptime are approximate
+const rebootSlack = 30 * time.Second
+
+// initiatedReboot is a reboot, or firmware update, this process started: the
+// device is expected to boot between at and deadline
+type initiatedReboot struct {
+	at, deadline time.Time
+}
+
+// noteReboot records that a device is about to be rebooted, and should boot
+// within timeout
+func (sm *SyncManager) noteReboot(deviceID string, timeout time.Duration) {
+	now := time.Now()
+	sm.initiatedReboots.Store(deviceID, initiatedReboot{at: now, deadline: now.Add(timeout)})
+}
+
+// InitiatedReboot reports whether a device booting at bootedAt was rebooted
+// by this SyncManager, after a push (SetRebootIfNeeded), an IP plan or a
+// firmware update, so status monitoring doesn't report it as unexpected. Each
+// reboot is reported once.
+func (sm *SyncManager) InitiatedReboot(deviceID string, bootedAt time.Time) bool {
+	value, ok := sm.initiatedReboots.Load(deviceID)
+	if !ok {
+		return false
+	}
+	reboot := value.(initiatedReboot)
+	if bootedAt.Before(reboot.at.Add(-rebootSlack)) {
+		return false
+	}
+	// Either this is the reboot, or a later one and this one never came
+	sm.initiatedReboots.Delete(deviceID)
+	return !bootedAt.After(reboot.deadline.Add(rebootSlack))
+}
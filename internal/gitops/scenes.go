@@ -0,0 +1,125 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/darkermage/shelly-git-ops/internal/cloud"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// sceneFileName returns the file name a scene is stored under in scenes/
+func sceneFileName(scene cloud.Scene) string {
+	if scene.Name == "" {
+		return storage.SanitizeFolderName(scene.ID)
+	}
+	return storage.DeviceFolderName(scene.Name, scene.ID)
+}
+
+// PullScenes replaces the scenes/ folder with the account's cloud scenes
+func (sm *SyncManager) PullScenes(ctx context.Context, client *cloud.Client) (int, error) {
+	scenes, err := client.ListScenes(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list scenes: %w", err)
+	}
+
+	local, err := sm.deviceStorage.ListScenes()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, scene := range scenes {
+		file := sceneFileName(scene)
+		if err := sm.deviceStorage.SaveScene(file, scene.Raw); err != nil {
+			return 0, err
+		}
+		delete(local, file)
+	}
+
+	// Scenes deleted in the app (or renamed, which changes the file name)
+	for file := range local {
+		if err := sm.deviceStorage.DeleteScene(file); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(scenes), nil
+}
+
+// SceneChange is a planned or applied change to a cloud scene
+type SceneChange struct {
+	Action string // "create", "update" or "delete"
+	ID     string
+	Name   string
+}
+
+// PushScenes makes the cloud scenes match the scenes/ folder. Scenes without
+// an "id" field are created; cloud scenes without a local file are deleted.
+func (sm *SyncManager) PushScenes(ctx context.Context, client *cloud.Client, dryRun bool) ([]SceneChange, error) {
+	local, err := sm.deviceStorage.ListScenes()
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := client.ListScenes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scenes: %w", err)
+	}
+	remoteByID := make(map[string]cloud.Scene, len(remote))
+	for _, scene := range remote {
+		remoteByID[scene.ID] = scene
+	}
+
+	var changes []SceneChange
+	seen := make(map[string]bool)
+
+	for file, raw := range local {
+		scene, err := cloud.ParseScene(raw)
+		if err != nil {
+			return changes, fmt.Errorf("scene %s: %w", file, err)
+		}
+
+		change := SceneChange{Action: "create", ID: scene.ID, Name: scene.Name}
+		if existing, ok := remoteByID[scene.ID]; ok && scene.ID != "" {
+			seen[scene.ID] = true
+			if jsonEqual(existing.Raw, scene.Raw) {
+				continue
+			}
+			change.Action = "update"
+		}
+
+		if !dryRun {
+			id, err := client.SaveScene(ctx, scene)
+			if err != nil {
+				return changes, fmt.Errorf("failed to %s scene %s: %w", change.Action, file, err)
+			}
+			change.ID = id
+		}
+		changes = append(changes, change)
+	}
+
+	for _, scene := range remote {
+		if seen[scene.ID] {
+			continue
+		}
+		if !dryRun {
+			if err := client.DeleteScene(ctx, scene.ID); err != nil {
+				return changes, fmt.Errorf("failed to delete scene %s: %w", scene.Name, err)
+			}
+		}
+		changes = append(changes, SceneChange{Action: "delete", ID: scene.ID, Name: scene.Name})
+	}
+
+	return changes, nil
+}
+
+// jsonEqual compares two JSON documents ignoring formatting and key order
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
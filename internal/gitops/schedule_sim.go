@@ -0,0 +1,145 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// scheduleHorizon bounds how far ahead schedule simulation searches for firings
+const scheduleHorizon = 5 * 366 * 24 * time.Hour
+
+// ScheduleSimulation lists the upcoming firing times of one schedule
+type ScheduleSimulation struct {
+	DeviceID   string
+	DeviceName string
+	ScheduleID int
+	Timespec   string
+	Enabled    bool
+	Timezone   string
+	NextFires  []time.Time
+	NeverFires bool   // no firing found within the simulation horizon
+	Solar      bool   // sunrise/sunset based, not simulated
+	Error      string // timespec could not be parsed
+}
+
+// ScheduleOverlap reports two enabled schedules on a device firing at the same time
+type ScheduleOverlap struct {
+	DeviceID    string
+	ScheduleIDs [2]int
+	At          time.Time
+}
+
+// SimulateSchedules computes the next n firing times of every local schedule
+// across the fleet, in each device's configured timezone (configs/sys.json)
+func (sm *SyncManager) SimulateSchedules(from time.Time, n int) ([]ScheduleSimulation, []ScheduleOverlap, error) {
+	var simulations []ScheduleSimulation
+	var overlaps []ScheduleOverlap
+
+	for _, device := range sm.manifest.Devices {
+		schedules, err := sm.deviceStorage.ListSchedules(device.Folder)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list schedules for %s: %w", device.Name, err)
+		}
+
+		loc, tzName := sm.deviceLocation(device)
+		fires := make(map[time.Time][]int)
+
+		sort.Slice(schedules, func(i, j int) bool { return schedules[i].ID < schedules[j].ID })
+		for _, schedule := range schedules {
+			sim := simulateSchedule(device, schedule, from.In(loc), n)
+			sim.Timezone = tzName
+			simulations = append(simulations, sim)
+
+			if !schedule.Enable {
+				continue
+			}
+			for _, at := range sim.NextFires {
+				fires[at] = append(fires[at], schedule.ID)
+			}
+		}
+
+		for at, ids := range fires {
+			for i := 0; i < len(ids); i++ {
+				for j := i + 1; j < len(ids); j++ {
+					overlaps = append(overlaps, ScheduleOverlap{
+						DeviceID:    device.DeviceID,
+						ScheduleIDs: [2]int{ids[i], ids[j]},
+						At:          at,
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(overlaps, func(i, j int) bool {
+		if overlaps[i].DeviceID != overlaps[j].DeviceID {
+			return overlaps[i].DeviceID < overlaps[j].DeviceID
+		}
+		return overlaps[i].At.Before(overlaps[j].At)
+	})
+
+	return simulations, overlaps, nil
+}
+
+// simulateSchedule computes up to n firings of a single schedule after from
+func simulateSchedule(device storage.Device, schedule *shelly.Schedule, from time.Time, n int) ScheduleSimulation {
+	sim := ScheduleSimulation{
+		DeviceID:   device.DeviceID,
+		DeviceName: device.Name,
+		ScheduleID: schedule.ID,
+		Timespec:   schedule.Timespec,
+		Enabled:    schedule.Enable,
+	}
+
+	ts, err := shelly.ParseTimespec(schedule.Timespec)
+	if err != nil {
+		sim.Error = err.Error()
+		return sim
+	}
+	if ts.Solar != "" {
+		sim.Solar = true
+		return sim
+	}
+
+	at := from
+	for len(sim.NextFires) < n {
+		next, ok := ts.Next(at, scheduleHorizon)
+		if !ok {
+			break
+		}
+		sim.NextFires = append(sim.NextFires, next)
+		at = next
+	}
+	sim.NeverFires = len(sim.NextFires) == 0
+
+	return sim
+}
+
+// deviceLocation returns the timezone from the device's sys config, falling back to UTC
+func (sm *SyncManager) deviceLocation(device storage.Device) (*time.Location, string) {
+	data, err := sm.deviceStorage.LoadComponentConfig(device.Folder, "sys")
+	if err != nil {
+		return time.UTC, "UTC"
+	}
+
+	var sys struct {
+		Location struct {
+			TZ string `json:"tz"`
+		} `json:"location"`
+	}
+	if err := json.Unmarshal(data, &sys); err != nil || sys.Location.TZ == "" {
+		return time.UTC, "UTC"
+	}
+
+	loc, err := time.LoadLocation(sys.Location.TZ)
+	if err != nil {
+		return time.UTC, "UTC"
+	}
+
+	return loc, sys.Location.TZ
+}
@@ -0,0 +1,40 @@
+package gitops
+
+import "fmt"
+
+// SetScriptSizeLimit makes push and Validate reject scripts larger than limit
+// bytes, e.g. the smallest script size the fleet's devices accept. Zero, the
+// default, disables the check.
+func (sm *SyncManager) SetScriptSizeLimit(limit int) {
+	sm.scriptSizeLimit = limit
+}
+
+// checkScriptCode checks script code before it is uploaded: its size against
+// the configured limit and its syntax (see checkScriptSyntax)
+func (sm *SyncManager) checkScriptCode(code string) error {
+	if sm.scriptSizeLimit > 0 && len(code) > sm.scriptSizeLimit {
+		return fmt.Errorf("script is %d bytes, over the limit of %d", len(code), sm.scriptSizeLimit)
+	}
+	return checkScriptSyntax(code)
+}
+
+// checkScriptSyntax parses script code as JavaScript and returns the first
+// syntax error, e.g. an unterminated string, a missing brace or "let = ;",
+// with its line and column. It checks the grammar only, not scoping rules
+// such as redeclarations or where private names and super may appear, and a
+// script may still use a feature the device's interpreter lacks.
+func checkScriptSyntax(code string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			syntaxErr, ok := r.(*scriptSyntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = syntaxErr
+		}
+	}()
+
+	p := &scriptParser{lex: newScriptLexer(code), arrowAt: -1}
+	p.parseScript()
+	return nil
+}
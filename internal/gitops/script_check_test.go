@@ -0,0 +1,72 @@
+package gitops
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckScriptSyntaxAcceptsValidCode(t *testing.T) {
+	scripts := map[string]string{
+		"postfix increment then division": "let i = 4; let x = i++ / 2;",
+		"postfix decrement then division": "let i = 4; let x = i-- / 2 / 1;",
+		"division after call and index":   "let y = f(a) / b[0] / c;",
+		"regex after return":              "function f() { return /a[/]b\\//g.test('x'); }",
+		"regex after paren of if":         "if (x) /[(]/.test(s);",
+		"regex with quote":                "let r = /it's/;",
+		"comments":                        "// line ( [ {\n/* block ) ] } */ let a = 1;",
+		"strings with brackets":           "print(\"(\", '[', \"it's\");",
+		"nested template literals":        "print(`v=${res.x + `n${1}`} {`);",
+		"regex after block":               "if (x) {}\n/=a/.test(s);",
+		"division after object literal":   "let n = {a: 1}.a / 2;",
+		"regex closing brace in template": "let t = `${/}/.source}`;",
+		"arrows and destructuring":        "let f = ({a, b: [c = 1, ...d]}, ...e) => a + c;\nlet g = async x => await x;",
+		"classes":                         "class A extends B { #n = 1; static s; get n() { return this.#n; } m() { return #n in this; } }",
+		"automatic semicolons":            "let a = 1\nlet b = a\n++b\nreturn_ = a",
+		"labels":                          "outer: for (let i of xs) { for (;;) { continue outer; } }",
+		"optional chaining":               "let v = res?.result?.[0]?.(x) ?? null;",
+		"numbers":                         "let n = [0x1F, 0o17, 0b101, 1_000, 1e-3, .5, 10n];",
+		"generators":                      "function* g() { yield* h(); let y = yield; }",
+		"rpc callback": "Shelly.call(\"Switch.Set\", {id: 0, on: true}, function (res, code) {\n" +
+			"  if (code !== 0) { print(\"failed: \" + code); }\n});",
+	}
+	for name, code := range scripts {
+		if err := checkScriptSyntax(code); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+}
+
+func TestCheckScriptSyntaxRejectsBrokenCode(t *testing.T) {
+	scripts := []struct {
+		code string
+		want string
+	}{
+		{"function f() {\n  print(\"x);\n}", "line 2, col 9: unterminated string"},
+		{"let a = [1, 2);", "line 1, col 14: ')' does not match '['"},
+		{"function f() {\n  if (x) {\n}", "line 1, col 14: unclosed '{'"},
+		{"let a = 1; /* never ends", "line 1, col 12: unterminated block comment"},
+		{"let t = `abc ${x + 1", "line 1, col 14: unclosed \"${\" in template literal"},
+		{"let t = `abc ${x + 1 ;", "line 1, col 22: unexpected ';', expected '}'"},
+		{"let t = `abc", "line 1, col 9: unterminated template literal"},
+		{"let x = i++ / 2;\n}", "line 2, col 1: unexpected '}'"},
+		{"let = ;", "line 1, col 7: unexpected ';'"},
+		{"x = 1 +;", "line 1, col 8: unexpected ';'"},
+		{"f(a b);", "line 1, col 5: unexpected 'b', expected ')'"},
+		{"return 1;", "line 1, col 1: return outside a function"},
+		{"1 = x;", "line 1, col 1: invalid assignment target"},
+		{"const c;", "line 1, col 7: missing initializer"},
+		{"break;", "line 1, col 1: break outside a loop or switch"},
+		{"x = {a = 1};", "line 1, col 6: invalid shorthand property initializer"},
+		{"let r = /ab\n/;", "line 1, col 9: unterminated regular expression"},
+		{"let r = /a(b/;", "line 1, col 9: invalid regular expression: unterminated group"},
+		{"let v = a ?? b || c;", "line 1, col 11: '??' and '||' or '&&' need parentheses when mixed"},
+		{"'use strict';\nwith (o) {}", "line 2, col 1: with in strict mode"},
+		{strings.Repeat("x = a / b / c[0] / d;\n", 1000) + "}", "line 1001, col 1: unexpected '}'"},
+	}
+	for _, script := range scripts {
+		err := checkScriptSyntax(script.code)
+		if err == nil || !strings.Contains(err.Error(), script.want) {
+			t.Errorf("%q: got error %v, want %q", script.code, err, script.want)
+		}
+	}
+}
@@ -0,0 +1,805 @@
+package gitops
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// scriptTokenKind is what a token of script code is
+type scriptTokenKind int
+
+const (
+	scriptEOF         scriptTokenKind = iota
+	scriptName                        // identifier or keyword
+	scriptPrivateName                 // "#name" of a class member
+	scriptNumber
+	scriptString
+	scriptTemplate // a template literal up to its closing backtick or next "${"
+	scriptRegex
+	scriptPunct
+)
+
+// scriptToken is a token of script code
+type scriptToken struct {
+	kind            scriptTokenKind
+	text            string // as written
+	start, end      int    // byte offsets
+	line, col       int
+	endLine, endCol int
+	newlineBefore   bool // a line break separates it from the previous token
+	escaped         bool // a name written with \u escapes, which is never a keyword
+	tail            bool // a template literal part ending at the closing backtick
+	legacyOctal     bool // a number like 017 or a string with an escape like \1, not allowed in strict mode
+}
+
+// is reports whether the token is the punctuator or keyword text
+func (t scriptToken) is(text string) bool {
+	return (t.kind == scriptPunct || t.kind == scriptName && !t.escaped) && t.text == text
+}
+
+// String describes the token for error messages
+func (t scriptToken) String() string {
+	switch t.kind {
+	case scriptEOF:
+		return "end of script"
+	case scriptNumber:
+		return "number"
+	case scriptString:
+		return "string"
+	case scriptTemplate:
+		return "template literal"
+	case scriptRegex:
+		return "regular expression"
+	}
+	return "'" + t.text + "'"
+}
+
+// scriptSyntaxError is the first syntax error in script code. The lexer and
+// parser panic with it, and checkScriptSyntax recovers it.
+type scriptSyntaxError struct {
+	line, col int
+	msg       string
+}
+
+func (e *scriptSyntaxError) Error() string {
+	return fmt.Sprintf("line %d, col %d: %s", e.line, e.col, e.msg)
+}
+
+// failScript stops the check with a syntax error at line and col
+func failScript(line, col int, format string, args ...interface{}) {
+	panic(&scriptSyntaxError{line: line, col: col, msg: fmt.Sprintf(format, args...)})
+}
+
+// scriptPunctuators are the punctuators, longest first
+var scriptPunctuators = []string{
+	">>>=", "...", "===", "!==", "**=", "<<=", ">>=", ">>>", "&&=", "||=", "??=",
+	"=>", "==", "!=", "<=", ">=", "&&", "||", "??", "?.", "++", "--",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "<<", ">>", "**",
+	"{", "}", "(", ")", "[", "]", ";", ",", "<", ">", "+", "-", "*", "/", "%",
+	"&", "|", "^", "!", "~", "?", ":", "=", ".",
+}
+
+// scriptLexer splits script code into tokens for scriptParser
+type scriptLexer struct {
+	code      string
+	i         int
+	line, col int
+}
+
+func newScriptLexer(code string) *scriptLexer {
+	l := &scriptLexer{code: code, line: 1, col: 1}
+	if strings.HasPrefix(code, "#!") {
+		for l.i < len(code) && !isScriptLineTerminator(l.peekRune()) {
+			l.advance()
+		}
+	}
+	return l
+}
+
+// peekRune returns the rune at the current position, or -1 at the end
+func (l *scriptLexer) peekRune() rune {
+	if l.i >= len(l.code) {
+		return -1
+	}
+	if c := l.code[l.i]; c < utf8.RuneSelf {
+		return rune(c)
+	}
+	r, _ := utf8.DecodeRuneInString(l.code[l.i:])
+	return r
+}
+
+// peekByte returns the byte n bytes ahead, or 0 past the end
+func (l *scriptLexer) peekByte(n int) byte {
+	if l.i+n < len(l.code) {
+		return l.code[l.i+n]
+	}
+	return 0
+}
+
+// advance moves past the current rune
+func (l *scriptLexer) advance() {
+	r, size := utf8.DecodeRuneInString(l.code[l.i:])
+	l.i += size
+	if r == '\n' || r == '\r' && l.peekByte(0) != '\n' || r == '\u2028' || r == '\u2029' {
+		l.line, l.col = l.line+1, 1
+	} else {
+		l.col++
+	}
+}
+
+// skipSpace moves past white space and comments and reports whether they
+// contain a line break
+func (l *scriptLexer) skipSpace() bool {
+	newline := false
+	for l.i < len(l.code) {
+		r := l.peekRune()
+		switch {
+		case isScriptLineTerminator(r):
+			newline = true
+			l.advance()
+		case r == ' ' || r == '\t' || r == '\v' || r == '\f' || r == '\ufeff' || unicode.Is(unicode.Zs, r):
+			l.advance()
+		case r == '/' && l.peekByte(1) == '/':
+			for l.i < len(l.code) && !isScriptLineTerminator(l.peekRune()) {
+				l.advance()
+			}
+		case r == '/' && l.peekByte(1) == '*':
+			line, col := l.line, l.col
+			end := strings.Index(l.code[l.i+2:], "*/")
+			if end < 0 {
+				failScript(line, col, "unterminated block comment")
+			}
+			for stop := l.i + 2 + end + 2; l.i < stop; {
+				newline = newline || isScriptLineTerminator(l.peekRune())
+				l.advance()
+			}
+		default:
+			return newline
+		}
+	}
+	return newline
+}
+
+// next reads the next token. A "/" is read as a punctuator; the parser
+// rereads it with rescanRegex where the grammar expects an expression.
+func (l *scriptLexer) next() scriptToken {
+	newline := l.skipSpace()
+	tok := scriptToken{start: l.i, line: l.line, col: l.col, newlineBefore: newline}
+	switch r := l.peekRune(); {
+	case r < 0:
+		tok.kind = scriptEOF
+	case isScriptIdentStart(r) || r == '\\':
+		tok.kind = scriptName
+		tok.escaped = l.scanName()
+	case r == '#':
+		l.advance()
+		if r := l.peekRune(); !isScriptIdentStart(r) && r != '\\' {
+			failScript(tok.line, tok.col, "unexpected '#'")
+		}
+		tok.kind = scriptPrivateName
+		l.scanName()
+	case r >= '0' && r <= '9' || r == '.' && isScriptDigit(l.peekByte(1)):
+		tok.kind = scriptNumber
+		tok.legacyOctal = l.scanNumber(tok)
+	case r == '"' || r == '\'':
+		tok.kind = scriptString
+		tok.legacyOctal = l.scanString(tok)
+	case r == '`':
+		tok.kind = scriptTemplate
+		l.advance()
+		tok.tail = l.scanTemplate(tok)
+	default:
+		tok.kind = scriptPunct
+		l.scanPunct(tok)
+	}
+	return l.finish(tok)
+}
+
+// finish sets the end and text of a token read up to the current position
+func (l *scriptLexer) finish(tok scriptToken) scriptToken {
+	tok.end, tok.endLine, tok.endCol = l.i, l.line, l.col
+	tok.text = l.code[tok.start:l.i]
+	return tok
+}
+
+// rescanRegex rereads a "/" or "/=" token as a regular expression literal
+func (l *scriptLexer) rescanRegex(slash scriptToken) scriptToken {
+	l.i, l.line, l.col = slash.start, slash.line, slash.col
+	tok := scriptToken{kind: scriptRegex, start: l.i, line: l.line, col: l.col, newlineBefore: slash.newlineBefore}
+	l.advance()
+	inClass := false
+	for {
+		r := l.peekRune()
+		if r < 0 || isScriptLineTerminator(r) {
+			failScript(tok.line, tok.col, "unterminated regular expression")
+		}
+		switch {
+		case r == '\\':
+			l.advance()
+			if r := l.peekRune(); r < 0 || isScriptLineTerminator(r) {
+				failScript(tok.line, tok.col, "unterminated regular expression")
+			}
+		case r == '[':
+			inClass = true
+		case r == ']':
+			inClass = false
+		case r == '/' && !inClass:
+			l.advance()
+			flags := l.i
+			for isScriptIdentPart(l.peekRune()) {
+				l.advance()
+			}
+			flagText := l.code[flags:l.i]
+			for i, flag := range flagText {
+				if !strings.ContainsRune("dgimsuvy", flag) || strings.ContainsRune(flagText[:i], flag) {
+					failScript(tok.line, tok.col, "invalid regular expression flags")
+				}
+			}
+			// The v flag changes the syntax of character classes
+			if !strings.ContainsRune(flagText, 'v') {
+				if msg := checkScriptRegex(l.code[tok.start+1:flags-1], strings.ContainsRune(flagText, 'u')); msg != "" {
+					failScript(tok.line, tok.col, "invalid regular expression: %s", msg)
+				}
+			}
+			return l.finish(tok)
+		}
+		l.advance()
+	}
+}
+
+// rescanTemplate rereads the "}" closing a substitution in a template
+// literal as the start of the literal's next part
+func (l *scriptLexer) rescanTemplate(brace scriptToken) scriptToken {
+	l.i, l.line, l.col = brace.start, brace.line, brace.col
+	tok := scriptToken{kind: scriptTemplate, start: l.i, line: l.line, col: l.col, newlineBefore: brace.newlineBefore}
+	l.advance()
+	tok.tail = l.scanTemplate(tok)
+	return l.finish(tok)
+}
+
+// scanName moves past an identifier name and reports whether it contains
+// \u escapes
+func (l *scriptLexer) scanName() bool {
+	escaped := false
+	for first := true; ; first = false {
+		r := l.peekRune()
+		switch {
+		case r == '\\':
+			line, col := l.line, l.col
+			if l.peekByte(1) != 'u' {
+				failScript(line, col, "invalid escape in identifier")
+			}
+			l.advance()
+			l.advance()
+			l.scanUnicodeEscape(line, col)
+			escaped = true
+		case first && isScriptIdentStart(r) || !first && isScriptIdentPart(r):
+			l.advance()
+		default:
+			return escaped
+		}
+	}
+}
+
+// scanUnicodeEscape moves past the code point of a \u escape
+func (l *scriptLexer) scanUnicodeEscape(line, col int) {
+	if l.peekByte(0) == '{' {
+		l.advance()
+		digits := 0
+		for ; isScriptHexDigit(l.peekByte(0)); digits++ {
+			l.advance()
+		}
+		if digits == 0 || l.peekByte(0) != '}' {
+			failScript(line, col, "invalid Unicode escape")
+		}
+		l.advance()
+		return
+	}
+	for digits := 0; digits < 4; digits++ {
+		if !isScriptHexDigit(l.peekByte(0)) {
+			failScript(line, col, "invalid Unicode escape")
+		}
+		l.advance()
+	}
+}
+
+// scanNumber moves past a numeric literal and reports whether it has a
+// legacy leading zero
+func (l *scriptLexer) scanNumber(tok scriptToken) bool {
+	bigint, legacy := true, false
+	switch prefix := l.peekByte(1); {
+	case l.peekByte(0) == '0' && (prefix == 'x' || prefix == 'X'):
+		l.advance()
+		l.advance()
+		l.scanDigits(tok, isScriptHexDigit)
+	case l.peekByte(0) == '0' && (prefix == 'o' || prefix == 'O'):
+		l.advance()
+		l.advance()
+		l.scanDigits(tok, func(c byte) bool { return c >= '0' && c <= '7' })
+	case l.peekByte(0) == '0' && (prefix == 'b' || prefix == 'B'):
+		l.advance()
+		l.advance()
+		l.scanDigits(tok, func(c byte) bool { return c == '0' || c == '1' })
+	case l.peekByte(0) == '0' && isScriptDigit(prefix):
+		// A legacy octal, or decimal with a leading zero, e.g. 017 or 089
+		for isScriptDigit(l.peekByte(0)) {
+			l.advance()
+		}
+		bigint, legacy = false, true
+	default:
+		if l.peekByte(0) != '.' {
+			l.scanDigits(tok, isScriptDigit)
+		}
+		if l.peekByte(0) == '.' {
+			l.advance()
+			bigint = false
+			if isScriptDigit(l.peekByte(0)) {
+				l.scanDigits(tok, isScriptDigit)
+			}
+		}
+		if e := l.peekByte(0); e == 'e' || e == 'E' {
+			l.advance()
+			bigint = false
+			if sign := l.peekByte(0); sign == '+' || sign == '-' {
+				l.advance()
+			}
+			l.scanDigits(tok, isScriptDigit)
+		}
+	}
+	if bigint && l.peekByte(0) == 'n' {
+		l.advance()
+	}
+	if r := l.peekRune(); isScriptIdentStart(r) || r == '\\' || r >= '0' && r <= '9' {
+		failScript(tok.line, tok.col, "invalid number")
+	}
+	return legacy
+}
+
+// scanDigits moves past one or more digits, with single "_" separators
+// between them
+func (l *scriptLexer) scanDigits(tok scriptToken, isDigit func(byte) bool) {
+	if !isDigit(l.peekByte(0)) {
+		failScript(tok.line, tok.col, "invalid number")
+	}
+	for isDigit(l.peekByte(0)) {
+		l.advance()
+		if l.peekByte(0) == '_' && isDigit(l.peekByte(1)) {
+			l.advance()
+		}
+	}
+}
+
+// scanString moves past a string literal and reports whether it has a
+// legacy octal escape
+func (l *scriptLexer) scanString(tok scriptToken) bool {
+	legacy := false
+	quote := l.peekRune()
+	l.advance()
+	for {
+		switch r := l.peekRune(); {
+		case r < 0 || r == '\n' || r == '\r':
+			failScript(tok.line, tok.col, "unterminated string")
+		case r == quote:
+			l.advance()
+			return legacy
+		case r == '\\':
+			legacy = l.scanEscape() || legacy
+		default:
+			l.advance()
+		}
+	}
+}
+
+// scanEscape moves past an escape sequence in a string literal and reports
+// whether it is a legacy octal escape: \0 followed by a digit, or \1 to \9
+func (l *scriptLexer) scanEscape() bool {
+	line, col := l.line, l.col
+	l.advance()
+	if c := l.peekByte(0); c >= '1' && c <= '9' || c == '0' && isScriptDigit(l.peekByte(1)) {
+		for isScriptDigit(l.peekByte(0)) {
+			l.advance()
+		}
+		return true
+	}
+	switch l.peekRune() {
+	case -1:
+		// Reported as an unterminated string
+	case 'x':
+		l.advance()
+		for digits := 0; digits < 2; digits++ {
+			if !isScriptHexDigit(l.peekByte(0)) {
+				failScript(line, col, "invalid escape")
+			}
+			l.advance()
+		}
+	case 'u':
+		l.advance()
+		l.scanUnicodeEscape(line, col)
+	case '\r':
+		l.advance()
+		if l.peekByte(0) == '\n' {
+			l.advance()
+		}
+	default:
+		l.advance()
+	}
+	return false
+}
+
+// scanTemplate moves past a part of a template literal, from after its
+// opening backtick or the "}" closing a substitution, and reports whether
+// the part ends the literal; otherwise it ends at "${"
+func (l *scriptLexer) scanTemplate(tok scriptToken) bool {
+	for {
+		switch r := l.peekRune(); {
+		case r < 0:
+			failScript(tok.line, tok.col, "unterminated template literal")
+		case r == '`':
+			l.advance()
+			return true
+		case r == '$' && l.peekByte(1) == '{':
+			l.advance()
+			l.advance()
+			return false
+		case r == '\\':
+			// Tagged templates may contain any escape, so none is checked
+			l.advance()
+			if l.peekRune() >= 0 {
+				l.advance()
+			}
+		default:
+			l.advance()
+		}
+	}
+}
+
+// scanPunct moves past a punctuator
+func (l *scriptLexer) scanPunct(tok scriptToken) {
+	rest := l.code[l.i:]
+	for _, punct := range scriptPunctuators {
+		// "?." followed by a digit is "?" and a number, as in a?.5:0
+		if strings.HasPrefix(rest, punct) && !(punct == "?." && len(rest) > 2 && isScriptDigit(rest[2])) {
+			l.i += len(punct)
+			l.col += len(punct)
+			return
+		}
+	}
+	failScript(tok.line, tok.col, "unexpected character %q", l.peekRune())
+}
+
+func isScriptLineTerminator(r rune) bool {
+	return r == '\n' || r == '\r' || r == '\u2028' || r == '\u2029'
+}
+
+func isScriptDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isScriptHexDigit(c byte) bool {
+	return isScriptDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// isScriptIdentStart reports whether r can start an identifier
+func isScriptIdentStart(r rune) bool {
+	return r == '$' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+		r >= utf8.RuneSelf && (unicode.IsLetter(r) || unicode.Is(unicode.Nl, r))
+}
+
+// isScriptIdentPart reports whether r can be part of an identifier
+func isScriptIdentPart(r rune) bool {
+	return isScriptIdentStart(r) || r >= '0' && r <= '9' ||
+		r >= utf8.RuneSelf && (unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc) || r == '\u200c' || r == '\u200d')
+}
+
+// checkScriptRegex checks the pattern of a regular expression literal for
+// the errors that keep it from compiling: unbalanced parentheses, unknown
+// kinds of group, quantifiers with nothing to repeat, ranges out of order
+// and, in unicode mode, escapes it doesn't allow. It returns what is wrong,
+// or "" if nothing is.
+func checkScriptRegex(pattern string, unicodeMode bool) string {
+	var groups []bool // for each open group, whether it can be quantified
+	captures, reference := 0, 0
+	quantifiable := false
+	for i := 0; i < len(pattern); {
+		switch c := pattern[i]; c {
+		case '\\':
+			n, value, msg := scanScriptRegexEscape(pattern[i:], unicodeMode, false)
+			if msg != "" {
+				return msg
+			}
+			if value == scriptRegexReference && isScriptDigit(pattern[i+1]) {
+				number, _ := strconv.Atoi(pattern[i+1 : i+n])
+				reference = max(reference, number)
+			}
+			i += n
+			quantifiable = value != scriptRegexAssertion
+			continue
+		case '[':
+			n, msg := scanScriptRegexClass(pattern[i:], unicodeMode)
+			if msg != "" {
+				return msg
+			}
+			i += n
+			quantifiable = true
+			continue
+		case '(':
+			n, group := scriptRegexGroup(pattern[i:])
+			switch group {
+			case "":
+				return "invalid group"
+			case "lookbehind":
+				groups = append(groups, false)
+			case "lookahead":
+				groups = append(groups, !unicodeMode)
+			default:
+				groups = append(groups, true)
+				if n != 3 { // not (?:
+					captures++
+				}
+			}
+			i += n
+			quantifiable = false
+			continue
+		case ')':
+			if len(groups) == 0 {
+				return "unmatched ')'"
+			}
+			quantifiable = groups[len(groups)-1]
+			groups = groups[:len(groups)-1]
+		case '*', '+', '?', '{':
+			n := 1
+			if c == '{' {
+				var min, max int
+				var ok bool
+				if n, min, max, ok = scriptRegexBraces(pattern[i:]); !ok {
+					if unicodeMode {
+						return "incomplete quantifier"
+					}
+					quantifiable = true // a literal "{"
+					break
+				}
+				if max >= 0 && min > max {
+					return "numbers out of order in {} quantifier"
+				}
+			}
+			if !quantifiable {
+				return "nothing to repeat"
+			}
+			i += n
+			if i < len(pattern) && pattern[i] == '?' {
+				i++ // lazy
+			}
+			quantifiable = false
+			continue
+		case '}', ']':
+			if unicodeMode {
+				return "lone quantifier brackets"
+			}
+			quantifiable = true
+		case '|', '^', '$':
+			quantifiable = false
+		default:
+			quantifiable = true
+		}
+		i++
+	}
+	if len(groups) > 0 {
+		return "unterminated group"
+	}
+	if unicodeMode && reference > captures {
+		return "invalid escape" // a reference to a group that doesn't exist
+	}
+	return ""
+}
+
+// Values scanScriptRegexEscape returns for escapes that aren't a single
+// character
+const (
+	scriptRegexClassEscape = -1 // e.g. \d
+	scriptRegexAssertion   = -2 // \b or \B
+	scriptRegexReference   = -3 // a backreference
+)
+
+// scanScriptRegexEscape reads the escape at the start of s, in a regular
+// expression or, with inClass, a character class in one. It returns its
+// length and the character it stands for, or why it is invalid.
+func scanScriptRegexEscape(s string, unicodeMode, inClass bool) (int, rune, string) {
+	if len(s) < 2 {
+		return 0, 0, "\\ at end of pattern"
+	}
+	switch c := s[1]; {
+	case strings.IndexByte("dDsSwW", c) >= 0:
+		return 2, scriptRegexClassEscape, ""
+	case c == 'b' && inClass:
+		return 2, '\b', ""
+	case (c == 'b' || c == 'B') && !inClass:
+		return 2, scriptRegexAssertion, ""
+	case strings.IndexByte("fnrtv", c) >= 0:
+		return 2, rune("\f\n\r\t\v"[strings.IndexByte("fnrtv", c)]), ""
+	case c == 'c':
+		if len(s) > 2 && (s[2] >= 'a' && s[2] <= 'z' || s[2] >= 'A' && s[2] <= 'Z') {
+			return 3, rune(s[2] % 32), ""
+		}
+	case c == '0' && (len(s) < 3 || !isScriptDigit(s[2])):
+		return 2, 0, ""
+	case isScriptDigit(c):
+		if unicodeMode && (c == '0' || inClass) {
+			break
+		}
+		n := 2
+		for n < len(s) && isScriptDigit(s[n]) {
+			n++
+		}
+		if inClass {
+			// A legacy octal escape
+			value, digits := rune(0), 1
+			for ; digits < n && digits <= 3 && s[digits] <= '7'; digits++ {
+				value = value*8 + rune(s[digits]-'0')
+			}
+			if digits == 1 {
+				return 2, rune(c), ""
+			}
+			return digits, value, ""
+		}
+		return n, scriptRegexReference, ""
+	case c == 'x':
+		if len(s) >= 4 && isScriptHexDigit(s[2]) && isScriptHexDigit(s[3]) {
+			return 4, scriptHexValue(s[2:4]), ""
+		}
+	case c == 'u':
+		if len(s) >= 6 && isScriptHexDigit(s[2]) && isScriptHexDigit(s[3]) && isScriptHexDigit(s[4]) && isScriptHexDigit(s[5]) {
+			return 6, scriptHexValue(s[2:6]), ""
+		}
+		if unicodeMode && len(s) > 2 && s[2] == '{' {
+			end := strings.IndexByte(s, '}')
+			if end > 3 && strings.Trim(s[3:end], "0123456789abcdefABCDEF") == "" && scriptHexValue(s[3:end]) <= unicode.MaxRune {
+				return end + 1, scriptHexValue(s[3:end]), ""
+			}
+		}
+		if unicodeMode {
+			return 0, 0, "invalid Unicode escape"
+		}
+	case c == 'k' && !inClass:
+		if len(s) > 2 && s[2] == '<' {
+			if end := strings.IndexByte(s, '>'); end > 3 {
+				return end + 1, scriptRegexReference, ""
+			}
+		}
+		if unicodeMode {
+			return 0, 0, "invalid named reference"
+		}
+	case (c == 'p' || c == 'P') && unicodeMode:
+		if len(s) > 2 && s[2] == '{' {
+			if end := strings.IndexByte(s, '}'); end > 3 {
+				return end + 1, scriptRegexClassEscape, ""
+			}
+		}
+		return 0, 0, "invalid property name"
+	case strings.IndexByte(`^$\.*+?()[]{}|/`, c) >= 0, c == '-' && inClass:
+		return 2, rune(c), ""
+	}
+	if unicodeMode {
+		return 0, 0, "invalid escape"
+	}
+	// An identity escape, e.g. \a for "a"
+	r, size := utf8.DecodeRuneInString(s[1:])
+	return 1 + size, r, ""
+}
+
+// scanScriptRegexClass reads the character class at the start of s and
+// returns its length, or why it is invalid
+func scanScriptRegexClass(s string, unicodeMode bool) (int, string) {
+	i := 1
+	if i < len(s) && s[i] == '^' {
+		i++
+	}
+	// atom reads one class atom: a character or a class escape like \d
+	atom := func() (rune, string) {
+		if s[i] == '\\' {
+			n, value, msg := scanScriptRegexEscape(s[i:], unicodeMode, true)
+			i += n
+			return value, msg
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		return r, ""
+	}
+	for i < len(s) && s[i] != ']' {
+		from, msg := atom()
+		if msg != "" {
+			return 0, msg
+		}
+		if i+1 < len(s) && s[i] == '-' && s[i+1] != ']' {
+			i++
+			to, msg := atom()
+			if msg != "" {
+				return 0, msg
+			}
+			switch {
+			case from < 0 || to < 0:
+				if unicodeMode {
+					return 0, "invalid character class"
+				}
+			case from > to:
+				return 0, "range out of order in character class"
+			}
+		}
+	}
+	if i >= len(s) {
+		return 0, "unterminated character class"
+	}
+	return i + 1, ""
+}
+
+// scriptRegexGroup reads the start of the group at the start of s and
+// returns its length and kind: "group", "lookahead" or "lookbehind", or ""
+// if it is invalid
+func scriptRegexGroup(s string) (int, string) {
+	switch {
+	case !strings.HasPrefix(s, "(?"):
+		return 1, "group"
+	case strings.HasPrefix(s, "(?:"):
+		return 3, "group"
+	case strings.HasPrefix(s, "(?="), strings.HasPrefix(s, "(?!"):
+		return 3, "lookahead"
+	case strings.HasPrefix(s, "(?<="), strings.HasPrefix(s, "(?<!"):
+		return 4, "lookbehind"
+	case strings.HasPrefix(s, "(?<"):
+		end := strings.IndexByte(s, '>')
+		if end < 4 {
+			return 0, ""
+		}
+		for i, r := range s[3:end] {
+			if i == 0 && !isScriptIdentStart(r) || !isScriptIdentPart(r) {
+				return 0, ""
+			}
+		}
+		return end + 1, "group"
+	}
+	return 0, ""
+}
+
+// scriptRegexBraces reads a {min}, {min,} or {min,max} quantifier at the
+// start of s, with max -1 if there is none, and reports whether there is one
+func scriptRegexBraces(s string) (n, min, max int, ok bool) {
+	number := func(i int) (int, int) {
+		value := 0
+		start := i
+		for ; i < len(s) && isScriptDigit(s[i]); i++ {
+			if value < 1<<30 {
+				value = value*10 + int(s[i]-'0')
+			}
+		}
+		if i == start {
+			return -1, i
+		}
+		return value, i
+	}
+	min, i := number(1)
+	if min < 0 {
+		return 0, 0, 0, false
+	}
+	max = min
+	if i < len(s) && s[i] == ',' {
+		max, i = number(i + 1)
+	}
+	if i >= len(s) || s[i] != '}' {
+		return 0, 0, 0, false
+	}
+	return i + 1, min, max, true
+}
+
+// scriptHexValue returns the value of hex digits, saturating past the
+// largest code point
+func scriptHexValue(digits string) rune {
+	value := rune(0)
+	for _, c := range digits {
+		if value <= unicode.MaxRune {
+			value = value*16 + rune(strings.IndexRune("0123456789abcdef", unicode.ToLower(c)))
+		}
+	}
+	return value
+}
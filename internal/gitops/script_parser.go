@@ -0,0 +1,1403 @@
+package gitops
+
+// scriptParser checks script code against the JavaScript grammar. It builds
+// no syntax tree: it keeps only what it needs to tell whether an expression
+// can be assigned to, or reread as arrow function parameters once "=>"
+// follows. Whether a "/" divides or starts a regular expression follows from
+// the grammar, so every token is read once.
+type scriptParser struct {
+	lex *scriptLexer
+	tok scriptToken
+	fn  *scriptFunctionContext
+
+	// arrowAt is where the current assignment expression starts: a name or
+	// "(" there may be the parameters of an arrow function
+	arrowAt int
+}
+
+// scriptFunctionContext is what the parser tracks per function body
+type scriptFunctionContext struct {
+	top              bool // the script itself, or a class static block or field
+	async, generator bool
+	strict           bool // "use strict", or in a class
+	loops, switches  int  // enclosing the current statement
+	labels           []scriptLabel
+
+	// pending are the indexes in labels of the labels of the statement
+	// being parsed
+	pending []int
+}
+
+// scriptLabel is a statement label in scope
+type scriptLabel struct {
+	name string
+	loop bool // labels a loop, so continue may name it
+}
+
+// scriptExprKind is what the parser needs to know about an expression
+type scriptExprKind int
+
+const (
+	scriptExprOther scriptExprKind = iota
+	scriptExprIdent
+	scriptExprMember    // a.b or a[b]
+	scriptExprArray     // items are the elements, nil for holes
+	scriptExprObject    // items are the properties
+	scriptExprProperty  // key: items[0]
+	scriptExprShorthand // {a}
+	scriptExprCoverInit // {a = 1}, only valid as a pattern
+	scriptExprMethod    // a method or accessor in an object literal
+	scriptExprSpread    // ...items[0]
+	scriptExprAssign    // items[0] = value, with items[0] a pattern
+	scriptExprArrow
+	scriptExprUnary
+	scriptExprBinary // op is the operator
+)
+
+// scriptExpr is a parsed expression
+type scriptExpr struct {
+	kind          scriptExprKind
+	at            scriptToken // first token
+	op            string
+	items         []*scriptExpr
+	parenthesized bool
+	trailingComma bool // a spread element followed by a comma
+	checked       bool // by checkExpr
+}
+
+// scriptReserved are the words that can't name a variable
+var scriptReserved = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true, "continue": true,
+	"debugger": true, "default": true, "delete": true, "do": true, "else": true, "enum": true,
+	"export": true, "extends": true, "false": true, "finally": true, "for": true, "function": true,
+	"if": true, "import": true, "in": true, "instanceof": true, "new": true, "null": true,
+	"return": true, "super": true, "switch": true, "this": true, "throw": true, "true": true,
+	"try": true, "typeof": true, "var": true, "void": true, "while": true, "with": true,
+}
+
+// scriptStrictReserved are the words that can't name a variable in strict
+// mode code
+var scriptStrictReserved = map[string]bool{
+	"implements": true, "interface": true, "let": true, "package": true, "private": true,
+	"protected": true, "public": true, "static": true, "yield": true,
+}
+
+// scriptBinaryPrecedence is how tightly each binary operator binds
+var scriptBinaryPrecedence = map[string]int{
+	"??": 1, "||": 2, "&&": 3, "|": 4, "^": 5, "&": 6,
+	"==": 7, "!=": 7, "===": 7, "!==": 7,
+	"<": 8, ">": 8, "<=": 8, ">=": 8, "instanceof": 8, "in": 8,
+	"<<": 9, ">>": 9, ">>>": 9,
+	"+": 10, "-": 10,
+	"*": 11, "/": 11, "%": 11,
+	"**": 12,
+}
+
+// scriptAssignOps are the compound assignment operators
+var scriptAssignOps = map[string]bool{
+	"+=": true, "-=": true, "*=": true, "/=": true, "%=": true, "**=": true,
+	"<<=": true, ">>=": true, ">>>=": true, "&=": true, "|=": true, "^=": true,
+	"&&=": true, "||=": true, "??=": true,
+}
+
+// parseScript parses the whole script
+func (p *scriptParser) parseScript() {
+	p.fn = &scriptFunctionContext{top: true}
+	p.next()
+	p.parseDirectives()
+	for p.tok.kind != scriptEOF {
+		p.parseStatement(true)
+	}
+}
+
+// parseDirectives parses the string statements starting the script or a
+// function body, and makes the code strict if one is "use strict"
+func (p *scriptParser) parseDirectives() {
+	for p.tok.kind == scriptString {
+		next := p.peek()
+		if !next.is(";") && !next.is("}") && next.kind != scriptEOF && !next.newlineBefore {
+			return
+		}
+		if text := p.tok.text; text[1:len(text)-1] == "use strict" {
+			p.fn.strict = true
+		}
+		p.parseStatement(true)
+	}
+}
+
+// nested returns the context of a function nested in the current one
+func (p *scriptParser) nested(async, generator bool) *scriptFunctionContext {
+	return &scriptFunctionContext{async: async, generator: generator, strict: p.fn.strict}
+}
+
+// next moves to the next token
+func (p *scriptParser) next() {
+	p.tok = p.lex.next()
+}
+
+// peek returns the token after the current one. It is only used where that
+// token can't start a regular expression.
+func (p *scriptParser) peek() scriptToken {
+	saved := *p.lex
+	tok := p.lex.next()
+	*p.lex = saved
+	return tok
+}
+
+// fail stops the check with a syntax error at tok
+func (p *scriptParser) fail(tok scriptToken, format string, args ...interface{}) {
+	failScript(tok.line, tok.col, format, args...)
+}
+
+// unexpected stops the check at the current token
+func (p *scriptParser) unexpected() {
+	p.fail(p.tok, "unexpected %s", p.tok)
+}
+
+// eat moves past the current token if it is the punctuator or keyword text
+func (p *scriptParser) eat(text string) bool {
+	if p.tok.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expect moves past the punctuator or keyword text, which must come next
+func (p *scriptParser) expect(text string) {
+	if !p.eat(text) {
+		p.fail(p.tok, "unexpected %s, expected '%s'", p.tok, text)
+	}
+}
+
+// expectClose moves past the bracket closing open
+func (p *scriptParser) expectClose(open scriptToken, close string) {
+	if p.eat(close) {
+		return
+	}
+	switch {
+	case p.tok.kind == scriptEOF:
+		p.fail(open, "unclosed '%s'", open.text)
+	case p.tok.is(")") || p.tok.is("]") || p.tok.is("}"):
+		p.fail(p.tok, "%s does not match '%s' at line %d, col %d", p.tok, open.text, open.line, open.col)
+	}
+	p.fail(p.tok, "unexpected %s, expected '%s'", p.tok, close)
+}
+
+// semicolon moves past the ";" ending a statement, or inserts it where a
+// line break, "}" or the end of the script allows
+func (p *scriptParser) semicolon() {
+	if !p.eat(";") && !p.tok.is("}") && p.tok.kind != scriptEOF && !p.tok.newlineBefore {
+		p.unexpected()
+	}
+}
+
+// reserved reports whether tok is a word that can't name a variable here
+func (p *scriptParser) reserved(tok scriptToken) bool {
+	if tok.kind != scriptName || tok.escaped {
+		return false
+	}
+	return scriptReserved[tok.text] || p.fn.strict && scriptStrictReserved[tok.text] ||
+		tok.text == "yield" && p.fn.generator || tok.text == "await" && p.fn.async
+}
+
+// startsLexical reports whether next, the token after "let", makes it a
+// declaration rather than a variable named let
+func startsLexical(next scriptToken) bool {
+	return next.kind == scriptName && !next.is("in") && !next.is("instanceof") || next.is("[") || next.is("{")
+}
+
+// parseStatement parses a statement. Declarations of let, const, classes
+// and async or generator functions are only allowed where declarations is
+// true, i.e. not as the body of if, a loop or a label.
+func (p *scriptParser) parseStatement(declarations bool) {
+	labels := p.fn.pending
+	p.fn.pending = nil
+	tok := p.tok
+
+	switch {
+	case tok.is("{"):
+		p.parseBlock()
+		return
+	case tok.is(";"):
+		p.next()
+		return
+	case tok.is("var"), tok.is("const"), tok.is("let") && startsLexical(p.peek()):
+		if !declarations && !tok.is("var") {
+			p.unexpected()
+		}
+		p.next()
+		if _, _, missing := p.parseDeclarations(tok, false); missing != nil {
+			p.fail(*missing, "missing initializer")
+		}
+		p.semicolon()
+		return
+	case tok.is("function"):
+		p.next()
+		if !declarations && p.tok.is("*") {
+			p.unexpected()
+		}
+		p.parseFunction(false, true)
+		return
+	case tok.is("async"):
+		if next := p.peek(); next.is("function") && !next.newlineBefore {
+			if !declarations {
+				p.unexpected()
+			}
+			p.next()
+			p.next()
+			p.parseFunction(true, true)
+			return
+		}
+	case tok.is("class"):
+		if !declarations {
+			p.unexpected()
+		}
+		p.next()
+		p.parseClass(true)
+		return
+	case tok.is("if"):
+		p.next()
+		p.parseCondition()
+		p.parseStatement(false)
+		if p.eat("else") {
+			p.parseStatement(false)
+		}
+		return
+	case tok.is("for"):
+		p.parseFor(labels)
+		return
+	case tok.is("while"):
+		p.markLoop(labels)
+		p.next()
+		p.parseCondition()
+		p.parseLoopBody()
+		return
+	case tok.is("do"):
+		p.markLoop(labels)
+		p.next()
+		p.parseLoopBody()
+		p.expect("while")
+		p.parseCondition()
+		p.eat(";") // inserted even without a line break
+		return
+	case tok.is("continue"), tok.is("break"):
+		p.parseJump()
+		return
+	case tok.is("return"):
+		if p.fn.top {
+			p.fail(tok, "return outside a function")
+		}
+		p.next()
+		if !p.tok.is(";") && !p.tok.is("}") && p.tok.kind != scriptEOF && !p.tok.newlineBefore {
+			p.parseExpression(false, false)
+		}
+		p.semicolon()
+		return
+	case tok.is("throw"):
+		p.next()
+		if p.tok.newlineBefore {
+			p.fail(tok, "line break after throw")
+		}
+		p.parseExpression(false, false)
+		p.semicolon()
+		return
+	case tok.is("try"):
+		p.parseTry()
+		return
+	case tok.is("switch"):
+		p.parseSwitch()
+		return
+	case tok.is("with"):
+		if p.fn.strict {
+			p.fail(tok, "with in strict mode")
+		}
+		p.next()
+		p.parseCondition()
+		p.parseStatement(false)
+		return
+	case tok.is("debugger"):
+		p.next()
+		p.semicolon()
+		return
+	case tok.is("let") && !declarations && p.peek().is("["):
+		p.unexpected()
+	case tok.kind == scriptName && !p.reserved(tok) && p.peek().is(":"):
+		p.next()
+		p.next()
+		p.parseLabeled(tok, labels)
+		return
+	}
+
+	p.parseExpression(false, false)
+	p.semicolon()
+}
+
+// parseBlock parses statements in braces
+func (p *scriptParser) parseBlock() {
+	open := p.tok
+	p.expect("{")
+	for !p.tok.is("}") && p.tok.kind != scriptEOF {
+		p.parseStatement(true)
+	}
+	p.expectClose(open, "}")
+}
+
+// parseCondition parses the parenthesized expression of if, while, with and
+// switch
+func (p *scriptParser) parseCondition() {
+	open := p.tok
+	p.expect("(")
+	p.parseExpression(false, false)
+	p.expectClose(open, ")")
+}
+
+// parseDeclarations parses the declarators of a var, let or const
+// declaration after the keyword. It returns how many there are, whether any
+// has an initializer, and the first one missing a required initializer,
+// which only the head of a for-in or for-of loop may leave out.
+func (p *scriptParser) parseDeclarations(keyword scriptToken, noIn bool) (count int, initialized bool, missing *scriptToken) {
+	for {
+		target := p.tok
+		pattern := p.tok.is("[") || p.tok.is("{")
+		p.parseBindingTarget()
+		count++
+		if p.eat("=") {
+			p.parseAssignment(noIn, false)
+			initialized = true
+		} else if missing == nil && (pattern || keyword.is("const")) {
+			missing = &target
+		}
+		if !p.eat(",") {
+			return count, initialized, missing
+		}
+	}
+}
+
+// markLoop marks the labels of a loop statement as loop labels
+func (p *scriptParser) markLoop(labels []int) {
+	for _, i := range labels {
+		p.fn.labels[i].loop = true
+	}
+}
+
+// parseLoopBody parses the statement a loop repeats
+func (p *scriptParser) parseLoopBody() {
+	p.fn.loops++
+	p.parseStatement(false)
+	p.fn.loops--
+}
+
+// parseFor parses the three kinds of for loop
+func (p *scriptParser) parseFor(labels []int) {
+	p.markLoop(labels)
+	p.next()
+	await := p.fn.async && p.eat("await")
+	open := p.tok
+	p.expect("(")
+
+	switch {
+	case p.tok.is(";"):
+	case p.tok.is("var"), p.tok.is("const"), p.tok.is("let") && startsLexical(p.peek()):
+		keyword := p.tok
+		p.next()
+		count, initialized, missing := p.parseDeclarations(keyword, true)
+		if p.tok.is("of") || p.tok.is("in") {
+			if count != 1 || initialized {
+				p.fail(keyword, "invalid declaration in for-%s loop", p.tok.text)
+			}
+			p.parseForInOf(open, await)
+			return
+		}
+		if missing != nil {
+			p.fail(*missing, "missing initializer")
+		}
+	default:
+		init := p.parseExpression(true, true)
+		if p.tok.is("of") || p.tok.is("in") {
+			p.toPattern(init, false)
+			p.parseForInOf(open, await)
+			return
+		}
+		p.checkExpr(init)
+	}
+
+	if await {
+		p.fail(open, "for await needs an of loop")
+	}
+	p.expect(";")
+	if !p.tok.is(";") {
+		p.parseExpression(false, false)
+	}
+	p.expect(";")
+	if !p.tok.is(")") {
+		p.parseExpression(false, false)
+	}
+	p.expectClose(open, ")")
+	p.parseLoopBody()
+}
+
+// parseForInOf parses a for-in or for-of loop from its "in" or "of"
+func (p *scriptParser) parseForInOf(open scriptToken, await bool) {
+	if p.eat("of") {
+		p.parseAssignment(false, false)
+	} else {
+		if await {
+			p.fail(open, "for await needs an of loop")
+		}
+		p.next()
+		p.parseExpression(false, false)
+	}
+	p.expectClose(open, ")")
+	p.parseLoopBody()
+}
+
+// parseJump parses break or continue, with an optional label
+func (p *scriptParser) parseJump() {
+	tok := p.tok
+	p.next()
+	if label := p.tok; label.kind == scriptName && !label.newlineBefore && !p.reserved(label) {
+		found := false
+		for _, l := range p.fn.labels {
+			if l.name == label.text {
+				found = true
+				if tok.is("continue") && !l.loop {
+					p.fail(label, "continue to label '%s', which is not a loop", label.text)
+				}
+			}
+		}
+		if !found {
+			p.fail(label, "undefined label '%s'", label.text)
+		}
+		p.next()
+	} else if tok.is("continue") && p.fn.loops == 0 {
+		p.fail(tok, "continue outside a loop")
+	} else if p.fn.loops == 0 && p.fn.switches == 0 {
+		p.fail(tok, "break outside a loop or switch")
+	}
+	p.semicolon()
+}
+
+// parseLabeled parses a labeled statement after "label:"
+func (p *scriptParser) parseLabeled(label scriptToken, labels []int) {
+	for _, l := range p.fn.labels {
+		if l.name == label.text {
+			p.fail(label, "label '%s' already declared", label.text)
+		}
+	}
+	p.fn.labels = append(p.fn.labels, scriptLabel{name: label.text})
+	p.fn.pending = append(labels, len(p.fn.labels)-1)
+	p.parseStatement(false)
+	p.fn.labels = p.fn.labels[:len(p.fn.labels)-1]
+}
+
+// parseTry parses try with catch, finally or both
+func (p *scriptParser) parseTry() {
+	p.next()
+	p.parseBlock()
+	handled := false
+	if p.eat("catch") {
+		if open := p.tok; p.eat("(") {
+			p.parseBindingTarget()
+			p.expectClose(open, ")")
+		}
+		p.parseBlock()
+		handled = true
+	}
+	if p.eat("finally") {
+		p.parseBlock()
+		handled = true
+	}
+	if !handled {
+		p.fail(p.tok, "unexpected %s, expected 'catch' or 'finally'", p.tok)
+	}
+}
+
+// parseSwitch parses a switch statement
+func (p *scriptParser) parseSwitch() {
+	p.next()
+	p.parseCondition()
+	open := p.tok
+	p.expect("{")
+	p.fn.switches++
+	hasDefault := false
+	for !p.tok.is("}") && p.tok.kind != scriptEOF {
+		switch tok := p.tok; {
+		case p.eat("case"):
+			p.parseExpression(false, false)
+		case p.eat("default"):
+			if hasDefault {
+				p.fail(tok, "more than one default in switch")
+			}
+			hasDefault = true
+		default:
+			p.unexpected()
+		}
+		p.expect(":")
+		for !p.tok.is("case") && !p.tok.is("default") && !p.tok.is("}") && p.tok.kind != scriptEOF {
+			p.parseStatement(true)
+		}
+	}
+	p.expectClose(open, "}")
+	p.fn.switches--
+}
+
+// parseBindingTarget parses a declared name or destructuring pattern
+func (p *scriptParser) parseBindingTarget() {
+	switch open := p.tok; {
+	case p.eat("["):
+		for !p.tok.is("]") && p.tok.kind != scriptEOF {
+			if p.eat(",") {
+				continue
+			}
+			if p.eat("...") {
+				p.parseBindingTarget()
+				break
+			}
+			p.parseBindingElement()
+			if !p.eat(",") {
+				break
+			}
+		}
+		p.expectClose(open, "]")
+	case p.eat("{"):
+		for !p.tok.is("}") && p.tok.kind != scriptEOF {
+			if p.eat("...") {
+				p.parseBindingIdentifier()
+				break
+			}
+			key := p.tok
+			p.parsePropertyKey(false)
+			if p.eat(":") {
+				p.parseBindingElement()
+			} else {
+				if key.kind != scriptName {
+					p.fail(p.tok, "unexpected %s, expected ':'", p.tok)
+				}
+				p.checkBindingIdentifier(key)
+				if p.eat("=") {
+					p.parseAssignment(false, false)
+				}
+			}
+			if !p.eat(",") {
+				break
+			}
+		}
+		p.expectClose(open, "}")
+	default:
+		p.parseBindingIdentifier()
+	}
+}
+
+// parseBindingElement parses a binding target with an optional default
+func (p *scriptParser) parseBindingElement() {
+	p.parseBindingTarget()
+	if p.eat("=") {
+		p.parseAssignment(false, false)
+	}
+}
+
+// parseBindingIdentifier parses a declared name
+func (p *scriptParser) parseBindingIdentifier() {
+	p.checkBindingIdentifier(p.tok)
+	p.next()
+}
+
+// checkBindingIdentifier checks that tok can name a variable
+func (p *scriptParser) checkBindingIdentifier(tok scriptToken) {
+	if tok.kind != scriptName || p.reserved(tok) {
+		p.fail(tok, "unexpected %s", tok)
+	}
+}
+
+// parseFunction parses a function after the "function" keyword. A
+// declaration must have a name.
+func (p *scriptParser) parseFunction(async, declaration bool) {
+	generator := p.eat("*")
+	if declaration || !p.tok.is("(") {
+		p.parseBindingIdentifier()
+	}
+	p.parseFunctionRest(p.nested(async, generator))
+}
+
+// parseFunctionRest parses the parameters and body of a function in the
+// context fn, and returns the number of parameters before any rest parameter
+func (p *scriptParser) parseFunctionRest(fn *scriptFunctionContext) (params int, rest bool) {
+	outer := p.fn
+	p.fn = fn
+	open := p.tok
+	p.expect("(")
+	for !p.tok.is(")") && p.tok.kind != scriptEOF {
+		if p.eat("...") {
+			p.parseBindingTarget()
+			rest = true
+			break
+		}
+		p.parseBindingElement()
+		params++
+		if !p.eat(",") {
+			break
+		}
+	}
+	p.expectClose(open, ")")
+	p.parseFunctionBody()
+	p.fn = outer
+	return params, rest
+}
+
+// parseFunctionBody parses the statements of a function in braces
+func (p *scriptParser) parseFunctionBody() {
+	open := p.tok
+	p.expect("{")
+	p.parseDirectives()
+	for !p.tok.is("}") && p.tok.kind != scriptEOF {
+		p.parseStatement(true)
+	}
+	p.expectClose(open, "}")
+}
+
+// parseClass parses a class after the "class" keyword. A declaration must
+// have a name.
+func (p *scriptParser) parseClass(declaration bool) {
+	// Classes are strict mode code
+	strict := p.fn.strict
+	p.fn.strict = true
+	defer func() { p.fn.strict = strict }()
+
+	if declaration || !p.tok.is("extends") && !p.tok.is("{") {
+		p.parseBindingIdentifier()
+	}
+	if p.eat("extends") {
+		p.parseLeftHandSide()
+	}
+	open := p.tok
+	p.expect("{")
+	for !p.tok.is("}") && p.tok.kind != scriptEOF {
+		if !p.eat(";") {
+			p.parseClassMember()
+		}
+	}
+	p.expectClose(open, "}")
+}
+
+// parseClassMember parses a method, accessor, field or static block
+func (p *scriptParser) parseClassMember() {
+	if p.tok.is("static") {
+		switch next := p.peek(); {
+		case next.is("{"):
+			p.next()
+			p.parseInitializer(p.parseBlock)
+			return
+		case !next.is("(") && !next.is("=") && !next.is(";") && !next.is("}"):
+			p.next()
+		}
+	}
+	if _, method := p.parseMethodOrKey(true); method {
+		return
+	}
+	if p.eat("=") {
+		p.parseInitializer(func() { p.parseAssignment(false, false) })
+	}
+	p.semicolon()
+}
+
+// parseInitializer runs parse for a class field initializer or static
+// block, which are function bodies of their own but can't return
+func (p *scriptParser) parseInitializer(parse func()) {
+	outer := p.fn
+	p.fn = p.nested(false, false)
+	p.fn.top = true
+	parse()
+	p.fn = outer
+}
+
+// parseMethodOrKey parses the start of an object literal property or class
+// member: modifiers (get, set, async, *) and the key, and for a method the
+// parameters and body. It returns the key's first token and whether it
+// parsed a method; otherwise the caller parses what follows the key.
+func (p *scriptParser) parseMethodOrKey(inClass bool) (scriptToken, bool) {
+	async, generator, accessor := false, false, ""
+	if p.tok.is("get") || p.tok.is("set") || p.tok.is("async") {
+		next := p.peek()
+		isKey := next.is("(") || next.is(":") || next.is(",") || next.is("}") || next.is("=") || next.is(";")
+		if !isKey && !(p.tok.is("async") && next.newlineBefore) {
+			if p.tok.is("async") {
+				async = true
+			} else {
+				accessor = p.tok.text
+			}
+			p.next()
+		}
+	}
+	if accessor == "" {
+		generator = p.eat("*")
+	}
+
+	key := p.tok
+	p.parsePropertyKey(inClass)
+	if !p.tok.is("(") {
+		if async || generator || accessor != "" {
+			p.fail(p.tok, "unexpected %s, expected '('", p.tok)
+		}
+		return key, false
+	}
+	params, rest := p.parseFunctionRest(p.nested(async, generator))
+	if accessor == "get" && (params > 0 || rest) {
+		p.fail(key, "getter must not have parameters")
+	}
+	if accessor == "set" && (params != 1 || rest) {
+		p.fail(key, "setter must have exactly one parameter")
+	}
+	return key, true
+}
+
+// parsePropertyKey parses the key of a property, method or class member,
+// which in a class may be private
+func (p *scriptParser) parsePropertyKey(private bool) {
+	switch open := p.tok; {
+	case p.tok.kind == scriptName, p.tok.kind == scriptString, p.tok.kind == scriptNumber, private && p.tok.kind == scriptPrivateName:
+		p.next()
+	case p.eat("["):
+		p.parseAssignment(false, false)
+		p.expectClose(open, "]")
+	default:
+		p.unexpected()
+	}
+}
+
+// parseExpression parses an expression, including comma sequences. In the
+// head of a for loop (noIn), "in" is not an operator. With cover, a single
+// expression is returned unchecked, for the caller to read as a pattern.
+func (p *scriptParser) parseExpression(noIn, cover bool) *scriptExpr {
+	expr := p.parseAssignment(noIn, cover)
+	if !p.tok.is(",") {
+		return expr
+	}
+	p.checkExpr(expr)
+	for p.eat(",") {
+		p.parseAssignment(noIn, false)
+	}
+	return &scriptExpr{at: expr.at}
+}
+
+// parseAssignment parses an assignment expression, including arrow
+// functions and yield. With cover, the result is left unchecked for the
+// caller to read as a pattern.
+func (p *scriptParser) parseAssignment(noIn, cover bool) *scriptExpr {
+	if p.tok.is("yield") && p.fn.generator {
+		return p.parseYield(noIn)
+	}
+	p.arrowAt = p.tok.start
+	left := p.parseConditional(noIn)
+	if left.kind == scriptExprArrow {
+		return left
+	}
+
+	switch op := p.tok; {
+	case op.is("="):
+		p.toPattern(left, false)
+		p.next()
+		p.parseAssignment(noIn, false)
+		return &scriptExpr{kind: scriptExprAssign, at: left.at, items: []*scriptExpr{left}}
+	case op.kind == scriptPunct && scriptAssignOps[op.text]:
+		if !simpleScriptTarget(left) {
+			p.fail(left.at, "invalid assignment target")
+		}
+		p.next()
+		p.parseAssignment(noIn, false)
+		return &scriptExpr{at: left.at}
+	}
+	if !cover {
+		p.checkExpr(left)
+	}
+	return left
+}
+
+// parseYield parses a yield expression in a generator
+func (p *scriptParser) parseYield(noIn bool) *scriptExpr {
+	tok := p.tok
+	p.next()
+	if !p.tok.newlineBefore && (p.eat("*") || p.startsExpression()) {
+		p.parseAssignment(noIn, false)
+	}
+	return &scriptExpr{at: tok}
+}
+
+// startsExpression reports whether the current token can start an
+// expression, which makes it the operand of yield
+func (p *scriptParser) startsExpression() bool {
+	switch tok := p.tok; tok.kind {
+	case scriptEOF:
+		return false
+	case scriptPunct:
+		switch tok.text {
+		case "(", "[", "{", "+", "-", "!", "~", "++", "--", "/", "/=":
+			return true
+		}
+		return false
+	case scriptName:
+		return !tok.is("in") && !tok.is("of") && !tok.is("instanceof")
+	}
+	return true
+}
+
+// parseConditional parses a conditional expression
+func (p *scriptParser) parseConditional(noIn bool) *scriptExpr {
+	test := p.parseBinary(noIn, 0)
+	if test.kind == scriptExprArrow || !p.tok.is("?") {
+		return test
+	}
+	p.checkExpr(test)
+	p.next()
+	p.parseAssignment(false, false)
+	p.expect(":")
+	p.parseAssignment(noIn, false)
+	return &scriptExpr{at: test.at}
+}
+
+// parseBinary parses binary operations with operators that bind tighter
+// than minPrecedence
+func (p *scriptParser) parseBinary(noIn bool, minPrecedence int) *scriptExpr {
+	var left *scriptExpr
+	if tok := p.tok; tok.kind == scriptPrivateName {
+		// A private name only stands alone in "#name in object"
+		p.next()
+		if !p.tok.is("in") || noIn || scriptBinaryPrecedence["in"] <= minPrecedence {
+			p.fail(tok, "unexpected %s", tok)
+		}
+		left = &scriptExpr{at: tok}
+	} else {
+		left = p.parseUnary()
+	}
+	for left.kind != scriptExprArrow {
+		op := p.tok
+		precedence := 0
+		if op.kind == scriptPunct || op.is("instanceof") || op.is("in") && !noIn {
+			precedence = scriptBinaryPrecedence[op.text]
+		}
+		if precedence <= minPrecedence {
+			break
+		}
+		if op.text == "**" && left.kind == scriptExprUnary && !left.parenthesized {
+			p.fail(op, "unary operator before '**' needs parentheses")
+		}
+		p.checkExpr(left)
+		p.next()
+		if op.text == "**" {
+			precedence-- // right-associative
+		}
+		right := p.parseBinary(noIn, precedence)
+		p.checkExpr(right)
+		if mixesCoalesce(op.text, left) || mixesCoalesce(op.text, right) {
+			p.fail(op, "'??' and '||' or '&&' need parentheses when mixed")
+		}
+		left = &scriptExpr{kind: scriptExprBinary, at: left.at, op: op.text}
+	}
+	return left
+}
+
+// mixesCoalesce reports whether op applied to operand mixes "??" with "||"
+// or "&&", which needs parentheses
+func mixesCoalesce(op string, operand *scriptExpr) bool {
+	if operand.kind != scriptExprBinary || operand.parenthesized {
+		return false
+	}
+	if op == "??" {
+		return operand.op == "||" || operand.op == "&&"
+	}
+	return (op == "||" || op == "&&") && operand.op == "??"
+}
+
+// parseUnary parses unary operators and prefix increments
+func (p *scriptParser) parseUnary() *scriptExpr {
+	tok := p.tok
+	switch {
+	case tok.is("++"), tok.is("--"):
+		p.next()
+		if operand := p.parseUnary(); !simpleScriptTarget(operand) {
+			p.fail(operand.at, "invalid assignment target")
+		}
+		return &scriptExpr{at: tok}
+	case tok.is("!"), tok.is("~"), tok.is("+"), tok.is("-"), tok.is("typeof"), tok.is("void"), tok.is("delete"),
+		tok.is("await") && p.fn.async:
+		p.next()
+		operand := p.parseUnary()
+		p.checkExpr(operand)
+		if tok.is("delete") && p.fn.strict && operand.kind == scriptExprIdent {
+			p.fail(tok, "delete of a variable in strict mode")
+		}
+		return &scriptExpr{kind: scriptExprUnary, at: tok}
+	}
+	return p.parsePostfix()
+}
+
+// parsePostfix parses postfix increments
+func (p *scriptParser) parsePostfix() *scriptExpr {
+	expr := p.parseLeftHandSide()
+	if (p.tok.is("++") || p.tok.is("--")) && !p.tok.newlineBefore && expr.kind != scriptExprArrow {
+		if !simpleScriptTarget(expr) {
+			p.fail(expr.at, "invalid assignment target")
+		}
+		p.next()
+		return &scriptExpr{at: expr.at}
+	}
+	return expr
+}
+
+// parseLeftHandSide parses a member, call or new expression
+func (p *scriptParser) parseLeftHandSide() *scriptExpr {
+	if p.tok.is("new") {
+		return p.parseSubscripts(p.parseNew(), false)
+	}
+	return p.parseSubscripts(p.parsePrimary(), false)
+}
+
+// parseNew parses new, with its callee and arguments, or new.target
+func (p *scriptParser) parseNew() *scriptExpr {
+	tok := p.tok
+	p.next()
+	if p.eat(".") {
+		if !p.tok.is("target") {
+			p.unexpected()
+		}
+		p.next()
+		return &scriptExpr{at: tok}
+	}
+	var callee *scriptExpr
+	if p.tok.is("new") {
+		callee = p.parseNew()
+	} else {
+		callee = p.parsePrimary()
+	}
+	p.parseSubscripts(callee, true)
+	if p.tok.is("?.") {
+		p.fail(p.tok, "optional chain in the callee of new")
+	}
+	if p.tok.is("(") {
+		p.parseArguments()
+	}
+	return &scriptExpr{at: tok}
+}
+
+// parseSubscripts parses the property accesses, calls and tagged templates
+// following expr. For the callee of new (noCalls), it stops at a call.
+func (p *scriptParser) parseSubscripts(expr *scriptExpr, noCalls bool) *scriptExpr {
+	if expr.kind == scriptExprArrow {
+		return expr
+	}
+	chain := false // in an optional chain, whose members can't be assigned to
+	for {
+		tok := p.tok
+		kind := scriptExprOther
+		switch {
+		case p.eat("."):
+			p.parseMemberName()
+			kind = scriptExprMember
+		case tok.is("?.") && !noCalls:
+			p.next()
+			chain = true
+			switch {
+			case p.tok.is("("):
+				p.parseArguments()
+			case p.tok.is("["):
+				p.parseIndex()
+			default:
+				p.parseMemberName()
+			}
+		case tok.is("["):
+			p.parseIndex()
+			kind = scriptExprMember
+		case tok.is("(") && !noCalls:
+			p.parseArguments()
+		case tok.kind == scriptTemplate:
+			if chain {
+				p.fail(tok, "tagged template in an optional chain")
+			}
+			p.parseTemplate()
+		default:
+			if chain {
+				expr.kind = scriptExprOther
+			}
+			return expr
+		}
+		p.checkExpr(expr)
+		expr = &scriptExpr{kind: kind, at: expr.at}
+	}
+}
+
+// parseMemberName parses the name after "." or "?."
+func (p *scriptParser) parseMemberName() {
+	if p.tok.kind != scriptName && p.tok.kind != scriptPrivateName {
+		p.unexpected()
+	}
+	p.next()
+}
+
+// parseIndex parses a computed member access, "[expr]"
+func (p *scriptParser) parseIndex() {
+	open := p.tok
+	p.next()
+	p.parseExpression(false, false)
+	p.expectClose(open, "]")
+}
+
+// parseArguments parses the arguments of a call
+func (p *scriptParser) parseArguments() {
+	open := p.tok
+	p.next()
+	for !p.tok.is(")") && p.tok.kind != scriptEOF {
+		p.eat("...")
+		p.parseAssignment(false, false)
+		if !p.eat(",") {
+			break
+		}
+	}
+	p.expectClose(open, ")")
+}
+
+// parsePrimary parses literals, names, parenthesized expressions, and
+// function and class expressions
+func (p *scriptParser) parsePrimary() *scriptExpr {
+	tok := p.tok
+	canBeArrow := tok.start == p.arrowAt
+	switch {
+	case tok.kind == scriptNumber, tok.kind == scriptString:
+		if tok.legacyOctal && p.fn.strict {
+			p.fail(tok, "octal %s in strict mode", tok)
+		}
+		p.next()
+		return &scriptExpr{at: tok}
+	case tok.kind == scriptTemplate:
+		p.parseTemplate()
+		return &scriptExpr{at: tok}
+	case tok.is("/"), tok.is("/="):
+		p.tok = p.lex.rescanRegex(tok)
+		p.next()
+		return &scriptExpr{at: tok}
+	case tok.is("("):
+		return p.parseParenthesized(canBeArrow)
+	case tok.is("["):
+		return p.parseArray()
+	case tok.is("{"):
+		return p.parseObject()
+	case tok.is("this"), tok.is("null"), tok.is("true"), tok.is("false"), tok.is("super"):
+		p.next()
+		return &scriptExpr{at: tok}
+	case tok.is("function"):
+		p.next()
+		p.parseFunction(false, false)
+		return &scriptExpr{at: tok}
+	case tok.is("class"):
+		p.next()
+		p.parseClass(false)
+		return &scriptExpr{at: tok}
+	case tok.is("import"):
+		// Scripts aren't modules, so only import() is allowed
+		p.next()
+		if !p.tok.is("(") {
+			p.unexpected()
+		}
+		return &scriptExpr{at: tok}
+	case tok.is("async"):
+		if expr := p.parseAsync(canBeArrow); expr != nil {
+			return expr
+		}
+	}
+
+	if tok.kind != scriptName || p.reserved(tok) {
+		p.unexpected()
+	}
+	p.next()
+	if canBeArrow && p.tok.is("=>") && !p.tok.newlineBefore {
+		return p.parseArrowBody(tok, false)
+	}
+	return &scriptExpr{kind: scriptExprIdent, at: tok}
+}
+
+// parseAsync parses what starts with "async" if it is an async function or
+// arrow function, or a call of a function named async, and returns nil if
+// async is just a name
+func (p *scriptParser) parseAsync(canBeArrow bool) *scriptExpr {
+	tok := p.tok
+	next := p.peek()
+	if next.newlineBefore {
+		return nil
+	}
+	switch {
+	case next.is("function"):
+		p.next()
+		p.next()
+		p.parseFunction(true, false)
+		return &scriptExpr{at: tok}
+	case canBeArrow && next.kind == scriptName && !scriptReserved[next.text]:
+		p.next()
+		p.parseBindingIdentifier()
+		if !p.tok.is("=>") || p.tok.newlineBefore {
+			p.fail(p.tok, "unexpected %s, expected '=>'", p.tok)
+		}
+		return p.parseArrowBody(tok, true)
+	case canBeArrow && next.is("("):
+		p.next()
+		items := p.parseCoverList()
+		if p.tok.is("=>") && !p.tok.newlineBefore {
+			p.toParams(items)
+			return p.parseArrowBody(tok, true)
+		}
+		for _, item := range items {
+			p.checkExpr(item)
+		}
+		return &scriptExpr{at: tok}
+	}
+	return nil
+}
+
+// parseArrowBody parses an arrow function from its "=>"
+func (p *scriptParser) parseArrowBody(at scriptToken, async bool) *scriptExpr {
+	p.next()
+	outer := p.fn
+	p.fn = p.nested(async, false)
+	if p.tok.is("{") {
+		p.parseFunctionBody()
+	} else {
+		p.parseAssignment(false, false)
+	}
+	p.fn = outer
+	return &scriptExpr{kind: scriptExprArrow, at: at}
+}
+
+// parseParenthesized parses a parenthesized expression, or the parameters
+// of an arrow function if canBeArrow and "=>" follows
+func (p *scriptParser) parseParenthesized(canBeArrow bool) *scriptExpr {
+	open := p.tok
+	items := p.parseCoverList()
+	if canBeArrow && p.tok.is("=>") && !p.tok.newlineBefore {
+		p.toParams(items)
+		return p.parseArrowBody(open, false)
+	}
+
+	if len(items) == 0 {
+		p.fail(open, "empty parentheses")
+	}
+	for _, item := range items {
+		if item.kind == scriptExprSpread {
+			p.fail(item.at, "unexpected '...'")
+		}
+		p.checkExpr(item)
+	}
+	if last := items[len(items)-1]; last.trailingComma {
+		p.fail(open, "trailing comma in parentheses")
+	}
+	if len(items) > 1 {
+		return &scriptExpr{at: open}
+	}
+	expr := items[0]
+	if expr.kind == scriptExprArrow {
+		expr.kind = scriptExprOther
+	}
+	expr.parenthesized = true
+	return expr
+}
+
+// parseCoverList parses the expressions in parentheses that are either
+// arrow function parameters, arguments of a call of async, or a
+// parenthesized expression. A trailing comma is recorded on the last item.
+func (p *scriptParser) parseCoverList() []*scriptExpr {
+	open := p.tok
+	p.expect("(")
+	var items []*scriptExpr
+	for !p.tok.is(")") && p.tok.kind != scriptEOF {
+		var item *scriptExpr
+		if spread := p.tok; p.eat("...") {
+			item = &scriptExpr{kind: scriptExprSpread, at: spread, items: []*scriptExpr{p.parseAssignment(false, true)}}
+		} else {
+			item = p.parseAssignment(false, true)
+		}
+		items = append(items, item)
+		if !p.eat(",") {
+			break
+		}
+		item.trailingComma = true
+	}
+	p.expectClose(open, ")")
+	// Only a comma after the last item is trailing
+	for _, item := range items[:max(len(items)-1, 0)] {
+		item.trailingComma = false
+	}
+	return items
+}
+
+// toParams checks expressions parsed by parseCoverList as arrow function
+// parameters
+func (p *scriptParser) toParams(items []*scriptExpr) {
+	for i, item := range items {
+		if item.kind == scriptExprSpread {
+			if i != len(items)-1 || item.trailingComma {
+				p.fail(item.at, "rest parameter must be last")
+			}
+			p.toPattern(item.items[0], true)
+			continue
+		}
+		p.toPatternElement(item, true)
+	}
+}
+
+// parseArray parses an array literal
+func (p *scriptParser) parseArray() *scriptExpr {
+	open := p.tok
+	expr := &scriptExpr{kind: scriptExprArray, at: open}
+	p.next()
+	for !p.tok.is("]") && p.tok.kind != scriptEOF {
+		if p.eat(",") {
+			expr.items = append(expr.items, nil)
+			continue
+		}
+		var item *scriptExpr
+		if spread := p.tok; p.eat("...") {
+			item = &scriptExpr{kind: scriptExprSpread, at: spread, items: []*scriptExpr{p.parseAssignment(false, true)}}
+		} else {
+			item = p.parseAssignment(false, true)
+		}
+		expr.items = append(expr.items, item)
+		if p.tok.is("]") {
+			break
+		}
+		if !p.tok.is(",") {
+			p.expectClose(open, "]")
+		}
+		p.next()
+		item.trailingComma = true
+	}
+	p.expectClose(open, "]")
+	return expr
+}
+
+// parseObject parses an object literal
+func (p *scriptParser) parseObject() *scriptExpr {
+	open := p.tok
+	expr := &scriptExpr{kind: scriptExprObject, at: open}
+	p.next()
+	for !p.tok.is("}") && p.tok.kind != scriptEOF {
+		item := p.parseProperty()
+		expr.items = append(expr.items, item)
+		if p.tok.is("}") {
+			break
+		}
+		if !p.tok.is(",") {
+			p.expectClose(open, "}")
+		}
+		p.next()
+		item.trailingComma = true
+	}
+	p.expectClose(open, "}")
+	return expr
+}
+
+// parseProperty parses a property of an object literal
+func (p *scriptParser) parseProperty() *scriptExpr {
+	if spread := p.tok; p.eat("...") {
+		return &scriptExpr{kind: scriptExprSpread, at: spread, items: []*scriptExpr{p.parseAssignment(false, true)}}
+	}
+	key, method := p.parseMethodOrKey(false)
+	switch {
+	case method:
+		return &scriptExpr{kind: scriptExprMethod, at: key}
+	case p.eat(":"):
+		return &scriptExpr{kind: scriptExprProperty, at: key, items: []*scriptExpr{p.parseAssignment(false, true)}}
+	case key.kind != scriptName:
+		p.fail(p.tok, "unexpected %s, expected ':'", p.tok)
+	case p.reserved(key):
+		p.fail(key, "unexpected %s", key)
+	case p.eat("="):
+		p.parseAssignment(false, false)
+		return &scriptExpr{kind: scriptExprCoverInit, at: key}
+	}
+	return &scriptExpr{kind: scriptExprShorthand, at: key}
+}
+
+// parseTemplate parses a template literal from its first part
+func (p *scriptParser) parseTemplate() {
+	for !p.tok.tail {
+		part := p.tok
+		p.next()
+		p.parseExpression(false, false)
+		if !p.tok.is("}") {
+			if p.tok.kind == scriptEOF {
+				failScript(part.endLine, part.endCol-2, "unclosed \"${\" in template literal")
+			}
+			p.fail(p.tok, "unexpected %s, expected '}'", p.tok)
+		}
+		p.tok = p.lex.rescanTemplate(p.tok)
+	}
+	p.next()
+}
+
+// simpleScriptTarget reports whether expr can be assigned to with a
+// compound assignment or incremented
+func simpleScriptTarget(expr *scriptExpr) bool {
+	return expr.kind == scriptExprIdent || expr.kind == scriptExprMember
+}
+
+// toPattern checks that expr, parsed before "=" or in the head of a for-in
+// or for-of loop, can be read as what it assigns to: a name, a member
+// (unless binding, for arrow function parameters) or a destructuring pattern
+func (p *scriptParser) toPattern(expr *scriptExpr, binding bool) {
+	switch expr.kind {
+	case scriptExprIdent:
+		if !binding || !expr.parenthesized {
+			return
+		}
+	case scriptExprMember:
+		if !binding {
+			return
+		}
+	case scriptExprArray, scriptExprObject:
+		if expr.parenthesized {
+			break
+		}
+		for i, item := range expr.items {
+			switch {
+			case item == nil, item.kind == scriptExprShorthand, item.kind == scriptExprCoverInit:
+			case item.kind == scriptExprSpread:
+				if i != len(expr.items)-1 || item.trailingComma {
+					p.fail(item.at, "rest element must be last")
+				}
+				p.toPattern(item.items[0], binding)
+			case item.kind == scriptExprProperty:
+				p.toPatternElement(item.items[0], binding)
+			case item.kind == scriptExprMethod:
+				p.fail(item.at, "invalid destructuring target")
+			default:
+				p.toPatternElement(item, binding)
+			}
+		}
+		return
+	}
+	p.fail(expr.at, "invalid assignment target")
+}
+
+// toPatternElement checks an element of a pattern, which may have a default
+func (p *scriptParser) toPatternElement(expr *scriptExpr, binding bool) {
+	if expr.kind == scriptExprAssign {
+		expr = expr.items[0]
+	}
+	p.toPattern(expr, binding)
+}
+
+// checkExpr reports a shorthand property with an initializer, "{a = 1}", in
+// an expression that turned out not to be a pattern
+func (p *scriptParser) checkExpr(expr *scriptExpr) {
+	if expr.checked {
+		return
+	}
+	expr.checked = true
+	switch expr.kind {
+	case scriptExprCoverInit:
+		p.fail(expr.at, "invalid shorthand property initializer")
+	case scriptExprArray, scriptExprObject, scriptExprProperty, scriptExprSpread:
+		for _, item := range expr.items {
+			if item != nil {
+				p.checkExpr(item)
+			}
+		}
+	}
+}
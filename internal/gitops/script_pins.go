@@ -0,0 +1,156 @@
+package gitops
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+var (
+	// scriptURLPattern finds http(s) URLs in script code, including ones
+	// with template actions in them
+	scriptURLPattern = regexp.MustCompile(`https?://(?:\{\{.*?\}\}|[^\s'"` + "`" + `<>{}])+`)
+
+	// versionSegmentPattern matches a release version (1.4, v1.4.2, 2.0.0-rc1)
+	versionSegmentPattern = regexp.MustCompile(`^v?\d+(\.\d+)+([-+][0-9A-Za-z.-]+)?$`)
+
+	// commitSegmentPattern matches an abbreviated or full commit hash
+	commitSegmentPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+	// libraryReferencePattern finds references to pinned library versions
+	libraryReferencePattern = regexp.MustCompile(`\.(?:Values\.)?libraries\.([A-Za-z0-9_]+)|index\s+\.(?:Values\.)?libraries\s+"([^"]+)"`)
+)
+
+// movingRefs are path segments that name a branch or alias rather than a release
+var movingRefs = map[string]bool{"main": true, "master": true, "latest": true, "head": true, "develop": true, "trunk": true}
+
+// checkScriptURL reports why a URL fetched by a script isn't pinned, or ""
+// if it is: it must carry a release version or commit hash, get its version
+// from a pinned library, or be allowed by script-pins.yaml
+func checkScriptURL(url string, pins *storage.ScriptPins) string {
+	if pins.Allowed(url) {
+		return ""
+	}
+
+	if IsTemplated(url) {
+		var missing []string
+		referenced := false
+		for _, match := range libraryReferencePattern.FindAllStringSubmatch(url, -1) {
+			name := match[1] + match[2]
+			referenced = true
+			if _, ok := pins.Libraries[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Sprintf("%s uses libraries not pinned in script-pins.yaml: %s", url, strings.Join(missing, ", "))
+		}
+		if referenced {
+			return ""
+		}
+	}
+
+	// Strip scheme, query and fragment; look at the host-relative path only
+	rest := url[strings.Index(url, "://")+3:]
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	segments := strings.Split(rest, "/")[1:]
+
+	// Package CDNs pin with name@version, e.g. gh/user/repo@v1.2.0
+	refs := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		if i := strings.LastIndex(segment, "@"); i >= 0 {
+			segment = segment[i+1:]
+		}
+		refs = append(refs, segment)
+	}
+
+	for _, ref := range refs {
+		if movingRefs[strings.ToLower(ref)] {
+			return fmt.Sprintf("%s tracks the moving ref %q; pin a release version or commit", url, ref)
+		}
+	}
+	for _, ref := range refs {
+		if versionSegmentPattern.MatchString(ref) || (commitSegmentPattern.MatchString(ref) && strings.ContainsAny(ref, "0123456789")) {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("%s has no version; pin a release version or commit, template one from script-pins.yaml libraries, or allow it in script-pins.yaml", url)
+}
+
+// checkScriptPins reports the unpinned URLs fetched by a device's scripts
+func (sm *SyncManager) checkScriptPins(device storage.Device, pins *storage.ScriptPins) []ValidationIssue {
+	scripts, err := sm.deviceStorage.ListScripts(device.Folder)
+	if err != nil {
+		return nil
+	}
+
+	var issues []ValidationIssue
+	for _, script := range scripts {
+		code, err := sm.deviceStorage.LoadScript(device.Folder, script.ID)
+		if err != nil {
+			continue
+		}
+		for _, url := range scriptURLPattern.FindAllString(code, -1) {
+			if problem := checkScriptURL(url, pins); problem != "" {
+				issues = append(issues, ValidationIssue{
+					DeviceID: device.DeviceID,
+					File:     path.Join(device.Folder, fmt.Sprintf("scripts/script-%d.js", script.ID)),
+					Message:  "unpinned URL: " + problem,
+				})
+			}
+		}
+	}
+
+	return issues
+}
+
+// addLibraryPins exposes the pinned library versions as values.libraries,
+// keeping versions the values file sets itself
+func (sm *SyncManager) addLibraryPins(values Values) error {
+	pins, err := storage.LoadScriptPins(sm.repoPath)
+	if err != nil {
+		return err
+	}
+	if len(pins.Libraries) == 0 {
+		return nil
+	}
+
+	libraries, _ := values["libraries"].(map[string]interface{})
+	if libraries == nil {
+		libraries = make(map[string]interface{}, len(pins.Libraries))
+	}
+	for name, version := range pins.Libraries {
+		if _, ok := libraries[name]; !ok {
+			libraries[name] = version
+		}
+	}
+	values["libraries"] = libraries
+
+	return nil
+}
+
+// scriptMatchesTemplate reports whether code could be the rendering of tmpl,
+// treating every template action as a wildcard. Pull uses it to keep a
+// templated script instead of overwriting it with its rendered device copy.
+func scriptMatchesTemplate(tmpl, code string) bool {
+	actions := regexp.MustCompile(`\{\{.*?\}\}`)
+	var pattern strings.Builder
+	pattern.WriteString(`(?s)^`)
+	last := 0
+	for _, loc := range actions.FindAllStringIndex(tmpl, -1) {
+		pattern.WriteString(regexp.QuoteMeta(tmpl[last:loc[0]]))
+		pattern.WriteString(`.*?`)
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(tmpl[last:]))
+	pattern.WriteString(`$`)
+
+	re, err := regexp.Compile(pattern.String())
+	return err == nil && re.MatchString(code)
+}
@@ -0,0 +1,108 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// ScriptToggleResult is the outcome of enabling or disabling a script on one
+// device
+type ScriptToggleResult struct {
+	DeviceID   string
+	DeviceName string
+	ScriptID   int
+	Changed    bool // the enable flag was flipped; false if it already had the wanted value
+	Error      error
+}
+
+// SetScriptEnabled enables or disables the script called name on the
+// selected devices without a push: the device's Script.SetConfig enable flag
+// is flipped and the script started or stopped, and the enable flag in the
+// script's meta.json follows. The changed metadata files are committed alone,
+// and the commit hash returned ("" if nothing changed). Devices without a
+// script of that name are skipped.
+func (sm *SyncManager) SetScriptEnabled(ctx context.Context, name string, deviceFilter []string, enable bool) ([]ScriptToggleResult, string, error) {
+	release, err := sm.LockRepo("script")
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+	if err := sm.checkFreeze(); err != nil {
+		return nil, "", err
+	}
+
+	var results []ScriptToggleResult
+	var changed []string
+	for _, device := range sm.SelectDevices(deviceFilter) {
+		scripts, err := sm.deviceStorage.ListScripts(device.Folder)
+		if err != nil {
+			continue
+		}
+		for _, script := range scripts {
+			if script.Name != name {
+				continue
+			}
+			result := ScriptToggleResult{DeviceID: device.DeviceID, DeviceName: device.Name, ScriptID: script.ID}
+			result.Error = sm.toggleScript(ctx, device, script, enable)
+			if result.Error == nil && script.Enable != enable {
+				result.Changed = true
+				changed = append(changed, path.Join(device.Folder, "scripts", fmt.Sprintf("script-%d.meta.json", script.ID)))
+			}
+			results = append(results, result)
+		}
+	}
+	if len(results) == 0 {
+		return nil, "", fmt.Errorf("no selected device has a script named %q", name)
+	}
+	if len(changed) == 0 {
+		return results, "", nil
+	}
+
+	if err := sm.repo.StagePaths(changed); err != nil {
+		return results, "", err
+	}
+	action := "Disable"
+	if enable {
+		action = "Enable"
+	}
+	devices := make([]string, 0, len(results))
+	for _, result := range results {
+		if result.Changed {
+			devices = append(devices, result.DeviceName)
+		}
+	}
+	hash, err := sm.repo.Commit(fmt.Sprintf("%s script %s on %s", action, name, strings.Join(devices, ", ")))
+	if err != nil {
+		return results, "", err
+	}
+	return results, hash, nil
+}
+
+// toggleScript applies the enable flag on the device, starting or stopping
+// the script to match, and saves it to the script's metadata
+func (sm *SyncManager) toggleScript(ctx context.Context, device storage.Device, script storage.ScriptMetadata, enable bool) error {
+	if !enable {
+		// Stopping a script that isn't running is a no-op on the device
+		if err := sm.shellyClient.StopScript(ctx, device.IPAddress, script.ID); err != nil {
+			return fmt.Errorf("failed to stop script: %w", err)
+		}
+	}
+	if err := sm.shellyClient.SetScriptConfig(ctx, device.IPAddress, script.ID, script.Name, enable); err != nil {
+		return fmt.Errorf("failed to set script config: %w", err)
+	}
+	if enable {
+		if err := sm.shellyClient.StartScript(ctx, device.IPAddress, script.ID); err != nil {
+			return fmt.Errorf("failed to start script: %w", err)
+		}
+	}
+
+	if script.Enable == enable {
+		return nil
+	}
+	script.Enable = enable
+	return sm.deviceStorage.SaveScriptMetadata(device.Folder, script)
+}
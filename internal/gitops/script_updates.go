@@ -0,0 +1,331 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// GitHub endpoints used to look up and fetch vendored scripts
+const (
+	defaultGitHubAPI = "https://api.github.com"
+	defaultGitHubRaw = "https://raw.githubusercontent.com"
+)
+
+// ScriptUpdateOptions configures a check for upstream script updates
+type ScriptUpdateOptions struct {
+	DryRun       bool   // only report the available updates
+	BranchPrefix string // prefix of the update branches (default "script-update/")
+	Push         bool   // push each update branch
+	Remote       string // remote used when Push is set (default "origin")
+
+	// PullRequestRepo ("owner/name") and GitHubToken open a pull request
+	// for each pushed branch against the branch the check started from
+	PullRequestRepo string
+	GitHubToken     string
+
+	GitHubAPI string // API base URL, e.g. of GitHub Enterprise (default https://api.github.com)
+	GitHubRaw string // raw file base URL (default https://raw.githubusercontent.com)
+}
+
+// ScriptUpdate is a newer upstream version of a vendored script
+type ScriptUpdate struct {
+	Repo        string
+	Path        string
+	From        []string // versions the scripts are on
+	To          string
+	Scripts     []string // device script files updated
+	Branch      string
+	Existing    bool   // the branch was created by an earlier check
+	PullRequest string // URL of the opened pull request
+	Error       error
+}
+
+// vendoredScript is a device script with a declared source
+type vendoredScript struct {
+	device   storage.Device
+	metadata storage.ScriptMetadata
+}
+
+// CheckScriptUpdates looks up the release tags of the repositories scripts
+// were vendored from (the source in script-N.meta.json) and, for every
+// upstream file with a newer release, creates a branch updating all device
+// scripts taken from it, Renovate-style. Branches are left for review, and
+// optionally pushed and proposed as pull requests; the repository stays on
+// its current branch. Templated scripts are skipped.
+func (sm *SyncManager) CheckScriptUpdates(ctx context.Context, opts ScriptUpdateOptions) ([]ScriptUpdate, error) {
+	if opts.BranchPrefix == "" {
+		opts.BranchPrefix = "script-update/"
+	}
+	if opts.GitHubAPI == "" {
+		opts.GitHubAPI = defaultGitHubAPI
+	}
+	if opts.GitHubRaw == "" {
+		opts.GitHubRaw = defaultGitHubRaw
+	}
+
+	if !opts.DryRun {
+		hasChanges, err := sm.repo.HasChanges()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check repository status: %w", err)
+		}
+		if hasChanges {
+			return nil, fmt.Errorf("cannot create update branches: working tree has uncommitted changes. Please commit or stash your changes first")
+		}
+	}
+
+	sources := make(map[string][]vendoredScript)
+	for _, device := range sm.manifest.Devices {
+		scripts, err := sm.deviceStorage.ListScripts(device.Folder)
+		if err != nil {
+			continue
+		}
+		for _, script := range scripts {
+			if script.Source == nil || script.Source.Repo == "" || script.Source.Path == "" {
+				continue
+			}
+			if script.Templated {
+				fmt.Fprintf(os.Stderr, "Warning: Skipping templated script %d of %s vendored from %s\n", script.ID, device.Name, script.Source.Repo)
+				continue
+			}
+			key := script.Source.Repo + "/" + script.Source.Path
+			sources[key] = append(sources[key], vendoredScript{device: device, metadata: script})
+		}
+	}
+	keys := make([]string, 0, len(sources))
+	for key := range sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	latest := make(map[string]string)
+	var updates []ScriptUpdate
+	for _, key := range keys {
+		scripts := sources[key]
+		source := scripts[0].metadata.Source
+
+		version, ok := latest[source.Repo]
+		if !ok {
+			var err error
+			if version, err = latestReleaseTag(ctx, client, opts, source.Repo); err != nil {
+				updates = append(updates, ScriptUpdate{Repo: source.Repo, Path: source.Path, Error: err})
+				continue
+			}
+			latest[source.Repo] = version
+		}
+
+		update := ScriptUpdate{Repo: source.Repo, Path: source.Path, To: version}
+		var outdated []vendoredScript
+		seen := make(map[string]bool)
+		for _, script := range scripts {
+			if compareReleaseVersions(script.metadata.Source.Version, version) >= 0 {
+				continue
+			}
+			outdated = append(outdated, script)
+			if from := script.metadata.Source.Version; !seen[from] {
+				seen[from] = true
+				update.From = append(update.From, from)
+			}
+			update.Scripts = append(update.Scripts, path.Join(script.device.Folder, fmt.Sprintf("scripts/script-%d.js", script.metadata.ID)))
+		}
+		if len(outdated) == 0 {
+			continue
+		}
+		update.Branch = BranchNameFromDescription(opts.BranchPrefix, fmt.Sprintf("%s %s %s", path.Base(source.Repo), strings.TrimSuffix(source.Path, ".js"), version))
+
+		if !opts.DryRun {
+			update.Error = sm.proposeScriptUpdate(ctx, client, opts, &update, outdated)
+		}
+		updates = append(updates, update)
+	}
+
+	return updates, nil
+}
+
+// proposeScriptUpdate commits the new upstream version of a script to its
+// update branch and returns to the current branch
+func (sm *SyncManager) proposeScriptUpdate(ctx context.Context, client *http.Client, opts ScriptUpdateOptions, update *ScriptUpdate, scripts []vendoredScript) error {
+	if sm.repo.BranchExists(update.Branch) {
+		update.Existing = true
+		return nil
+	}
+
+	code, err := githubGet(ctx, client, fmt.Sprintf("%s/%s/%s/%s", opts.GitHubRaw, update.Repo, update.To, update.Path), "")
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s at %s: %w", update.Path, update.To, err)
+	}
+
+	baseBranch, err := sm.repo.GetCurrentBranch()
+	if err != nil {
+		return err
+	}
+	if err := sm.repo.CreateBranch(update.Branch); err != nil {
+		return err
+	}
+	if err := sm.repo.CheckoutBranch(update.Branch); err != nil {
+		return err
+	}
+	defer func() {
+		if err := sm.repo.CheckoutBranch(baseBranch); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to return to branch %s: %v\n", baseBranch, err)
+		}
+	}()
+
+	for _, script := range scripts {
+		metadata := script.metadata
+		source := *metadata.Source
+		source.Version = update.To
+		metadata.Source = &source
+		if err := sm.deviceStorage.SaveScript(script.device.Folder, &shelly.ScriptCode{ID: metadata.ID, Name: metadata.Name, Code: string(code)}, metadata.Enable); err != nil {
+			return err
+		}
+		if err := sm.deviceStorage.SaveScriptMetadata(script.device.Folder, metadata); err != nil {
+			return err
+		}
+	}
+
+	if err := sm.repo.AddAll(); err != nil {
+		return err
+	}
+	title := fmt.Sprintf("Update %s from %s to %s", update.Path, update.Repo, update.To)
+	if _, err := sm.repo.Commit(title); err != nil {
+		return err
+	}
+
+	if !opts.Push {
+		return nil
+	}
+	if err := sm.repo.PushBranch(opts.Remote, update.Branch); err != nil {
+		return err
+	}
+	if opts.PullRequestRepo == "" || opts.GitHubToken == "" {
+		return nil
+	}
+
+	body := fmt.Sprintf("Updates `%s` from [%s](https://github.com/%s) (%s → %s) in:\n\n- %s\n",
+		update.Path, update.Repo, update.Repo, strings.Join(update.From, ", "), update.To, strings.Join(update.Scripts, "\n- "))
+	update.PullRequest, err = openPullRequest(ctx, client, opts, title, body, update.Branch, baseBranch)
+	return err
+}
+
+// latestReleaseTag returns the highest release version among the tags of a
+// GitHub repository; pre-releases are ignored
+func latestReleaseTag(ctx context.Context, client *http.Client, opts ScriptUpdateOptions, repo string) (string, error) {
+	data, err := githubGet(ctx, client, fmt.Sprintf("%s/repos/%s/tags?per_page=100", opts.GitHubAPI, repo), opts.GitHubToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to list tags of %s: %w", repo, err)
+	}
+
+	var tags []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return "", fmt.Errorf("failed to parse tags of %s: %w", repo, err)
+	}
+
+	latest := ""
+	for _, tag := range tags {
+		if !versionSegmentPattern.MatchString(tag.Name) || strings.ContainsAny(tag.Name, "-+") {
+			continue
+		}
+		if latest == "" || compareReleaseVersions(tag.Name, latest) > 0 {
+			latest = tag.Name
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("%s has no release tags", repo)
+	}
+	return latest, nil
+}
+
+// compareReleaseVersions compares two versions like v1.4.2 numerically
+func compareReleaseVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// githubGet fetches a GitHub URL, authenticated if a token is given
+func githubGet(ctx context.Context, client *http.Client, url, token string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return githubDo(client, req)
+}
+
+// openPullRequest opens a pull request and returns its URL
+func openPullRequest(ctx context.Context, client *http.Client, opts ScriptUpdateOptions, title, body, head, base string) (string, error) {
+	payload, err := json.Marshal(map[string]string{"title": title, "body": body, "head": head, "base": base})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/repos/%s/pulls", opts.GitHubAPI, opts.PullRequestRepo), bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+opts.GitHubToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	data, err := githubDo(client, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to open pull request: %w", err)
+	}
+	var pr struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.Unmarshal(data, &pr); err != nil {
+		return "", fmt.Errorf("failed to parse pull request: %w", err)
+	}
+	return pr.HTMLURL, nil
+}
+
+// githubDo sends a request and returns the body of a successful response
+func githubDo(client *http.Client, req *http.Request) ([]byte, error) {
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
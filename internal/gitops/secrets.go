@@ -0,0 +1,185 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/config"
+	"github.com/darkermage/shelly-git-ops/internal/secrets"
+)
+
+// SetSecretStore sets the store whose secrets are exposed to templates as .secrets
+// and which receives values moved out of the repository by RedactSecrets
+func (sm *SyncManager) SetSecretStore(store *config.SecretStore) {
+	sm.credentialsMu.Lock()
+	defer sm.credentialsMu.Unlock()
+	sm.secretStore = store
+	sm.storedSecrets = nil
+}
+
+// SetDeviceAuth sets the credentials used for devices with authentication
+// enabled that have no credentials of their own (see SetDeviceCredentials)
+func (sm *SyncManager) SetDeviceAuth(username, password string) {
+	sm.shellyClient.SetAuth(username, password)
+}
+
+// addSecretsToValues exposes secrets from the secret store to templates
+func (sm *SyncManager) addSecretsToValues(values Values) error {
+	if sm.secretStore == nil {
+		return nil
+	}
+
+	stored, err := sm.secretStore.Load()
+	if err != nil {
+		return err
+	}
+
+	secretValues := make(map[string]interface{}, len(stored))
+	for name, value := range stored {
+		secretValues[name] = value
+	}
+	values["secrets"] = secretValues
+
+	return nil
+}
+
+// ScanSecrets scans device folders for plaintext passwords, tokens and private keys
+// File paths in findings are relative to the repository root
+func (sm *SyncManager) ScanSecrets(deviceFilter []string) ([]secrets.Finding, error) {
+	var findings []secrets.Finding
+
+	for _, device := range sm.SelectDevices(deviceFilter) {
+		root := sm.deviceStorage.GetDevicePath(device.Folder)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", path, err)
+			}
+
+			relPath, _ := filepath.Rel(sm.repoPath, path)
+			relPath = filepath.ToSlash(relPath)
+
+			if filepath.Ext(path) == ".json" {
+				jsonFindings, err := secrets.ScanJSON(relPath, data)
+				if err == nil {
+					findings = append(findings, jsonFindings...)
+				}
+			}
+			findings = append(findings, secrets.ScanText(relPath, string(data), secrets.DefaultRules)...)
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", device.Name, err)
+		}
+	}
+
+	return findings, nil
+}
+
+// RedactSecrets moves plaintext secret fields found in device JSON files into the
+// secret store, replacing them with {{ index .secrets "<name>" }} placeholders
+// that push resolves again. Secrets found in scripts or other text can't be
+// redacted safely and are returned as remaining findings.
+func (sm *SyncManager) RedactSecrets(deviceFilter []string) (redacted []secrets.Finding, remaining []secrets.Finding, err error) {
+	if sm.secretStore == nil {
+		return nil, nil, fmt.Errorf("no secret store configured")
+	}
+
+	stored, err := sm.secretStore.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	findings, err := sm.ScanSecrets(deviceFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byFile := make(map[string]bool)
+	for _, finding := range findings {
+		if finding.Path != "" {
+			byFile[finding.File] = true
+			continue
+		}
+		remaining = append(remaining, finding)
+	}
+
+	for file := range byFile {
+		path := filepath.Join(sm.repoPath, filepath.FromSlash(file))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return redacted, remaining, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return redacted, remaining, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+
+		prefix := strings.TrimSuffix(strings.ReplaceAll(file, "/", "."), ".json")
+		doc = replaceSecretValues(doc, "", func(path, secret string) string {
+			name := prefix + "." + path
+			stored[name] = secret
+			redacted = append(redacted, secrets.Finding{File: file, RuleID: "secret-field", Path: path, Preview: secrets.Redact(secret)})
+			return fmt.Sprintf(`{{ index .secrets "%s" }}`, name)
+		})
+
+		output, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return redacted, remaining, fmt.Errorf("failed to marshal %s: %w", file, err)
+		}
+		if err := os.WriteFile(path, output, 0644); err != nil {
+			return redacted, remaining, fmt.Errorf("failed to write %s: %w", file, err)
+		}
+	}
+
+	if err := sm.secretStore.Save(stored); err != nil {
+		return redacted, remaining, err
+	}
+
+	return redacted, remaining, nil
+}
+
+// replaceSecretValues returns a copy of value with every plaintext secret field
+// replaced by the result of replace
+func replaceSecretValues(value interface{}, path string, replace func(path, secret string) string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if s, ok := item.(string); ok && secrets.IsSecretKey(key) && s != "" && !IsTemplated(s) {
+				out[key] = replace(childPath, s)
+				continue
+			}
+			out[key] = replaceSecretValues(item, childPath, replace)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = replaceSecretValues(item, fmt.Sprintf("%s[%d]", path, i), replace)
+		}
+		return out
+	default:
+		return value
+	}
+}
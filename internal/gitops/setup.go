@@ -0,0 +1,124 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hookMarker identifies hooks installed by SetupRepository so they can be updated
+const hookMarker = "# Installed by shelly-gitops"
+
+// gitignoreEntries keep local-only files out of device repositories
+var gitignoreEntries = []string{
+	"# shelly-gitops",
+	"credentials.json",
+	"secrets.json",
+	".env",
+	"traces/",
+	"*.tmp",
+	"*.rename-tmp/",
+	".DS_Store",
+	"Thumbs.db",
+}
+
+// hooks are the Git hooks installed by SetupRepository
+var hooks = map[string]string{
+	"pre-commit": `#!/bin/sh
+` + hookMarker + `
+# Validates configs, templates and schedules before every commit
+if ! command -v shelly-gitops >/dev/null 2>&1; then
+	echo "shelly-gitops not found in PATH, skipping validation" >&2
+	exit 0
+fi
+exec shelly-gitops validate
+`,
+	"pre-push": `#!/bin/sh
+` + hookMarker + `
+# Checks that the pushed state can be applied to the devices
+if ! command -v shelly-gitops >/dev/null 2>&1; then
+	echo "shelly-gitops not found in PATH, skipping plan check" >&2
+	exit 0
+fi
+exec shelly-gitops push --dry-run
+`,
+}
+
+// SetupResult reports what SetupRepository changed
+type SetupResult struct {
+	GitignoreUpdated bool
+	HooksInstalled   []string
+	HooksSkipped     []string // existing hooks not written by this tool
+}
+
+// SetupRepository writes a .gitignore for credentials, traces and temp files
+// and installs pre-commit (validate) and pre-push (dry-run push) hooks.
+// Hooks not installed by this tool are only replaced when force is set.
+func SetupRepository(repoPath string, force bool) (*SetupResult, error) {
+	result := &SetupResult{}
+
+	updated, err := ensureGitignore(filepath.Join(repoPath, ".gitignore"))
+	if err != nil {
+		return result, err
+	}
+	result.GitignoreUpdated = updated
+
+	hooksDir := filepath.Join(repoPath, ".git", "hooks")
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return result, fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+
+	for _, name := range []string{"pre-commit", "pre-push"} {
+		hookPath := filepath.Join(hooksDir, name)
+		if existing, err := os.ReadFile(hookPath); err == nil && !strings.Contains(string(existing), hookMarker) && !force {
+			result.HooksSkipped = append(result.HooksSkipped, name)
+			continue
+		}
+
+		if err := os.WriteFile(hookPath, []byte(hooks[name]), 0755); err != nil {
+			return result, fmt.Errorf("failed to write %s hook: %w", name, err)
+		}
+		result.HooksInstalled = append(result.HooksInstalled, name)
+	}
+
+	return result, nil
+}
+
+// ensureGitignore appends missing entries to a .gitignore file
+func ensureGitignore(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read .gitignore: %w", err)
+	}
+
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		existing[strings.TrimSpace(line)] = true
+	}
+
+	var missing []string
+	for _, entry := range gitignoreEntries {
+		if !existing[entry] {
+			missing = append(missing, entry)
+		}
+	}
+	if len(missing) == 0 || (len(missing) == 1 && strings.HasPrefix(missing[0], "#")) {
+		return false, nil
+	}
+
+	content := string(data)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if content != "" {
+		content += "\n"
+	}
+	content += strings.Join(missing, "\n") + "\n"
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return false, fmt.Errorf("failed to write .gitignore: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,119 @@
+package gitops
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// CommitInfo summarizes a commit for status and history output
+type CommitInfo struct {
+	Hash    string    `json:"hash"`
+	Message string    `json:"message"`
+	Author  string    `json:"author"`
+	When    time.Time `json:"when"`
+}
+
+// DeviceStatus is the status of a single device as known from the repository
+type DeviceStatus struct {
+	Device       storage.Device `json:"device"`
+	Health       *DeviceHealth  `json:"health,omitempty"`
+	LocalChanges int            `json:"local_changes"` // uncommitted files in the device folder
+	LastChange   *CommitInfo    `json:"last_change,omitempty"`
+}
+
+// FleetStatus is the status of the repository and every device in the manifest
+type FleetStatus struct {
+	Branch      string         `json:"branch"`
+	Head        string         `json:"head"`
+	Clean       bool           `json:"clean"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Devices     []DeviceStatus `json:"devices"`
+}
+
+// Devices returns the devices registered in the manifest
+func (sm *SyncManager) Devices() []storage.Device {
+	return sm.manifest.Devices
+}
+
+// DeviceNotes returns the notes for a device: manifest values, overridden
+// field by field by those in the device's device.yaml
+func (sm *SyncManager) DeviceNotes(device storage.Device) storage.DeviceNotes {
+	notes := device.DeviceNotes
+	if metadata, err := sm.deviceStorage.LoadDeviceMetadata(device.Folder); err == nil {
+		notes = notes.Merge(metadata.DeviceNotes)
+	}
+	return notes
+}
+
+// FleetStatus gathers repository and per-device status without contacting devices
+func (sm *SyncManager) FleetStatus() (*FleetStatus, error) {
+	status := &FleetStatus{GeneratedAt: time.Now()}
+
+	branch, err := sm.repo.GetCurrentBranch()
+	if err == nil {
+		status.Branch = branch
+	}
+	head, err := sm.repo.HeadCommit()
+	if err == nil {
+		status.Head = head
+	}
+
+	worktreeStatus, err := sm.repo.GetStatus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository status: %w", err)
+	}
+	status.Clean = worktreeStatus.IsClean()
+
+	for _, device := range sm.manifest.Devices {
+		ds := DeviceStatus{Device: device}
+		ds.Device.DeviceNotes = sm.DeviceNotes(device)
+
+		if h, ok := sm.health.Get(device.DeviceID); ok {
+			ds.Health = &h
+		}
+
+		prefix := device.Folder + "/"
+		for path, fileStatus := range worktreeStatus {
+			if strings.HasPrefix(path, prefix) && (fileStatus.Worktree != ' ' || fileStatus.Staging != ' ') {
+				ds.LocalChanges++
+			}
+		}
+
+		history, err := sm.DeviceHistory(device.DeviceID, 1)
+		if err == nil && len(history) > 0 {
+			ds.LastChange = &history[0]
+		}
+
+		status.Devices = append(status.Devices, ds)
+	}
+
+	return status, nil
+}
+
+// DeviceHistory returns the most recent commits touching a device's folder
+func (sm *SyncManager) DeviceHistory(deviceID string, maxCount int) ([]CommitInfo, error) {
+	device := sm.manifest.GetDevice(deviceID)
+	if device == nil {
+		return nil, fmt.Errorf("device %s not found in manifest", deviceID)
+	}
+
+	commits, err := sm.repo.GetPathLog(device.Folder, maxCount)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]CommitInfo, 0, len(commits))
+	for _, c := range commits {
+		history = append(history, CommitInfo{
+			Hash:    c.Hash.String(),
+			Message: strings.TrimSpace(c.Message),
+			Author:  c.Author.Name,
+			When:    c.Author.When,
+		})
+	}
+
+	return history, nil
+}
@@ -0,0 +1,40 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// SetCaptureStatus makes pulls store each device's runtime state (uptime,
+// RSSI, power, ...) in status.json next to its configs. The snapshot changes
+// on every pull, so it is off by default; push never reads it.
+func (sm *SyncManager) SetCaptureStatus(enabled bool) {
+	sm.captureStatus = enabled
+}
+
+// captureStatusSnapshot saves status.json from the statuses returned with the
+// components of the pull, or from Shelly.GetStatus when there were none
+func (sm *SyncManager) captureStatusSnapshot(ctx context.Context, device storage.Device, components []shelly.ComponentInfo) error {
+	status := make(map[string]json.RawMessage, len(components))
+	for _, component := range components {
+		if len(component.Status) > 0 {
+			status[component.Key] = component.Status
+		}
+	}
+
+	if len(status) == 0 {
+		result, err := sm.shellyClient.GetStatus(ctx, device.IPAddress)
+		if err != nil {
+			return fmt.Errorf("failed to get status: %w", err)
+		}
+		if err := json.Unmarshal(result, &status); err != nil {
+			return fmt.Errorf("failed to parse status: %w", err)
+		}
+	}
+
+	return sm.deviceStorage.SaveStatusSnapshot(device.Folder, status)
+}
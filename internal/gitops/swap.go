@@ -0,0 +1,125 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// DeviceSwapError reports that a manifest entry's IP address now answers with
+// a different physical device, e.g. after hardware was replaced or DHCP
+// handed the address to another device
+type DeviceSwapError struct {
+	DeviceID    string
+	Name        string
+	IPAddress   string
+	ExpectedMAC string
+	FoundID     string
+	FoundMAC    string
+	FoundModel  string
+}
+
+func (e *DeviceSwapError) Error() string {
+	return fmt.Sprintf("device swap detected: %s answers as %s (MAC %s) instead of %s (MAC %s); run ReplaceDevice if the hardware was replaced, or fix the IP address in the manifest",
+		e.IPAddress, e.FoundID, formatMAC(e.FoundMAC), e.DeviceID, formatMAC(e.ExpectedMAC))
+}
+
+// detectDeviceSwap compares the identity a device reports with its manifest
+// entry. A missing MAC on either side is not treated as a mismatch.
+func detectDeviceSwap(device storage.Device, info *shelly.DeviceInfo) *DeviceSwapError {
+	idMismatch := info.ID != "" && !strings.EqualFold(info.ID, device.DeviceID)
+	macMismatch := info.MAC != "" && device.MACAddress != "" && normalizeMAC(info.MAC) != normalizeMAC(device.MACAddress)
+	if !idMismatch && !macMismatch {
+		return nil
+	}
+
+	return &DeviceSwapError{
+		DeviceID:    device.DeviceID,
+		Name:        device.Name,
+		IPAddress:   device.IPAddress,
+		ExpectedMAC: device.MACAddress,
+		FoundID:     info.ID,
+		FoundMAC:    info.MAC,
+		FoundModel:  info.Model,
+	}
+}
+
+// alertDeviceSwap prints a swap prominently, as it halts all operations on the entry
+func alertDeviceSwap(swap *DeviceSwapError) {
+	fmt.Fprintf(os.Stderr, "\n!!! DEVICE SWAP DETECTED: %s (%s) !!!\n", swap.Name, swap.IPAddress)
+	fmt.Fprintf(os.Stderr, "    manifest: %s, MAC %s\n", swap.DeviceID, formatMAC(swap.ExpectedMAC))
+	fmt.Fprintf(os.Stderr, "    found:    %s, MAC %s, model %s\n", swap.FoundID, formatMAC(swap.FoundMAC), swap.FoundModel)
+	fmt.Fprintf(os.Stderr, "    Skipping this device. If the hardware was replaced, adopt it with ReplaceDevice\n")
+	fmt.Fprintf(os.Stderr, "    and push to restore its configuration; otherwise fix its IP address in the manifest.\n\n")
+}
+
+// ReplaceDevice adopts the device now answering at a manifest entry's IP
+// address as its replacement: the entry keeps its name, folder, tags and notes
+// but takes the new device ID, MAC and model. Push afterwards to restore the
+// stored configuration onto the new hardware, after PlanModelRemap if the
+// model changed.
+func (sm *SyncManager) ReplaceDevice(ctx context.Context, deviceID string) (*storage.Device, error) {
+	index := -1
+	for i, device := range sm.manifest.Devices {
+		if device.DeviceID == deviceID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("device %s not found in manifest", deviceID)
+	}
+	device := sm.manifest.Devices[index]
+
+	info, err := sm.shellyClient.GetDeviceInfo(ctx, device.IPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device info: %w", err)
+	}
+	if info.ID == "" {
+		return nil, fmt.Errorf("device at %s did not report an ID", device.IPAddress)
+	}
+	if info.ID != deviceID {
+		if existing := sm.manifest.GetDevice(info.ID); existing != nil {
+			return nil, fmt.Errorf("device %s is already in the manifest as %s", info.ID, existing.Name)
+		}
+	}
+
+	sm.InvalidateDeviceCache(deviceID)
+	previousModel := device.Model
+	device.DeviceID = info.ID
+	device.Model = info.Model
+	if info.MAC != "" {
+		device.MACAddress = formatMAC(info.MAC)
+	}
+	sm.manifest.Devices[index] = device
+
+	if err := sm.manifest.Save(); err != nil {
+		return nil, fmt.Errorf("failed to update manifest: %w", err)
+	}
+	printModelChange(device, previousModel)
+
+	return &device, nil
+}
+
+// normalizeMAC strips separators and case so MACs from discovery providers
+// (aa:bb:cc:dd:ee:ff) and devices (AABBCCDDEEFF) compare equal
+func normalizeMAC(mac string) string {
+	return strings.ToUpper(strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac))
+}
+
+// formatMAC renders a MAC in the colon-separated form used by discovery
+func formatMAC(mac string) string {
+	mac = normalizeMAC(mac)
+	if len(mac) != 12 {
+		return mac
+	}
+	parts := make([]string, 0, 6)
+	for i := 0; i < 12; i += 2 {
+		parts = append(parts, mac[i:i+2])
+	}
+	return strings.ToLower(strings.Join(parts, ":"))
+}
@@ -4,15 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/darkermage/shelly-git-ops/internal/cloud"
+	"github.com/darkermage/shelly-git-ops/internal/config"
 	"github.com/darkermage/shelly-git-ops/internal/discovery"
-	"github.com/darkermage/shelly-git-ops/internal/shelly"
 	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/internal/tunnel"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -23,6 +30,40 @@ type SyncManager struct {
 	manifest      *storage.Manifest
 	shellyClient  *shelly.Client
 	deviceStorage *storage.DeviceStorage
+	health        *HealthTracker
+	secretStore   *config.SecretStore
+	cloudClient   *cloud.Client // relays calls to devices with transport: cloud
+
+	quarantineDegraded   bool
+	maxFailures          *FailureBudget
+	maxParallel          int
+	maxPullConcurrency   int
+	redactionRules       *storage.RedactionRules
+	volatileFields       *storage.VolatileFields
+	requireCloudDisabled bool
+	freezeOverride       bool
+	pushConfirmed        bool
+	pullMerge            bool
+	scriptSizeLimit      int
+	captureStatus        bool
+	rebootIfNeeded       *RebootOptions
+	rollbackWindow       time.Duration
+	timings              *timings
+	secretsMu            sync.Mutex
+	traceFile            *os.File
+	liveTransport        http.RoundTripper // the device transport while recording or replaying
+	tunnel               tunnel.Dialer     // the site's jump host, set by SetAddressing
+	methodSupport        sync.Map          // "<device ID>/<method>" -> bool
+	initiatedReboots     sync.Map          // device ID -> initiatedReboot
+	deviceCacheTTL       time.Duration
+	cacheMu              sync.Mutex
+	lockMu               sync.Mutex
+	lockDepth            int
+	lockInfo             LockInfo // the lock this process holds while lockDepth > 0
+	lockStop             chan struct{}
+	credentialsMu        sync.Mutex
+	deviceAuth           map[string]*shelly.AuthConfig // by device ID
+	storedSecrets        map[string]string             // secret store contents, loaded on first use
 }
 
 // SyncResult represents the result of a sync operation
@@ -31,6 +72,29 @@ type SyncResult struct {
 	Success  bool
 	Error    error
 	Message  string
+
+	// RestartRequired lists the pushed components the device asked to be
+	// rebooted for, e.g. eth; Rebooted is set once a push rebooted it
+	RestartRequired []string
+	Rebooted        bool
+
+	// Conflicts lists the fields a merge pull kept local although the
+	// device changed them too (see SetPullMerge)
+	Conflicts []MergeConflict
+}
+
+// Hint returns what the user can do about the result's error, e.g. set
+// device credentials for an authentication error, or "" if there is no hint
+func (r SyncResult) Hint() string {
+	return shelly.Hint(r.Error)
+}
+
+// hintSuffix formats the remediation hint of err as an extra output line
+func hintSuffix(err error) string {
+	if hint := shelly.Hint(err); hint != "" {
+		return "\n  Hint: " + hint
+	}
+	return ""
 }
 
 // NewSyncManager creates a new sync manager
@@ -39,107 +103,218 @@ func NewSyncManager(repoPath string) (*SyncManager, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := checkRepoFormat(repoPath); err != nil {
+		return nil, err
+	}
 
-	manifestPath := filepath.Join(repoPath, "manifest.yaml")
+	manifestPath := storage.FindManifest(repoPath)
 	manifest, err := storage.LoadManifest(manifestPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load manifest: %w", err)
 	}
+	for _, issue := range manifest.PortabilityIssues() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", issue)
+	}
 
-	return &SyncManager{
+	sm := &SyncManager{
 		repo:          repo,
 		repoPath:      repoPath,
 		manifest:      manifest,
 		shellyClient:  shelly.NewClient(),
 		deviceStorage: storage.NewDeviceStorage(repoPath),
-	}, nil
+	}
+
+	sm.health, err = LoadHealthTracker(filepath.Join(sm.StateDir(), "health.json"))
+	if err != nil {
+		return nil, err
+	}
+	sm.timings = newTimings()
+	sm.shellyClient.SetObserver(sm.observeCall)
+	sm.deviceStorage.SetObserver(func(op string, d time.Duration) { sm.timings.record(StageFileIO, op, "", d) })
+	sm.repo.SetObserver(func(op string, d time.Duration) { sm.timings.record(StageGit, op, "", d) })
+	sm.shellyClient.SetCredentialsFunc(sm.deviceCredentials)
+	sm.shellyClient.SetRelayResolver(sm.deviceRelay)
+	sm.shellyClient.SetHTTPSFunc(sm.deviceHTTPS)
+	sm.shellyClient.SetTimeoutFunc(sm.deviceTimeouts)
+	sm.shellyClient.SetPacingFunc(sm.devicePacing)
+
+	return sm, nil
+}
+
+// defaultParallelism is the number of devices pulled or pushed at the same time
+const defaultParallelism = 16
+
+// SetParallelism sets how many devices are pulled or pushed at the same time,
+// so large fleets don't saturate Wi-Fi access points. Values <= 0 restore the
+// default.
+func (sm *SyncManager) SetParallelism(n int) {
+	sm.maxParallel = n
+}
+
+// parallelism returns the effective device parallelism
+func (sm *SyncManager) parallelism() int {
+	if sm.maxParallel <= 0 {
+		return defaultParallelism
+	}
+	return sm.maxParallel
+}
+
+// SetPullConcurrency sets how many devices are pulled at the same time,
+// overriding SetParallelism for pulls. Values <= 0 restore the default.
+func (sm *SyncManager) SetPullConcurrency(n int) {
+	sm.maxPullConcurrency = n
+}
+
+// pullConcurrency returns the effective pull concurrency
+func (sm *SyncManager) pullConcurrency() int {
+	if sm.maxPullConcurrency <= 0 {
+		return sm.parallelism()
+	}
+	return sm.maxPullConcurrency
+}
+
+// pushConcurrency returns the effective push concurrency, lowered while a
+// failure budget is set
+func (sm *SyncManager) pushConcurrency(budgeted bool) int {
+	n := sm.parallelism()
+	if budgeted && n > budgetedPushConcurrency {
+		return budgetedPushConcurrency
+	}
+	return n
+}
+
+// SetMaxInFlight limits how many RPC calls run against a single device at the
+// same time, e.g. 1 for devices that drop concurrent requests. Values <= 0
+// remove the limit.
+func (sm *SyncManager) SetMaxInFlight(n int) {
+	sm.shellyClient.SetMaxInFlight(n)
+}
+
+// SetTransportOptions tunes how connections to devices are pooled, e.g. to
+// disable keep-alives for devices that misbehave with them
+func (sm *SyncManager) SetTransportOptions(opts shelly.TransportOptions) {
+	sm.shellyClient.SetTransportOptions(opts)
+}
+
+// StateDir returns the directory for local tool state that must never be committed
+// It lives inside .git so it doesn't show up as working tree changes
+func (sm *SyncManager) StateDir() string {
+	return filepath.Join(sm.repoPath, ".git", "shelly-gitops")
+}
+
+// journalPath returns the location of the push journal
+func (sm *SyncManager) journalPath() string {
+	return filepath.Join(sm.StateDir(), "journal.json")
+}
+
+// InterruptedDevices returns journal entries for devices whose last push was
+// interrupted or failed, and which should be re-verified or re-pushed
+func (sm *SyncManager) InterruptedDevices() ([]JournalEntry, error) {
+	journal, err := LoadJournal(sm.journalPath())
+	if err != nil {
+		return nil, err
+	}
+	return journal.Pending(), nil
 }
 
 // PullFromDevices fetches current state from all devices and overwrites local files
 func (sm *SyncManager) PullFromDevices(ctx context.Context) ([]SyncResult, error) {
-	// Safety check: ensure there are no uncommitted changes
-	hasChanges, err := sm.repo.HasChanges()
+	return sm.PullDevices(ctx, nil)
+}
+
+// PullDevices fetches current state from devices matching deviceFilter (all
+// devices if empty) and overwrites local files, or merges into them with
+// SetPullMerge. See SelectDevices for filter syntax.
+func (sm *SyncManager) PullDevices(ctx context.Context, deviceFilter []string) ([]SyncResult, error) {
+	release, err := sm.LockRepo("pull")
 	if err != nil {
-		return nil, fmt.Errorf("failed to check repository status: %w", err)
+		return nil, err
 	}
-	if hasChanges {
-		return nil, fmt.Errorf("cannot pull: working tree has uncommitted changes. Please commit or stash your changes first")
+	defer release()
+
+	// Safety check: ensure there are no uncommitted changes, unless they
+	// are to be merged with the device state
+	var mergeBase *object.Commit
+	if sm.pullMerge {
+		// No commits yet means there is no last synced state to merge from
+		mergeBase, _ = sm.repo.ResolveCommit("HEAD")
+	} else {
+		hasChanges, err := sm.repo.HasChanges()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check repository status: %w", err)
+		}
+		if hasChanges {
+			return nil, fmt.Errorf("cannot pull: working tree has uncommitted changes. Please commit or stash your changes first")
+		}
+	}
+
+	sm.redactionRules, err = storage.LoadRedactionRules(sm.repoPath)
+	if err != nil {
+		return nil, err
+	}
+	sm.volatileFields, err = storage.LoadVolatileFields(sm.repoPath)
+	if err != nil {
+		return nil, err
 	}
 
-	// Pull from all devices in parallel
+	devicesToPull, skipped := sm.beginHealthTracking(sm.SelectDevices(deviceFilter))
+	defer sm.endHealthTracking()
+
+	// Settle device names and folders before any device is written, so no
+	// goroutine writes into a folder that is being renamed
+	results := make([]SyncResult, len(devicesToPull))
+	targets, err := sm.preparePull(ctx, devicesToPull, results)
+	if err != nil {
+		return append(results, skipped...), err
+	}
+
+	// Pull from devices in parallel, bounded so large fleets don't hold
+	// hundreds of in-flight payloads at once
 	g, ctx := errgroup.WithContext(ctx)
-	results := make([]SyncResult, len(sm.manifest.Devices))
+	g.SetLimit(sm.pullConcurrency())
 
-	for i, device := range sm.manifest.Devices {
-		i, device := i, device // Capture loop variables
+	for _, target := range targets {
+		target := target // Capture loop variable
 		g.Go(func() error {
-			result := sm.pullDeviceConfig(ctx, device)
-			results[i] = result
+			ctx := shelly.WithTraceOperation(ctx, "pull")
+			if sm.pullMerge {
+				results[target.index] = sm.mergeDeviceState(ctx, mergeBase, target.device, target.info)
+			} else {
+				results[target.index] = sm.pullDeviceState(ctx, target.device, target.info)
+			}
 			return nil // Don't fail entire operation if one device fails
 		})
 	}
 
 	if err := g.Wait(); err != nil {
-		return results, err
+		return append(results, skipped...), err
 	}
 
-	return results, nil
+	return append(results, skipped...), nil
 }
 
 // pullDeviceConfig pulls configuration from a single device
 func (sm *SyncManager) pullDeviceConfig(ctx context.Context, device storage.Device) SyncResult {
-	result := SyncResult{
-		DeviceID: device.DeviceID,
-		Success:  false,
-	}
-
-	// Get device info
-	deviceInfo, err := sm.shellyClient.GetDeviceInfo(ctx, device.IPAddress)
+	results := make([]SyncResult, 1)
+	targets, err := sm.preparePull(ctx, []storage.Device{device}, results)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to get device info: %w", err)
-		return result
+		return SyncResult{DeviceID: device.DeviceID, Error: err}
 	}
-
-	// Use device name from Shelly.GetDeviceInfo, fallback to manifest name if empty
-	deviceName := deviceInfo.Name
-	if deviceName == "" {
-		deviceName = device.Name
+	if len(targets) == 0 {
+		return results[0]
 	}
+	return sm.pullDeviceState(ctx, targets[0].device, targets[0].info)
+}
 
-	// Check if name changed and update manifest
-	if deviceName != device.Name && deviceName != "" {
-		// Create new folder name based on device name (sanitize for filesystem)
-		sanitizedName := strings.ToLower(deviceName)
-		sanitizedName = strings.ReplaceAll(sanitizedName, " ", "-")
-		sanitizedName = strings.ReplaceAll(sanitizedName, "_", "-")
-		newFolderName := fmt.Sprintf("%s-%s", sanitizedName, device.DeviceID)
-
-		// Rename folder if it exists and name changed
-		if device.Folder != newFolderName && sm.deviceStorage.DeviceExists(device.Folder) {
-			oldPath := sm.deviceStorage.GetDevicePath(device.Folder)
-			newPath := sm.deviceStorage.GetDevicePath(newFolderName)
-
-			if err := os.Rename(oldPath, newPath); err != nil {
-				result.Error = fmt.Errorf("failed to rename device folder: %w", err)
-				return result
-			}
-
-			// Update device folder in local variable
-			device.Folder = newFolderName
-		}
-
-		// Update manifest
-		device.Name = deviceName
-		device.Folder = newFolderName
-		sm.manifest.AddDevice(device)
-		if err := sm.manifest.Save(); err != nil {
-			result.Error = fmt.Errorf("failed to update manifest: %w", err)
-			return result
-		}
+// pullDeviceState writes the state of a device prepared by preparePull into
+// its folder
+func (sm *SyncManager) pullDeviceState(ctx context.Context, device storage.Device, deviceInfo *shelly.DeviceInfo) SyncResult {
+	result := SyncResult{
+		DeviceID: device.DeviceID,
+		Success:  false,
 	}
 
 	// Ensure device folder and all subdirectories exist
-	// Call this AFTER rename logic to ensure subdirs exist in the correct location
 	// Always create/ensure folder structure exists (MkdirAll is safe to call multiple times)
 	if err := sm.deviceStorage.CreateDeviceFolder(device.Folder); err != nil {
 		result.Error = fmt.Errorf("failed to create device folder: %w", err)
@@ -149,67 +324,94 @@ func (sm *SyncManager) pullDeviceConfig(ctx context.Context, device storage.Devi
 	// Save device metadata
 	metadata := storage.DeviceMetadata{
 		DeviceID:   device.DeviceID,
-		Name:       deviceName,
+		Name:       device.Name,
 		Model:      deviceInfo.Model,
 		Firmware:   deviceInfo.FW,
+		Generation: deviceInfo.Gen,
+		App:        deviceInfo.App,
+		Uptime:     device.Uptime,
 		IPAddress:  device.IPAddress,
 		MACAddress: device.MACAddress,
+		Network:    device.Network,
+		VLAN:       device.VLAN,
+	}
+	if existing, err := sm.deviceStorage.LoadDeviceMetadata(device.Folder); err == nil {
+		metadata.DeviceNotes = existing.DeviceNotes
+		metadata.PowerRanges = existing.PowerRanges
+		metadata.HomeAssistant = existing.HomeAssistant
 	}
 	if err := sm.deviceStorage.SaveDeviceMetadata(device.Folder, metadata); err != nil {
 		result.Error = fmt.Errorf("failed to save metadata: %w", err)
 		return result
 	}
 
-	// Get all component configurations using Shelly.GetConfig
-	shellyConfig, err := sm.shellyClient.GetShellyConfig(ctx, device.IPAddress)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to get shelly config: %w", err)
-		return result
-	}
-
-	// Parse the config as a map to extract individual components
-	var configMap map[string]json.RawMessage
-	if err := json.Unmarshal(shellyConfig, &configMap); err != nil {
-		result.Error = fmt.Errorf("failed to parse shelly config: %w", err)
-		return result
-	}
-
-	// Save each component configuration separately
+	// Read the config and status of every component with one paginated
+	// Shelly.GetComponents call. Firmware that leaves configs out of it gets
+	// Shelly.GetConfig streamed instead, saving each component as it is decoded.
 	configCount := 0
-	for componentKey, componentConfig := range configMap {
-		// Skip cloud config (read-only, only cloud can update)
-		if componentKey == "cloud" {
-			continue
+	var unknownComponents []string
+	saveConfig := func(componentKey string, componentConfig json.RawMessage) error {
+		saved, err := sm.savePulledConfig(device, componentKey, componentConfig)
+		if err != nil || !saved {
+			return err
 		}
-
-		// Skip script configs (managed separately in scripts folder)
-		if strings.HasPrefix(componentKey, "script:") {
-			continue
+		if !knownComponentTypes[componentType(componentKey)] {
+			unknownComponents = append(unknownComponents, componentKey)
 		}
+		configCount++
+		return nil
+	}
 
-		// componentKey format: "switch:0", "input:1", "sys", "wifi", etc.
-		// Convert to filename: "switch-0.json", "input-1.json", "sys.json", "wifi.json"
-		filename := strings.ReplaceAll(componentKey, ":", "-")
-
-		// Save component config
-		if err := sm.deviceStorage.SaveComponentConfig(device.Folder, filename, componentConfig); err != nil {
-			result.Error = fmt.Errorf("failed to save %s config: %w", filename, err)
-			return result
+	components, componentsErr := sm.shellyClient.GetComponentsIncluding(ctx, device.IPAddress, "config", "status")
+	if componentsErr == nil && hasComponentConfigs(components) {
+		for _, component := range components {
+			if err := saveConfig(component.Key, component.Config); err != nil {
+				result.Error = fmt.Errorf("failed to save shelly config: %w", err)
+				return result
+			}
+		}
+	} else if err := sm.shellyClient.StreamConfig(ctx, device.IPAddress, saveConfig); err != nil {
+		result.Error = fmt.Errorf("failed to get shelly config: %w", err)
+		return result
+	}
+	if err := sm.recordUnknownComponents(device, deviceInfo.FW, unknownComponents); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to record unknown components for %s: %v\n", device.Name, err)
+	}
+	if sm.captureStatus {
+		if err := sm.captureStatusSnapshot(ctx, device, components); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to capture status of %s: %v\n", device.Name, err)
 		}
-
-		configCount++
 	}
 
 	// Get and save scripts
 	scripts, err := sm.shellyClient.ListScripts(ctx, device.IPAddress)
 	scriptCount := 0
 	if err == nil {
+		templated := make(map[int]bool)
+		if local, err := sm.deviceStorage.ListScripts(device.Folder); err == nil {
+			for _, meta := range local {
+				templated[meta.ID] = meta.Templated
+			}
+		}
+
 		for _, script := range scripts {
+			// A rollback point left armed by an unconfirmed push isn't configuration
+			if script.Name == rollbackScriptName {
+				continue
+			}
+
 			code, err := sm.shellyClient.GetScriptCode(ctx, device.IPAddress, script.ID)
 			if err != nil {
 				continue
 			}
 
+			// Keep a templated script if the device runs a rendering of it
+			if templated[script.ID] {
+				if local, err := sm.deviceStorage.LoadScript(device.Folder, script.ID); err == nil && scriptMatchesTemplate(local, code) {
+					code = local
+				}
+			}
+
 			scriptCode := &shelly.ScriptCode{
 				ID:   script.ID,
 				Name: script.Name,
@@ -228,6 +430,7 @@ func (sm *SyncManager) pullDeviceConfig(ctx context.Context, device storage.Devi
 	scheduleCount := 0
 	if err == nil {
 		for _, schedule := range schedules {
+			schedule = schedule.Normalize()
 			if err := sm.deviceStorage.SaveSchedule(device.Folder, &schedule); err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: Failed to save schedule %d for %s: %v\n", schedule.ID, device.Name, err)
 				continue
@@ -244,6 +447,7 @@ func (sm *SyncManager) pullDeviceConfig(ctx context.Context, device storage.Devi
 	webhookCount := 0
 	if err == nil {
 		for _, webhook := range webhooks {
+			webhook = webhook.Normalize()
 			if err := sm.deviceStorage.SaveWebhook(device.Folder, &webhook); err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: Failed to save webhook %d for %s: %v\n", webhook.ID, device.Name, err)
 				continue
@@ -291,11 +495,14 @@ func (sm *SyncManager) pullDeviceConfig(ctx context.Context, device storage.Devi
 		fmt.Fprintf(os.Stderr, "Warning: Failed to get KVS data for %s: %v\n", device.Name, err)
 	}
 
-	// Get all components (including virtual components and groups)
-	components, err := sm.shellyClient.GetComponents(ctx, device.IPAddress)
+	// Save virtual components and groups from the components read above
+	if componentsErr != nil {
+		components, componentsErr = sm.shellyClient.GetComponents(ctx, device.IPAddress)
+	}
 	virtualComponentCount := 0
 	groupCount := 0
-	if err == nil {
+	if err := componentsErr; err == nil {
+		sm.cacheComponents(device.DeviceID, components)
 		for _, component := range components {
 			// Parse component key (e.g., "boolean:200", "number:201", "group:200")
 			parts := strings.SplitN(component.Key, ":", 2)
@@ -310,11 +517,9 @@ func (sm *SyncManager) pullDeviceConfig(ctx context.Context, device storage.Devi
 			// Check if this is a virtual component or group
 			// Virtual components typically have IDs >= 200 and include:
 			// boolean, number, text, enum, button, group
-			isVirtualComponent := componentType == "boolean" || componentType == "number" ||
-				componentType == "text" || componentType == "enum" || componentType == "button"
 			isGroup := componentType == "group"
 
-			if !isVirtualComponent && !isGroup {
+			if !isVirtualComponentType(componentType) {
 				// Skip non-virtual components (like input, switch, cover, etc.)
 				continue
 			}
@@ -369,6 +574,16 @@ func (sm *SyncManager) pullDeviceConfig(ctx context.Context, device storage.Devi
 	// Update last sync time
 	sm.manifest.UpdateLastSync(device.DeviceID, time.Now())
 
+	// Regenerate the human-readable summary from the files just written
+	if err := sm.GenerateDeviceReadme(device); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to write README for %s: %v\n", device.Name, err)
+	}
+
+	// Record what was pulled so out-of-band edits can be detected later
+	if err := sm.updateChecksums(device); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to write checksums for %s: %v\n", device.Name, err)
+	}
+
 	result.Success = true
 
 	// Build success message
@@ -388,6 +603,9 @@ func (sm *SyncManager) pullDeviceConfig(ctx context.Context, device storage.Devi
 	if kvsCount > 0 {
 		msgParts = append(msgParts, fmt.Sprintf("%d KVS item(s)", kvsCount))
 	}
+	if len(unknownComponents) > 0 {
+		msgParts = append(msgParts, fmt.Sprintf("%d unknown component(s)", len(unknownComponents)))
+	}
 
 	// Add virtual component and group counts
 	if virtualComponentCount > 0 {
@@ -406,68 +624,274 @@ func (sm *SyncManager) pullDeviceConfig(ctx context.Context, device storage.Devi
 	return result
 }
 
+// savePulledConfig writes a component config read from a device into the
+// device folder, keeping templated fields and applying redaction rules. It
+// reports false for components that aren't stored under configs/.
+func (sm *SyncManager) savePulledConfig(device storage.Device, componentKey string, componentConfig json.RawMessage) (bool, error) {
+	// Skip cloud config (read-only, only cloud can update)
+	if componentKey == "cloud" {
+		return false, nil
+	}
+
+	// Skip script configs (managed separately in scripts folder)
+	if strings.HasPrefix(componentKey, "script:") {
+		return false, nil
+	}
+
+	// componentKey format: "switch:0", "input:1", "sys", "wifi", etc.
+	// Convert to filename: "switch-0.json", "input-1.json", "sys.json", "wifi.json"
+	filename := strings.ReplaceAll(componentKey, ":", "-")
+
+	// Keep templated fields from the local file instead of their rendered device values
+	if localConfig, err := sm.deviceStorage.LoadComponentConfig(device.Folder, filename); err == nil {
+		var local, remote interface{}
+		if json.Unmarshal(localConfig, &local) == nil && json.Unmarshal(componentConfig, &remote) == nil {
+			if merged, err := json.Marshal(PreserveTemplates(local, remote)); err == nil {
+				componentConfig = merged
+			}
+		}
+	}
+
+	// Leave out fields the device changes on its own
+	if sm.volatileFields != nil {
+		var config interface{}
+		if err := json.Unmarshal(componentConfig, &config); err != nil {
+			return false, fmt.Errorf("failed to parse %s config: %w", filename, err)
+		}
+		data, err := json.Marshal(stripVolatile(sm.volatileFields, filename, config))
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal %s config: %w", filename, err)
+		}
+		componentConfig = data
+	}
+
+	// Replace or drop fields that must never be written to the repository
+	if sm.redactionRules != nil {
+		var config interface{}
+		if err := json.Unmarshal(componentConfig, &config); err != nil {
+			return false, fmt.Errorf("failed to parse %s config: %w", filename, err)
+		}
+		redacted, captured := redactComponent(sm.redactionRules, device.Folder, filename, config)
+		if err := sm.storeRedactedSecrets(captured); err != nil {
+			return false, fmt.Errorf("failed to store redacted %s secrets: %w", filename, err)
+		}
+		data, err := json.Marshal(redacted)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal %s config: %w", filename, err)
+		}
+		componentConfig = data
+	}
+
+	// Save component config
+	if err := sm.deviceStorage.SaveComponentConfig(device.Folder, filename, componentConfig); err != nil {
+		return false, fmt.Errorf("failed to save %s config: %w", filename, err)
+	}
+	return true, nil
+}
+
+// hasComponentConfigs reports whether Shelly.GetComponents returned the
+// configs of the device's components, which older firmware leaves out
+func hasComponentConfigs(components []shelly.ComponentInfo) bool {
+	for _, component := range components {
+		if component.Key == "sys" {
+			return len(component.Config) > 0 && string(component.Config) != "null"
+		}
+	}
+	return false
+}
+
 // PushToDevices applies current local configuration to devices
 // If deviceFilter is empty, pushes to all devices
-// If deviceFilter is provided, only pushes to devices matching the filter (by ID or name)
+// If deviceFilter is provided, only pushes to devices matching the filter (see SelectDevices)
 // If valuesFile is provided, it will be used for templating KVS values
 func (sm *SyncManager) PushToDevices(ctx context.Context, dryRun bool, deviceFilter []string, valuesFile string) ([]SyncResult, error) {
+	if !dryRun {
+		release, err := sm.LockRepo("push")
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		if err := sm.checkFreeze(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Load values file if provided
 	values, err := LoadValuesFile(valuesFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load values file: %w", err)
 	}
+	if err := sm.addSecretsToValues(values); err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+	if err := sm.addLibraryPins(values); err != nil {
+		return nil, err
+	}
+	if _, err := webhookHostRewriteFrom(values); err != nil {
+		return nil, err
+	}
 
 	// Build allDevices map for template context
 	allDevices := make(map[string]DeviceContext)
 	for _, device := range sm.manifest.Devices {
-		allDevices[device.DeviceID] = DeviceContext{
-			DeviceID:   device.DeviceID,
-			Name:       device.Name,
-			Model:      device.Model,
-			IPAddress:  device.IPAddress,
-			MACAddress: device.MACAddress,
-			Folder:     device.Folder,
-		}
+		allDevices[device.DeviceID] = deviceContextFor(device)
 	}
 
 	// Filter devices if a filter is provided
-	devicesToPush := sm.manifest.Devices
-	if len(deviceFilter) > 0 {
-		// Create a map for quick lookup
-		filterMap := make(map[string]bool)
-		for _, f := range deviceFilter {
-			filterMap[strings.ToLower(f)] = true
+	devicesToPush, skipped := sm.beginHealthTracking(sm.SelectDevices(deviceFilter))
+	defer sm.endHealthTracking()
+
+	// Refuse sweeping changes, e.g. from a bad merge, before touching any device
+	if !dryRun {
+		if err := sm.checkGuardrails(ctx, devicesToPush, values); err != nil {
+			return nil, err
 		}
+	}
 
-		// Filter devices
-		var filtered []storage.Device
-		for _, device := range sm.manifest.Devices {
-			// Match by device ID or name (case-insensitive)
-			if filterMap[strings.ToLower(device.DeviceID)] || filterMap[strings.ToLower(device.Name)] {
-				filtered = append(filtered, device)
-			}
+	// Journal every mutation so an interrupted run can be detected next time
+	var journal *Journal
+	var commit string
+	if !dryRun {
+		journal, err = LoadJournal(sm.journalPath())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load push journal: %w", err)
 		}
-		devicesToPush = filtered
+		commit, _ = sm.repo.HeadCommit()
+		devicesToPush = prioritizePending(devicesToPush, journal.Pending())
+	}
+
+	// Stop mutating the fleet once too many devices fail, as that usually means
+	// a systemic problem such as a bad template or a network outage
+	var failures *failureTracker
+	if sm.maxFailures != nil && !dryRun {
+		failures = &failureTracker{allowed: sm.maxFailures.allowed(len(devicesToPush))}
 	}
 
-	// Push to filtered devices in parallel
+	// Push to filtered devices in parallel, bounded like pulls
+	rebootCtx := ctx
 	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(sm.pushConcurrency(failures != nil))
 	results := make([]SyncResult, len(devicesToPush))
 
 	for i, device := range devicesToPush {
 		i, device := i, device
 		g.Go(func() error {
-			result := sm.pushDeviceConfig(ctx, device, dryRun, values, allDevices)
+			if failures != nil && failures.exceeded() {
+				results[i] = SyncResult{
+					DeviceID: device.DeviceID,
+					Error:    fmt.Errorf("skipped: failure budget exceeded"),
+				}
+				return nil
+			}
+			if journal != nil {
+				if err := journal.Begin(device.DeviceID, "push", commit); err != nil {
+					results[i] = SyncResult{DeviceID: device.DeviceID, Error: err}
+					return nil
+				}
+			}
+			result := sm.pushDeviceConfig(shelly.WithTraceOperation(ctx, "push"), device, dryRun, values, allDevices)
+			if journal != nil {
+				// Only a device that took every component is complete; any
+				// other is pushed again first on the next run
+				opErr := result.Error
+				if !result.Success && opErr == nil {
+					opErr = fmt.Errorf("push incomplete")
+				}
+				if err := journal.Complete(device.DeviceID, opErr); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: Failed to update push journal for %s: %v\n", device.Name, err)
+				}
+			}
+			if failures != nil && !result.Success && failures.record() {
+				fmt.Fprintf(os.Stderr, "Error: Failure budget of %s exceeded, skipping remaining devices\n", sm.maxFailures)
+			}
 			results[i] = result
 			return nil
 		})
 	}
 
 	if err := g.Wait(); err != nil {
-		return results, err
+		return append(results, skipped...), err
 	}
 
-	return results, nil
+	if failures != nil && failures.exceeded() {
+		return append(results, skipped...), fmt.Errorf("push aborted: more than %s devices failed", sm.maxFailures)
+	}
+
+	if sm.rebootIfNeeded != nil && !dryRun {
+		sm.rebootPushed(rebootCtx, devicesToPush, results)
+	}
+
+	return append(results, skipped...), nil
+}
+
+// prioritizePending moves devices with interrupted or failed journal entries to
+// the front so they are re-pushed first
+func prioritizePending(devices []storage.Device, pending []JournalEntry) []storage.Device {
+	if len(pending) == 0 {
+		return devices
+	}
+
+	pendingIDs := make(map[string]JournalEntry)
+	for _, entry := range pending {
+		pendingIDs[entry.DeviceID] = entry
+	}
+
+	var first, rest []storage.Device
+	for _, device := range devices {
+		if entry, ok := pendingIDs[device.DeviceID]; ok {
+			if entry.Status == JournalInProgress {
+				fmt.Fprintf(os.Stderr, "Warning: Previous %s to %s was interrupted at %s, device state is unknown - re-pushing first\n",
+					entry.Operation, device.Name, entry.StartedAt.Format(time.RFC3339))
+			}
+			first = append(first, device)
+			continue
+		}
+		rest = append(rest, device)
+	}
+
+	return append(first, rest...)
+}
+
+// newPendingConfig builds the SetConfig call for a rendered component config
+func newPendingConfig(componentFile string, config map[string]interface{}) pendingConfig {
+	// Parse component filename: "switch-0" -> component="Switch", id=0
+	// or "sys" -> component="Sys", id=-1 (no id)
+	var componentName string
+	var componentID int = -1
+
+	if strings.Contains(componentFile, "-") {
+		// Has ID: "switch-0", "input-1"
+		parts := strings.SplitN(componentFile, "-", 2)
+		componentName = strings.Title(parts[0])
+		fmt.Sscanf(parts[1], "%d", &componentID)
+	} else {
+		// No ID: "sys", "wifi", "cloud"
+		componentName = strings.Title(componentFile)
+	}
+
+	// Build params for SetConfig
+	var params map[string]interface{}
+	if componentID >= 0 {
+		// Component with ID: {"id": 0, "config": {...}}
+		params = map[string]interface{}{
+			"id":     componentID,
+			"config": config,
+		}
+	} else {
+		// Component without ID: {"config": {...}}
+		params = map[string]interface{}{
+			"config": config,
+		}
+	}
+
+	return pendingConfig{
+		file:      componentFile,
+		key:       strings.Replace(componentFile, "-", ":", 1),
+		component: componentName,
+		params:    params,
+		config:    config,
+	}
 }
 
 // pushDeviceConfig pushes configuration to a single device
@@ -488,16 +912,43 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 		return result
 	}
 
+	// Don't push a device's configuration onto different hardware
+	if info, err := sm.shellyClient.GetDeviceInfo(ctx, device.IPAddress); err == nil {
+		if swap := detectDeviceSwap(device, info); swap != nil {
+			alertDeviceSwap(swap)
+			result.Error = swap
+			return result
+		}
+		metadata, _ := sm.deviceStorage.LoadDeviceMetadata(device.Folder)
+		if err := checkModelRemapped(device, metadata, info.Model); err != nil {
+			result.Error = err
+			return result
+		}
+	}
+
+	// Cached components and device info are stale once the device is changed
+	defer sm.InvalidateDeviceCache(device.DeviceID)
+
+	// Record the config before the push, so RollbackPush can restore it
+	snapshot, err := sm.capturePushSnapshot(ctx, device)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to record pre-push snapshot of %s, rollback won't be possible: %v\n", device.Name, err)
+	}
+
 	// Create template context with device information
-	currentDevice := DeviceContext{
-		DeviceID:   device.DeviceID,
-		Name:       device.Name,
-		Model:      device.Model,
-		IPAddress:  device.IPAddress,
-		MACAddress: device.MACAddress,
-		Folder:     device.Folder,
+	templateContext := CreateTemplateContext(values, deviceContextFor(device), allDevices)
+
+	// Components that fail are reported as they happen and fail the device
+	// once the rest is pushed
+	var failed []string
+
+	// Create/delete virtual components declared in virtual-components.yaml
+	// before configs, so configs for newly created components can be applied
+	virtualCreated, virtualDeleted, err := sm.applyVirtualComponents(ctx, device)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to reconcile virtual components: %v%s\n", err, hintSuffix(err))
+		failed = append(failed, "virtual components")
 	}
-	templateContext := CreateTemplateContext(values, currentDevice, allDevices)
 
 	// Push component configs
 	componentFiles, err := sm.deviceStorage.ListComponentConfigs(device.Folder)
@@ -506,7 +957,7 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 		return result
 	}
 
-	configCount := 0
+	var pending []pendingConfig
 	for _, componentFile := range componentFiles {
 		// Skip cloud config (read-only, only cloud can update)
 		if componentFile == "cloud" {
@@ -518,56 +969,49 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 			continue
 		}
 
-		configData, err := sm.deviceStorage.LoadComponentConfig(device.Folder, componentFile)
+		// Load config with its merge patch (configs/<component>.patch.json) applied
+		rawConfig, _, err := sm.loadDesiredConfig(device, componentFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: Failed to load config %s: %v\n", componentFile, err)
+			failed = append(failed, "config "+componentFile)
 			continue
 		}
 
-		// Parse config
-		var config map[string]interface{}
-		if err := json.Unmarshal(configData, &config); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Failed to parse config %s: %v\n", componentFile, err)
+		// Render templated fields (strings, and numbers/booleans via "| int", "| float", "| bool")
+		rendered, templatedCount, err := RenderConfigTemplates(rawConfig, templateContext)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to render templates in config %s: %v\n", componentFile, err)
+			failed = append(failed, "config "+componentFile)
 			continue
 		}
+		config := rendered.(map[string]interface{})
+		if templatedCount > 0 {
+			fmt.Fprintf(os.Stderr, "Info: Rendered %d template(s) in config %s\n", templatedCount, componentFile)
+		}
 
-		// Parse component filename: "switch-0" -> component="Switch", id=0
-		// or "sys" -> component="Sys", id=-1 (no id)
-		var componentName string
-		var componentID int = -1
+		pending = append(pending, newPendingConfig(componentFile, config))
+	}
 
-		if strings.Contains(componentFile, "-") {
-			// Has ID: "switch-0", "input-1"
-			parts := strings.SplitN(componentFile, "-", 2)
-			componentName = strings.Title(parts[0])
-			fmt.Sscanf(parts[1], "%d", &componentID)
-		} else {
-			// No ID: "sys", "wifi", "cloud"
-			componentName = strings.Title(componentFile)
-		}
+	// Network changes can cut the device off, so let it restore itself
+	rollback := sm.armRollbackPoint(ctx, device, pending)
 
-		// Build params for SetConfig
-		var params map[string]interface{}
-		if componentID >= 0 {
-			// Component with ID: {"id": 0, "config": {...}}
-			params = map[string]interface{}{
-				"id":     componentID,
-				"config": config,
-			}
-		} else {
-			// Component without ID: {"config": {...}}
-			params = map[string]interface{}{
-				"config": config,
-			}
-		}
+	// Apply configs, in a single Shelly.SetConfig call where the firmware supports it
+	configCount, restartRequired := sm.applyComponentConfigs(ctx, device, pending)
+	result.RestartRequired = restartRequired
+	if unapplied := len(pending) - configCount; unapplied > 0 {
+		failed = append(failed, fmt.Sprintf("%d config(s)", unapplied))
+	}
 
-		// Apply config
-		if err := sm.shellyClient.SetComponentConfig(ctx, device.IPAddress, componentName, params); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Failed to set %s config: %v\n", componentFile, err)
-			continue
+	if rollback != nil {
+		if err := sm.confirmRollbackPoint(ctx, device, rollback); err != nil {
+			result.Error = err
+			return result
+		}
+	}
+	if snapshot != nil {
+		if err := sm.savePushSnapshot(ctx, device, snapshot); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to save pre-push snapshot of %s: %v\n", device.Name, err)
 		}
-
-		configCount++
 	}
 
 	// Push scripts
@@ -580,7 +1024,8 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 	// Get device scripts once for comparison
 	deviceScripts, err := sm.shellyClient.ListScripts(ctx, device.IPAddress)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to list device scripts: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: Failed to list device scripts: %v%s\n", err, hintSuffix(err))
+		failed = append(failed, "scripts")
 		deviceScripts = []shelly.Script{} // Continue with empty list
 	}
 
@@ -589,6 +1034,20 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 		code, err := sm.deviceStorage.LoadScript(device.Folder, scriptMeta.ID)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: Failed to load script %d: %v\n", scriptMeta.ID, err)
+			failed = append(failed, fmt.Sprintf("script %d", scriptMeta.ID))
+			continue
+		}
+		if scriptMeta.Templated {
+			code, err = RenderTemplate(code, templateContext)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to render script %d: %v\n", scriptMeta.ID, err)
+				failed = append(failed, fmt.Sprintf("script %d", scriptMeta.ID))
+				continue
+			}
+		}
+		if err := sm.checkScriptCode(code); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s/scripts/script-%d.js: %v, not uploaded\n", device.Folder, scriptMeta.ID, err)
+			failed = append(failed, fmt.Sprintf("script %d", scriptMeta.ID))
 			continue
 		}
 
@@ -607,27 +1066,31 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 			// Create script
 			id, err := sm.shellyClient.CreateScript(ctx, device.IPAddress, scriptMeta.Name)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: Failed to create script %s: %v\n", scriptMeta.Name, err)
+				fmt.Fprintf(os.Stderr, "Error: Failed to create script %s: %v%s\n", scriptMeta.Name, err, hintSuffix(err))
+				failed = append(failed, fmt.Sprintf("script %d", scriptMeta.ID))
 				continue
 			}
 			scriptMeta.ID = id
 		} else if existingScript.Running {
 			// Script is running, stop it before uploading
 			if err := sm.shellyClient.StopScript(ctx, device.IPAddress, scriptMeta.ID); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: Failed to stop running script %d: %v\n", scriptMeta.ID, err)
+				fmt.Fprintf(os.Stderr, "Error: Failed to stop running script %d: %v%s\n", scriptMeta.ID, err, hintSuffix(err))
+				failed = append(failed, fmt.Sprintf("script %d", scriptMeta.ID))
 				continue
 			}
 		}
 
 		// Upload script code
 		if err := sm.shellyClient.PutScriptCode(ctx, device.IPAddress, scriptMeta.ID, code, false); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Failed to upload script %d: %v\n", scriptMeta.ID, err)
+			fmt.Fprintf(os.Stderr, "Error: Failed to upload script %d: %v%s\n", scriptMeta.ID, err, hintSuffix(err))
+			failed = append(failed, fmt.Sprintf("script %d", scriptMeta.ID))
 			continue
 		}
 
 		// Set script config (name and enable state from metadata)
 		if err := sm.shellyClient.SetScriptConfig(ctx, device.IPAddress, scriptMeta.ID, scriptMeta.Name, scriptMeta.Enable); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Failed to set script %d config: %v\n", scriptMeta.ID, err)
+			fmt.Fprintf(os.Stderr, "Error: Failed to set script %d config: %v%s\n", scriptMeta.ID, err, hintSuffix(err))
+			failed = append(failed, fmt.Sprintf("script %d", scriptMeta.ID))
 			continue
 		}
 
@@ -653,7 +1116,8 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 	// Get device schedules for comparison
 	deviceSchedules, err := sm.shellyClient.ListSchedules(ctx, device.IPAddress)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to list device schedules: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: Failed to list device schedules: %v%s\n", err, hintSuffix(err))
+		failed = append(failed, "schedules")
 		deviceSchedules = []shelly.Schedule{}
 	}
 
@@ -669,30 +1133,41 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 	}
 
 	scheduleCount := 0
+	keptSchedules := make(map[int]bool) // device schedules matched by content
 
 	// Update or create schedules from local files
 	for _, localSchedule := range localSchedules {
-		if _, exists := deviceScheduleMap[localSchedule.ID]; exists {
+		if deviceSchedule, exists := deviceScheduleMap[localSchedule.ID]; exists {
+			// Leave schedules alone that only differ by device-side defaults
+			if shelly.SchedulesEqual(*localSchedule, deviceSchedule) {
+				scheduleCount++
+				continue
+			}
 			// Update existing schedule
-			if err := sm.shellyClient.UpdateSchedule(ctx, device.IPAddress, *localSchedule); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: Failed to update schedule %d: %v\n", localSchedule.ID, err)
+			if err := sm.shellyClient.UpdateSchedule(ctx, device.IPAddress, localSchedule.Normalize()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to update schedule %d: %v%s\n", localSchedule.ID, err, hintSuffix(err))
+				failed = append(failed, fmt.Sprintf("schedule %d", localSchedule.ID))
 				continue
 			}
 		} else {
-			// Create new schedule
-			if _, err := sm.shellyClient.CreateSchedule(ctx, device.IPAddress, *localSchedule); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: Failed to create schedule: %v\n", err)
+			// Create new schedule, reusing an identical one so retries never duplicate it
+			id, _, err := sm.shellyClient.EnsureSchedule(ctx, device.IPAddress, localSchedule.Normalize())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to create schedule: %v%s\n", err, hintSuffix(err))
+				failed = append(failed, fmt.Sprintf("schedule %d", localSchedule.ID))
 				continue
 			}
+			keptSchedules[id] = true
 		}
 		scheduleCount++
 	}
 
 	// Delete schedules that don't exist locally
 	for _, deviceSchedule := range deviceSchedules {
-		if _, exists := localScheduleMap[deviceSchedule.ID]; !exists {
+		if _, exists := localScheduleMap[deviceSchedule.ID]; !exists && !keptSchedules[deviceSchedule.ID] {
 			if err := sm.shellyClient.DeleteSchedule(ctx, device.IPAddress, deviceSchedule.ID); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: Failed to delete schedule %d: %v\n", deviceSchedule.ID, err)
+				fmt.Fprintf(os.Stderr, "Error: Failed to delete schedule %d: %v%s\n", deviceSchedule.ID, err, hintSuffix(err))
+				failed = append(failed, fmt.Sprintf("schedule %d", deviceSchedule.ID))
 			}
 		}
 	}
@@ -704,13 +1179,40 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 		localWebhooks = []*shelly.Webhook{}
 	}
 
+	// Point webhooks at the host of the environment being pushed to
+	if rewrite, _ := webhookHostRewriteFrom(values); rewrite != nil {
+		for _, localWebhook := range localWebhooks {
+			rewrite.apply(localWebhook)
+		}
+	}
+
 	// Get device webhooks for comparison
 	deviceWebhooks, err := sm.shellyClient.ListWebhooks(ctx, device.IPAddress)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to list device webhooks: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: Failed to list device webhooks: %v%s\n", err, hintSuffix(err))
+		failed = append(failed, "webhooks")
 		deviceWebhooks = []shelly.Webhook{}
 	}
 
+	// Check webhook definitions against the events the device offers, or the
+	// known events if it can't list them
+	supportedEvents, _ := sm.shellyClient.ListSupportedWebhookEvents(ctx, device.IPAddress)
+	hasComponent := make(map[string]bool, len(componentFiles))
+	for _, componentFile := range componentFiles {
+		hasComponent[componentFile] = true
+	}
+	invalidWebhooks := make(map[int]bool)
+	for _, localWebhook := range localWebhooks {
+		problems := checkWebhook(localWebhook, func(component string) bool { return hasComponent[component] }, supportedEvents)
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "Error: %s: %s\n", path.Join(device.Folder, "webhooks", fmt.Sprintf("webhook-%d.json", localWebhook.ID)), problem)
+		}
+		invalidWebhooks[localWebhook.ID] = len(problems) > 0
+		if len(problems) > 0 {
+			failed = append(failed, fmt.Sprintf("webhook %d", localWebhook.ID))
+		}
+	}
+
 	// Create maps for easier lookup
 	deviceWebhookMap := make(map[int]shelly.Webhook)
 	for _, dw := range deviceWebhooks {
@@ -723,30 +1225,44 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 	}
 
 	webhookCount := 0
+	keptWebhooks := make(map[int]bool) // device webhooks matched by content
 
 	// Update or create webhooks from local files
 	for _, localWebhook := range localWebhooks {
-		if _, exists := deviceWebhookMap[localWebhook.ID]; exists {
+		if invalidWebhooks[localWebhook.ID] {
+			continue
+		}
+		if deviceWebhook, exists := deviceWebhookMap[localWebhook.ID]; exists {
+			// Leave webhooks alone that only differ by device-side defaults
+			if shelly.WebhooksEqual(*localWebhook, deviceWebhook) {
+				webhookCount++
+				continue
+			}
 			// Update existing webhook
-			if err := sm.shellyClient.UpdateWebhook(ctx, device.IPAddress, *localWebhook); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: Failed to update webhook %d: %v\n", localWebhook.ID, err)
+			if err := sm.shellyClient.UpdateWebhook(ctx, device.IPAddress, localWebhook.Normalize()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to update webhook %d: %v%s\n", localWebhook.ID, err, hintSuffix(err))
+				failed = append(failed, fmt.Sprintf("webhook %d", localWebhook.ID))
 				continue
 			}
 		} else {
-			// Create new webhook
-			if _, err := sm.shellyClient.CreateWebhook(ctx, device.IPAddress, *localWebhook); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: Failed to create webhook: %v\n", err)
+			// Create new webhook, reusing an identical one so retries never duplicate it
+			id, _, err := sm.shellyClient.EnsureWebhook(ctx, device.IPAddress, localWebhook.Normalize())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to create webhook: %v%s\n", err, hintSuffix(err))
+				failed = append(failed, fmt.Sprintf("webhook %d", localWebhook.ID))
 				continue
 			}
+			keptWebhooks[id] = true
 		}
 		webhookCount++
 	}
 
 	// Delete webhooks that don't exist locally
 	for _, deviceWebhook := range deviceWebhooks {
-		if _, exists := localWebhookMap[deviceWebhook.ID]; !exists {
+		if _, exists := localWebhookMap[deviceWebhook.ID]; !exists && !keptWebhooks[deviceWebhook.ID] {
 			if err := sm.shellyClient.DeleteWebhook(ctx, device.IPAddress, deviceWebhook.ID); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: Failed to delete webhook %d: %v\n", deviceWebhook.ID, err)
+				fmt.Fprintf(os.Stderr, "Error: Failed to delete webhook %d: %v%s\n", deviceWebhook.ID, err, hintSuffix(err))
+				failed = append(failed, fmt.Sprintf("webhook %d", deviceWebhook.ID))
 			}
 		}
 	}
@@ -768,12 +1284,14 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 			renderedValue, wasTemplated, err := RenderKVSValue(value, templateContext)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: Failed to render template for KVS key %s: %v\n", key, err)
+				failed = append(failed, "KVS key "+key)
 				continue
 			}
 
 			// Use rendered value for push
 			if err := sm.shellyClient.SetKVS(ctx, device.IPAddress, key, renderedValue); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: Failed to set KVS key %s: %v\n", key, err)
+				fmt.Fprintf(os.Stderr, "Error: Failed to set KVS key %s: %v%s\n", key, err, hintSuffix(err))
+				failed = append(failed, "KVS key "+key)
 				continue
 			}
 
@@ -788,13 +1306,24 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 		for key := range deviceKVS {
 			if _, exists := localKVS[key]; !exists {
 				if err := sm.shellyClient.DeleteKVS(ctx, device.IPAddress, key); err != nil {
-					result.Message = fmt.Sprintf("failed to delete KVS key %s: %v", key, err)
+					fmt.Fprintf(os.Stderr, "Error: Failed to delete KVS key %s: %v%s\n", key, err, hintSuffix(err))
+					failed = append(failed, "KVS key "+key)
 				}
 			}
 		}
 	}
 
-	result.Success = true
+	// Record what was pushed so out-of-band edits can be detected later
+	if len(failed) == 0 {
+		if err := sm.updateChecksums(device); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to write checksums for %s: %v\n", device.Name, err)
+		}
+	}
+
+	result.Success = len(failed) == 0
+	if !result.Success {
+		result.Error = fmt.Errorf("failed to push %s", strings.Join(failed, ", "))
+	}
 
 	// Build success message
 	var msgParts []string
@@ -813,19 +1342,80 @@ func (sm *SyncManager) pushDeviceConfig(ctx context.Context, device storage.Devi
 	if kvsCount > 0 {
 		msgParts = append(msgParts, fmt.Sprintf("%d KVS item(s)", kvsCount))
 	}
+	if virtualCreated > 0 {
+		msgParts = append(msgParts, fmt.Sprintf("created %d virtual component(s)", virtualCreated))
+	}
+	if virtualDeleted > 0 {
+		msgParts = append(msgParts, fmt.Sprintf("deleted %d virtual component(s)", virtualDeleted))
+	}
 
 	if len(msgParts) > 0 {
 		result.Message = fmt.Sprintf("pushed %s", strings.Join(msgParts, ", "))
 	} else {
 		result.Message = "pushed to device"
 	}
+	if len(restartRequired) > 0 {
+		result.Message += fmt.Sprintf("; reboot required for %s", strings.Join(restartRequired, ", "))
+	}
 
 	return result
 }
 
+// DiscoverOptions narrows which discovered devices are added to the manifest
+type DiscoverOptions struct {
+	FilterPattern string // Hostname pattern passed to the provider (e.g. "shelly*")
+	Network       string // Only add devices on this network name or VLAN ID (e.g. "iot")
+	Baselines     bool   // Seed new device folders from baselines/<model> (see SeedFromBaseline)
+}
+
+// newDiscoveredDevice creates the manifest entry for a discovered device
+func newDiscoveredDevice(deviceInfo discovery.DeviceInfo, shellyInfo *shelly.DeviceInfo) storage.Device {
+	deviceName := strings.ToLower(deviceInfo.Hostname)
+	return storage.Device{
+		DeviceID:   shellyInfo.ID,
+		Name:       deviceName,
+		Folder:     storage.DeviceFolderName(deviceName, shellyInfo.ID),
+		IPAddress:  deviceInfo.IPAddress,
+		MACAddress: deviceInfo.MACAddress,
+		Model:      shellyInfo.Model,
+		LastSync:   time.Now(),
+		Network:    deviceInfo.Network,
+		VLAN:       deviceInfo.VLAN,
+	}
+}
+
+// adoptDevice adds a new device to the manifest (without saving it), creates
+// its folder and pulls its initial configuration
+func (sm *SyncManager) adoptDevice(ctx context.Context, device storage.Device, opts DiscoverOptions) {
+	// Add to manifest
+	sm.manifest.AddDevice(device)
+
+	// Create device folder
+	sm.deviceStorage.CreateDeviceFolder(device.Folder)
+
+	// Pull initial configuration
+	sm.pullDeviceConfig(ctx, device)
+
+	// Start from the model baseline rather than factory settings
+	if opts.Baselines {
+		changes, err := sm.SeedFromBaseline(device)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to seed %s from baseline: %v\n", device.Name, err)
+		}
+		printBaselineChanges(device, changes)
+	}
+}
+
 // DiscoverAndAdd discovers devices and adds them to the manifest
 func (sm *SyncManager) DiscoverAndAdd(ctx context.Context, provider discovery.Provider, filterPattern string) ([]storage.Device, error) {
-	devices, err := provider.DiscoverDevices(ctx, filterPattern)
+	return sm.DiscoverAndAddWithOptions(ctx, provider, DiscoverOptions{FilterPattern: filterPattern})
+}
+
+// DiscoverAndAddWithOptions discovers devices and adds those matching opts to the manifest
+func (sm *SyncManager) DiscoverAndAddWithOptions(ctx context.Context, provider discovery.Provider, opts DiscoverOptions) ([]storage.Device, error) {
+	start := time.Now()
+	devices, err := provider.DiscoverDevices(ctx, opts.FilterPattern)
+	sm.timings.record(StageDiscovery, "DiscoverDevices", "", time.Since(start))
 	if err != nil {
 		return nil, fmt.Errorf("discovery failed: %w", err)
 	}
@@ -838,6 +1428,10 @@ func (sm *SyncManager) DiscoverAndAdd(ctx context.Context, provider discovery.Pr
 			continue
 		}
 
+		if !deviceInfo.OnNetwork(opts.Network) {
+			continue
+		}
+
 		// Check if device already exists
 		if sm.manifest.GetDeviceByIP(deviceInfo.IPAddress) != nil {
 			continue
@@ -850,28 +1444,8 @@ func (sm *SyncManager) DiscoverAndAdd(ctx context.Context, provider discovery.Pr
 			continue
 		}
 
-		// Create device entry
-		deviceName := strings.ToLower(deviceInfo.Hostname)
-		folderName := fmt.Sprintf("%s-%s", deviceName, shellyInfo.ID)
-
-		device := storage.Device{
-			DeviceID:   shellyInfo.ID,
-			Name:       deviceName,
-			Folder:     folderName,
-			IPAddress:  deviceInfo.IPAddress,
-			MACAddress: deviceInfo.MACAddress,
-			Model:      shellyInfo.Model,
-			LastSync:   time.Now(),
-		}
-
-		// Add to manifest
-		sm.manifest.AddDevice(device)
-
-		// Create device folder
-		sm.deviceStorage.CreateDeviceFolder(folderName)
-
-		// Pull initial configuration
-		sm.pullDeviceConfig(ctx, device)
+		device := newDiscoveredDevice(deviceInfo, shellyInfo)
+		sm.adoptDevice(ctx, device, opts)
 
 		addedDevices = append(addedDevices, device)
 	}
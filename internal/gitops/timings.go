@@ -0,0 +1,198 @@
+package gitops
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timing stages
+const (
+	StageDiscovery = "discovery" // discovery provider queries
+	StageRPC       = "rpc"       // device RPC calls
+	StageFileIO    = "file_io"   // device folder reads and writes
+	StageGit       = "git"       // git status, add, commit, push and log
+)
+
+// slowestDevices is how many devices TimingReport.String lists
+const slowestDevices = 10
+
+// StageStats aggregates the durations of one stage or operation
+type StageStats struct {
+	Count int           `json:"count"`
+	Total time.Duration `json:"total_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+// Mean returns the average duration
+func (s StageStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// add records one duration
+func (s *StageStats) add(d time.Duration) {
+	s.Count++
+	s.Total += d
+	if d > s.Max {
+		s.Max = d
+	}
+}
+
+// TimingReport breaks down where a sync manager spent its time since it was
+// created or its timings were last reset
+type TimingReport struct {
+	Since time.Time `json:"since"`
+
+	// Stages holds the totals per stage (see the Stage constants)
+	Stages map[string]StageStats `json:"stages"`
+
+	// Operations breaks stages down, e.g. "rpc Shelly.GetConfig", "git commit"
+	// or "file_io write"
+	Operations map[string]StageStats `json:"operations"`
+
+	// Devices holds the RPC time per device address
+	Devices map[string]StageStats `json:"devices"`
+}
+
+// timings collects stage durations; it is safe for concurrent use
+type timings struct {
+	mu     sync.Mutex
+	report TimingReport
+}
+
+// newTimings creates an empty collector
+func newTimings() *timings {
+	t := &timings{}
+	t.reset()
+	return t
+}
+
+// reset discards everything recorded so far
+func (t *timings) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.report = TimingReport{
+		Since:      time.Now(),
+		Stages:     make(map[string]StageStats),
+		Operations: make(map[string]StageStats),
+		Devices:    make(map[string]StageStats),
+	}
+}
+
+// record adds a duration to a stage, its operation and, if set, a device address
+func (t *timings) record(stage, operation, deviceIP string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	add := func(m map[string]StageStats, key string) {
+		stats := m[key]
+		stats.add(d)
+		m[key] = stats
+	}
+	add(t.report.Stages, stage)
+	if operation != "" {
+		add(t.report.Operations, stage+" "+operation)
+	}
+	if deviceIP != "" {
+		add(t.report.Devices, deviceIP)
+	}
+}
+
+// snapshot returns a copy of the report
+func (t *timings) snapshot() TimingReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	copyStats := func(m map[string]StageStats) map[string]StageStats {
+		c := make(map[string]StageStats, len(m))
+		for key, stats := range m {
+			c[key] = stats
+		}
+		return c
+	}
+	return TimingReport{
+		Since:      t.report.Since,
+		Stages:     copyStats(t.report.Stages),
+		Operations: copyStats(t.report.Operations),
+		Devices:    copyStats(t.report.Devices),
+	}
+}
+
+// Timings returns the per-stage timing breakdown recorded so far
+func (sm *SyncManager) Timings() TimingReport {
+	return sm.timings.snapshot()
+}
+
+// observeCall records an RPC call in the device health and the timings; it
+// matches the shelly.CallObserver signature
+func (sm *SyncManager) observeCall(deviceIP, method string, duration time.Duration, err error) {
+	sm.health.Observe(deviceIP, method, duration, err)
+	sm.timings.record(StageRPC, method, deviceIP, duration)
+}
+
+// ResetTimings discards the recorded timings, e.g. before timing a single pull
+func (sm *SyncManager) ResetTimings() {
+	sm.timings.reset()
+}
+
+// String renders the stages, the operations of each stage and the devices
+// with the most RPC time
+func (r TimingReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Timings since %s:\n", r.Since.Format(time.RFC3339))
+
+	stages := sortedByTotal(r.Stages)
+	for _, stage := range stages {
+		writeStats(&b, "  ", stage, r.Stages[stage])
+
+		prefix := stage + " "
+		var operations []string
+		for _, op := range sortedByTotal(r.Operations) {
+			if strings.HasPrefix(op, prefix) {
+				operations = append(operations, op)
+			}
+		}
+		for _, op := range operations {
+			writeStats(&b, "    ", strings.TrimPrefix(op, prefix), r.Operations[op])
+		}
+	}
+
+	devices := sortedByTotal(r.Devices)
+	if len(devices) > 0 {
+		fmt.Fprintf(&b, "Slowest devices (RPC time):\n")
+		if len(devices) > slowestDevices {
+			devices = devices[:slowestDevices]
+		}
+		for _, device := range devices {
+			writeStats(&b, "  ", device, r.Devices[device])
+		}
+	}
+
+	return b.String()
+}
+
+// sortedByTotal returns the keys of m with the largest total first
+func sortedByTotal(m map[string]StageStats) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]].Total != m[keys[j]].Total {
+			return m[keys[i]].Total > m[keys[j]].Total
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// writeStats writes one line of the timing table
+func writeStats(b *strings.Builder, indent, name string, stats StageStats) {
+	fmt.Fprintf(b, "%s%-28s %6d calls  total %-10s mean %-10s max %s\n", indent, name, stats.Count,
+		stats.Total.Round(time.Microsecond), stats.Mean().Round(time.Microsecond), stats.Max.Round(time.Microsecond))
+}
@@ -0,0 +1,50 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StartTrace records every RPC request and response of this run, with secrets
+// redacted, to a JSON Lines file. An empty path writes to
+// .git/shelly-gitops/traces/<timestamp>.jsonl. It returns the file used.
+func (sm *SyncManager) StartTrace(path string) (string, error) {
+	if path == "" {
+		path = filepath.Join(sm.StateDir(), "traces", time.Now().Format("20060102-150405")+".jsonl")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create trace directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to open trace file: %w", err)
+	}
+
+	if err := sm.StopTrace(); err != nil {
+		file.Close()
+		return "", err
+	}
+	sm.traceFile = file
+	sm.shellyClient.SetTrace(file)
+
+	return path, nil
+}
+
+// StopTrace stops tracing and closes the trace file
+func (sm *SyncManager) StopTrace() error {
+	if sm.traceFile == nil {
+		return nil
+	}
+
+	sm.shellyClient.SetTrace(nil)
+	err := sm.traceFile.Close()
+	sm.traceFile = nil
+	if err != nil {
+		return fmt.Errorf("failed to close trace file: %w", err)
+	}
+	return nil
+}
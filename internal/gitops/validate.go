@@ -0,0 +1,208 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"text/template"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// ValidationIssue is a problem found in the repository by Validate
+type ValidationIssue struct {
+	DeviceID string `json:"device_id,omitempty"`
+	File     string `json:"file"`
+	Message  string `json:"message"`
+}
+
+// String formats the issue for terminal output
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.File, i.Message)
+}
+
+// Validate checks the repository without contacting devices: manifest folders,
+// JSON syntax of component configs, merge patches and KVS data, template
+// syntax (including manifest defaults), schedule timespecs, webhook events,
+// components and URLs, script syntax and size, virtual component specs,
+// redaction rules, freeze windows, the firmware rollout policy, output
+// templates and unpinned URLs fetched by scripts.
+// It is meant to run from a pre-commit hook.
+func (sm *SyncManager) Validate() []ValidationIssue {
+	var issues []ValidationIssue
+
+	for _, issue := range sm.manifest.PortabilityIssues() {
+		issues = append(issues, ValidationIssue{File: "manifest", Message: issue})
+	}
+
+	if _, _, _, err := resolveFirmwarePolicy(sm.manifest.Firmware); err != nil {
+		issues = append(issues, ValidationIssue{File: "manifest", Message: err.Error()})
+	}
+
+	for key, defaults := range sm.manifest.Defaults {
+		for _, templateErr := range checkTemplates(defaults, "defaults."+key) {
+			issues = append(issues, ValidationIssue{File: "manifest", Message: templateErr})
+		}
+	}
+
+	if _, err := storage.LoadRedactionRules(sm.repoPath); err != nil {
+		issues = append(issues, ValidationIssue{File: "redaction.yaml", Message: err.Error()})
+	}
+
+	if _, err := storage.LoadFreezeWindows(sm.repoPath); err != nil {
+		issues = append(issues, ValidationIssue{File: "freeze", Message: err.Error()})
+	}
+
+	issues = append(issues, sm.checkOutputTemplates()...)
+
+	pins, err := storage.LoadScriptPins(sm.repoPath)
+	if err != nil {
+		issues = append(issues, ValidationIssue{File: "script-pins.yaml", Message: err.Error()})
+		pins = &storage.ScriptPins{}
+	}
+
+	for _, device := range sm.manifest.Devices {
+		issues = append(issues, sm.validateDevice(device)...)
+		issues = append(issues, sm.checkScriptPins(device, pins)...)
+	}
+
+	return issues
+}
+
+// validateDevice checks the files of a single device folder
+func (sm *SyncManager) validateDevice(device storage.Device) []ValidationIssue {
+	var issues []ValidationIssue
+	add := func(file, format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{
+			DeviceID: device.DeviceID,
+			File:     path.Join(device.Folder, file),
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if !sm.deviceStorage.DeviceExists(device.Folder) {
+		add("", "device folder does not exist")
+		return issues
+	}
+
+	components, err := sm.deviceStorage.ListComponentConfigs(device.Folder)
+	if err != nil {
+		add("configs", "%v", err)
+	}
+	for _, component := range components {
+		file := "configs/" + component + ".json"
+		data, err := sm.deviceStorage.LoadComponentConfig(device.Folder, component)
+		if err != nil {
+			add(file, "%v", err)
+			continue
+		}
+		var config interface{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			add(file, "invalid JSON: %v", err)
+			continue
+		}
+		for _, templateErr := range checkTemplates(config, "") {
+			add(file, "%s", templateErr)
+		}
+	}
+
+	patches, err := sm.deviceStorage.ListComponentPatches(device.Folder)
+	if err != nil {
+		add("configs", "%v", err)
+	}
+	hasConfig := make(map[string]bool, len(components))
+	for _, component := range components {
+		hasConfig[component] = true
+	}
+	for _, component := range patches {
+		file := "configs/" + component + storage.ComponentPatchSuffix
+		if !hasConfig[component] {
+			add(file, "patch has no configs/%s.json to apply to", component)
+			continue
+		}
+		_, patch, err := sm.loadDesiredConfig(device, component)
+		if err != nil {
+			add(file, "%v", err)
+			continue
+		}
+		for _, templateErr := range checkTemplates(patch, "") {
+			add(file, "%s", templateErr)
+		}
+	}
+
+	if kvs, err := sm.deviceStorage.LoadKVS(device.Folder); err != nil {
+		add("kvs/data.json", "%v", err)
+	} else {
+		for _, templateErr := range checkTemplates(map[string]interface{}(kvs), "") {
+			add("kvs/data.json", "%s", templateErr)
+		}
+	}
+
+	if schedules, err := sm.deviceStorage.ListSchedules(device.Folder); err == nil {
+		for _, schedule := range schedules {
+			if _, err := shelly.ParseTimespec(schedule.Timespec); err != nil {
+				add(fmt.Sprintf("schedules/schedule-%d.json", schedule.ID), "%v", err)
+			}
+		}
+	}
+
+	if webhooks, err := sm.deviceStorage.ListWebhooks(device.Folder); err == nil {
+		hasComponent := func(component string) bool { return hasConfig[component] }
+		for _, webhook := range webhooks {
+			for _, problem := range checkWebhook(webhook, hasComponent, nil) {
+				add(fmt.Sprintf("webhooks/webhook-%d.json", webhook.ID), "%s", problem)
+			}
+		}
+	}
+
+	// Templated scripts are checked on push, once rendered
+	if scripts, err := sm.deviceStorage.ListScripts(device.Folder); err == nil {
+		for _, script := range scripts {
+			if script.Templated {
+				continue
+			}
+			code, err := sm.deviceStorage.LoadScript(device.Folder, script.ID)
+			if err != nil {
+				continue
+			}
+			if err := sm.checkScriptCode(code); err != nil {
+				add(fmt.Sprintf("scripts/script-%d.js", script.ID), "%v", err)
+			}
+		}
+	}
+
+	if _, err := sm.deviceStorage.LoadVirtualComponentSpec(device.Folder); err != nil {
+		add("virtual-components.yaml", "%v", err)
+	}
+
+	return issues
+}
+
+// checkTemplates parses every templated string in value and returns syntax errors
+func checkTemplates(value interface{}, fieldPath string) []string {
+	var errs []string
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			childPath := key
+			if fieldPath != "" {
+				childPath = fieldPath + "." + key
+			}
+			errs = append(errs, checkTemplates(item, childPath)...)
+		}
+	case []interface{}:
+		for i, item := range v {
+			errs = append(errs, checkTemplates(item, fmt.Sprintf("%s[%d]", fieldPath, i))...)
+		}
+	case string:
+		if IsTemplated(v) {
+			if _, err := template.New(fieldPath).Funcs(templateFuncs).Parse(v); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: invalid template: %v", fieldPath, err))
+			}
+		}
+	}
+
+	return errs
+}
@@ -5,15 +5,18 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 	"text/template"
 
-	"gopkg.in/yaml.v3"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
 )
 
 // Values represents the values loaded from values file
 type Values map[string]interface{}
 
-// LoadValuesFile loads values from a YAML file
+// LoadValuesFile loads values from a YAML, JSON or TOML file
+// The format is detected from the file extension
 func LoadValuesFile(path string) (Values, error) {
 	if path == "" {
 		return make(Values), nil
@@ -25,17 +28,29 @@ func LoadValuesFile(path string) (Values, error) {
 	}
 
 	var values Values
-	if err := yaml.Unmarshal(data, &values); err != nil {
+	if err := storage.Unmarshal(storage.FormatFromPath(path), data, &values); err != nil {
 		return nil, fmt.Errorf("failed to parse values file: %w", err)
 	}
 
 	return values, nil
 }
 
+// templateFuncs are the helper functions available in templates
+var templateFuncs = template.FuncMap{
+	"int":     toInt,
+	"float":   toFloat,
+	"bool":    toBool,
+	"default": defaultValue,
+}
+
+// typedTemplatePattern matches a template consisting of a single action whose
+// pipeline ends in a type conversion, e.g. "{{ .Values.delay | int }}"
+var typedTemplatePattern = regexp.MustCompile(`^\s*\{\{[^{}]*\|\s*(int|float|bool)\s*\}\}\s*$`)
+
 // RenderTemplate renders a Go template string with the given context
 func RenderTemplate(tmplStr string, context map[string]interface{}) (string, error) {
 	// Create template with option to treat missing keys as errors
-	tmpl, err := template.New("kvs").Option("missingkey=error").Parse(tmplStr)
+	tmpl, err := template.New("kvs").Funcs(templateFuncs).Option("missingkey=error").Parse(tmplStr)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %w", err)
 	}
@@ -92,6 +107,9 @@ func CreateTemplateContext(values Values, currentDevice DeviceContext, allDevice
 		context[k] = v
 	}
 
+	// Also expose values under .Values, Helm style
+	context["Values"] = map[string]interface{}(values)
+
 	// Add device-specific context
 	context["device"] = map[string]interface{}{
 		"device_id":   currentDevice.DeviceID,
@@ -122,6 +140,14 @@ func CreateTemplateContext(values Values, currentDevice DeviceContext, allDevice
 // RenderKVSValue renders a KVS value if it's a template, otherwise returns it as-is
 // Returns the rendered value and whether it was templated
 func RenderKVSValue(value interface{}, context map[string]interface{}) (interface{}, bool, error) {
+	return RenderTypedValue(value, context)
+}
+
+// RenderTypedValue renders a templated string value. If the template is a single
+// action ending in "| int", "| float" or "| bool", the output is coerced to that
+// JSON type so numeric and boolean fields can be templated.
+// Returns the rendered value and whether it was templated
+func RenderTypedValue(value interface{}, context map[string]interface{}) (interface{}, bool, error) {
 	// Only process string values
 	strValue, ok := value.(string)
 	if !ok {
@@ -139,5 +165,158 @@ func RenderKVSValue(value interface{}, context map[string]interface{}) (interfac
 		return nil, true, err
 	}
 
-	return rendered, true, nil
+	match := typedTemplatePattern.FindStringSubmatch(strValue)
+	if match == nil {
+		return rendered, true, nil
+	}
+
+	var typed interface{}
+	switch match[1] {
+	case "int":
+		typed, err = strconv.ParseInt(strings.TrimSpace(rendered), 10, 64)
+	case "float":
+		typed, err = strconv.ParseFloat(strings.TrimSpace(rendered), 64)
+	case "bool":
+		typed, err = strconv.ParseBool(strings.TrimSpace(rendered))
+	}
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to convert rendered value %q to %s: %w", rendered, match[1], err)
+	}
+
+	return typed, true, nil
+}
+
+// RenderConfigTemplates renders every templated string inside a decoded JSON
+// value (maps, arrays and scalars), returning the rendered copy and how many
+// values were templated
+func RenderConfigTemplates(value interface{}, context map[string]interface{}) (interface{}, int, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		count := 0
+		for key, item := range v {
+			r, n, err := RenderConfigTemplates(item, context)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%s: %w", key, err)
+			}
+			rendered[key] = r
+			count += n
+		}
+		return rendered, count, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		count := 0
+		for i, item := range v {
+			r, n, err := RenderConfigTemplates(item, context)
+			if err != nil {
+				return nil, 0, fmt.Errorf("[%d]: %w", i, err)
+			}
+			rendered[i] = r
+			count += n
+		}
+		return rendered, count, nil
+	default:
+		rendered, templated, err := RenderTypedValue(v, context)
+		if err != nil {
+			return nil, 0, err
+		}
+		if templated {
+			return rendered, 1, nil
+		}
+		return v, 0, nil
+	}
+}
+
+// PreserveTemplates returns the device value with every templated string found
+// in the local value at the same position kept in place, so pulls don't
+// overwrite templates with their rendered values
+func PreserveTemplates(local, device interface{}) interface{} {
+	if s, ok := local.(string); ok && IsTemplated(s) {
+		return s
+	}
+
+	localMap, ok := local.(map[string]interface{})
+	if !ok {
+		return device
+	}
+	deviceMap, ok := device.(map[string]interface{})
+	if !ok {
+		return device
+	}
+
+	merged := make(map[string]interface{}, len(deviceMap))
+	for key, deviceValue := range deviceMap {
+		if localValue, exists := localMap[key]; exists {
+			merged[key] = PreserveTemplates(localValue, deviceValue)
+		} else {
+			merged[key] = deviceValue
+		}
+	}
+
+	return merged
+}
+
+// toInt converts a template value to an int
+func toInt(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case float64:
+		return int64(n), nil
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+	case bool:
+		if n {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("cannot convert %T to int", v)
+	}
+}
+
+// toFloat converts a template value to a float
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(n), 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %T to float", v)
+	}
+}
+
+// toBool converts a template value to a bool
+func toBool(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		return strconv.ParseBool(strings.TrimSpace(b))
+	case int:
+		return b != 0, nil
+	case float64:
+		return b != 0, nil
+	default:
+		return false, fmt.Errorf("cannot convert %T to bool", v)
+	}
+}
+
+// defaultValue returns value unless it is nil or empty, in which case def is returned
+// Usage: {{ .timeout | default 30 }}
+func defaultValue(def interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || value[0] == nil {
+		return def
+	}
+	if s, ok := value[0].(string); ok && s == "" {
+		return def
+	}
+	return value[0]
 }
@@ -0,0 +1,159 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// Virtual component plan actions
+const (
+	VirtualCreate = "create"
+	VirtualDelete = "delete"
+)
+
+// VirtualComponentAction is a planned change to a device's virtual components
+type VirtualComponentAction struct {
+	Action string
+	Key    string // existing component key for deletes, or type:id for creates with a fixed ID
+	Decl   *storage.VirtualComponentDecl
+}
+
+// isVirtualComponentType reports whether a component type is a virtual component or group
+func isVirtualComponentType(componentType string) bool {
+	switch componentType {
+	case "boolean", "number", "text", "enum", "button", "group":
+		return true
+	}
+	return false
+}
+
+// PlanVirtualComponents compares each device's virtual-components.yaml with the
+// virtual components present on the device. Devices without a spec are skipped.
+func (sm *SyncManager) PlanVirtualComponents(ctx context.Context, deviceFilter []string) (map[string][]VirtualComponentAction, error) {
+	plans := make(map[string][]VirtualComponentAction)
+
+	for _, device := range sm.SelectDevices(deviceFilter) {
+		actions, err := sm.planDeviceVirtualComponents(ctx, device)
+		if err != nil {
+			return plans, fmt.Errorf("%s: %w", device.Name, err)
+		}
+		if len(actions) > 0 {
+			plans[device.DeviceID] = actions
+		}
+	}
+
+	return plans, nil
+}
+
+// planDeviceVirtualComponents computes create/delete actions for a single device
+func (sm *SyncManager) planDeviceVirtualComponents(ctx context.Context, device storage.Device) ([]VirtualComponentAction, error) {
+	spec, err := sm.deviceStorage.LoadVirtualComponentSpec(device.Folder)
+	if err != nil || spec == nil {
+		return nil, err
+	}
+
+	components, err := sm.shellyClient.GetComponents(ctx, device.IPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get components: %w", err)
+	}
+
+	// Index existing virtual components by key and by type+name
+	existing := make(map[string]bool)
+	byName := make(map[string]string)
+	for _, component := range components {
+		componentType, _, ok := strings.Cut(component.Key, ":")
+		if !ok || !isVirtualComponentType(componentType) {
+			continue
+		}
+		existing[component.Key] = true
+
+		var config struct {
+			Name string `json:"name"`
+		}
+		if len(component.Config) > 0 && json.Unmarshal(component.Config, &config) == nil && config.Name != "" {
+			byName[componentType+"/"+config.Name] = component.Key
+		}
+	}
+
+	var actions []VirtualComponentAction
+	claimed := make(map[string]bool)
+
+	for i := range spec.Components {
+		decl := &spec.Components[i]
+
+		var key string
+		if decl.ID != nil {
+			key = decl.Type + ":" + strconv.Itoa(*decl.ID)
+			if existing[key] {
+				claimed[key] = true
+				continue
+			}
+		} else if match, ok := byName[decl.Type+"/"+decl.Name]; ok && !claimed[match] {
+			claimed[match] = true
+			continue
+		}
+
+		actions = append(actions, VirtualComponentAction{Action: VirtualCreate, Key: key, Decl: decl})
+	}
+
+	var extras []string
+	for key := range existing {
+		if !claimed[key] {
+			extras = append(extras, key)
+		}
+	}
+	sort.Strings(extras)
+	for _, key := range extras {
+		actions = append(actions, VirtualComponentAction{Action: VirtualDelete, Key: key})
+	}
+
+	return actions, nil
+}
+
+// applyVirtualComponents creates missing and deletes extra virtual components on a device
+func (sm *SyncManager) applyVirtualComponents(ctx context.Context, device storage.Device) (created, deleted int, err error) {
+	actions, err := sm.planDeviceVirtualComponents(ctx, device)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, action := range actions {
+		switch action.Action {
+		case VirtualCreate:
+			config := make(map[string]interface{}, len(action.Decl.Config)+2)
+			for k, v := range action.Decl.Config {
+				config[k] = v
+			}
+			if action.Decl.Name != "" {
+				config["name"] = action.Decl.Name
+			}
+			if len(action.Decl.Meta) > 0 {
+				config["meta"] = action.Decl.Meta
+			}
+
+			id, err := sm.shellyClient.AddVirtualComponent(ctx, device.IPAddress, action.Decl.Type, action.Decl.ID, config)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to create virtual component %s %q: %v\n", action.Decl.Type, action.Decl.Name, err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Info: Created virtual component %s:%d (%s)\n", action.Decl.Type, id, action.Decl.Name)
+			created++
+		case VirtualDelete:
+			if err := sm.shellyClient.DeleteVirtualComponent(ctx, device.IPAddress, action.Key); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to delete virtual component %s: %v\n", action.Key, err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Info: Deleted virtual component %s\n", action.Key)
+			deleted++
+		}
+	}
+
+	return created, deleted, nil
+}
@@ -0,0 +1,47 @@
+package gitops
+
+import (
+	"path"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// stripVolatile removes the volatile fields of a component config file from
+// a decoded config in place and returns it
+func stripVolatile(fields *storage.VolatileFields, component string, config interface{}) interface{} {
+	if fields == nil {
+		return config
+	}
+	return stripFields(fields.Ignore, component, config)
+}
+
+// stripFields removes the fields matching "<component>.<path>" entries, in
+// which every part may be a glob, from a decoded config in place
+func stripFields(entries []string, component string, config interface{}) interface{} {
+	for _, entry := range entries {
+		pattern, fieldPath, _ := strings.Cut(entry, ".")
+		if matched, _ := path.Match(pattern, component); matched {
+			deleteMatching(config, strings.Split(fieldPath, "."))
+		}
+	}
+	return config
+}
+
+// deleteMatching deletes the fields matching a path of glob segments
+func deleteMatching(value interface{}, segments []string) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key, child := range m {
+		if matched, _ := path.Match(segments[0], key); !matched {
+			continue
+		}
+		if len(segments) == 1 {
+			delete(m, key)
+			continue
+		}
+		deleteMatching(child, segments[1:])
+	}
+}
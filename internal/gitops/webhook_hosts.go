@@ -0,0 +1,93 @@
+package gitops
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// Values keys selecting the webhook host of the environment being pushed to
+const (
+	environmentKey    = "environment"      // name of the environment, e.g. "lab"
+	webhookHostMapKey = "webhook_host_map" // environment name -> webhook host
+)
+
+// webhookHostRewrite moves webhook URLs pointing at the host of any
+// environment to the host of the selected one
+type webhookHostRewrite struct {
+	to   string
+	from map[string]bool // lowercase hosts of all environments
+}
+
+// webhookHostRewriteFrom reads the rewrite from values; it is nil when the
+// values have no webhook_host_map
+func webhookHostRewriteFrom(values Values) (*webhookHostRewrite, error) {
+	raw, ok := values[webhookHostMapKey]
+	if !ok {
+		return nil, nil
+	}
+	hostMap, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must map environment names to hosts", webhookHostMapKey)
+	}
+
+	environment, _ := values[environmentKey].(string)
+	if environment == "" {
+		return nil, fmt.Errorf("%s is set but %s is not; set it to one of its environments", webhookHostMapKey, environmentKey)
+	}
+
+	rewrite := &webhookHostRewrite{from: make(map[string]bool)}
+	for name, value := range hostMap {
+		host, ok := value.(string)
+		if !ok || host == "" {
+			return nil, fmt.Errorf("%s.%s must be a host name", webhookHostMapKey, name)
+		}
+		rewrite.from[strings.ToLower(host)] = true
+		if name == environment {
+			rewrite.to = host
+		}
+	}
+	if rewrite.to == "" {
+		return nil, fmt.Errorf("environment %q has no host in %s", environment, webhookHostMapKey)
+	}
+	return rewrite, nil
+}
+
+// apply rewrites the webhook's URLs, keeping scheme, port, path and query;
+// URLs to other hosts are left alone. The URLs are edited as strings, as
+// url.URL would re-encode the ${...} placeholders Shelly substitutes.
+func (r *webhookHostRewrite) apply(webhook *shelly.Webhook) {
+	for i, raw := range webhook.URLs {
+		hostPort := rawHost(raw)
+		host, port, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			host, port = hostPort, ""
+		}
+		if !r.from[strings.ToLower(host)] {
+			continue
+		}
+
+		target := r.to
+		if port != "" {
+			target = net.JoinHostPort(r.to, port)
+		}
+		webhook.URLs[i] = strings.Replace(raw, hostPort, target, 1)
+	}
+}
+
+// rawHost returns the host[:port] part of a URL as written
+func rawHost(raw string) string {
+	rest := raw
+	if _, after, ok := strings.Cut(raw, "://"); ok {
+		rest = after
+	}
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	if _, host, ok := strings.Cut(rest, "@"); ok {
+		return host
+	}
+	return rest
+}
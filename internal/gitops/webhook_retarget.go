@@ -0,0 +1,135 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// WebhookRetargetOptions controls a bulk webhook host change
+type WebhookRetargetOptions struct {
+	From string // old host name or IP, without scheme or port
+	To   string // new host name or IP
+
+	DeviceFilter []string // devices to change (see SelectDevices); empty for all
+	DryRun       bool     // only report the webhooks that would change
+
+	// Push updates the changed webhooks on their devices (Webhook.Update)
+	// and commits the webhook files; nothing else is pushed. Without it,
+	// the files are left uncommitted for review and a regular push.
+	Push bool
+}
+
+// WebhookRetarget is one webhook whose URLs point at the old host
+type WebhookRetarget struct {
+	DeviceID   string
+	DeviceName string
+	WebhookID  int
+	Name       string
+	Before     []string // URLs before the change
+	After      []string
+	Pushed     bool
+	Error      error
+}
+
+// RetargetWebhooks rewrites every webhook URL pointing at the host From to
+// the host To in the selected device folders, keeping scheme, port, path and
+// ${...} placeholders, e.g. after moving Home Assistant to a new server. It
+// returns the webhooks that changed and, with Push, the commit hash ("" if
+// nothing changed).
+func (sm *SyncManager) RetargetWebhooks(ctx context.Context, opts WebhookRetargetOptions) ([]WebhookRetarget, string, error) {
+	for _, host := range []string{opts.From, opts.To} {
+		if err := checkWebhookHost(host); err != nil {
+			return nil, "", err
+		}
+	}
+	rewrite := &webhookHostRewrite{to: opts.To, from: map[string]bool{strings.ToLower(opts.From): true}}
+
+	if !opts.DryRun {
+		release, err := sm.LockRepo("webhooks")
+		if err != nil {
+			return nil, "", err
+		}
+		defer release()
+		if opts.Push {
+			if err := sm.checkFreeze(); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	var results []WebhookRetarget
+	var changed []string
+	for _, device := range sm.SelectDevices(opts.DeviceFilter) {
+		webhooks, err := sm.deviceStorage.ListWebhooks(device.Folder)
+		if err != nil {
+			results = append(results, WebhookRetarget{DeviceID: device.DeviceID, DeviceName: device.Name, Error: err})
+			continue
+		}
+		for _, webhook := range webhooks {
+			before := append([]string(nil), webhook.URLs...)
+			rewrite.apply(webhook)
+			if strings.Join(before, "\n") == strings.Join(webhook.URLs, "\n") {
+				continue
+			}
+
+			result := WebhookRetarget{
+				DeviceID:   device.DeviceID,
+				DeviceName: device.Name,
+				WebhookID:  webhook.ID,
+				Name:       webhook.Name,
+				Before:     before,
+				After:      webhook.URLs,
+			}
+			if !opts.DryRun {
+				result.Error = sm.saveRetargetedWebhook(ctx, device, webhook, opts.Push)
+				if result.Error == nil {
+					result.Pushed = opts.Push
+					changed = append(changed, path.Join(device.Folder, "webhooks", fmt.Sprintf("webhook-%d.json", webhook.ID)))
+				}
+			}
+			results = append(results, result)
+		}
+	}
+
+	if !opts.Push || len(changed) == 0 {
+		return results, "", nil
+	}
+	if err := sm.repo.StagePaths(changed); err != nil {
+		return results, "", err
+	}
+	hash, err := sm.repo.Commit(fmt.Sprintf("Retarget webhooks from %s to %s (%d webhook(s))", opts.From, opts.To, len(changed)))
+	if err != nil {
+		return results, "", err
+	}
+	return results, hash, nil
+}
+
+// saveRetargetedWebhook updates the webhook on the device if push is set,
+// then in the device folder
+func (sm *SyncManager) saveRetargetedWebhook(ctx context.Context, device storage.Device, webhook *shelly.Webhook, push bool) error {
+	if push {
+		if err := sm.shellyClient.UpdateWebhook(ctx, device.IPAddress, webhook.Normalize()); err != nil {
+			return fmt.Errorf("failed to update webhook on device: %w", err)
+		}
+	}
+	return sm.deviceStorage.SaveWebhook(device.Folder, webhook)
+}
+
+// checkWebhookHost rejects hosts given as URLs or with a port
+func checkWebhookHost(host string) error {
+	switch {
+	case host == "":
+		return fmt.Errorf("webhook host must not be empty")
+	case strings.ContainsAny(host, "/@?#"):
+		return fmt.Errorf("webhook host %q must be a host name or IP, not a URL", host)
+	case strings.Contains(host, ":") && net.ParseIP(host) == nil:
+		return fmt.Errorf("webhook host %q must not include a port; ports are kept", host)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package gitops
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
+)
+
+// webhookEvents are the webhook events of the common component types, used
+// to check webhooks without asking the device (Webhook.ListSupported). Events
+// of other component types are only checked against the device.
+var webhookEvents = map[string][]string{
+	"switch":      {"on", "off", "overpower", "overvoltage", "undervoltage", "overcurrent", "overtemp"},
+	"light":       {"on", "off", "overpower", "overvoltage", "overcurrent", "overtemp"},
+	"cover":       {"open", "closed", "stopped", "opening", "closing", "calibrating", "overpower", "overvoltage", "overcurrent", "overtemp"},
+	"input":       {"toggle_on", "toggle_off", "button_push", "button_longpush", "button_doublepush", "button_triplepush", "analog_change", "analog_measurement", "count_change"},
+	"temperature": {"change"},
+	"humidity":    {"change"},
+	"illuminance": {"dark", "twilight", "bright"},
+	"voltmeter":   {"change"},
+	"smoke":       {"alarm", "alarm_off"},
+}
+
+// webhookPlaceholder matches the ${...} placeholders Shelly fills into
+// webhook URLs
+var webhookPlaceholder = regexp.MustCompile(`\$\{[^}]*\}`)
+
+// checkWebhook returns what is wrong with a webhook definition: its URL
+// syntax, whether its event is one the device offers, and whether the
+// component it listens to exists. hasComponent reports whether a config
+// file exists, e.g. "switch-0". supported lists the events the device
+// offers, or is nil to check against the known events of common
+// component types.
+func checkWebhook(webhook *shelly.Webhook, hasComponent func(string) bool, supported []string) []string {
+	var problems []string
+
+	componentType, eventName, ok := strings.Cut(webhook.Event, ".")
+	switch {
+	case webhook.Event == "":
+		problems = append(problems, "event is missing")
+	case !ok || componentType == "" || eventName == "":
+		problems = append(problems, fmt.Sprintf("event %q must be <component>.<event>, e.g. switch.on", webhook.Event))
+	case supported != nil:
+		if !containsString(supported, webhook.Event) {
+			problems = append(problems, fmt.Sprintf("event %q is not supported by the device (it offers %s)", webhook.Event, describeEvents(supported, componentType)))
+		}
+	default:
+		if known, ok := webhookEvents[componentType]; ok && !containsString(known, eventName) {
+			problems = append(problems, fmt.Sprintf("unknown event %q for %s components (known: %s)", webhook.Event, componentType, strings.Join(known, ", ")))
+		}
+	}
+
+	if ok && componentType != "" {
+		file := fmt.Sprintf("%s-%d", componentType, webhook.CID)
+		if !hasComponent(file) && !hasComponent(componentType) {
+			problems = append(problems, fmt.Sprintf("cid %d: the device has no %s:%d component (no configs/%s.json)", webhook.CID, componentType, webhook.CID, file))
+		}
+	}
+
+	if len(webhook.URLs) == 0 && len(webhook.Actions) == 0 {
+		problems = append(problems, "webhook has no urls")
+	}
+	for _, rawURL := range webhook.URLs {
+		if err := checkWebhookURL(rawURL); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	return problems
+}
+
+// checkWebhookURL checks that a webhook URL is an absolute http(s) URL,
+// allowing ${...} placeholders
+func checkWebhookURL(rawURL string) error {
+	parsed, err := url.Parse(webhookPlaceholder.ReplaceAllString(rawURL, "x"))
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", rawURL, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("URL %q must start with http:// or https://", rawURL)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("URL %q has no host", rawURL)
+	}
+	return nil
+}
+
+// describeEvents lists the offered events of a component type, or says the
+// device offers none for it
+func describeEvents(events []string, componentType string) string {
+	var matching []string
+	for _, event := range events {
+		if strings.HasPrefix(event, componentType+".") {
+			matching = append(matching, event)
+		}
+	}
+	if len(matching) == 0 {
+		return "no " + componentType + " events"
+	}
+	return strings.Join(matching, ", ")
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+// Package homeassistant reads the device, entity and area registries of a
+// Home Assistant instance, so names and areas can be kept consistent between
+// Home Assistant and the repository
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client handles Home Assistant WebSocket API communication. The registries
+// are only exposed over the WebSocket API, not the REST API.
+type Client struct {
+	baseURL string
+	token   string // long-lived access token, created on the user's profile page
+	timeout time.Duration
+}
+
+// Device is an entry of the device registry
+type Device struct {
+	ID               string     `json:"id"`
+	Name             string     `json:"name"`
+	NameByUser       string     `json:"name_by_user"`
+	AreaID           string     `json:"area_id"`
+	Manufacturer     string     `json:"manufacturer"`
+	Model            string     `json:"model"`
+	ConfigurationURL string     `json:"configuration_url"`
+	Connections      [][]string `json:"connections"` // e.g. ["mac", "aa:bb:cc:dd:ee:ff"]
+}
+
+// DisplayName is the name shown in Home Assistant: the user's name if set,
+// otherwise the integration's
+func (d Device) DisplayName() string {
+	if d.NameByUser != "" {
+		return d.NameByUser
+	}
+	return d.Name
+}
+
+// MAC returns the device's network MAC connection, or "" if it has none
+func (d Device) MAC() string {
+	for _, connection := range d.Connections {
+		if len(connection) == 2 && connection[0] == "mac" {
+			return connection[1]
+		}
+	}
+	return ""
+}
+
+// Host returns the host of the device's configuration URL, usually its IP
+// address for Shelly devices
+func (d Device) Host() string {
+	if d.ConfigurationURL == "" {
+		return ""
+	}
+	u, err := url.Parse(d.ConfigurationURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// Entity is an entry of the entity registry
+type Entity struct {
+	EntityID     string `json:"entity_id"`
+	DeviceID     string `json:"device_id"`
+	AreaID       string `json:"area_id"`
+	Name         string `json:"name"`
+	OriginalName string `json:"original_name"`
+	DisabledBy   string `json:"disabled_by"`
+}
+
+// DisplayName is the entity's name as set by the user, falling back to the
+// integration's
+func (e Entity) DisplayName() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return e.OriginalName
+}
+
+// Area is an entry of the area registry
+type Area struct {
+	AreaID string `json:"area_id"`
+	Name   string `json:"name"`
+}
+
+// Registry holds the registries of a Home Assistant instance
+type Registry struct {
+	Devices  []Device
+	Entities []Entity
+	Areas    []Area
+}
+
+// AreaName returns the name of an area ID, or "" if it is unknown
+func (r *Registry) AreaName(areaID string) string {
+	for _, area := range r.Areas {
+		if area.AreaID == areaID {
+			return area.Name
+		}
+	}
+	return ""
+}
+
+// NewClient creates a new Home Assistant client for baseURL, e.g.
+// http://homeassistant.local:8123
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		timeout: 30 * time.Second,
+	}
+}
+
+// message is a WebSocket API message; only the fields used here
+type message struct {
+	ID      int             `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Success bool            `json:"success,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Error   *messageError   `json:"error,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+}
+
+// messageError is the error of a failed command
+type messageError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// LoadRegistry fetches the device, entity and area registries
+func (c *Client) LoadRegistry(ctx context.Context) (*Registry, error) {
+	wsURL, err := websocketURL(c.baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	dialer := websocket.Dialer{HandshakeTimeout: c.timeout}
+	conn, _, err := dialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", wsURL, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+		conn.SetWriteDeadline(deadline)
+	}
+
+	if err := c.authenticate(conn); err != nil {
+		return nil, err
+	}
+
+	registry := &Registry{}
+	commands := []struct {
+		command string
+		out     interface{}
+	}{
+		{"config/device_registry/list", &registry.Devices},
+		{"config/entity_registry/list", &registry.Entities},
+		{"config/area_registry/list", &registry.Areas},
+	}
+	for i, cmd := range commands {
+		id := i + 1
+		if err := conn.WriteJSON(message{ID: id, Type: cmd.command}); err != nil {
+			return nil, fmt.Errorf("failed to send %s: %w", cmd.command, err)
+		}
+		for {
+			var resp message
+			if err := conn.ReadJSON(&resp); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", cmd.command, err)
+			}
+			if resp.ID != id || resp.Type != "result" {
+				continue
+			}
+			if !resp.Success {
+				if resp.Error != nil {
+					return nil, fmt.Errorf("%s failed: %s", cmd.command, resp.Error.Message)
+				}
+				return nil, fmt.Errorf("%s failed", cmd.command)
+			}
+			if err := json.Unmarshal(resp.Result, cmd.out); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", cmd.command, err)
+			}
+			break
+		}
+	}
+
+	return registry, nil
+}
+
+// authenticate answers the server's auth_required greeting with the token
+func (c *Client) authenticate(conn *websocket.Conn) error {
+	var greeting message
+	if err := conn.ReadJSON(&greeting); err != nil {
+		return fmt.Errorf("failed to read greeting: %w", err)
+	}
+	if greeting.Type != "auth_required" {
+		return fmt.Errorf("unexpected greeting %q", greeting.Type)
+	}
+
+	if err := conn.WriteJSON(map[string]string{"type": "auth", "access_token": c.token}); err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+	var resp message
+	if err := conn.ReadJSON(&resp); err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+	switch resp.Type {
+	case "auth_ok":
+		return nil
+	case "auth_invalid":
+		return fmt.Errorf("authentication failed: %s", resp.Message)
+	default:
+		return fmt.Errorf("authentication failed: unexpected answer %q", resp.Type)
+	}
+}
+
+// websocketURL derives the WebSocket API URL from the instance URL
+func websocketURL(baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid Home Assistant URL %q: %w", baseURL, err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http", "":
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/websocket"
+	return u.String(), nil
+}
@@ -0,0 +1,376 @@
+// Package oidc obtains short-lived access tokens with the OAuth 2.0 device
+// authorization grant (RFC 8628), as offered by OIDC identity providers and
+// Git hosts like GitHub. Tokens are kept in memory only and never written to
+// disk, for setups where long-lived secrets in ~/.shelly-gitops are not
+// allowed.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	deviceCodeGrant = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// expiryMargin renews tokens a little before they expire, so a token
+	// isn't handed out just before it stops working
+	expiryMargin = 30 * time.Second
+)
+
+// Config describes an identity provider and the client to authorize
+type Config struct {
+	// Issuer is the OIDC issuer URL; the endpoints are discovered from its
+	// /.well-known/openid-configuration
+	Issuer string
+
+	// DeviceAuthorizationURL and TokenURL are used instead of discovery for
+	// providers without it, e.g. GitHub
+	// (https://github.com/login/device/code, https://github.com/login/oauth/access_token)
+	DeviceAuthorizationURL string
+	TokenURL               string
+
+	ClientID string
+	Scopes   []string
+	Audience string // requested audience, for providers that need one (e.g. Auth0)
+}
+
+// Token is an access token issued by the provider
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	TokenType    string
+	Expiry       time.Time // zero if the provider didn't say
+}
+
+// Valid reports whether the token is set and not about to expire
+func (t *Token) Valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(expiryMargin).Before(t.Expiry)
+}
+
+// DeviceCode is what the user needs to authorize the device flow
+type DeviceCode struct {
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string // includes the code, if the provider supports it
+	Expiry                  time.Time
+}
+
+// PromptFunc tells the user where to authorize a device code
+type PromptFunc func(code DeviceCode)
+
+// StderrPrompt prints the verification URL and code to stderr
+func StderrPrompt(code DeviceCode) {
+	if code.VerificationURIComplete != "" {
+		fmt.Fprintf(os.Stderr, "Info: To authorize, open %s (code %s)\n", code.VerificationURIComplete, code.UserCode)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Info: To authorize, open %s and enter code %s\n", code.VerificationURI, code.UserCode)
+}
+
+// TokenSource hands out access tokens for a Config, running the device flow
+// on first use and again, or a refresh, once the token expires
+type TokenSource struct {
+	config     Config
+	prompt     PromptFunc
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	token     *Token
+	endpoints *endpoints
+}
+
+// endpoints are the provider URLs used by the device flow
+type endpoints struct {
+	DeviceAuthorization string `json:"device_authorization_endpoint"`
+	Token               string `json:"token_endpoint"`
+}
+
+// NewTokenSource creates a token source; a nil prompt prints to stderr
+func NewTokenSource(config Config, prompt PromptFunc) *TokenSource {
+	if prompt == nil {
+		prompt = StderrPrompt
+	}
+	return &TokenSource{
+		config:     config,
+		prompt:     prompt,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// AccessToken returns a valid access token, authorizing or refreshing first
+// if needed
+func (s *TokenSource) AccessToken(ctx context.Context) (string, error) {
+	token, err := s.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// Token returns a valid token, authorizing or refreshing first if needed
+func (s *TokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.Valid() {
+		return s.token, nil
+	}
+
+	if err := s.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	if s.token != nil && s.token.RefreshToken != "" {
+		token, err := s.refresh(ctx, s.token.RefreshToken)
+		if err == nil {
+			s.token = token
+			return token, nil
+		}
+		fmt.Fprintf(os.Stderr, "Warning: Failed to refresh access token, authorizing again: %v\n", err)
+	}
+
+	token, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// discover resolves the provider endpoints once
+func (s *TokenSource) discover(ctx context.Context) error {
+	if s.endpoints != nil {
+		return nil
+	}
+
+	if s.config.DeviceAuthorizationURL != "" && s.config.TokenURL != "" {
+		s.endpoints = &endpoints{DeviceAuthorization: s.config.DeviceAuthorizationURL, Token: s.config.TokenURL}
+		return nil
+	}
+	if s.config.Issuer == "" {
+		return fmt.Errorf("either an issuer or the device authorization and token URLs are required")
+	}
+
+	discoveryURL := strings.TrimSuffix(s.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", discoveryURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: %s", discoveryURL, resp.Status)
+	}
+
+	var discovered endpoints
+	if err := json.NewDecoder(resp.Body).Decode(&discovered); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", discoveryURL, err)
+	}
+	if discovered.DeviceAuthorization == "" {
+		return fmt.Errorf("issuer %s does not support the device authorization grant", s.config.Issuer)
+	}
+	if discovered.Token == "" {
+		return fmt.Errorf("issuer %s has no token endpoint", s.config.Issuer)
+	}
+
+	s.endpoints = &discovered
+	return nil
+}
+
+// tokenResponse is the token endpoint's answer, successful or not
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// authorize runs the device flow: request a code, show it to the user and
+// poll the token endpoint until they approve, deny or the code expires
+func (s *TokenSource) authorize(ctx context.Context) (*Token, error) {
+	form := url.Values{"client_id": {s.config.ClientID}}
+	if len(s.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+	if s.config.Audience != "" {
+		form.Set("audience", s.config.Audience)
+	}
+
+	var code struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURL         string `json:"verification_url"` // Google's spelling
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+		Error                   string `json:"error"`
+		ErrorDescription        string `json:"error_description"`
+	}
+	status, err := s.post(ctx, s.endpoints.DeviceAuthorization, form, &code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request device code: %w", err)
+	}
+	if code.Error != "" || status != http.StatusOK {
+		return nil, fmt.Errorf("failed to request device code: %s", describeError(status, code.Error, code.ErrorDescription))
+	}
+	if code.VerificationURI == "" {
+		code.VerificationURI = code.VerificationURL
+	}
+
+	expiry := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+	if code.ExpiresIn <= 0 {
+		expiry = time.Now().Add(10 * time.Minute)
+	}
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	s.prompt(DeviceCode{
+		UserCode:                code.UserCode,
+		VerificationURI:         code.VerificationURI,
+		VerificationURIComplete: code.VerificationURIComplete,
+		Expiry:                  expiry,
+	})
+
+	poll := url.Values{
+		"grant_type":  {deviceCodeGrant},
+		"device_code": {code.DeviceCode},
+		"client_id":   {s.config.ClientID},
+	}
+	for time.Now().Before(expiry) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		var resp tokenResponse
+		status, err := s.post(ctx, s.endpoints.Token, poll, &resp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to poll for token: %w", err)
+		}
+
+		switch resp.Error {
+		case "":
+			if status != http.StatusOK || resp.AccessToken == "" {
+				return nil, fmt.Errorf("token endpoint returned no access token: %s", describeError(status, "", ""))
+			}
+			return resp.token(), nil
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+		case "access_denied":
+			return nil, fmt.Errorf("authorization was denied")
+		case "expired_token":
+			return nil, fmt.Errorf("device code expired before it was authorized")
+		default:
+			return nil, fmt.Errorf("failed to obtain token: %s", describeError(status, resp.Error, resp.ErrorDescription))
+		}
+	}
+
+	return nil, fmt.Errorf("device code expired before it was authorized")
+}
+
+// refresh exchanges a refresh token for a new access token
+func (s *TokenSource) refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {s.config.ClientID},
+	}
+
+	var resp tokenResponse
+	status, err := s.post(ctx, s.endpoints.Token, form, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" || status != http.StatusOK || resp.AccessToken == "" {
+		return nil, fmt.Errorf("%s", describeError(status, resp.Error, resp.ErrorDescription))
+	}
+
+	token := resp.token()
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	return token, nil
+}
+
+// post sends a form to an endpoint and decodes the JSON answer into out,
+// also for error statuses, which carry the OAuth error code
+func (s *TokenSource) post(ctx context.Context, endpoint string, form url.Values, out interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub answers form-encoded unless asked for JSON
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil && resp.StatusCode == http.StatusOK {
+			return resp.StatusCode, fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// token converts a successful response
+func (r tokenResponse) token() *Token {
+	token := &Token{
+		AccessToken:  r.AccessToken,
+		RefreshToken: r.RefreshToken,
+		IDToken:      r.IDToken,
+		TokenType:    r.TokenType,
+	}
+	if r.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(r.ExpiresIn) * time.Second)
+	}
+	return token
+}
+
+// describeError formats an OAuth error answer
+func describeError(status int, code, description string) string {
+	switch {
+	case code != "" && description != "":
+		return fmt.Sprintf("%s (%s)", code, description)
+	case code != "":
+		return code
+	default:
+		return fmt.Sprintf("status %d", status)
+	}
+}
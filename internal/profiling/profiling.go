@@ -0,0 +1,119 @@
+// Package profiling serves pprof profiles, runtime metrics and stage timings
+// for diagnosing performance on large fleets
+package profiling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/gitops"
+)
+
+// started is when the process began serving, for the uptime metric
+var started = time.Now()
+
+// RuntimeMetrics is a snapshot of the Go runtime
+type RuntimeMetrics struct {
+	Uptime        string `json:"uptime"`
+	Goroutines    int    `json:"goroutines"`
+	HeapAlloc     uint64 `json:"heap_alloc_bytes"`
+	HeapInuse     uint64 `json:"heap_inuse_bytes"`
+	Sys           uint64 `json:"sys_bytes"`
+	TotalAlloc    uint64 `json:"total_alloc_bytes"`
+	NumGC         uint32 `json:"num_gc"`
+	PauseTotalNs  uint64 `json:"gc_pause_total_ns"`
+	LastGCPauseNs uint64 `json:"gc_last_pause_ns"`
+}
+
+// ReadRuntimeMetrics returns the current runtime metrics
+func ReadRuntimeMetrics() RuntimeMetrics {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	metrics := RuntimeMetrics{
+		Uptime:       time.Since(started).Round(time.Second).String(),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    mem.HeapAlloc,
+		HeapInuse:    mem.HeapInuse,
+		Sys:          mem.Sys,
+		TotalAlloc:   mem.TotalAlloc,
+		NumGC:        mem.NumGC,
+		PauseTotalNs: mem.PauseTotalNs,
+	}
+	if mem.NumGC > 0 {
+		metrics.LastGCPauseNs = mem.PauseNs[(mem.NumGC+255)%256]
+	}
+	return metrics
+}
+
+// NewHandler serves /debug/pprof/ (the net/http/pprof profiles),
+// /debug/runtime (RuntimeMetrics) and /debug/timings (the sync manager's
+// TimingReport; POST resets it). sm may be nil to serve only the first two.
+func NewHandler(sm *gitops.SyncManager) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.HandleFunc("/debug/runtime", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, ReadRuntimeMetrics())
+	})
+
+	if sm != nil {
+		mux.HandleFunc("/debug/timings", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead:
+				if r.URL.Query().Get("format") == "text" {
+					w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+					w.Write([]byte(sm.Timings().String()))
+					return
+				}
+				writeJSON(w, sm.Timings())
+			case http.MethodPost:
+				sm.ResetTimings()
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			}
+		})
+	}
+
+	return mux
+}
+
+// writeJSON writes v as an indented JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// Serve runs the debug endpoints on addr until ctx is cancelled. Profiles
+// expose internals of the process, so addr should be a loopback address.
+func Serve(ctx context.Context, addr string, sm *gitops.SyncManager) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           NewHandler(sm),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule detects one kind of secret in text content
+type Rule struct {
+	ID      string
+	Pattern *regexp.Regexp
+	Group   int // capture group holding the secret value, 0 for the whole match
+}
+
+// Finding is a detected secret
+type Finding struct {
+	File    string
+	Line    int
+	RuleID  string
+	Path    string // JSON path for findings in JSON files (e.g. "sta.pass"), empty otherwise
+	Preview string // redacted preview of the secret
+}
+
+func (f Finding) String() string {
+	location := fmt.Sprintf("%s:%d", f.File, f.Line)
+	if f.Path != "" {
+		location = fmt.Sprintf("%s (%s)", f.File, f.Path)
+	}
+	return fmt.Sprintf("%s: %s %s", location, f.RuleID, f.Preview)
+}
+
+// DefaultRules are the built-in text rules, applied to scripts and any other file
+var DefaultRules = []Rule{
+	{ID: "private-key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{ID: "aws-access-key", Pattern: regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`)},
+	{ID: "github-token", Pattern: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`)},
+	{ID: "telegram-bot-token", Pattern: regexp.MustCompile(`\b\d{8,10}:[A-Za-z0-9_-]{35}\b`)},
+	{ID: "bearer-token", Pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{20,}=*)`), Group: 1},
+	{ID: "url-credentials", Pattern: regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^/\s:@"']+:([^/\s:@"']+)@`), Group: 1},
+	{ID: "assigned-secret", Pattern: regexp.MustCompile(`(?i)\b(?:password|passwd|pass|token|secret|api[_-]?key)\s*[:=]\s*["']([^"'\s{}]{6,})["']`), Group: 1},
+}
+
+// secretKeyPattern matches JSON object keys that hold credentials
+var secretKeyPattern = regexp.MustCompile(`(?i)^(pass|password|passwd|token|secret|api_?key|access_?token|auth_?token|client_?secret|psk)$`)
+
+// IsSecretKey reports whether a JSON key name conventionally holds a secret
+func IsSecretKey(key string) bool {
+	return secretKeyPattern.MatchString(key)
+}
+
+// ScanText applies text rules to content, reporting findings with line numbers
+func ScanText(file, content string, rules []Rule) []Finding {
+	var findings []Finding
+
+	for lineNo, line := range strings.Split(content, "\n") {
+		for _, rule := range rules {
+			for _, match := range rule.Pattern.FindAllStringSubmatch(line, -1) {
+				value := match[0]
+				if rule.Group > 0 && rule.Group < len(match) {
+					value = match[rule.Group]
+				}
+				findings = append(findings, Finding{
+					File:    file,
+					Line:    lineNo + 1,
+					RuleID:  rule.ID,
+					Preview: Redact(value),
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// ScanJSON reports non-empty string values stored under secret-looking keys,
+// skipping values that are already template placeholders
+func ScanJSON(file string, data []byte) ([]Finding, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	var findings []Finding
+	WalkSecretValues(value, "", func(path, secret string) {
+		findings = append(findings, Finding{
+			File:    file,
+			RuleID:  "secret-field",
+			Path:    path,
+			Preview: Redact(secret),
+		})
+	})
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Path < findings[j].Path })
+	return findings, nil
+}
+
+// WalkSecretValues calls fn for every plaintext string stored under a secret-looking key
+func WalkSecretValues(value interface{}, path string, fn func(path, secret string)) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if s, ok := item.(string); ok && IsSecretKey(key) && s != "" && !strings.Contains(s, "{{") {
+				fn(childPath, s)
+				continue
+			}
+			WalkSecretValues(item, childPath, fn)
+		}
+	case []interface{}:
+		for i, item := range v {
+			WalkSecretValues(item, fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	}
+}
+
+// Redact returns a preview of a secret that reveals at most its first two characters
+func Redact(secret string) string {
+	if len(secret) <= 4 {
+		return "****"
+	}
+	return secret[:2] + strings.Repeat("*", 6)
+}
@@ -0,0 +1,169 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/gitops"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// BenchmarkOptions controls a pull/push benchmark run
+type BenchmarkOptions struct {
+	Fleet           FleetOptions
+	PullConcurrency int    // passed to SetPullConcurrency; 0 keeps the default
+	Parallelism     int    // passed to SetParallelism; 0 keeps the default
+	MaxInFlight     int    // passed to SetMaxInFlight; 0 leaves calls unlimited
+	RepoPath        string // scratch repository; a temporary directory is used if empty
+	KeepRepo        bool   // keep the temporary repository after the run
+}
+
+// PhaseResult holds the timing of a single benchmark phase
+type PhaseResult struct {
+	Name      string
+	Devices   int
+	Succeeded int
+	Calls     int
+	Duration  time.Duration
+	Errors    []string
+}
+
+// Throughput returns devices processed per second
+func (p PhaseResult) Throughput() float64 {
+	if p.Duration <= 0 {
+		return 0
+	}
+	return float64(p.Devices) / p.Duration.Seconds()
+}
+
+// BenchmarkReport is the outcome of a benchmark run
+type BenchmarkReport struct {
+	RepoPath string
+	Phases   []PhaseResult
+	Timings  gitops.TimingReport // stage breakdown of both phases
+}
+
+// RunBenchmark starts a simulated fleet, registers it in a scratch repository
+// and times a full pull followed by a full push against it
+func RunBenchmark(ctx context.Context, opts BenchmarkOptions) (*BenchmarkReport, error) {
+	fleet, err := StartFleet(opts.Fleet)
+	if err != nil {
+		return nil, err
+	}
+	defer fleet.Close()
+
+	repoPath := opts.RepoPath
+	if repoPath == "" {
+		repoPath, err = os.MkdirTemp("", "shelly-gitops-bench-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create scratch repository: %w", err)
+		}
+		if !opts.KeepRepo {
+			defer os.RemoveAll(repoPath)
+		}
+	}
+
+	sm, err := prepareRepository(repoPath, fleet.ManifestDevices())
+	if err != nil {
+		return nil, err
+	}
+	sm.SetParallelism(opts.Parallelism)
+	sm.SetPullConcurrency(opts.PullConcurrency)
+	sm.SetMaxInFlight(opts.MaxInFlight)
+
+	report := &BenchmarkReport{RepoPath: repoPath}
+
+	pull, err := runPhase(fleet, "pull", func() ([]gitops.SyncResult, error) {
+		return sm.PullFromDevices(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Phases = append(report.Phases, pull)
+
+	push, err := runPhase(fleet, "push", func() ([]gitops.SyncResult, error) {
+		return sm.PushToDevices(ctx, false, nil, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Phases = append(report.Phases, push)
+	report.Timings = sm.Timings()
+
+	return report, nil
+}
+
+// prepareRepository initializes a repository whose manifest lists the given
+// devices and commits it so pull starts from a clean working tree
+func prepareRepository(repoPath string, devices []storage.Device) (*gitops.SyncManager, error) {
+	repo, err := gitops.InitRepository(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := storage.LoadManifest(storage.FindManifest(repoPath))
+	if err != nil {
+		return nil, err
+	}
+	manifest.Discovery.Provider = "simulator"
+	for _, device := range devices {
+		manifest.AddDevice(device)
+	}
+	if err := manifest.Save(); err != nil {
+		return nil, err
+	}
+
+	if err := repo.AddAll(); err != nil {
+		return nil, err
+	}
+	if _, err := repo.Commit("Register simulated devices"); err != nil {
+		return nil, err
+	}
+
+	return gitops.NewSyncManager(repoPath)
+}
+
+// runPhase times op and counts the RPC calls it made against the fleet
+func runPhase(fleet *Fleet, name string, op func() ([]gitops.SyncResult, error)) (PhaseResult, error) {
+	callsBefore := fleet.Calls()
+	start := time.Now()
+	results, err := op()
+	phase := PhaseResult{
+		Name:     name,
+		Devices:  len(results),
+		Calls:    fleet.Calls() - callsBefore,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		return phase, fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	for _, result := range results {
+		if result.Success {
+			phase.Succeeded++
+		} else if result.Error != nil {
+			phase.Errors = append(phase.Errors, fmt.Sprintf("%s: %v", result.DeviceID, result.Error))
+		}
+	}
+	return phase, nil
+}
+
+// String renders per-phase throughput followed by the stage timings
+func (r *BenchmarkReport) String() string {
+	var b strings.Builder
+	for _, phase := range r.Phases {
+		fmt.Fprintf(&b, "%s: %d/%d devices succeeded in %s (%.1f devices/s, %d RPC calls, %.1f calls/s)\n",
+			phase.Name, phase.Succeeded, phase.Devices, phase.Duration.Round(time.Millisecond),
+			phase.Throughput(), phase.Calls, float64(phase.Calls)/phase.Duration.Seconds())
+		for _, e := range phase.Errors {
+			fmt.Fprintf(&b, "  %s\n", e)
+		}
+	}
+	if len(r.Timings.Stages) > 0 {
+		b.WriteString(r.Timings.String())
+	}
+	return b.String()
+}
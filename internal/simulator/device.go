@@ -0,0 +1,305 @@
+// Package simulator runs simulated Shelly Gen2 devices on local ports for load
+// testing pull and push at fleet scale without real hardware
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Model describes the components a simulated device exposes
+type Model struct {
+	Name     string
+	App      string
+	Switches int
+	Inputs   int
+
+	// BatchSetConfig advertises Shelly.SetConfig for several components at once
+	BatchSetConfig bool
+}
+
+// Models are the device models the simulator picks from
+var Models = []Model{
+	{Name: "SNSW-001X16EU", App: "Plus1", Switches: 1, Inputs: 1},
+	{Name: "SNSW-102P16EU", App: "Plus2PM", Switches: 2, Inputs: 2},
+	{Name: "SPSW-104PE16EU", App: "Pro4PM", Switches: 4, Inputs: 4, BatchSetConfig: true},
+	{Name: "SNSN-0024X", App: "PlusI4", Inputs: 4},
+}
+
+// Device is a single simulated device serving the RPC API over HTTP
+type Device struct {
+	ID      string
+	Name    string
+	Model   Model
+	Latency time.Duration // base latency added to every call
+	Jitter  time.Duration // random extra latency up to this value
+	Addr    string        // host:port once started
+
+	mu        sync.Mutex
+	configs   map[string]map[string]interface{}
+	kvs       map[string]interface{}
+	schedules []map[string]interface{}
+	calls     int
+	booted    time.Time
+}
+
+// NewDevice creates a simulated device with factory configs for its model
+func NewDevice(id, name string, model Model) *Device {
+	d := &Device{
+		ID:      id,
+		Name:    name,
+		Model:   model,
+		configs: make(map[string]map[string]interface{}),
+		kvs:     make(map[string]interface{}),
+		booted:  time.Now().Add(-time.Hour), // as if up for an hour already
+	}
+
+	d.configs["sys"] = map[string]interface{}{
+		"device":   map[string]interface{}{"name": name, "mac": strings.ToUpper(id[len(id)-12:]), "fw_id": "20240101-000000/1.2.0-sim"},
+		"location": map[string]interface{}{"tz": "Europe/Sofia", "lat": 42.69, "lon": 23.32},
+	}
+	d.configs["wifi"] = map[string]interface{}{
+		"sta": map[string]interface{}{"ssid": "iot", "enable": true, "ipv4mode": "dhcp"},
+	}
+	d.configs["cloud"] = map[string]interface{}{"enable": false, "server": "shelly-sim.cloud:6022/jrpc"}
+	d.configs["mqtt"] = map[string]interface{}{"enable": false, "server": nil}
+	for i := 0; i < model.Switches; i++ {
+		d.configs[fmt.Sprintf("switch:%d", i)] = map[string]interface{}{
+			"id": i, "name": nil, "initial_state": "restore_last", "auto_off": false, "auto_off_delay": 60.0,
+		}
+	}
+	for i := 0; i < model.Inputs; i++ {
+		d.configs[fmt.Sprintf("input:%d", i)] = map[string]interface{}{
+			"id": i, "name": nil, "type": "switch", "invert": false,
+		}
+	}
+
+	return d
+}
+
+// Calls returns how many RPC calls the device has served
+func (d *Device) Calls() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls
+}
+
+// ServeHTTP handles POST /rpc
+func (d *Device) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/rpc" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req struct {
+		ID     int             `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	delay := d.Latency
+	if d.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(d.Jitter)))
+	}
+	time.Sleep(delay)
+
+	result, rpcErr := d.handle(req.Method, req.Params)
+
+	resp := map[string]interface{}{"id": req.ID, "src": d.ID}
+	if rpcErr != nil {
+		resp["error"] = map[string]interface{}{"code": -103, "message": rpcErr.Error()}
+	} else {
+		resp["result"] = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handle dispatches a single RPC method
+func (d *Device) handle(method string, rawParams json.RawMessage) (interface{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls++
+
+	var params map[string]interface{}
+	if len(rawParams) > 0 {
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return nil, fmt.Errorf("invalid params: %v", err)
+		}
+	}
+
+	switch method {
+	case "Shelly.GetDeviceInfo":
+		return map[string]interface{}{
+			"id": d.ID, "name": d.Name, "mac": strings.ToUpper(d.ID[len(d.ID)-12:]), "model": d.Model.Name, "gen": 2, "app": d.Model.App,
+			"fw_id": "20240101-000000/1.2.0-sim", "ver": "1.2.0", "auth_en": false,
+		}, nil
+	case "Shelly.ListMethods":
+		return map[string]interface{}{"methods": d.methods()}, nil
+	case "Shelly.GetConfig":
+		return d.configs, nil
+	case "Shelly.GetStatus":
+		status := make(map[string]interface{}, len(d.configs))
+		for key := range d.configs {
+			status[key] = map[string]interface{}{}
+		}
+		status["sys"] = map[string]interface{}{"uptime": int(time.Since(d.booted).Seconds())}
+		return status, nil
+	case "Shelly.GetComponents":
+		return d.components(params), nil
+	case "Script.List":
+		return map[string]interface{}{"scripts": []interface{}{}}, nil
+	case "Schedule.List":
+		return map[string]interface{}{"jobs": d.schedules, "rev": 0}, nil
+	case "Webhook.List":
+		return map[string]interface{}{"hooks": []interface{}{}, "rev": 0}, nil
+	case "KVS.List":
+		keys := make(map[string]interface{}, len(d.kvs))
+		for key := range d.kvs {
+			keys[key] = map[string]interface{}{"etag": "sim"}
+		}
+		return map[string]interface{}{"keys": keys, "rev": 0}, nil
+	case "KVS.GetMany":
+		items := make([]map[string]interface{}, 0, len(d.kvs))
+		for key, value := range d.kvs {
+			items = append(items, map[string]interface{}{"key": key, "value": value, "etag": "sim"})
+		}
+		return map[string]interface{}{"items": items, "offset": 0, "total": len(items)}, nil
+	case "KVS.Set":
+		key, _ := params["key"].(string)
+		d.kvs[key] = params["value"]
+		return map[string]interface{}{"etag": "sim", "rev": 1}, nil
+	case "KVS.Delete":
+		key, _ := params["key"].(string)
+		delete(d.kvs, key)
+		return map[string]interface{}{"rev": 1}, nil
+	case "Shelly.Reboot":
+		d.booted = time.Now()
+		return nil, nil
+	case "Shelly.SetConfig":
+		if !d.Model.BatchSetConfig {
+			break
+		}
+		updates, _ := params["config"].(map[string]interface{})
+		for key := range updates {
+			if _, exists := d.configs[key]; !exists {
+				return nil, fmt.Errorf("unknown component %s", key)
+			}
+		}
+		for key, update := range updates {
+			if update, ok := update.(map[string]interface{}); ok {
+				mergeConfig(d.configs[key], update)
+			}
+		}
+		return map[string]interface{}{"restart_required": false}, nil
+	}
+
+	if namespace, name, ok := strings.Cut(method, "."); ok {
+		key := strings.ToLower(namespace)
+		if id, ok := params["id"].(float64); ok {
+			key = fmt.Sprintf("%s:%d", key, int(id))
+		}
+		config, exists := d.configs[key]
+		if exists {
+			switch name {
+			case "GetConfig":
+				return config, nil
+			case "SetConfig":
+				update, _ := params["config"].(map[string]interface{})
+				mergeConfig(config, update)
+				return map[string]interface{}{"restart_required": false}, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("method %s not found", method)
+}
+
+// methods returns the RPC methods the device advertises
+func (d *Device) methods() []string {
+	methods := []string{
+		"Shelly.GetDeviceInfo", "Shelly.ListMethods", "Shelly.GetConfig", "Shelly.GetStatus",
+		"Shelly.GetComponents", "Shelly.Reboot", "Script.List", "Schedule.List", "Webhook.List",
+		"KVS.List", "KVS.GetMany", "KVS.Set", "KVS.Delete",
+	}
+	if d.Model.BatchSetConfig {
+		methods = append(methods, "Shelly.SetConfig")
+	}
+	namespaces := make(map[string]bool)
+	for key := range d.configs {
+		namespace, _, _ := strings.Cut(key, ":")
+		namespaces[namespace] = true
+	}
+	for namespace := range namespaces {
+		title := strings.ToUpper(namespace[:1]) + namespace[1:]
+		methods = append(methods, title+".GetConfig", title+".SetConfig")
+	}
+	return methods
+}
+
+// componentsPageSize is how many components a Shelly.GetComponents page
+// holds; real devices page in small chunks as well
+const componentsPageSize = 8
+
+// components answers Shelly.GetComponents with one page of components in
+// key order, holding the properties named by include (all without it)
+func (d *Device) components(params map[string]interface{}) map[string]interface{} {
+	keys := make([]string, 0, len(d.configs))
+	for key := range d.configs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	include := map[string]bool{"config": true, "status": true}
+	if requested, ok := params["include"].([]interface{}); ok {
+		include = make(map[string]bool)
+		for _, property := range requested {
+			if name, ok := property.(string); ok {
+				include[name] = true
+			}
+		}
+	}
+
+	offset := 0
+	if value, ok := params["offset"].(float64); ok && value > 0 {
+		offset = min(int(value), len(keys))
+	}
+	end := min(offset+componentsPageSize, len(keys))
+
+	page := make([]interface{}, 0, end-offset)
+	for _, key := range keys[offset:end] {
+		component := map[string]interface{}{"key": key}
+		if include["config"] {
+			component["config"] = d.configs[key]
+		}
+		if include["status"] {
+			component["status"] = map[string]interface{}{}
+		}
+		page = append(page, component)
+	}
+	return map[string]interface{}{"components": page, "offset": offset, "total": len(keys)}
+}
+
+// mergeConfig applies a partial config update in place
+func mergeConfig(config, update map[string]interface{}) {
+	for key, value := range update {
+		if nested, ok := value.(map[string]interface{}); ok {
+			if existing, ok := config[key].(map[string]interface{}); ok {
+				mergeConfig(existing, nested)
+				continue
+			}
+		}
+		config[key] = value
+	}
+}
@@ -0,0 +1,107 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// FleetOptions controls how a simulated fleet is generated
+type FleetOptions struct {
+	Devices    int           // number of devices to start
+	MinLatency time.Duration // lower bound of the per-device base latency
+	MaxLatency time.Duration // upper bound of the per-device base latency
+	Jitter     time.Duration // random extra latency per call
+	Seed       int64         // seed for model and latency selection; 0 uses the current time
+}
+
+// Fleet is a set of running simulated devices, each on its own local port
+type Fleet struct {
+	Devices []*Device
+	servers []*http.Server
+}
+
+// StartFleet starts opts.Devices simulated devices on 127.0.0.1 with models
+// and latencies picked at random from the configured ranges
+func StartFleet(opts FleetOptions) (*Fleet, error) {
+	if opts.Devices <= 0 {
+		return nil, fmt.Errorf("fleet must have at least one device")
+	}
+	if opts.MaxLatency < opts.MinLatency {
+		opts.MaxLatency = opts.MinLatency
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	fleet := &Fleet{}
+	for i := 0; i < opts.Devices; i++ {
+		model := Models[rng.Intn(len(Models))]
+		id := fmt.Sprintf("shelly%s-%012x", model.App, 0xa0b1c2000000+i)
+		device := NewDevice(id, fmt.Sprintf("Sim %s %03d", model.App, i+1), model)
+
+		device.Latency = opts.MinLatency
+		if spread := opts.MaxLatency - opts.MinLatency; spread > 0 {
+			device.Latency += time.Duration(rng.Int63n(int64(spread)))
+		}
+		device.Jitter = opts.Jitter
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			fleet.Close()
+			return nil, fmt.Errorf("failed to listen for device %s: %w", id, err)
+		}
+		device.Addr = listener.Addr().String()
+
+		server := &http.Server{Handler: device}
+		go server.Serve(listener)
+
+		fleet.Devices = append(fleet.Devices, device)
+		fleet.servers = append(fleet.servers, server)
+	}
+
+	return fleet, nil
+}
+
+// Close stops every simulated device
+func (f *Fleet) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, server := range f.servers {
+		server.Shutdown(ctx)
+	}
+	return nil
+}
+
+// Calls returns the total number of RPC calls served by the fleet
+func (f *Fleet) Calls() int {
+	total := 0
+	for _, device := range f.Devices {
+		total += device.Calls()
+	}
+	return total
+}
+
+// ManifestDevices returns manifest entries pointing at the simulated devices
+func (f *Fleet) ManifestDevices() []storage.Device {
+	devices := make([]storage.Device, 0, len(f.Devices))
+	for _, device := range f.Devices {
+		devices = append(devices, storage.Device{
+			DeviceID:   device.ID,
+			Name:       device.Name,
+			Folder:     storage.DeviceFolderName(device.Name, device.ID),
+			IPAddress:  device.Addr,
+			MACAddress: device.ID[len(device.ID)-12:],
+			Model:      device.Model.Name,
+		})
+	}
+	return devices
+}
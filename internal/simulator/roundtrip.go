@@ -0,0 +1,393 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+)
+
+// GoldenFile is the file in a round-trip case holding the expected push calls
+const GoldenFile = "push.golden.json"
+
+// UpdateGoldenEnv rewrites golden files instead of comparing against them
+// when set to a non-empty value
+const UpdateGoldenEnv = "SHELLY_GITOPS_UPDATE_GOLDEN"
+
+// replayDefaults answer read methods a case didn't record, matching an idle
+// device without scripts, schedules, webhooks or KVS entries
+var replayDefaults = map[string]string{
+	"Shelly.GetComponents": `{"components":[],"offset":0,"total":0}`,
+	"Script.List":          `{"scripts":[]}`,
+	"Schedule.List":        `{"jobs":[],"rev":0}`,
+	"Webhook.List":         `{"hooks":[],"rev":0}`,
+	"KVS.List":             `{"keys":{},"rev":0}`,
+	"KVS.GetMany":          `{"items":[],"offset":0,"total":0}`,
+}
+
+// RPCCall is a state-changing RPC call made by push, with its params in
+// canonical JSON (object keys sorted)
+type RPCCall struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// RoundTripResult is the outcome of pulling a recorded device and pushing
+// the stored configuration back to it
+type RoundTripResult struct {
+	// Calls are the state-changing calls push made, in order
+	Calls []RPCCall
+
+	// Mismatches lists components whose pushed config differs from the
+	// config the device reported, or that weren't pushed at all
+	Mismatches []string
+}
+
+// Golden renders the calls in the format of a case's push.golden.json
+func (r *RoundTripResult) Golden() ([]byte, error) {
+	data, err := json.MarshalIndent(r.Calls, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// RunRoundTrip replays a recorded device from caseDir, pulls it into a
+// scratch repository and pushes the stored configuration back, recording
+// every state-changing call. caseDir holds one <Method>.json file per
+// recorded RPC result, e.g. Shelly.GetDeviceInfo.json and
+// Shelly.GetConfig.json (both required) and Shelly.GetComponents.json.
+func RunRoundTrip(ctx context.Context, caseDir string) (*RoundTripResult, error) {
+	device, err := loadReplayDevice(caseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var info struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		MAC   string `json:"mac"`
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(device.results["Shelly.GetDeviceInfo"], &info); err != nil {
+		return nil, fmt.Errorf("failed to parse Shelly.GetDeviceInfo.json: %w", err)
+	}
+	if info.ID == "" {
+		return nil, fmt.Errorf("Shelly.GetDeviceInfo.json has no device id")
+	}
+	name := info.Name
+	if name == "" {
+		name = info.ID
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for replayed device: %w", err)
+	}
+	server := &http.Server{Handler: device}
+	go server.Serve(listener)
+	defer server.Close()
+
+	repoPath, err := os.MkdirTemp("", "shelly-gitops-roundtrip-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scratch repository: %w", err)
+	}
+	defer os.RemoveAll(repoPath)
+
+	sm, err := prepareRepository(repoPath, []storage.Device{{
+		DeviceID:   info.ID,
+		Name:       name,
+		Folder:     storage.DeviceFolderName(name, info.ID),
+		IPAddress:  listener.Addr().String(),
+		MACAddress: info.MAC,
+		Model:      info.Model,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := sm.PullFromDevices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pull failed: %w", err)
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			return nil, fmt.Errorf("pull failed: %w", result.Error)
+		}
+	}
+
+	device.startRecording()
+	results, err = sm.PushToDevices(ctx, false, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("push failed: %w", err)
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			return nil, fmt.Errorf("push failed: %w", result.Error)
+		}
+	}
+
+	result := &RoundTripResult{Calls: device.recorded()}
+	result.Mismatches, err = configMismatches(device.results["Shelly.GetConfig"], result.Calls)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RoundTripCases returns the case directories under root, sorted by name
+func RoundTripCases(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read round-trip cases: %w", err)
+	}
+
+	var cases []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			cases = append(cases, filepath.Join(root, entry.Name()))
+		}
+	}
+	return cases, nil
+}
+
+// CheckRoundTrip runs the case in caseDir and returns an error when push
+// doesn't send a component's config back exactly as the device reported it,
+// or when the calls differ from the case's push.golden.json. A missing golden
+// file is created; set SHELLY_GITOPS_UPDATE_GOLDEN=1 to rewrite existing ones
+// after an intentional change. Contributors adding a component type drop a
+// recorded device into a new case directory under testdata/roundtrip, which
+// TestRoundTrip checks.
+func CheckRoundTrip(ctx context.Context, caseDir string) error {
+	result, err := RunRoundTrip(ctx, caseDir)
+	if err != nil {
+		return err
+	}
+	if len(result.Mismatches) > 0 {
+		return fmt.Errorf("config not round-tripped:\n  %s", strings.Join(result.Mismatches, "\n  "))
+	}
+
+	got, err := result.Golden()
+	if err != nil {
+		return err
+	}
+	goldenPath := filepath.Join(caseDir, GoldenFile)
+	want, err := os.ReadFile(goldenPath)
+	if os.IsNotExist(err) || os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", goldenPath, err)
+		}
+		fmt.Fprintf(os.Stderr, "Info: Wrote %s\n", goldenPath)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", goldenPath, err)
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("push calls differ from %s (set %s=1 to update):\n%s", goldenPath, UpdateGoldenEnv, got)
+	}
+	return nil
+}
+
+// configMismatches compares the configs push sent with the recorded
+// Shelly.GetConfig result. Cloud and script configs are never pushed.
+func configMismatches(recordedConfig json.RawMessage, calls []RPCCall) ([]string, error) {
+	var recorded map[string]json.RawMessage
+	if err := json.Unmarshal(recordedConfig, &recorded); err != nil {
+		return nil, fmt.Errorf("failed to parse Shelly.GetConfig.json: %w", err)
+	}
+
+	pushed := make(map[string]json.RawMessage)
+	for _, call := range calls {
+		namespace, method, _ := strings.Cut(call.Method, ".")
+		if method != "SetConfig" {
+			continue
+		}
+		var params struct {
+			ID     *int            `json:"id"`
+			Config json.RawMessage `json:"config"`
+		}
+		if err := json.Unmarshal(call.Params, &params); err != nil {
+			return nil, fmt.Errorf("failed to parse %s params: %w", call.Method, err)
+		}
+
+		if namespace == "Shelly" {
+			// Batched Shelly.SetConfig carries every component keyed like GetConfig
+			var configs map[string]json.RawMessage
+			if err := json.Unmarshal(params.Config, &configs); err != nil {
+				return nil, fmt.Errorf("failed to parse Shelly.SetConfig config: %w", err)
+			}
+			for key, config := range configs {
+				pushed[key] = config
+			}
+			continue
+		}
+
+		key := strings.ToLower(namespace)
+		if params.ID != nil {
+			key = fmt.Sprintf("%s:%d", key, *params.ID)
+		}
+		pushed[key] = params.Config
+	}
+
+	keys := make([]string, 0, len(recorded))
+	for key := range recorded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var mismatches []string
+	for _, key := range keys {
+		if key == "cloud" || strings.HasPrefix(key, "script:") {
+			continue
+		}
+		config, ok := pushed[key]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s: not pushed", key))
+			continue
+		}
+		want, err := canonicalJSON(recorded[key])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse recorded %s config: %w", key, err)
+		}
+		got, err := canonicalJSON(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pushed %s config: %w", key, err)
+		}
+		if !bytes.Equal(got, want) {
+			mismatches = append(mismatches, fmt.Sprintf("%s: pushed %s, device reported %s", key, got, want))
+		}
+	}
+	return mismatches, nil
+}
+
+// canonicalJSON re-encodes JSON with object keys sorted
+func canonicalJSON(data json.RawMessage) (json.RawMessage, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// replayDevice answers RPC calls with recorded results and records the
+// state-changing calls made once recording starts
+type replayDevice struct {
+	results map[string]json.RawMessage
+
+	mu        sync.Mutex
+	recording bool
+	calls     []RPCCall
+}
+
+// loadReplayDevice loads the <Method>.json results of a case directory
+func loadReplayDevice(caseDir string) (*replayDevice, error) {
+	entries, err := os.ReadDir(caseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read round-trip case: %w", err)
+	}
+
+	d := &replayDevice{results: make(map[string]json.RawMessage)}
+	for method, result := range replayDefaults {
+		d.results[method] = json.RawMessage(result)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == GoldenFile || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(caseDir, name))
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("%s is not valid JSON", name)
+		}
+		d.results[strings.TrimSuffix(name, ".json")] = data
+	}
+
+	for _, required := range []string{"Shelly.GetDeviceInfo", "Shelly.GetConfig"} {
+		if _, ok := d.results[required]; !ok {
+			return nil, fmt.Errorf("round-trip case %s has no %s.json", caseDir, required)
+		}
+	}
+	return d, nil
+}
+
+// startRecording starts recording state-changing calls
+func (d *replayDevice) startRecording() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.recording = true
+}
+
+// recorded returns the calls recorded so far
+func (d *replayDevice) recorded() []RPCCall {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]RPCCall(nil), d.calls...)
+}
+
+// ServeHTTP handles POST /rpc
+func (d *replayDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/rpc" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req struct {
+		ID     int             `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := map[string]interface{}{"id": req.ID, "src": "replay"}
+	if result, ok := d.handle(req.Method, req.Params); ok {
+		resp["result"] = result
+	} else {
+		resp["error"] = map[string]interface{}{"code": 404, "message": fmt.Sprintf("No handler for %s", req.Method)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handle answers reads from the recorded results and acknowledges writes
+func (d *replayDevice) handle(method string, params json.RawMessage) (json.RawMessage, bool) {
+	_, name, _ := strings.Cut(method, ".")
+	if strings.HasPrefix(name, "Get") || strings.HasPrefix(name, "List") {
+		result, ok := d.results[method]
+		return result, ok
+	}
+
+	canonical, err := canonicalJSON(params)
+	if err != nil {
+		canonical = params
+	}
+	d.mu.Lock()
+	if d.recording {
+		d.calls = append(d.calls, RPCCall{Method: method, Params: canonical})
+	}
+	d.mu.Unlock()
+
+	if result, ok := d.results[method]; ok {
+		return result, true
+	}
+	return json.RawMessage(`{"restart_required":false}`), true
+}
@@ -0,0 +1,26 @@
+package simulator
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	cases, err := RoundTripCases("testdata/roundtrip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatal("no round-trip cases in testdata/roundtrip")
+	}
+
+	for _, caseDir := range cases {
+		caseDir := caseDir
+		t.Run(filepath.Base(caseDir), func(t *testing.T) {
+			if err := CheckRoundTrip(context.Background(), caseDir); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// baselinesDir is the repository folder holding per-model default configs
+const baselinesDir = "baselines"
+
+// BaselinePath returns the folder holding the baseline for a device model
+// Baselines are stored as baselines/<model>/<component>.json
+func (ds *DeviceStorage) BaselinePath(model string) string {
+	return filepath.Join(ds.repoPath, baselinesDir, strings.ToLower(model))
+}
+
+// SaveBaselineConfig saves one component of a model baseline
+func (ds *DeviceStorage) SaveBaselineConfig(model, component string, config json.RawMessage) error {
+	baselinePath := ds.BaselinePath(model)
+	if err := os.MkdirAll(baselinePath, 0755); err != nil {
+		return fmt.Errorf("failed to create baseline directory: %w", err)
+	}
+
+	var prettyJSON interface{}
+	if err := json.Unmarshal(config, &prettyJSON); err != nil {
+		return fmt.Errorf("failed to unmarshal %s baseline: %w", component, err)
+	}
+
+	data, err := json.MarshalIndent(prettyJSON, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s baseline: %w", component, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(baselinePath, component+".json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s baseline: %w", component, err)
+	}
+
+	return nil
+}
+
+// LoadBaseline loads all component configs of a model baseline keyed by
+// component file name, returning nil if the model has no baseline
+func (ds *DeviceStorage) LoadBaseline(model string) (map[string]json.RawMessage, error) {
+	baselinePath := ds.BaselinePath(model)
+
+	entries, err := os.ReadDir(baselinePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read baseline directory: %w", err)
+	}
+
+	baseline := make(map[string]json.RawMessage)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(baselinePath, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read baseline %s: %w", entry.Name(), err)
+		}
+		baseline[strings.TrimSuffix(entry.Name(), ".json")] = json.RawMessage(data)
+	}
+
+	return baseline, nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DeviceCapabilities is the RPC surface of a device as recorded by an interview
+// It is stored in capabilities.json in the device folder
+type DeviceCapabilities struct {
+	InterviewedAt time.Time              `json:"interviewed_at"`
+	DeviceInfo    json.RawMessage        `json:"device_info,omitempty"`
+	Methods       []string               `json:"methods"`
+	Namespaces    map[string][]string    `json:"namespaces"` // e.g. "Switch" -> ["GetConfig", "Set", ...]
+	Components    []ComponentCapability  `json:"components"`
+	Status        map[string]interface{} `json:"status,omitempty"`
+	Errors        map[string]string      `json:"errors,omitempty"` // RPC method -> error for calls that failed
+}
+
+// ComponentCapability describes a single component instance found on the device
+type ComponentCapability struct {
+	Key       string `json:"key"`
+	Type      string `json:"type"`
+	HasConfig bool   `json:"has_config"`
+	HasStatus bool   `json:"has_status"`
+}
+
+// Supports reports whether the device advertised the given RPC method
+func (c *DeviceCapabilities) Supports(method string) bool {
+	for _, m := range c.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveCapabilities saves an interview result to capabilities.json
+func (ds *DeviceStorage) SaveCapabilities(folderName string, capabilities *DeviceCapabilities) error {
+	devicePath := ds.GetDevicePath(folderName)
+	capabilitiesPath := filepath.Join(devicePath, "capabilities.json")
+
+	data, err := json.MarshalIndent(capabilities, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal capabilities: %w", err)
+	}
+
+	if err := os.WriteFile(capabilitiesPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write capabilities: %w", err)
+	}
+
+	return nil
+}
+
+// LoadCapabilities loads capabilities.json, returning nil if the device was never interviewed
+func (ds *DeviceStorage) LoadCapabilities(folderName string) (*DeviceCapabilities, error) {
+	devicePath := ds.GetDevicePath(folderName)
+	capabilitiesPath := filepath.Join(devicePath, "capabilities.json")
+
+	data, err := os.ReadFile(capabilitiesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read capabilities: %w", err)
+	}
+
+	var capabilities DeviceCapabilities
+	if err := json.Unmarshal(data, &capabilities); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal capabilities: %w", err)
+	}
+
+	return &capabilities, nil
+}
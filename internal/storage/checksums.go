@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checksumsFile is the per-device file recording hashes of desired-state files
+const checksumsFile = "checksums.json"
+
+// checksumExcluded are generated files in a device folder that aren't desired state
+var checksumExcluded = map[string]bool{
+	checksumsFile:       true,
+	"README.md":         true,
+	"capabilities.json": true,
+	"status.json":       true,
+}
+
+// FileChecksum holds the hash of a file as written and of its content with
+// line endings and byte order mark normalized
+type FileChecksum struct {
+	SHA256     string `json:"sha256"`
+	Normalized string `json:"normalized"`
+}
+
+// Checksums records the hashes of every desired-state file in a device folder
+type Checksums struct {
+	UpdatedAt time.Time               `json:"updated_at"`
+	Files     map[string]FileChecksum `json:"files"` // slash-separated paths relative to the device folder
+}
+
+// utf8BOM is the UTF-8 byte order mark some Windows editors prepend
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// ChecksumOf hashes file content
+func ChecksumOf(data []byte) FileChecksum {
+	raw := sha256.Sum256(data)
+
+	normalized := bytes.TrimPrefix(data, utf8BOM)
+	normalized = bytes.ReplaceAll(normalized, []byte("\r\n"), []byte("\n"))
+	norm := sha256.Sum256(normalized)
+
+	return FileChecksum{
+		SHA256:     hex.EncodeToString(raw[:]),
+		Normalized: hex.EncodeToString(norm[:]),
+	}
+}
+
+// ComputeChecksums hashes every desired-state file in a device folder
+func (ds *DeviceStorage) ComputeChecksums(folderName string) (*Checksums, error) {
+	devicePath := ds.GetDevicePath(folderName)
+	checksums := &Checksums{
+		UpdatedAt: time.Now(),
+		Files:     make(map[string]FileChecksum),
+	}
+
+	err := filepath.WalkDir(devicePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(devicePath, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if checksumExcluded[relPath] {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", relPath, err)
+		}
+		checksums.Files[relPath] = ChecksumOf(data)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash device folder: %w", err)
+	}
+
+	return checksums, nil
+}
+
+// SaveChecksums writes checksums.json into the device folder
+func (ds *DeviceStorage) SaveChecksums(folderName string, checksums *Checksums) error {
+	data, err := json.MarshalIndent(checksums, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checksums: %w", err)
+	}
+
+	checksumsPath := filepath.Join(ds.GetDevicePath(folderName), checksumsFile)
+	if err := os.WriteFile(checksumsPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checksums: %w", err)
+	}
+
+	return nil
+}
+
+// LoadChecksums loads checksums.json, returning nil if the device has none yet
+func (ds *DeviceStorage) LoadChecksums(folderName string) (*Checksums, error) {
+	checksumsPath := filepath.Join(ds.GetDevicePath(folderName), checksumsFile)
+
+	data, err := os.ReadFile(checksumsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read checksums: %w", err)
+	}
+
+	var checksums Checksums
+	if err := json.Unmarshal(data, &checksums); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal checksums: %w", err)
+	}
+
+	return &checksums, nil
+}
@@ -5,24 +5,67 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/darkermage/shelly-git-ops/internal/shelly"
+	"github.com/darkermage/shelly-git-ops/pkg/shelly"
 	"gopkg.in/yaml.v3"
 )
 
 // DeviceStorage handles device folder structure and file operations
 type DeviceStorage struct {
 	repoPath string
+	observer IOObserver
 }
 
+// IOObserver is notified after every device file read ("read") or write
+// ("write") with its duration
+type IOObserver func(op string, duration time.Duration)
+
 // DeviceMetadata represents device metadata stored in device.yaml
 type DeviceMetadata struct {
 	DeviceID   string `yaml:"device_id"`
 	Name       string `yaml:"name"`
 	Model      string `yaml:"model"`
 	Firmware   string `yaml:"firmware"`
+	Generation int    `yaml:"gen,omitempty"`
+	App        string `yaml:"app,omitempty"`
+	Uptime     int64  `yaml:"uptime,omitempty"` // seconds at the last pull
 	IPAddress  string `yaml:"ip_address"`
 	MACAddress string `yaml:"mac_address"`
+	Network    string `yaml:"network,omitempty"`
+	VLAN       int    `yaml:"vlan,omitempty"`
+
+	DeviceNotes `yaml:",inline"` // maintained by hand and preserved on pull
+
+	// PowerRanges is the expected active power per output component, e.g.
+	// "switch:0": {min: 40, max: 200} for a fridge; maintained by hand and
+	// preserved on pull
+	PowerRanges map[string]PowerRange `yaml:"power_ranges,omitempty"`
+
+	// HomeAssistant is the matching Home Assistant device, imported by
+	// SyncManager.ImportHomeAssistant and preserved on pull
+	HomeAssistant *HomeAssistantDevice `yaml:"home_assistant,omitempty"`
+}
+
+// HomeAssistantDevice is how a device is known in Home Assistant
+type HomeAssistantDevice struct {
+	DeviceID string            `yaml:"device_id"`
+	Name     string            `yaml:"name"`
+	Area     string            `yaml:"area,omitempty"`
+	Entities map[string]string `yaml:"entities,omitempty"` // entity ID to friendly name
+}
+
+// PowerRange bounds the active power of an output in watts; a zero Max
+// means no upper bound
+type PowerRange struct {
+	Min float64 `yaml:"min,omitempty"`
+	Max float64 `yaml:"max,omitempty"`
+}
+
+// Contains reports whether power lies within the range
+func (r PowerRange) Contains(power float64) bool {
+	return power >= r.Min && (r.Max == 0 || power <= r.Max)
 }
 
 // ScriptMetadata represents script metadata
@@ -30,6 +73,22 @@ type ScriptMetadata struct {
 	ID     int    `json:"id"`
 	Name   string `json:"name"`
 	Enable bool   `json:"enable"`
+
+	// Templated scripts are rendered as templates with the push values, e.g.
+	// to fill in pinned library versions. It is set by hand and kept on pull.
+	Templated bool `json:"templated,omitempty"`
+
+	// Source declares where a script vendored from a community repository
+	// came from, so updates can be proposed. It is set by hand and kept on pull.
+	Source *ScriptSource `json:"source,omitempty"`
+}
+
+// ScriptSource is the upstream of a vendored script: a file of a GitHub
+// repository at a release tag
+type ScriptSource struct {
+	Repo    string `json:"repo"`    // "owner/name"
+	Path    string `json:"path"`    // file within the repository
+	Version string `json:"version"` // release tag the script was taken from
 }
 
 // NewDeviceStorage creates a new device storage handler
@@ -39,6 +98,31 @@ func NewDeviceStorage(repoPath string) *DeviceStorage {
 	}
 }
 
+// SetObserver registers a callback invoked after every device file read and write
+func (ds *DeviceStorage) SetObserver(observer IOObserver) {
+	ds.observer = observer
+}
+
+// readFile reads a file and reports the read to the observer
+func (ds *DeviceStorage) readFile(path string) ([]byte, error) {
+	start := time.Now()
+	data, err := os.ReadFile(path)
+	if ds.observer != nil {
+		ds.observer("read", time.Since(start))
+	}
+	return data, err
+}
+
+// writeFile writes a file and reports the write to the observer
+func (ds *DeviceStorage) writeFile(path string, data []byte, perm os.FileMode) error {
+	start := time.Now()
+	err := os.WriteFile(path, data, perm)
+	if ds.observer != nil {
+		ds.observer("write", time.Since(start))
+	}
+	return err
+}
+
 // GetDevicePath returns the full path to a device folder
 func (ds *DeviceStorage) GetDevicePath(folderName string) string {
 	return filepath.Join(ds.repoPath, folderName)
@@ -75,7 +159,7 @@ func (ds *DeviceStorage) SaveDeviceMetadata(folderName string, metadata DeviceMe
 		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
-	if err := os.WriteFile(metadataPath, data, 0644); err != nil {
+	if err := ds.writeFile(metadataPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
 
@@ -87,7 +171,7 @@ func (ds *DeviceStorage) LoadDeviceMetadata(folderName string) (*DeviceMetadata,
 	devicePath := ds.GetDevicePath(folderName)
 	metadataPath := filepath.Join(devicePath, "device.yaml")
 
-	data, err := os.ReadFile(metadataPath)
+	data, err := ds.readFile(metadataPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read metadata: %w", err)
 	}
@@ -116,7 +200,7 @@ func (ds *DeviceStorage) SaveConfig(folderName string, config json.RawMessage) e
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	if err := ds.writeFile(configPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
@@ -139,7 +223,7 @@ func (ds *DeviceStorage) SaveShellyConfig(folderName string, config json.RawMess
 		return fmt.Errorf("failed to marshal shelly config: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	if err := ds.writeFile(configPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write shelly config: %w", err)
 	}
 
@@ -169,7 +253,7 @@ func (ds *DeviceStorage) SaveComponentConfig(folderName, component string, confi
 		return fmt.Errorf("failed to marshal %s config: %w", component, err)
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	if err := ds.writeFile(configPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write %s config: %w", component, err)
 	}
 
@@ -181,7 +265,7 @@ func (ds *DeviceStorage) LoadComponentConfig(folderName, component string) (json
 	devicePath := ds.GetDevicePath(folderName)
 	configPath := filepath.Join(devicePath, "configs", component+".json")
 
-	data, err := os.ReadFile(configPath)
+	data, err := ds.readFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read %s config: %w", component, err)
 	}
@@ -189,7 +273,68 @@ func (ds *DeviceStorage) LoadComponentConfig(folderName, component string) (json
 	return json.RawMessage(data), nil
 }
 
-// ListComponentConfigs lists all component config files
+// ComponentPatchSuffix marks JSON merge-patch files (configs/<component>.patch.json)
+// applied on top of the pulled component config at push time
+const ComponentPatchSuffix = ".patch.json"
+
+// LoadComponentPatch loads the merge patch of a component from
+// configs/<component>.patch.json, returning nil if there is none
+func (ds *DeviceStorage) LoadComponentPatch(folderName, component string) (json.RawMessage, error) {
+	patchPath := filepath.Join(ds.GetDevicePath(folderName), "configs", component+ComponentPatchSuffix)
+
+	data, err := ds.readFile(patchPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s patch: %w", component, err)
+	}
+
+	return json.RawMessage(data), nil
+}
+
+// SaveComponentPatch writes the merge patch of a component to
+// configs/<component>.patch.json
+func (ds *DeviceStorage) SaveComponentPatch(folderName, component string, patch json.RawMessage) error {
+	patchPath := filepath.Join(ds.GetDevicePath(folderName), "configs", component+ComponentPatchSuffix)
+	if err := ds.writeFile(patchPath, patch, 0644); err != nil {
+		return fmt.Errorf("failed to write %s patch: %w", component, err)
+	}
+	return nil
+}
+
+// DeleteComponentConfig removes configs/<component>.json and its merge patch
+func (ds *DeviceStorage) DeleteComponentConfig(folderName, component string) error {
+	configsPath := filepath.Join(ds.GetDevicePath(folderName), "configs")
+	for _, name := range []string{component + ".json", component + ComponentPatchSuffix} {
+		if err := os.Remove(filepath.Join(configsPath, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ListComponentPatches lists the components that have a merge patch file
+func (ds *DeviceStorage) ListComponentPatches(folderName string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(ds.GetDevicePath(folderName), "configs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read configs directory: %w", err)
+	}
+
+	var components []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ComponentPatchSuffix) {
+			components = append(components, strings.TrimSuffix(entry.Name(), ComponentPatchSuffix))
+		}
+	}
+
+	return components, nil
+}
+
+// ListComponentConfigs lists all component config files, excluding merge patches
 func (ds *DeviceStorage) ListComponentConfigs(folderName string) ([]string, error) {
 	devicePath := ds.GetDevicePath(folderName)
 	configsPath := filepath.Join(devicePath, "configs")
@@ -204,7 +349,7 @@ func (ds *DeviceStorage) ListComponentConfigs(folderName string) ([]string, erro
 
 	var components []string
 	for _, entry := range entries {
-		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" || strings.HasSuffix(entry.Name(), ComponentPatchSuffix) {
 			continue
 		}
 		// Remove .json extension to get component name
@@ -220,7 +365,7 @@ func (ds *DeviceStorage) LoadConfig(folderName string) (json.RawMessage, error)
 	devicePath := ds.GetDevicePath(folderName)
 	configPath := filepath.Join(devicePath, "config.json")
 
-	data, err := os.ReadFile(configPath)
+	data, err := ds.readFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
@@ -235,11 +380,11 @@ func (ds *DeviceStorage) SaveScript(folderName string, script *shelly.ScriptCode
 
 	// Save script code
 	scriptFile := filepath.Join(scriptsPath, fmt.Sprintf("script-%d.js", script.ID))
-	if err := os.WriteFile(scriptFile, []byte(script.Code), 0644); err != nil {
+	if err := ds.writeFile(scriptFile, []byte(script.Code), 0644); err != nil {
 		return fmt.Errorf("failed to write script code: %w", err)
 	}
 
-	// Save script metadata
+	// Save script metadata, keeping the hand-set templated flag and source
 	metadata := ScriptMetadata{
 		ID:     script.ID,
 		Name:   script.Name,
@@ -247,12 +392,26 @@ func (ds *DeviceStorage) SaveScript(folderName string, script *shelly.ScriptCode
 	}
 
 	metadataFile := filepath.Join(scriptsPath, fmt.Sprintf("script-%d.meta.json", script.ID))
+	if existing, err := ds.readFile(metadataFile); err == nil {
+		var previous ScriptMetadata
+		if json.Unmarshal(existing, &previous) == nil {
+			metadata.Templated = previous.Templated
+			metadata.Source = previous.Source
+		}
+	}
+
+	return ds.SaveScriptMetadata(folderName, metadata)
+}
+
+// SaveScriptMetadata writes the metadata file of a script
+func (ds *DeviceStorage) SaveScriptMetadata(folderName string, metadata ScriptMetadata) error {
+	metadataFile := filepath.Join(ds.GetDevicePath(folderName), "scripts", fmt.Sprintf("script-%d.meta.json", metadata.ID))
 	data, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal script metadata: %w", err)
 	}
 
-	if err := os.WriteFile(metadataFile, data, 0644); err != nil {
+	if err := ds.writeFile(metadataFile, data, 0644); err != nil {
 		return fmt.Errorf("failed to write script metadata: %w", err)
 	}
 
@@ -275,7 +434,7 @@ func (ds *DeviceStorage) ListScripts(folderName string) ([]ScriptMetadata, error
 			continue
 		}
 
-		data, err := os.ReadFile(filepath.Join(scriptsPath, entry.Name()))
+		data, err := ds.readFile(filepath.Join(scriptsPath, entry.Name()))
 		if err != nil {
 			continue
 		}
@@ -296,7 +455,7 @@ func (ds *DeviceStorage) LoadScript(folderName string, scriptID int) (string, er
 	devicePath := ds.GetDevicePath(folderName)
 	scriptFile := filepath.Join(devicePath, "scripts", fmt.Sprintf("script-%d.js", scriptID))
 
-	data, err := os.ReadFile(scriptFile)
+	data, err := ds.readFile(scriptFile)
 	if err != nil {
 		return "", fmt.Errorf("failed to read script: %w", err)
 	}
@@ -336,13 +495,55 @@ func (ds *DeviceStorage) SaveVirtualComponent(folderName, componentType string,
 		return fmt.Errorf("failed to marshal component: %w", err)
 	}
 
-	if err := os.WriteFile(filename, prettyData, 0644); err != nil {
+	if err := ds.writeFile(filename, prettyData, 0644); err != nil {
 		return fmt.Errorf("failed to write component: %w", err)
 	}
 
 	return nil
 }
 
+// VirtualComponentSpec declares the virtual components a device should have
+type VirtualComponentSpec struct {
+	Components []VirtualComponentDecl `yaml:"components"`
+}
+
+// VirtualComponentDecl declares a single virtual component
+// If ID is nil the device assigns one, and the component is matched by type and name
+type VirtualComponentDecl struct {
+	Type   string                 `yaml:"type"`
+	ID     *int                   `yaml:"id,omitempty"`
+	Name   string                 `yaml:"name"`
+	Meta   map[string]interface{} `yaml:"meta,omitempty"`
+	Config map[string]interface{} `yaml:"config,omitempty"`
+}
+
+// LoadVirtualComponentSpec loads virtual-components.yaml from the device folder
+// Returns nil if the device has no spec
+func (ds *DeviceStorage) LoadVirtualComponentSpec(folderName string) (*VirtualComponentSpec, error) {
+	specPath := filepath.Join(ds.GetDevicePath(folderName), "virtual-components.yaml")
+
+	data, err := ds.readFile(specPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read virtual component spec: %w", err)
+	}
+
+	var spec VirtualComponentSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal virtual component spec: %w", err)
+	}
+
+	for i, decl := range spec.Components {
+		if decl.Type == "" {
+			return nil, fmt.Errorf("virtual component spec entry %d has no type", i)
+		}
+	}
+
+	return &spec, nil
+}
+
 // SaveGroup saves a group configuration
 func (ds *DeviceStorage) SaveGroup(folderName string, group *shelly.Group) error {
 	devicePath := ds.GetDevicePath(folderName)
@@ -355,7 +556,7 @@ func (ds *DeviceStorage) SaveGroup(folderName string, group *shelly.Group) error
 		return fmt.Errorf("failed to marshal group: %w", err)
 	}
 
-	if err := os.WriteFile(filename, data, 0644); err != nil {
+	if err := ds.writeFile(filename, data, 0644); err != nil {
 		return fmt.Errorf("failed to write group: %w", err)
 	}
 
@@ -372,7 +573,7 @@ func (ds *DeviceStorage) SaveKVS(folderName string, data map[string]interface{})
 		return fmt.Errorf("failed to marshal KVS data: %w", err)
 	}
 
-	if err := os.WriteFile(kvsPath, jsonData, 0644); err != nil {
+	if err := ds.writeFile(kvsPath, jsonData, 0644); err != nil {
 		return fmt.Errorf("failed to write KVS data: %w", err)
 	}
 
@@ -389,7 +590,7 @@ func (ds *DeviceStorage) LoadKVS(folderName string) (map[string]interface{}, err
 		return make(map[string]interface{}), nil
 	}
 
-	data, err := os.ReadFile(kvsPath)
+	data, err := ds.readFile(kvsPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read KVS data: %w", err)
 	}
@@ -414,7 +615,7 @@ func (ds *DeviceStorage) SaveSchedule(folderName string, schedule *shelly.Schedu
 		return fmt.Errorf("failed to marshal schedule: %w", err)
 	}
 
-	if err := os.WriteFile(filename, data, 0644); err != nil {
+	if err := ds.writeFile(filename, data, 0644); err != nil {
 		return fmt.Errorf("failed to write schedule: %w", err)
 	}
 
@@ -440,7 +641,7 @@ func (ds *DeviceStorage) ListSchedules(folderName string) ([]*shelly.Schedule, e
 			continue
 		}
 
-		data, err := os.ReadFile(filepath.Join(schedulesPath, entry.Name()))
+		data, err := ds.readFile(filepath.Join(schedulesPath, entry.Name()))
 		if err != nil {
 			continue
 		}
@@ -476,7 +677,7 @@ func (ds *DeviceStorage) SaveWebhook(folderName string, webhook *shelly.Webhook)
 		return fmt.Errorf("failed to marshal webhook: %w", err)
 	}
 
-	if err := os.WriteFile(filename, data, 0644); err != nil {
+	if err := ds.writeFile(filename, data, 0644); err != nil {
 		return fmt.Errorf("failed to write webhook: %w", err)
 	}
 
@@ -502,7 +703,7 @@ func (ds *DeviceStorage) ListWebhooks(folderName string) ([]*shelly.Webhook, err
 			continue
 		}
 
-		data, err := os.ReadFile(filepath.Join(webhooksPath, entry.Name()))
+		data, err := ds.readFile(filepath.Join(webhooksPath, entry.Name()))
 		if err != nil {
 			continue
 		}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// discoveryProposalsFile is the repository-level review file written by
+// discovery in review mode
+const discoveryProposalsFile = "discovery-proposals.yaml"
+
+// Discovery proposal actions
+const (
+	ProposalAdd    = "add"    // a device not in the manifest yet
+	ProposalUpdate = "update" // a manifest device whose address or network changed
+)
+
+// DiscoveryProposal is one manifest change found by discovery, waiting for review
+type DiscoveryProposal struct {
+	ID      string   `yaml:"id"` // device ID, used to accept the proposal
+	Action  string   `yaml:"action"`
+	Device  Device   `yaml:"device"`            // the manifest entry after accepting
+	Changes []string `yaml:"changes,omitempty"` // field changes of an update, e.g. "ip_address: 10.0.0.5 -> 10.0.0.9"
+}
+
+// DiscoveryProposals is the content of discovery-proposals.yaml
+type DiscoveryProposals struct {
+	GeneratedAt time.Time           `yaml:"generated_at"`
+	Proposals   []DiscoveryProposal `yaml:"proposals"`
+}
+
+// DiscoveryProposalsPath returns the path of discovery-proposals.yaml
+func DiscoveryProposalsPath(repoPath string) string {
+	return filepath.Join(repoPath, discoveryProposalsFile)
+}
+
+// LoadDiscoveryProposals loads discovery-proposals.yaml from the repository
+// root, returning nil if there is nothing to review
+func LoadDiscoveryProposals(repoPath string) (*DiscoveryProposals, error) {
+	data, err := os.ReadFile(DiscoveryProposalsPath(repoPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read discovery proposals: %w", err)
+	}
+
+	var proposals DiscoveryProposals
+	if err := yaml.Unmarshal(data, &proposals); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal discovery proposals: %w", err)
+	}
+
+	return &proposals, nil
+}
+
+// SaveDiscoveryProposals writes discovery-proposals.yaml, removing the file
+// once no proposals are left
+func SaveDiscoveryProposals(repoPath string, proposals *DiscoveryProposals) error {
+	path := DiscoveryProposalsPath(repoPath)
+	if proposals == nil || len(proposals.Proposals) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove discovery proposals: %w", err)
+		}
+		return nil
+	}
+
+	data, err := yaml.Marshal(proposals)
+	if err != nil {
+		return fmt.Errorf("failed to marshal discovery proposals: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write discovery proposals: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format identifies a structured file format
+type Format string
+
+// Supported manifest and values file formats
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+)
+
+// manifestNames lists recognised manifest file names in lookup order
+var manifestNames = []string{"manifest.yaml", "manifest.yml", "manifest.json", "manifest.toml"}
+
+// ManifestFileNames returns the recognised manifest file names in lookup order
+func ManifestFileNames() []string {
+	return append([]string(nil), manifestNames...)
+}
+
+// FindManifest returns the path of the manifest in repoPath
+// If no manifest exists yet, the default manifest.yaml path is returned
+func FindManifest(repoPath string) string {
+	for _, name := range manifestNames {
+		path := filepath.Join(repoPath, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(repoPath, manifestNames[0])
+}
+
+// FormatFromPath detects the file format from the file extension, defaulting to YAML
+func FormatFromPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatYAML
+	}
+}
+
+// Unmarshal decodes data in the given format into v
+func Unmarshal(format Format, data []byte, v interface{}) error {
+	switch format {
+	case FormatJSON:
+		return json.Unmarshal(data, v)
+	case FormatTOML:
+		return toml.Unmarshal(data, v)
+	case FormatYAML:
+		return yaml.Unmarshal(data, v)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// Marshal encodes v in the given format
+func Marshal(format Format, v interface{}) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(v, "", "  ")
+	case FormatTOML:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatYAML:
+		return yaml.Marshal(v)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Repository-level files declaring change freeze windows
+const (
+	freezeFile         = "freeze.yaml"
+	freezeCalendarFile = "freeze.ics"
+)
+
+// FreezeConfig lists the change freeze windows of freeze.yaml
+type FreezeConfig struct {
+	Windows []FreezeWindowSpec `yaml:"windows"`
+}
+
+// FreezeWindowSpec is a freeze window as written in freeze.yaml. Start and
+// End are RFC 3339 times, "2006-01-02 15:04" in local time, or dates; an End
+// date includes the whole day.
+type FreezeWindowSpec struct {
+	Name   string `yaml:"name"`
+	Start  string `yaml:"start"`
+	End    string `yaml:"end"`
+	Reason string `yaml:"reason,omitempty"`
+}
+
+// FreezeWindow is a period during which nothing is applied to devices
+type FreezeWindow struct {
+	Name   string
+	Start  time.Time
+	End    time.Time // exclusive
+	Reason string
+	Source string // file the window was read from
+}
+
+// Contains reports whether t lies within the window
+func (w FreezeWindow) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// LoadFreezeWindows loads the windows of freeze.yaml and of the events in
+// freeze.ics (e.g. exported from a shared team calendar) at the repository
+// root, sorted by start. Missing files declare no windows.
+func LoadFreezeWindows(repoPath string) ([]FreezeWindow, error) {
+	var windows []FreezeWindow
+
+	data, err := os.ReadFile(filepath.Join(repoPath, freezeFile))
+	switch {
+	case err == nil:
+		var config FreezeConfig
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s: %w", freezeFile, err)
+		}
+		for i, spec := range config.Windows {
+			window, err := spec.parse()
+			if err != nil {
+				return nil, fmt.Errorf("%s: window %d: %w", freezeFile, i+1, err)
+			}
+			windows = append(windows, window)
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read %s: %w", freezeFile, err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(repoPath, freezeCalendarFile))
+	switch {
+	case err == nil:
+		events, err := parseFreezeCalendar(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", freezeCalendarFile, err)
+		}
+		windows = append(windows, events...)
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read %s: %w", freezeCalendarFile, err)
+	}
+
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Start.Before(windows[j].Start) })
+	return windows, nil
+}
+
+// parse resolves the spec's times
+func (s FreezeWindowSpec) parse() (FreezeWindow, error) {
+	start, _, err := parseFreezeTime(s.Start)
+	if err != nil {
+		return FreezeWindow{}, fmt.Errorf("invalid start: %w", err)
+	}
+	end, dateOnly, err := parseFreezeTime(s.End)
+	if err != nil {
+		return FreezeWindow{}, fmt.Errorf("invalid end: %w", err)
+	}
+	if dateOnly {
+		end = end.AddDate(0, 0, 1)
+	}
+	if !end.After(start) {
+		return FreezeWindow{}, fmt.Errorf("end %s is not after start %s", s.End, s.Start)
+	}
+
+	name := s.Name
+	if name == "" {
+		name = "freeze"
+	}
+	return FreezeWindow{Name: name, Start: start, End: end, Reason: s.Reason, Source: freezeFile}, nil
+}
+
+// parseFreezeTime parses a freeze.yaml time and reports whether it was a date
+func parseFreezeTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("%q is not a date or time", value)
+}
+
+// parseFreezeCalendar reads the VEVENTs of an iCalendar file as freeze
+// windows. Recurring events aren't supported; export their occurrences
+// instead.
+func parseFreezeCalendar(data []byte) ([]FreezeWindow, error) {
+	var windows []FreezeWindow
+	var event map[string]icalProperty
+
+	for _, line := range unfoldICal(data) {
+		name, prop := parseICalLine(line)
+		switch {
+		case name == "BEGIN" && prop.value == "VEVENT":
+			event = make(map[string]icalProperty)
+		case name == "END" && prop.value == "VEVENT":
+			window, err := freezeWindowFromEvent(event)
+			if err != nil {
+				return nil, err
+			}
+			windows = append(windows, window)
+			event = nil
+		case event != nil:
+			event[name] = prop
+		}
+	}
+	return windows, nil
+}
+
+// freezeWindowFromEvent converts the properties of a VEVENT
+func freezeWindowFromEvent(event map[string]icalProperty) (FreezeWindow, error) {
+	summary := event["SUMMARY"].value
+	if summary == "" {
+		summary = "freeze"
+	}
+	if _, ok := event["RRULE"]; ok {
+		return FreezeWindow{}, fmt.Errorf("event %q: recurring events are not supported", summary)
+	}
+
+	start, dateOnly, err := event["DTSTART"].time()
+	if err != nil {
+		return FreezeWindow{}, fmt.Errorf("event %q: invalid DTSTART: %w", summary, err)
+	}
+	var end time.Time
+	if _, ok := event["DTEND"]; ok {
+		if end, _, err = event["DTEND"].time(); err != nil {
+			return FreezeWindow{}, fmt.Errorf("event %q: invalid DTEND: %w", summary, err)
+		}
+	} else if dateOnly {
+		// An all-day event without an end lasts one day
+		end = start.AddDate(0, 0, 1)
+	} else {
+		return FreezeWindow{}, fmt.Errorf("event %q has no DTEND", summary)
+	}
+
+	return FreezeWindow{
+		Name:   summary,
+		Start:  start,
+		End:    end,
+		Reason: event["DESCRIPTION"].value,
+		Source: freezeCalendarFile,
+	}, nil
+}
+
+// icalProperty is the value and parameters of an iCalendar content line
+type icalProperty struct {
+	value  string
+	params map[string]string
+}
+
+// time parses a DATE or DATE-TIME value: UTC with a Z suffix, in the zone of
+// a TZID parameter, or in local time
+func (p icalProperty) time() (time.Time, bool, error) {
+	loc := time.Local
+	if tzid := p.params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+
+	switch {
+	case len(p.value) == 8:
+		t, err := time.ParseInLocation("20060102", p.value, loc)
+		return t, true, err
+	case strings.HasSuffix(p.value, "Z"):
+		t, err := time.Parse("20060102T150405Z", p.value)
+		return t, false, err
+	default:
+		t, err := time.ParseInLocation("20060102T150405", p.value, loc)
+		return t, false, err
+	}
+}
+
+// unfoldICal splits iCalendar data into content lines, joining folded lines
+func unfoldICal(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseICalLine splits "NAME;PARAM=x:value" into its name and property
+func parseICalLine(line string) (string, icalProperty) {
+	head, value, _ := strings.Cut(line, ":")
+	parts := strings.Split(head, ";")
+	prop := icalProperty{value: unescapeICal(value), params: make(map[string]string)}
+	for _, param := range parts[1:] {
+		key, val, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(key)] = strings.Trim(val, `"`)
+	}
+	return strings.ToUpper(parts[0]), prop
+}
+
+// unescapeICal reverses the text escaping of RFC 5545
+func unescapeICal(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
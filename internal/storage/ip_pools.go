@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// maxPoolSize bounds the addresses expanded from a single pool
+const maxPoolSize = 65536
+
+// IPPool is a manifest-defined range of static addresses for the devices
+// matching its filters, e.g. one range per room. Pools are matched in order;
+// a pool without filters takes every device not matched by an earlier pool.
+type IPPool struct {
+	Name string `yaml:"name" json:"name" toml:"name"`
+
+	// Devices are device filters as accepted by SyncManager.SelectDevices,
+	// e.g. "area:Kitchen", "tag:lighting" or "vlan:IoT"
+	Devices []string `yaml:"devices,omitempty" json:"devices,omitempty" toml:"devices,omitempty"`
+
+	// Range is a CIDR ("192.168.20.0/27") or an inclusive range
+	// ("192.168.20.10-192.168.20.29"). Network and broadcast addresses of an
+	// IPv4 CIDR are never assigned.
+	Range string `yaml:"range" json:"range" toml:"range"`
+
+	// Exclude lists addresses and ranges inside Range that must not be assigned
+	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty" toml:"exclude,omitempty"`
+}
+
+// Addresses returns the assignable addresses of the pool in ascending order
+func (p IPPool) Addresses() ([]netip.Addr, error) {
+	first, last, err := parseAddressRange(p.Range)
+	if err != nil {
+		return nil, fmt.Errorf("pool %s: %w", p.Name, err)
+	}
+
+	var excluded [][2]netip.Addr
+	for _, exclude := range p.Exclude {
+		lo, hi, err := parseAddressRange(exclude)
+		if err != nil {
+			return nil, fmt.Errorf("pool %s: exclude: %w", p.Name, err)
+		}
+		excluded = append(excluded, [2]netip.Addr{lo, hi})
+	}
+
+	var addresses []netip.Addr
+	for addr := first; addr.IsValid() && addr.Compare(last) <= 0; addr = addr.Next() {
+		skip := false
+		for _, r := range excluded {
+			if addr.Compare(r[0]) >= 0 && addr.Compare(r[1]) <= 0 {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			addresses = append(addresses, addr)
+		}
+		if len(addresses) > maxPoolSize {
+			return nil, fmt.Errorf("pool %s has more than %d addresses", p.Name, maxPoolSize)
+		}
+	}
+	return addresses, nil
+}
+
+// parseAddressRange parses a single address, a CIDR or a "first-last" range
+func parseAddressRange(value string) (netip.Addr, netip.Addr, error) {
+	value = strings.TrimSpace(value)
+
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid CIDR %q", value)
+		}
+		prefix = prefix.Masked()
+		first := prefix.Addr()
+		last := first
+		for next := last.Next(); next.IsValid() && prefix.Contains(next); next = next.Next() {
+			last = next
+		}
+		if first.Is4() && prefix.Bits() < 31 {
+			first, last = first.Next(), last.Prev()
+		}
+		return first, last, nil
+	}
+
+	from, to, isRange := strings.Cut(value, "-")
+	first, err := netip.ParseAddr(strings.TrimSpace(from))
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid address %q", from)
+	}
+	last := first
+	if isRange {
+		if last, err = netip.ParseAddr(strings.TrimSpace(to)); err != nil {
+			return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid address %q", to)
+		}
+	}
+	if first.BitLen() != last.BitLen() || first.Compare(last) > 0 {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid range %q", value)
+	}
+	return first, last, nil
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FormatDotenv is a flat KEY=value file, as read by shells and most
+// deployment tools; only KVS data can be converted to it
+const FormatDotenv Format = "dotenv"
+
+// KVSFormatFromPath detects the format of a KVS export from the file name:
+// .env files (including names like prod.env or .env.local) are dotenv,
+// anything else as FormatFromPath
+func KVSFormatFromPath(path string) Format {
+	name := strings.ToLower(filepath.Base(path))
+	if name == ".env" || strings.HasPrefix(name, ".env.") || strings.HasSuffix(name, ".env") {
+		return FormatDotenv
+	}
+	return FormatFromPath(path)
+}
+
+// MarshalKVS encodes KVS data. In dotenv, strings are double-quoted and other
+// values written as JSON, so UnmarshalKVS restores their types.
+func MarshalKVS(format Format, data map[string]interface{}) ([]byte, error) {
+	if format != FormatDotenv {
+		return Marshal(format, data)
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		if !validDotenvKey(key) {
+			return nil, fmt.Errorf("KVS key %q can't be written to a dotenv file", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	for _, key := range keys {
+		var value string
+		if s, ok := data[key].(string); ok {
+			value = strconv.Quote(s)
+		} else {
+			encoded, err := json.Marshal(data[key])
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode KVS key %s: %w", key, err)
+			}
+			value = string(encoded)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", key, value)
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalKVS decodes KVS data. Dotenv values in double quotes are strings;
+// unquoted values are read as JSON where they parse (numbers, booleans,
+// null, objects) and as strings otherwise. Single quotes keep the value
+// literally.
+func UnmarshalKVS(format Format, data []byte) (map[string]interface{}, error) {
+	kvs := make(map[string]interface{})
+	if format != FormatDotenv {
+		if err := Unmarshal(format, data, &kvs); err != nil {
+			return nil, err
+		}
+		return kvs, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !validDotenvKey(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNo)
+		}
+
+		value, err := parseDotenvValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		kvs[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return kvs, nil
+}
+
+// parseDotenvValue decodes the value part of a dotenv line
+func parseDotenvValue(raw string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted value %s", raw)
+		}
+		return value, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return nil, fmt.Errorf("unterminated value %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	}
+
+	// Unquoted values end at an inline comment
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err == nil {
+		return value, nil
+	}
+	return raw, nil
+}
+
+// validDotenvKey reports whether a KVS key can be a dotenv variable name;
+// dots, dashes and slashes are allowed as many tools accept them
+func validDotenvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_' || r == '.' || r == '-' || r == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
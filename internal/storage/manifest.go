@@ -3,37 +3,181 @@ package storage
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
-
-	"gopkg.in/yaml.v3"
 )
 
 // Manifest represents the root manifest file
 type Manifest struct {
-	Version   string          `yaml:"version"`
-	Discovery DiscoveryConfig `yaml:"discovery"`
-	Devices   []Device        `yaml:"devices"`
-	filePath  string
+	Version    string          `yaml:"version" json:"version" toml:"version"`
+	Discovery  DiscoveryConfig `yaml:"discovery" json:"discovery" toml:"discovery"`
+	IPPools    []IPPool        `yaml:"ip_pools,omitempty" json:"ip_pools,omitempty" toml:"ip_pools,omitempty"`
+	Firmware   *FirmwarePolicy `yaml:"firmware_rollout,omitempty" json:"firmware_rollout,omitempty" toml:"firmware_rollout,omitempty"`
+	Guardrails *Guardrails     `yaml:"guardrails,omitempty" json:"guardrails,omitempty" toml:"guardrails,omitempty"`
+
+	// Defaults are merge patches applied to the component configs of every
+	// device before its own patch, keyed by component type ("switch") or
+	// config file name ("switch-0")
+	Defaults map[string]map[string]interface{} `yaml:"defaults,omitempty" json:"defaults,omitempty" toml:"defaults,omitempty"`
+
+	Devices  []Device `yaml:"devices" json:"devices" toml:"devices"`
+	filePath string
 }
 
 // DiscoveryConfig holds discovery provider configuration
 type DiscoveryConfig struct {
-	Provider      string `yaml:"provider"`
-	ControllerURL string `yaml:"controller_url,omitempty"`
+	Provider      string `yaml:"provider" json:"provider" toml:"provider"`
+	ControllerURL string `yaml:"controller_url,omitempty" json:"controller_url,omitempty" toml:"controller_url,omitempty"`
+}
+
+// FirmwarePolicy configures how firmware updates are rolled out: canary
+// devices are updated first and must stay healthy for VerifyMinutes, then the
+// rest are updated in batches until more than MaxFailures devices failed.
+// Zero fields take the defaults.
+type FirmwarePolicy struct {
+	Channel       string   `yaml:"channel,omitempty" json:"channel,omitempty" toml:"channel,omitempty"`                      // "stable" (default) or "beta"
+	Canary        int      `yaml:"canary,omitempty" json:"canary,omitempty" toml:"canary,omitempty"`                         // canary devices (default 1)
+	CanaryTags    []string `yaml:"canary_tags,omitempty" json:"canary_tags,omitempty" toml:"canary_tags,omitempty"`          // devices preferred as canaries
+	VerifyMinutes int      `yaml:"verify_minutes,omitempty" json:"verify_minutes,omitempty" toml:"verify_minutes,omitempty"` // canary healthy time (default 15)
+	BatchSize     string   `yaml:"batch_size,omitempty" json:"batch_size,omitempty" toml:"batch_size,omitempty"`             // "N" or "N%" (default 25%)
+	MaxFailures   string   `yaml:"max_failures,omitempty" json:"max_failures,omitempty" toml:"max_failures,omitempty"`       // "N" or "N%" (default 0)
+}
+
+// Guardrails limit how much of the fleet a single push may change, so a bad
+// merge can't sweep across every device. Zero fields are not enforced.
+type Guardrails struct {
+	MaxDevices     int     `yaml:"max_devices,omitempty" json:"max_devices,omitempty" toml:"max_devices,omitempty"`             // devices a push may change
+	MaxDeletions   int     `yaml:"max_deletions,omitempty" json:"max_deletions,omitempty" toml:"max_deletions,omitempty"`       // schedules, webhooks and KVS keys a push may delete
+	ConfirmPercent float64 `yaml:"confirm_percent,omitempty" json:"confirm_percent,omitempty" toml:"confirm_percent,omitempty"` // changing more of the fleet needs confirmation
 }
 
 // Device represents a device in the manifest
 type Device struct {
-	DeviceID   string    `yaml:"device_id"`
-	Name       string    `yaml:"name"`
-	Folder     string    `yaml:"folder"`
-	IPAddress  string    `yaml:"ip_address"`
-	MACAddress string    `yaml:"mac_address"`
-	Model      string    `yaml:"model"`
-	LastSync   time.Time `yaml:"last_sync"`
+	DeviceID   string    `yaml:"device_id" json:"device_id" toml:"device_id"`
+	Name       string    `yaml:"name" json:"name" toml:"name"`
+	Folder     string    `yaml:"folder" json:"folder" toml:"folder"`
+	IPAddress  string    `yaml:"ip_address" json:"ip_address" toml:"ip_address"`
+	MACAddress string    `yaml:"mac_address" json:"mac_address" toml:"mac_address"`
+	Model      string    `yaml:"model" json:"model" toml:"model"`
+	LastSync   time.Time `yaml:"last_sync" json:"last_sync" toml:"last_sync"`
+	Network    string    `yaml:"network,omitempty" json:"network,omitempty" toml:"network,omitempty"`
+	VLAN       int       `yaml:"vlan,omitempty" json:"vlan,omitempty" toml:"vlan,omitempty"`
+	Tags       []string  `yaml:"tags,omitempty" json:"tags,omitempty" toml:"tags,omitempty"`
+	Transport  string    `yaml:"transport,omitempty" json:"transport,omitempty" toml:"transport,omitempty"` // "cloud" or empty for local HTTP
+	HTTPS      bool      `yaml:"https,omitempty" json:"https,omitempty" toml:"https,omitempty"`             // call the device over HTTPS
+
+	// Refreshed from Shelly.GetDeviceInfo on every pull, so devices can be
+	// selected by them offline
+	Generation int    `yaml:"gen,omitempty" json:"gen,omitempty" toml:"gen,omitempty"`
+	App        string `yaml:"app,omitempty" json:"app,omitempty" toml:"app,omitempty"`                // e.g. "Plus1PM"
+	Firmware   string `yaml:"firmware,omitempty" json:"firmware,omitempty" toml:"firmware,omitempty"` // version, e.g. "1.4.4"
+	Uptime     int64  `yaml:"uptime,omitempty" json:"uptime,omitempty" toml:"uptime,omitempty"`       // seconds, from Shelly.GetStatus
+
+	// RPC timeouts as Go durations (e.g. "90s"); empty keeps the client's
+	Timeout        string `yaml:"timeout,omitempty" json:"timeout,omitempty" toml:"timeout,omitempty"`
+	ConnectTimeout string `yaml:"connect_timeout,omitempty" json:"connect_timeout,omitempty" toml:"connect_timeout,omitempty"`
+
+	// Serial devices (flaky Gen1 or battery devices) get one call at a time
+	// with SerialDelay (a Go duration, default 500ms) between calls
+	Serial      bool   `yaml:"serial,omitempty" json:"serial,omitempty" toml:"serial,omitempty"`
+	SerialDelay string `yaml:"serial_delay,omitempty" json:"serial_delay,omitempty" toml:"serial_delay,omitempty"`
+
+	DeviceNotes `yaml:",inline"`
+}
+
+// TransportCloud marks a device reached through the Shelly Cloud instead of
+// the local network
+const TransportCloud = "cloud"
+
+// DeviceNotes is free-form operational knowledge about a device, kept in the
+// manifest or the device's device.yaml. It is never sent to the device.
+type DeviceNotes struct {
+	Notes       string `yaml:"notes,omitempty" json:"notes,omitempty" toml:"notes,omitempty"`
+	Owner       string `yaml:"owner,omitempty" json:"owner,omitempty" toml:"owner,omitempty"`
+	InstalledAt string `yaml:"installed_at,omitempty" json:"installed_at,omitempty" toml:"installed_at,omitempty"`
+	Circuit     string `yaml:"circuit,omitempty" json:"circuit,omitempty" toml:"circuit,omitempty"` // circuit or breaker feeding the device
+	Area        string `yaml:"area,omitempty" json:"area,omitempty" toml:"area,omitempty"`          // room or area the device serves
 }
 
-// LoadManifest loads a manifest from a YAML file
+// HasTag reports whether the device carries tag (case-insensitive)
+func (d Device) HasTag(tag string) bool {
+	for _, t := range d.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// RPCTimeouts parses the device's request and connect timeouts; unset ones
+// are zero
+func (d Device) RPCTimeouts() (request, connect time.Duration, err error) {
+	parse := func(field, value string) (time.Duration, error) {
+		if value == "" {
+			return 0, nil
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return 0, fmt.Errorf("device %s: invalid %s %q", d.DeviceID, field, value)
+		}
+		return timeout, nil
+	}
+
+	if request, err = parse("timeout", d.Timeout); err != nil {
+		return 0, 0, err
+	}
+	if connect, err = parse("connect_timeout", d.ConnectTimeout); err != nil {
+		return 0, 0, err
+	}
+	return request, connect, nil
+}
+
+// defaultSerialDelay is the pause between calls to a serial device
+const defaultSerialDelay = 500 * time.Millisecond
+
+// CallPacing reports whether calls to the device must run one at a time and
+// the delay between them
+func (d Device) CallPacing() (bool, time.Duration, error) {
+	if !d.Serial {
+		return false, 0, nil
+	}
+	if d.SerialDelay == "" {
+		return true, defaultSerialDelay, nil
+	}
+	delay, err := time.ParseDuration(d.SerialDelay)
+	if err != nil || delay < 0 {
+		return false, 0, fmt.Errorf("device %s: invalid serial_delay %q", d.DeviceID, d.SerialDelay)
+	}
+	return true, delay, nil
+}
+
+// IsZero reports whether no notes are set
+func (n DeviceNotes) IsZero() bool {
+	return n == DeviceNotes{}
+}
+
+// Merge returns n with every field that is set in override replaced
+func (n DeviceNotes) Merge(override DeviceNotes) DeviceNotes {
+	if override.Notes != "" {
+		n.Notes = override.Notes
+	}
+	if override.Owner != "" {
+		n.Owner = override.Owner
+	}
+	if override.InstalledAt != "" {
+		n.InstalledAt = override.InstalledAt
+	}
+	if override.Circuit != "" {
+		n.Circuit = override.Circuit
+	}
+	if override.Area != "" {
+		n.Area = override.Area
+	}
+	return n
+}
+
+// LoadManifest loads a manifest from a YAML, JSON or TOML file
+// The format is detected from the file extension
 func LoadManifest(filePath string) (*Manifest, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
@@ -48,18 +192,36 @@ func LoadManifest(filePath string) (*Manifest, error) {
 		return nil, fmt.Errorf("failed to read manifest: %w", err)
 	}
 
+	manifest, err := ParseManifest(data, FormatFromPath(filePath))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest.filePath = filePath
+	return manifest, nil
+}
+
+// ParseManifest parses manifest content in the given format without binding it to a file
+func ParseManifest(data []byte, format Format) (*Manifest, error) {
 	var manifest Manifest
-	if err := yaml.Unmarshal(data, &manifest); err != nil {
+	if err := Unmarshal(format, data, &manifest); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
 	}
+	for _, device := range manifest.Devices {
+		if _, _, err := device.RPCTimeouts(); err != nil {
+			return nil, err
+		}
+		if _, _, err := device.CallPacing(); err != nil {
+			return nil, err
+		}
+	}
 
-	manifest.filePath = filePath
 	return &manifest, nil
 }
 
-// Save saves the manifest to its file
+// Save saves the manifest to its file, keeping the file's format
 func (m *Manifest) Save() error {
-	data, err := yaml.Marshal(m)
+	data, err := Marshal(FormatFromPath(m.filePath), m)
 	if err != nil {
 		return fmt.Errorf("failed to marshal manifest: %w", err)
 	}
@@ -126,3 +288,26 @@ func (m *Manifest) UpdateLastSync(deviceID string, syncTime time.Time) {
 		}
 	}
 }
+
+// PortabilityIssues reports device folders that would break a checkout on
+// Windows or other case-insensitive file systems
+func (m *Manifest) PortabilityIssues() []string {
+	var issues []string
+	seen := make(map[string]string, len(m.Devices))
+
+	for _, device := range m.Devices {
+		if err := ValidateFolderName(device.Folder); err != nil {
+			issues = append(issues, fmt.Sprintf("%s: %v", device.DeviceID, err))
+			continue
+		}
+
+		folded := strings.ToLower(device.Folder)
+		if other, ok := seen[folded]; ok && other != device.Folder {
+			issues = append(issues, fmt.Sprintf("%s: folder %q differs from %q only by case", device.DeviceID, device.Folder, other))
+			continue
+		}
+		seen[folded] = device.Folder
+	}
+
+	return issues
+}
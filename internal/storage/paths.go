@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Folder names are validated against Windows rules on every platform so a
+// repository created on Linux or macOS can always be checked out on Windows.
+
+// windowsReservedNames are device names Windows refuses as file or folder names,
+// with or without an extension
+var windowsReservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// invalidFolderChars are characters that aren't allowed in Windows file names
+const invalidFolderChars = `<>:"/\|?*`
+
+// DeviceFolderName builds a portable folder name for a device from its name and ID
+func DeviceFolderName(name, deviceID string) string {
+	sanitized := strings.ToLower(name)
+	sanitized = strings.ReplaceAll(sanitized, " ", "-")
+	sanitized = strings.ReplaceAll(sanitized, "_", "-")
+
+	if sanitized == "" {
+		return SanitizeFolderName(deviceID)
+	}
+	return SanitizeFolderName(fmt.Sprintf("%s-%s", sanitized, deviceID))
+}
+
+// SanitizeFolderName makes a single path segment safe on Windows by replacing
+// invalid characters, trimming trailing dots and spaces and avoiding reserved names
+func SanitizeFolderName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(invalidFolderChars, r) {
+			return '-'
+		}
+		return r
+	}, name)
+
+	sanitized = strings.TrimRight(sanitized, ". ")
+	if sanitized == "" {
+		return "device"
+	}
+
+	base, _, _ := strings.Cut(sanitized, ".")
+	if windowsReservedNames[strings.ToLower(base)] {
+		sanitized = "_" + sanitized
+	}
+
+	return sanitized
+}
+
+// ValidateFolderName checks that a manifest folder is a single portable path segment
+func ValidateFolderName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("invalid folder name %q", name)
+	}
+	if SanitizeFolderName(name) != name {
+		return fmt.Errorf("folder name %q is not portable (invalid characters, trailing dot/space or reserved Windows name)", name)
+	}
+	return nil
+}
+
+// RenameDeviceFolder renames a device folder. Renames that only change case go
+// through a temporary name, since on case-insensitive file systems (Windows,
+// macOS) the target already "exists" as the source folder.
+func (ds *DeviceStorage) RenameDeviceFolder(oldFolder, newFolder string) error {
+	if oldFolder == newFolder {
+		return nil
+	}
+	if err := ValidateFolderName(newFolder); err != nil {
+		return err
+	}
+
+	oldPath := ds.GetDevicePath(oldFolder)
+	newPath := ds.GetDevicePath(newFolder)
+
+	if strings.EqualFold(oldFolder, newFolder) {
+		tmpPath := filepath.Join(ds.repoPath, newFolder+".rename-tmp")
+		if err := os.Rename(oldPath, tmpPath); err != nil {
+			return fmt.Errorf("failed to rename %s: %w", oldFolder, err)
+		}
+		if err := os.Rename(tmpPath, newPath); err != nil {
+			// Put the folder back where it was
+			os.Rename(tmpPath, oldPath)
+			return fmt.Errorf("failed to rename %s to %s: %w", oldFolder, newFolder, err)
+		}
+		return nil
+	}
+
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("cannot rename %s: %s already exists", oldFolder, newFolder)
+	}
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", oldFolder, newFolder, err)
+	}
+
+	return nil
+}
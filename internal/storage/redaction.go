@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactionFile is the repository-level file with redaction rules applied on pull
+const redactionFile = "redaction.yaml"
+
+// Redaction rule actions
+const (
+	RedactReplace = "redact" // replace the value with a template placeholder
+	RedactDrop    = "drop"   // leave the field out of the saved config
+)
+
+// RedactionRules lists JSON paths that must never be written to the repository
+type RedactionRules struct {
+	Rules []RedactionRule `yaml:"rules"`
+}
+
+// RedactionRule matches a field in component configs by "<component>.<path>",
+// e.g. "wifi.sta.pass" or "mqtt.pass". The component part may be a glob
+// such as "switch-*".
+type RedactionRule struct {
+	Path   string `yaml:"path"`
+	Action string `yaml:"action,omitempty"` // redact (default) or drop
+
+	// Placeholder replaces the value; defaults to a .secrets lookup under a
+	// name derived from the device folder and path
+	Placeholder string `yaml:"placeholder,omitempty"`
+}
+
+// LoadRedactionRules loads redaction.yaml from the repository root,
+// returning nil if the file doesn't exist
+func LoadRedactionRules(repoPath string) (*RedactionRules, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, redactionFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read redaction rules: %w", err)
+	}
+
+	var rules RedactionRules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal redaction rules: %w", err)
+	}
+
+	for i, rule := range rules.Rules {
+		switch rule.Action {
+		case "":
+			rules.Rules[i].Action = RedactReplace
+		case RedactReplace, RedactDrop:
+		default:
+			return nil, fmt.Errorf("redaction rule %q: unknown action %q", rule.Path, rule.Action)
+		}
+		if rule.Path == "" {
+			return nil, fmt.Errorf("redaction rule %d has no path", i+1)
+		}
+	}
+
+	return &rules, nil
+}
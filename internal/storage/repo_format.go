@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// repoFormatFile records the layout version of the repository
+const repoFormatFile = "repo-format.yaml"
+
+// RepoFormat is the repository layout version this build reads and writes.
+// It is bumped, with an upgrade step, whenever files move or change meaning.
+const RepoFormat = 1
+
+// RepoFormatInfo is the content of repo-format.yaml
+type RepoFormatInfo struct {
+	Format int `yaml:"format"`
+}
+
+// LoadRepoFormat returns the layout version recorded in repo-format.yaml.
+// Repositories created before the file existed are format 1.
+func LoadRepoFormat(repoPath string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, repoFormatFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 1, nil
+		}
+		return 0, fmt.Errorf("failed to read %s: %w", repoFormatFile, err)
+	}
+
+	var info RepoFormatInfo
+	if err := yaml.Unmarshal(data, &info); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal %s: %w", repoFormatFile, err)
+	}
+	if info.Format <= 0 {
+		return 0, fmt.Errorf("%s: invalid format %d", repoFormatFile, info.Format)
+	}
+	return info.Format, nil
+}
+
+// WriteRepoFormat records the layout version in repo-format.yaml
+func WriteRepoFormat(repoPath string, format int) error {
+	data, err := yaml.Marshal(RepoFormatInfo{Format: format})
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", repoFormatFile, err)
+	}
+	header := "# Layout version of this repository, checked by shelly-git-ops on startup. Don't edit.\n"
+	if err := os.WriteFile(filepath.Join(repoPath, repoFormatFile), append([]byte(header), data...), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", repoFormatFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rolloutFile is the repository-level file defining rollout rings
+const rolloutFile = "rollout.yaml"
+
+// RolloutConfig splits a push into rings that are pushed one after another,
+// each promoted only once the previous ring stayed healthy
+type RolloutConfig struct {
+	Rings []RolloutRing `yaml:"rings"`
+
+	// HealthyMinutes is how long every device of a ring must stay reachable
+	// without rebooting before the next ring is pushed
+	HealthyMinutes int `yaml:"healthy_minutes"`
+}
+
+// RolloutRing is a single stage of a rollout. Devices carrying any of Tags are
+// placed in the first ring naming that tag; Size then adds untagged devices.
+type RolloutRing struct {
+	Name string   `yaml:"name"`
+	Tags []string `yaml:"tags,omitempty"`
+	Size string   `yaml:"size,omitempty"` // "N" devices, "N%" of the fleet, or empty for all remaining devices
+}
+
+// DefaultRolloutConfig is used when the repository has no rollout.yaml:
+// one canary device, then 10% of the fleet, then the rest
+func DefaultRolloutConfig() *RolloutConfig {
+	return &RolloutConfig{
+		Rings: []RolloutRing{
+			{Name: "ring0", Size: "1"},
+			{Name: "ring1", Size: "10%"},
+			{Name: "ring2"},
+		},
+		HealthyMinutes: 10,
+	}
+}
+
+// LoadRolloutConfig loads rollout.yaml from the repository root, returning
+// DefaultRolloutConfig if the file doesn't exist
+func LoadRolloutConfig(repoPath string) (*RolloutConfig, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, rolloutFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DefaultRolloutConfig(), nil
+		}
+		return nil, fmt.Errorf("failed to read rollout config: %w", err)
+	}
+
+	var config RolloutConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rollout config: %w", err)
+	}
+	if len(config.Rings) == 0 {
+		return nil, fmt.Errorf("rollout config defines no rings")
+	}
+	for i, ring := range config.Rings {
+		if ring.Name == "" {
+			config.Rings[i].Name = fmt.Sprintf("ring%d", i)
+		}
+	}
+
+	return &config, nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// scenesDir is the top-level repository folder holding cloud scenes
+const scenesDir = "scenes"
+
+// ScenesPath returns the folder holding cloud scenes
+func (ds *DeviceStorage) ScenesPath() string {
+	return filepath.Join(ds.repoPath, scenesDir)
+}
+
+// SaveScene writes a scene definition to scenes/<file>.json
+func (ds *DeviceStorage) SaveScene(file string, scene json.RawMessage) error {
+	scenesPath := ds.ScenesPath()
+	if err := os.MkdirAll(scenesPath, 0755); err != nil {
+		return fmt.Errorf("failed to create scenes directory: %w", err)
+	}
+
+	var prettyJSON interface{}
+	if err := json.Unmarshal(scene, &prettyJSON); err != nil {
+		return fmt.Errorf("failed to unmarshal scene %s: %w", file, err)
+	}
+
+	data, err := json.MarshalIndent(prettyJSON, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal scene %s: %w", file, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(scenesPath, file+".json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write scene %s: %w", file, err)
+	}
+
+	return nil
+}
+
+// ListScenes loads all scene definitions keyed by file name (without .json)
+func (ds *DeviceStorage) ListScenes() (map[string]json.RawMessage, error) {
+	scenesPath := ds.ScenesPath()
+
+	entries, err := os.ReadDir(scenesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]json.RawMessage{}, nil
+		}
+		return nil, fmt.Errorf("failed to read scenes directory: %w", err)
+	}
+
+	scenes := make(map[string]json.RawMessage)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(scenesPath, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read scene %s: %w", entry.Name(), err)
+		}
+		scenes[entry.Name()[:len(entry.Name())-5]] = json.RawMessage(data)
+	}
+
+	return scenes, nil
+}
+
+// DeleteScene removes a scene file
+func (ds *DeviceStorage) DeleteScene(file string) error {
+	err := os.Remove(filepath.Join(ds.ScenesPath(), file+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete scene %s: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scriptPinsFile is the repository-level file pinning the remote resources
+// fetched by device scripts
+const scriptPinsFile = "script-pins.yaml"
+
+// ScriptPins is the pinned-versions manifest for device scripts
+type ScriptPins struct {
+	// Libraries maps a library name to its pinned version. Templated scripts
+	// read them as {{ .Values.libraries.<name> }}; a values file may override them.
+	Libraries map[string]string `yaml:"libraries,omitempty"`
+
+	// Allow lists URL prefixes scripts may fetch without a version, e.g.
+	// local services whose responses aren't code
+	Allow []string `yaml:"allow,omitempty"`
+}
+
+// Allowed reports whether url starts with one of the allowed prefixes
+func (p *ScriptPins) Allowed(url string) bool {
+	for _, prefix := range p.Allow {
+		if prefix != "" && strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadScriptPins loads script-pins.yaml from the repository root, returning
+// an empty manifest if the file doesn't exist
+func LoadScriptPins(repoPath string) (*ScriptPins, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, scriptPinsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &ScriptPins{}, nil
+		}
+		return nil, fmt.Errorf("failed to read script pins: %w", err)
+	}
+
+	var pins ScriptPins
+	if err := yaml.Unmarshal(data, &pins); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal script pins: %w", err)
+	}
+
+	return &pins, nil
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SaveStatusSnapshot writes status.json with the runtime state of every
+// component, keyed by component key as returned by Shelly.GetStatus
+func (ds *DeviceStorage) SaveStatusSnapshot(folderName string, status map[string]json.RawMessage) error {
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %w", err)
+	}
+
+	if err := ds.writeFile(filepath.Join(ds.GetDevicePath(folderName), "status.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write status: %w", err)
+	}
+
+	return nil
+}
+
+// LoadStatusSnapshot loads status.json, returning nil if no snapshot was captured
+func (ds *DeviceStorage) LoadStatusSnapshot(folderName string) (map[string]json.RawMessage, error) {
+	data, err := ds.readFile(filepath.Join(ds.GetDevicePath(folderName), "status.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read status: %w", err)
+	}
+
+	var status map[string]json.RawMessage
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal status: %w", err)
+	}
+
+	return status, nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// UnknownComponents lists the component keys a device reported on pull that
+// the tool doesn't recognize. It is stored in unknown-components.json.
+type UnknownComponents struct {
+	Firmware   string             `json:"firmware"`
+	Components []UnknownComponent `json:"components"`
+}
+
+// UnknownComponent is a single unrecognized component and the file it was saved to
+type UnknownComponent struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	File string `json:"file"`
+}
+
+// SaveUnknownComponents writes unknown-components.json, or removes it when
+// components is empty
+func (ds *DeviceStorage) SaveUnknownComponents(folderName, firmware string, components []UnknownComponent) error {
+	unknownPath := filepath.Join(ds.GetDevicePath(folderName), "unknown-components.json")
+
+	if len(components) == 0 {
+		if err := os.Remove(unknownPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove unknown components: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(UnknownComponents{Firmware: firmware, Components: components}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal unknown components: %w", err)
+	}
+
+	if err := os.WriteFile(unknownPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write unknown components: %w", err)
+	}
+
+	return nil
+}
+
+// LoadUnknownComponents loads unknown-components.json, returning nil if there is none
+func (ds *DeviceStorage) LoadUnknownComponents(folderName string) (*UnknownComponents, error) {
+	data, err := os.ReadFile(filepath.Join(ds.GetDevicePath(folderName), "unknown-components.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read unknown components: %w", err)
+	}
+
+	var unknown UnknownComponents
+	if err := json.Unmarshal(data, &unknown); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal unknown components: %w", err)
+	}
+
+	return &unknown, nil
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// volatileFile is the repository-level file listing device-managed fields
+const volatileFile = "volatile.yaml"
+
+// VolatileFields lists component config fields the device changes on its
+// own, e.g. positions or calibration data, which are left out of pulled
+// configs and drift checks so they don't clutter the history
+type VolatileFields struct {
+	// Ignore holds "<component>.<path>" entries like redaction rules, e.g.
+	// "cover-*.current_pos". Every part may be a glob.
+	Ignore []string `yaml:"ignore"`
+}
+
+// LoadVolatileFields loads volatile.yaml from the repository root,
+// returning nil if the file doesn't exist
+func LoadVolatileFields(repoPath string) (*VolatileFields, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, volatileFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read volatile fields: %w", err)
+	}
+
+	var fields VolatileFields
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal volatile fields: %w", err)
+	}
+
+	for _, entry := range fields.Ignore {
+		if component, path, ok := strings.Cut(entry, "."); !ok || component == "" || path == "" {
+			return nil, fmt.Errorf("volatile field %q must be <component>.<path>", entry)
+		}
+	}
+
+	return &fields, nil
+}
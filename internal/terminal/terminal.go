@@ -0,0 +1,96 @@
+// Package terminal renders output for interactive terminals: ANSI colors that
+// respect NO_COLOR, and a pager for output taller than the screen
+package terminal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ANSI styles used by the renderers
+const (
+	Reset   = "\033[0m"
+	Bold    = "\033[1m"
+	Dim     = "\033[2m"
+	Red     = "\033[31m"
+	Green   = "\033[32m"
+	Yellow  = "\033[33m"
+	Blue    = "\033[34m"
+	Magenta = "\033[35m"
+	Cyan    = "\033[36m"
+)
+
+// defaultPager shows long output page by page, keeps colors, and exits right
+// away when the output fits on one screen
+const defaultPager = "less -FRX"
+
+// IsTerminal reports whether f is an interactive terminal
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// ColorEnabled reports whether output to f should be colored: f must be a
+// terminal, and neither NO_COLOR nor TERM=dumb may be set
+func ColorEnabled(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return IsTerminal(f)
+}
+
+// Style wraps s in an ANSI style when enabled
+func Style(enabled bool, style, s string) string {
+	if !enabled || s == "" {
+		return s
+	}
+	return style + s + Reset
+}
+
+// Page writes text to f, through a pager when f is a terminal and the text is
+// taller than it. The pager is $SHELLY_GITOPS_PAGER, then $PAGER, then
+// "less -FRX"; an empty pager variable or one that fails to start writes the
+// text directly.
+func Page(f *os.File, text string) error {
+	if !IsTerminal(f) || fits(f, text) {
+		_, err := io.WriteString(f, text)
+		return err
+	}
+
+	pager, ok := os.LookupEnv("SHELLY_GITOPS_PAGER")
+	if !ok {
+		pager, ok = os.LookupEnv("PAGER")
+	}
+	if !ok {
+		pager = defaultPager
+	}
+	if strings.TrimSpace(pager) == "" || runtime.GOOS == "windows" {
+		_, err := io.WriteString(f, text)
+		return err
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = f
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to start pager %q: %v\n", pager, err)
+		_, err := io.WriteString(f, text)
+		return err
+	}
+	return cmd.Wait()
+}
+
+// fits reports whether text fits on the screen of terminal f
+func fits(f *os.File, text string) bool {
+	_, height, err := term.GetSize(int(f.Fd()))
+	if err != nil || height <= 0 {
+		return true
+	}
+	return strings.Count(text, "\n") < height
+}
@@ -0,0 +1,340 @@
+// Package tunnel dials devices at a remote site through a jump host there,
+// either an SSH server (with dynamic port forwarding, like ssh -D) or a
+// SOCKS5 proxy, so a site can be managed without a VPN
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	connectTimeout    = 15 * time.Second
+	keepaliveInterval = 30 * time.Second
+)
+
+// Dialer opens connections through a site's jump host
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	Close() error
+}
+
+// Open creates the dialer for a tunnel config. SSH connects lazily, on the
+// first dial.
+func Open(cfg *config.Tunnel) (Dialer, error) {
+	switch {
+	case cfg.SSH != "" && cfg.SOCKS5 != "":
+		return nil, fmt.Errorf("tunnel requires exactly one of ssh and socks5")
+	case cfg.SSH != "":
+		return NewSSHDialer(cfg.SSH, expandHome(cfg.IdentityFile), expandHome(cfg.KnownHosts))
+	case cfg.SOCKS5 != "":
+		return NewSOCKS5Dialer(cfg.SOCKS5)
+	default:
+		return nil, fmt.Errorf("tunnel requires exactly one of ssh and socks5")
+	}
+}
+
+// expandHome expands a leading ~ to the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// socks5Dialer dials through a SOCKS5 proxy
+type socks5Dialer struct {
+	dialer proxy.ContextDialer
+}
+
+// NewSOCKS5Dialer creates a dialer for the SOCKS5 proxy at host:port
+func NewSOCKS5Dialer(addr string) (Dialer, error) {
+	forward := &net.Dialer{Timeout: connectTimeout, KeepAlive: keepaliveInterval}
+	dialer, err := proxy.SOCKS5("tcp", addr, nil, forward)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOCKS5 proxy %q: %w", addr, err)
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("SOCKS5 dialer does not support contexts")
+	}
+	return &socks5Dialer{dialer: contextDialer}, nil
+}
+
+// DialContext implements Dialer
+func (d *socks5Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("SOCKS5 proxy: %w", err)
+	}
+	return conn, nil
+}
+
+// Close implements Dialer; SOCKS5 keeps no connection of its own
+func (d *socks5Dialer) Close() error {
+	return nil
+}
+
+// SSHDialer forwards connections over one SSH connection to a jump host,
+// which is opened on the first dial and reopened after it drops
+type SSHDialer struct {
+	addr   string
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+	closed bool
+}
+
+// NewSSHDialer creates a dialer for the jump host [user@]host[:port]. The
+// host key must be in knownHostsFile (default ~/.ssh/known_hosts). Keys are
+// read from identityFile if set, else from ssh-agent and ~/.ssh/id_*.
+func NewSSHDialer(target, identityFile, knownHostsFile string) (*SSHDialer, error) {
+	username, addr, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known hosts to verify %s: %w", addr, err)
+	}
+
+	auth, err := authMethods(identityFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSHDialer{
+		addr: addr,
+		config: &ssh.ClientConfig{
+			User:              username,
+			Auth:              auth,
+			HostKeyCallback:   hostKeyCallback,
+			HostKeyAlgorithms: knownKeyAlgorithms(hostKeyCallback, addr),
+			Timeout:           connectTimeout,
+		},
+	}, nil
+}
+
+// DialContext implements Dialer, connecting to addr from the jump host
+func (d *SSHDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := d.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("jump host %s: %w", d.addr, err)
+	}
+	return conn, nil
+}
+
+// Close closes the SSH connection; later dials fail
+func (d *SSHDialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	if d.client == nil {
+		return nil
+	}
+	err := d.client.Close()
+	d.client = nil
+	return err
+}
+
+// connect returns the open SSH connection, opening it if needed
+func (d *SSHDialer) connect(ctx context.Context) (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, fmt.Errorf("tunnel to %s is closed", d.addr)
+	}
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	dialer := net.Dialer{Timeout: connectTimeout, KeepAlive: keepaliveInterval}
+	conn, err := dialer.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to jump host %s: %w", d.addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, d.addr, d.config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open SSH session to %s: %w", d.addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	client := ssh.NewClient(clientConn, channels, requests)
+	d.client = client
+	go d.keepalive(client)
+	go func() {
+		client.Wait()
+		d.mu.Lock()
+		if d.client == client {
+			d.client = nil
+		}
+		d.mu.Unlock()
+	}()
+	return client, nil
+}
+
+// keepalive pings the jump host so idle connections through NAT stay open
+// and a dead one is noticed; it closes the client when a ping fails
+func (d *SSHDialer) keepalive(client *ssh.Client) {
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			client.Close()
+			return
+		}
+	}
+}
+
+// parseTarget splits [user@]host[:port], defaulting to the local user and
+// port 22
+func parseTarget(target string) (string, string, error) {
+	username, host, found := strings.Cut(target, "@")
+	if !found {
+		host = username
+		username = ""
+		if current, err := user.Current(); err == nil {
+			username = current.Username
+		}
+	}
+	if username == "" || host == "" {
+		return "", "", fmt.Errorf("invalid SSH jump host %q (want [user@]host[:port])", target)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "22")
+	}
+	return username, host, nil
+}
+
+// authMethods returns the key authentication to try: identityFile alone if
+// set, else ssh-agent and the default key files
+func authMethods(identityFile string) ([]ssh.AuthMethod, error) {
+	if identityFile != "" {
+		signer, err := loadKey(identityFile)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+
+	var methods []ssh.AuthMethod
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	var signers []ssh.Signer
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			// Missing and passphrase-protected keys are left to the agent
+			if signer, err := loadKey(filepath.Join(home, ".ssh", name)); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no SSH key found: set identity_file or load a key into ssh-agent")
+	}
+	return methods, nil
+}
+
+// loadKey reads an unencrypted private key
+func loadKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, fmt.Errorf("SSH key %s is passphrase-protected: load it into ssh-agent instead", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH key %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// knownKeyAlgorithms lists the key algorithms known_hosts holds for addr, so
+// the server is asked for a key that can be verified instead of its
+// preferred one. It is empty if the host isn't known, leaving the default.
+func knownKeyAlgorithms(callback ssh.HostKeyCallback, addr string) []string {
+	// Checking a throwaway key makes the callback report the known keys
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		return nil
+	}
+	err = callback(addr, &net.TCPAddr{IP: net.IPv4zero}, signer.PublicKey())
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil
+	}
+	var algorithms []string
+	seen := make(map[string]bool)
+	for _, known := range keyErr.Want {
+		for _, algorithm := range keyAlgorithms(known.Key.Type()) {
+			if !seen[algorithm] {
+				seen[algorithm] = true
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+	}
+	return algorithms
+}
+
+// keyAlgorithms maps a key type to the signature algorithms that verify it
+func keyAlgorithms(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
@@ -0,0 +1,221 @@
+// Package workspace runs operations across several fleet repositories, e.g. an
+// installer managing multiple customers' homes from one machine
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/config"
+	"github.com/darkermage/shelly-git-ops/internal/gitops"
+	"github.com/darkermage/shelly-git-ops/internal/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultConcurrency = 4
+
+// Config lists the repositories of a workspace
+type Config struct {
+	Concurrency int          `yaml:"concurrency,omitempty" json:"concurrency,omitempty" toml:"concurrency,omitempty"`
+	Repos       []RepoConfig `yaml:"repos" json:"repos" toml:"repos"`
+}
+
+// RepoConfig describes one repository and the credentials isolated to it
+type RepoConfig struct {
+	Name string `yaml:"name" json:"name" toml:"name"`
+	Path string `yaml:"path" json:"path" toml:"path"`
+
+	// Credentials is a credentials.json for this repository only. The custom
+	// fields device_username and device_password are used for device auth.
+	Credentials string `yaml:"credentials,omitempty" json:"credentials,omitempty" toml:"credentials,omitempty"`
+
+	// Secrets is the secret store exposed to this repository's templates
+	Secrets string `yaml:"secrets,omitempty" json:"secrets,omitempty" toml:"secrets,omitempty"`
+
+	// Addressing is an addressing.json describing how this repository's
+	// devices are reached, e.g. through the site's VPN or an SSH jump host
+	Addressing string `yaml:"addressing,omitempty" json:"addressing,omitempty" toml:"addressing,omitempty"`
+}
+
+// RepoResult is the outcome of an operation on one repository
+type RepoResult struct {
+	Repo     string
+	Results  []gitops.SyncResult
+	Error    error
+	Duration time.Duration
+}
+
+// Report combines the results of all repositories in workspace order
+type Report struct {
+	Repos []RepoResult
+}
+
+// Operation is run once per repository with a SyncManager scoped to it
+type Operation func(ctx context.Context, sm *gitops.SyncManager) ([]gitops.SyncResult, error)
+
+// LoadConfig loads a workspace config from a YAML, JSON or TOML file
+// Relative repository and credential paths are resolved against the config's directory
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace config: %w", err)
+	}
+
+	var cfg Config
+	if err := storage.Unmarshal(storage.FormatFromPath(path), data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workspace config: %w", err)
+	}
+
+	baseDir := filepath.Dir(path)
+	seen := make(map[string]bool, len(cfg.Repos))
+	for i := range cfg.Repos {
+		repo := &cfg.Repos[i]
+		if repo.Path == "" {
+			return nil, fmt.Errorf("repository %d has no path", i+1)
+		}
+		if repo.Name == "" {
+			repo.Name = filepath.Base(repo.Path)
+		}
+		if seen[repo.Name] {
+			return nil, fmt.Errorf("duplicate repository name %q", repo.Name)
+		}
+		seen[repo.Name] = true
+
+		repo.Path = resolvePath(baseDir, repo.Path)
+		repo.Credentials = resolvePath(baseDir, repo.Credentials)
+		repo.Secrets = resolvePath(baseDir, repo.Secrets)
+		repo.Addressing = resolvePath(baseDir, repo.Addressing)
+	}
+
+	return &cfg, nil
+}
+
+// resolvePath expands ~ and makes relative paths relative to baseDir
+func resolvePath(baseDir, path string) string {
+	if path == "" {
+		return ""
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	return path
+}
+
+// Run runs op against every repository concurrently. A failure in one
+// repository never affects the others; it is recorded in its RepoResult.
+func (cfg *Config) Run(ctx context.Context, op Operation) *Report {
+	report := &Report{Repos: make([]RepoResult, len(cfg.Repos))}
+
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	var g errgroup.Group
+	g.SetLimit(concurrency)
+
+	for i, repo := range cfg.Repos {
+		i, repo := i, repo
+		g.Go(func() error {
+			start := time.Now()
+			results, err := runRepo(ctx, repo, op)
+			report.Repos[i] = RepoResult{
+				Repo:     repo.Name,
+				Results:  results,
+				Error:    err,
+				Duration: time.Since(start),
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	return report
+}
+
+// runRepo opens a repository with its own credentials and runs op on it
+func runRepo(ctx context.Context, repo RepoConfig, op Operation) ([]gitops.SyncResult, error) {
+	sm, err := gitops.NewSyncManager(repo.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer sm.Close()
+
+	if repo.Credentials != "" {
+		creds, err := config.NewCredentialStore(repo.Credentials).Load()
+		if err != nil {
+			return nil, err
+		}
+		if creds.Custom["device_password"] != "" {
+			sm.SetDeviceAuth(creds.Custom["device_username"], creds.Custom["device_password"])
+		}
+	}
+	if repo.Secrets != "" {
+		sm.SetSecretStore(config.NewSecretStore(repo.Secrets))
+	}
+	if repo.Addressing != "" {
+		addressing, err := config.LoadAddressing(repo.Addressing)
+		if err != nil {
+			return nil, err
+		}
+		if err := sm.SetAddressing(addressing); err != nil {
+			return nil, err
+		}
+	}
+
+	return op(ctx, sm)
+}
+
+// Failed returns the number of repositories with an error or a failed device
+func (r *Report) Failed() int {
+	failed := 0
+	for _, repo := range r.Repos {
+		if repo.Error != nil {
+			failed++
+			continue
+		}
+		for _, result := range repo.Results {
+			if !result.Success {
+				failed++
+				break
+			}
+		}
+	}
+	return failed
+}
+
+// String renders a combined per-repository summary
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, repo := range r.Repos {
+		if repo.Error != nil {
+			fmt.Fprintf(&b, "%s: error: %v\n", repo.Repo, repo.Error)
+			continue
+		}
+
+		succeeded := 0
+		for _, result := range repo.Results {
+			if result.Success {
+				succeeded++
+			}
+		}
+		fmt.Fprintf(&b, "%s: %d/%d devices succeeded (%s)\n", repo.Repo, succeeded, len(repo.Results), repo.Duration.Round(time.Millisecond))
+
+		for _, result := range repo.Results {
+			if !result.Success && result.Error != nil {
+				fmt.Fprintf(&b, "  %s: %v\n", result.DeviceID, result.Error)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "%d repositories, %d with failures\n", len(r.Repos), r.Failed())
+	return b.String()
+}
@@ -3,10 +3,13 @@ package shelly
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -14,7 +17,37 @@ import (
 type Client struct {
 	httpClient *http.Client
 	auth       *AuthConfig
-}
+	credFunc   CredentialsFunc
+	observer   CallObserver
+	tracer     *tracer
+	retry      RetryPolicy
+	resolver   AddressResolver
+	relays     RelayResolver
+	https      HTTPSFunc
+	tlsConfig  *tls.Config
+	inflight   *inflightLimiter
+	serial     *inflightLimiter // one slot per paced device
+	pacingFunc PacingFunc
+
+	timeoutFunc    TimeoutFunc
+	connectTimeout time.Duration // 0 keeps the transport's dialer
+	dialFunc       DialFunc      // nil dials devices directly
+}
+
+// AddressResolver maps the device address a caller uses (usually its LAN IP)
+// to the host[:port] actually dialled, e.g. through a VPN or subnet router
+type AddressResolver func(deviceIP string) string
+
+// RelayFunc carries a single RPC call to a device that can't be reached over
+// the local network, e.g. through the Shelly Cloud, and returns its result
+type RelayFunc func(ctx context.Context, method string, params interface{}) (json.RawMessage, error)
+
+// RelayResolver returns the relay for a device address, or nil to call the
+// device directly
+type RelayResolver func(deviceIP string) RelayFunc
+
+// CallObserver is notified after every RPC call with its duration and outcome
+type CallObserver func(deviceIP, method string, duration time.Duration, err error)
 
 // AuthConfig holds authentication configuration
 type AuthConfig struct {
@@ -22,9 +55,14 @@ type AuthConfig struct {
 	Password string
 }
 
+// CredentialsFunc returns the credentials for a single device, or nil to use
+// the client's default credentials set with SetAuth
+type CredentialsFunc func(deviceIP string) *AuthConfig
+
 // RPCRequest represents a JSON-RPC request
 type RPCRequest struct {
 	ID     int         `json:"id"`
+	Src    string      `json:"src,omitempty"` // identifies the peer on websocket connections
 	Method string      `json:"method"`
 	Params interface{} `json:"params,omitempty"`
 	Auth   *RPCAuth    `json:"auth,omitempty"`
@@ -32,11 +70,11 @@ type RPCRequest struct {
 
 // RPCAuth represents RPC authentication
 type RPCAuth struct {
-	Realm    string `json:"realm"`
-	Username string `json:"username"`
-	Nonce    int64  `json:"nonce"`
-	CNonce   int64  `json:"cnonce"`
-	Response string `json:"response"`
+	Realm     string `json:"realm"`
+	Username  string `json:"username"`
+	Nonce     int64  `json:"nonce"`
+	CNonce    int64  `json:"cnonce"`
+	Response  string `json:"response"`
 	Algorithm string `json:"algorithm"`
 }
 
@@ -49,22 +87,23 @@ type RPCResponse struct {
 	Error  *RPCError       `json:"error,omitempty"`
 }
 
-// RPCError represents an RPC error
-type RPCError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-}
-
-// NewClient creates a new Shelly API client
-func NewClient() *Client {
-	return &Client{
+// NewClient creates a new Shelly API client. Without options it uses its own
+// HTTP client with DefaultTimeout, keep-alive connections pooled per device,
+// no authentication and no retries.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   DefaultTimeout,
+			Transport: newTransport(),
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-// SetAuth sets authentication credentials
+// SetAuth sets authentication credentials. An empty username means DefaultUsername.
 func (c *Client) SetAuth(username, password string) {
 	c.auth = &AuthConfig{
 		Username: username,
@@ -72,35 +111,87 @@ func (c *Client) SetAuth(username, password string) {
 	}
 }
 
-// Call executes an RPC call to a Shelly device
-func (c *Client) Call(ctx context.Context, deviceIP, method string, params interface{}) (json.RawMessage, error) {
-	req := RPCRequest{
-		ID:     1,
-		Method: method,
-		Params: params,
+// SetCredentialsFunc sets a lookup for per-device credentials, consulted
+// before the default credentials
+func (c *Client) SetCredentialsFunc(credFunc CredentialsFunc) {
+	c.credFunc = credFunc
+}
+
+// authFor returns the credentials to answer a challenge from deviceIP with,
+// nil if there are none
+func (c *Client) authFor(deviceIP string) *AuthConfig {
+	if c.credFunc != nil {
+		if auth := c.credFunc(deviceIP); auth != nil {
+			return auth
+		}
 	}
+	return c.auth
+}
 
-	// TODO: Implement digest authentication if needed
-	// if c.auth != nil {
-	//     req.Auth = c.buildAuth(method)
-	// }
+// SetAddressResolver sets how device addresses are translated before dialling;
+// nil dials them as given
+func (c *Client) SetAddressResolver(resolver AddressResolver) {
+	c.resolver = resolver
+}
 
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+// address returns the host[:port] to dial for deviceIP
+func (c *Client) address(deviceIP string) string {
+	if c.resolver == nil {
+		return deviceIP
+	}
+	return c.resolver(deviceIP)
+}
+
+// SetRelayResolver sets how calls to devices outside the local network are
+// carried; nil calls every device directly
+func (c *Client) SetRelayResolver(relays RelayResolver) {
+	c.relays = relays
+}
+
+// relay returns the relay for deviceIP, nil for a direct call
+func (c *Client) relay(deviceIP string) RelayFunc {
+	if c.relays == nil {
+		return nil
 	}
+	return c.relays(deviceIP)
+}
+
+// SetObserver registers a callback invoked after every RPC call
+func (c *Client) SetObserver(observer CallObserver) {
+	c.observer = observer
+}
 
-	url := fmt.Sprintf("http://%s/rpc", deviceIP)
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+// Call executes an RPC call to a Shelly device
+func (c *Client) Call(ctx context.Context, deviceIP, method string, params interface{}) (json.RawMessage, error) {
+	release, err := c.acquireSlot(ctx, deviceIP)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
+	}
+	defer release()
+
+	if c.observer == nil && c.tracer == nil {
+		return c.call(ctx, deviceIP, method, params)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
+	start := time.Now()
+	result, err := c.call(ctx, deviceIP, method, params)
+	duration := time.Since(start)
+	if c.observer != nil {
+		c.observer(deviceIP, method, duration, err)
+	}
+	c.trace(ctx, deviceIP, method, params, result, duration, err)
+	return result, err
+}
 
-	resp, err := c.httpClient.Do(httpReq)
+// call performs a single RPC round trip
+func (c *Client) call(ctx context.Context, deviceIP, method string, params interface{}) (json.RawMessage, error) {
+	if relay := c.relay(deviceIP); relay != nil {
+		return relay(ctx, method, params)
+	}
+
+	resp, err := c.send(ctx, deviceIP, method, params)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -115,12 +206,217 @@ func (c *Client) Call(ctx context.Context, deviceIP, method string, params inter
 	}
 
 	if rpcResp.Error != nil {
-		return nil, fmt.Errorf("RPC error %d: %s", rpcResp.Error.Code, rpcResp.Error.Message)
+		return nil, rpcResp.Error
 	}
 
 	return rpcResp.Result, nil
 }
 
+// send posts an RPC request and returns the raw HTTP response, answering a
+// digest authentication challenge when credentials are set
+func (c *Client) send(ctx context.Context, deviceIP, method string, params interface{}) (*http.Response, error) {
+	req := RPCRequest{
+		ID:     1,
+		Method: method,
+		Params: params,
+	}
+
+	resp, err := c.post(ctx, deviceIP, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	auth := c.authFor(deviceIP)
+	if auth == nil {
+		closeBody(resp.Body)
+		return nil, fmt.Errorf("%s requires authentication: %w", deviceIP, &RPCError{Code: CodeUnauthorized, Message: "no credentials set"})
+	}
+
+	challenge, err := challengeFrom(resp)
+	closeBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Auth = buildAuth(auth, challenge)
+	resp, err = c.post(ctx, deviceIP, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		closeBody(resp.Body)
+		return nil, fmt.Errorf("authentication failed for %s: %w", deviceIP, &RPCError{Code: CodeUnauthorized, Message: "wrong password"})
+	}
+
+	return resp, nil
+}
+
+// post sends req, retrying per the client's retry policy while the device is
+// unreachable or answers with a server error. Calls that create an entry are
+// sent once (see retryable).
+func (c *Client) post(ctx context.Context, deviceIP string, req RPCRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	scheme := "http"
+	if c.useHTTPS(deviceIP) {
+		scheme = "https"
+	}
+	url := fmt.Sprintf("%s://%s/rpc", scheme, c.address(deviceIP))
+	ctx, httpClient := c.clientFor(ctx, deviceIP)
+	backoff := c.retry.Backoff
+	attempts := c.retry.Attempts
+	if !retryable(req.Method) {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(httpReq)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			if err != nil {
+				return nil, fmt.Errorf("request failed: %w", err)
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			closeBody(resp.Body)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("request failed: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// retryable reports whether method can be sent again after a failed round
+// trip. A create that times out may still have gone through on the device, so
+// sending it again could leave a duplicate; EnsureSchedule and EnsureWebhook
+// retry creates after checking what the device has.
+func retryable(method string) bool {
+	return !strings.HasSuffix(method, ".Create") && method != "Virtual.Add"
+}
+
+// StreamConfig calls Shelly.GetConfig and passes each component's config to fn
+// as it is decoded from the response, so the full payload is never held in
+// memory at once. Returning an error from fn stops the stream.
+func (c *Client) StreamConfig(ctx context.Context, deviceIP string, fn func(component string, config json.RawMessage) error) error {
+	release, err := c.acquireSlot(ctx, deviceIP)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	start := time.Now()
+	err = c.streamConfig(ctx, deviceIP, fn)
+	duration := time.Since(start)
+	if c.observer != nil {
+		c.observer(deviceIP, "Shelly.GetConfig", duration, err)
+	}
+	// The streamed payload isn't kept, so only the call itself is traced
+	c.trace(ctx, deviceIP, "Shelly.GetConfig", nil, nil, duration, err)
+	return err
+}
+
+func (c *Client) streamConfig(ctx context.Context, deviceIP string, fn func(component string, config json.RawMessage) error) error {
+	if relay := c.relay(deviceIP); relay != nil {
+		result, err := relay(ctx, "Shelly.GetConfig", nil)
+		if err != nil {
+			return err
+		}
+		return streamComponents(json.NewDecoder(bytes.NewReader(result)), fn)
+	}
+
+	resp, err := c.send(ctx, deviceIP, "Shelly.GetConfig", nil)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp.Body)
+
+	dec := json.NewDecoder(resp.Body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+
+		switch key {
+		case "result":
+			if err := streamComponents(dec, fn); err != nil {
+				return err
+			}
+		case "error":
+			var rpcErr RPCError
+			if err := dec.Decode(&rpcErr); err != nil {
+				return fmt.Errorf("failed to unmarshal error: %w", err)
+			}
+			return &rpcErr
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("failed to read response: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// streamComponents decodes a Shelly.GetConfig result object, passing each
+// component's config to fn
+func streamComponents(dec *json.Decoder, fn func(component string, config json.RawMessage) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		component, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to read config: %w", err)
+		}
+		var config json.RawMessage
+		if err := dec.Decode(&config); err != nil {
+			return fmt.Errorf("failed to read %v config: %w", component, err)
+		}
+		if err := fn(fmt.Sprint(component), config); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token and checks that it is the given delimiter
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if token != delim {
+		return fmt.Errorf("unexpected token %v in response, expected %v", token, delim)
+	}
+	return nil
+}
+
 // GetDeviceInfo retrieves device information
 func (c *Client) GetDeviceInfo(ctx context.Context, deviceIP string) (*DeviceInfo, error) {
 	result, err := c.Call(ctx, deviceIP, "Shelly.GetDeviceInfo", nil)
@@ -161,11 +457,29 @@ func (c *Client) GetComponentConfig(ctx context.Context, deviceIP, component str
 
 // SetComponentConfig sets configuration for a specific component
 func (c *Client) SetComponentConfig(ctx context.Context, deviceIP, component string, config interface{}) error {
-	method := component + ".SetConfig"
-	_, err := c.Call(ctx, deviceIP, method, config)
+	_, err := c.ApplyComponentConfig(ctx, deviceIP, component, config)
 	return err
 }
 
+// ApplyComponentConfig sets configuration for a specific component and
+// reports whether the device must reboot for it to take effect
+func (c *Client) ApplyComponentConfig(ctx context.Context, deviceIP, component string, config interface{}) (bool, error) {
+	method := component + ".SetConfig"
+	result, err := c.Call(ctx, deviceIP, method, config)
+	if err != nil {
+		return false, err
+	}
+	return restartRequired(result), nil
+}
+
+// restartRequired reads the restart_required flag of a SetConfig result
+func restartRequired(result json.RawMessage) bool {
+	var response struct {
+		RestartRequired bool `json:"restart_required"`
+	}
+	return json.Unmarshal(result, &response) == nil && response.RestartRequired
+}
+
 // GetConfig retrieves system-level device configuration
 func (c *Client) GetConfig(ctx context.Context, deviceIP string) (json.RawMessage, error) {
 	return c.Call(ctx, deviceIP, "Sys.GetConfig", nil)
@@ -303,6 +617,30 @@ func (c *Client) GetStatus(ctx context.Context, deviceIP string) (json.RawMessag
 	return c.Call(ctx, deviceIP, "Shelly.GetStatus", nil)
 }
 
+// CheckForUpdate asks the device for firmware newer than its own, keyed by
+// channel ("stable", "beta"); channels without a newer version are absent
+func (c *Client) CheckForUpdate(ctx context.Context, deviceIP string) (map[string]FirmwareVersion, error) {
+	result, err := c.Call(ctx, deviceIP, "Shelly.CheckForUpdate", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var updates map[string]FirmwareVersion
+	if err := json.Unmarshal(result, &updates); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal available updates: %w", err)
+	}
+
+	return updates, nil
+}
+
+// Update starts a firmware update from the given channel ("stable" or
+// "beta"). The device downloads the firmware and reboots on its own, so the
+// call returns long before the update is done.
+func (c *Client) Update(ctx context.Context, deviceIP string, stage string) error {
+	_, err := c.Call(ctx, deviceIP, "Shelly.Update", map[string]interface{}{"stage": stage})
+	return err
+}
+
 // Reboot reboots the device
 func (c *Client) Reboot(ctx context.Context, deviceIP string) error {
 	_, err := c.Call(ctx, deviceIP, "Shelly.Reboot", nil)
@@ -384,6 +722,31 @@ func (c *Client) ListWebhooks(ctx context.Context, deviceIP string) ([]Webhook,
 	return response.Hooks, nil
 }
 
+// ListSupportedWebhookEvents returns the webhook events the device offers,
+// e.g. "switch.on" (Webhook.ListSupported)
+func (c *Client) ListSupportedWebhookEvents(ctx context.Context, deviceIP string) ([]string, error) {
+	result, err := c.Call(ctx, deviceIP, "Webhook.ListSupported", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Current firmware returns a map of event types, older firmware a list
+	var response struct {
+		Types     map[string]json.RawMessage `json:"types"`
+		HookTypes []string                   `json:"hook_types"`
+	}
+	if err := json.Unmarshal(result, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal supported webhook events: %w", err)
+	}
+
+	events := response.HookTypes
+	for event := range response.Types {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	return events, nil
+}
+
 // CreateWebhook creates a new webhook
 func (c *Client) CreateWebhook(ctx context.Context, deviceIP string, webhook Webhook) (int, error) {
 	params := map[string]interface{}{
@@ -527,6 +890,13 @@ func (c *Client) GetKVS(ctx context.Context, deviceIP string) (map[string]interf
 // GetComponents retrieves all components including virtual components and groups
 // Handles pagination automatically to fetch all components
 func (c *Client) GetComponents(ctx context.Context, deviceIP string) ([]ComponentInfo, error) {
+	return c.GetComponentsIncluding(ctx, deviceIP)
+}
+
+// GetComponentsIncluding is GetComponents asking for the given component
+// properties ("config", "status"), so a single paginated call returns the
+// config and status of every component. Without include the device decides.
+func (c *Client) GetComponentsIncluding(ctx context.Context, deviceIP string, include ...string) ([]ComponentInfo, error) {
 	var allComponents []ComponentInfo
 	offset := 0
 
@@ -535,6 +905,9 @@ func (c *Client) GetComponents(ctx context.Context, deviceIP string) ([]Componen
 		params := map[string]interface{}{
 			"offset": offset,
 		}
+		if len(include) > 0 {
+			params["include"] = include
+		}
 		result, err := c.Call(ctx, deviceIP, "Shelly.GetComponents", params)
 		if err != nil {
 			return nil, err
@@ -568,3 +941,55 @@ func (c *Client) GetComponents(ctx context.Context, deviceIP string) ([]Componen
 
 	return allComponents, nil
 }
+
+// AddVirtualComponent creates a virtual component of the given type
+// If id is nil, the device assigns the next free ID
+func (c *Client) AddVirtualComponent(ctx context.Context, deviceIP, componentType string, id *int, config map[string]interface{}) (int, error) {
+	params := map[string]interface{}{
+		"type": componentType,
+	}
+	if id != nil {
+		params["id"] = *id
+	}
+	if len(config) > 0 {
+		params["config"] = config
+	}
+
+	result, err := c.Call(ctx, deviceIP, "Virtual.Add", params)
+	if err != nil {
+		return 0, err
+	}
+
+	var response struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(result, &response); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal add response: %w", err)
+	}
+
+	return response.ID, nil
+}
+
+// DeleteVirtualComponent deletes a virtual component by key (e.g. "boolean:200")
+func (c *Client) DeleteVirtualComponent(ctx context.Context, deviceIP, key string) error {
+	_, err := c.Call(ctx, deviceIP, "Virtual.Delete", map[string]interface{}{"key": key})
+	return err
+}
+
+// SetConfigs applies the configs of several components in a single
+// Shelly.SetConfig call, keyed by component key ("sys", "switch:0", ...).
+// Only newer firmware supports it; check ListMethods first.
+func (c *Client) SetConfigs(ctx context.Context, deviceIP string, configs map[string]interface{}) error {
+	_, err := c.ApplyConfigs(ctx, deviceIP, configs)
+	return err
+}
+
+// ApplyConfigs is SetConfigs, also reporting whether the device must reboot
+// for the configs to take effect
+func (c *Client) ApplyConfigs(ctx context.Context, deviceIP string, configs map[string]interface{}) (bool, error) {
+	result, err := c.Call(ctx, deviceIP, "Shelly.SetConfig", map[string]interface{}{"config": configs})
+	if err != nil {
+		return false, err
+	}
+	return restartRequired(result), nil
+}
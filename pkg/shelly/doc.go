@@ -0,0 +1,19 @@
+// Package shelly is a client for the RPC API of Shelly Gen2 and later devices
+// (Plus, Pro and Gen3 series) over HTTP and websocket.
+//
+// The package is public and its exported API follows semantic versioning of
+// the module: exported identifiers are not removed or changed incompatibly
+// outside a major release. A client is created with NewClient and configured
+// with options:
+//
+//	client := shelly.NewClient(
+//		shelly.WithAuth("admin", password),
+//		shelly.WithTimeout(10*time.Second),
+//		shelly.WithRetry(shelly.RetryPolicy{Attempts: 3, Backoff: 500 * time.Millisecond}),
+//	)
+//	info, err := client.GetDeviceInfo(ctx, "192.168.1.50")
+//
+// Every method takes the device address as host or host:port. A Client is
+// safe for concurrent use once configured; the Set* methods must not be called
+// while calls are in flight.
+package shelly
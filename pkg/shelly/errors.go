@@ -0,0 +1,93 @@
+package shelly
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// RPC error codes returned by Shelly devices
+const (
+	CodeInvalidArgument    = -103 // a parameter is missing, has the wrong type or is out of range
+	CodeDeadlineExceeded   = -104 // the device didn't finish the call in time
+	CodeNotFound           = -105 // the addressed component, script, schedule or key doesn't exist
+	CodeAlreadyExists      = -106 // the resource already exists
+	CodeResourceExhausted  = -108 // a resource limit was hit, e.g. too many scripts or schedules
+	CodeFailedPrecondition = -109 // the device is in the wrong state for the call, e.g. script running
+	CodeUnavailable        = -114 // the call can't be served right now, e.g. out of memory or busy
+	CodeUnauthorized       = 401  // authentication is enabled and credentials are missing or wrong
+	CodeMethodNotFound     = 404  // the firmware doesn't have the method
+)
+
+// Sentinel errors for matching RPC errors by code with errors.Is, e.g.
+// errors.Is(err, shelly.ErrNotFound)
+var (
+	ErrInvalidArgument    = &RPCError{Code: CodeInvalidArgument}
+	ErrDeadlineExceeded   = &RPCError{Code: CodeDeadlineExceeded}
+	ErrNotFound           = &RPCError{Code: CodeNotFound}
+	ErrAlreadyExists      = &RPCError{Code: CodeAlreadyExists}
+	ErrResourceExhausted  = &RPCError{Code: CodeResourceExhausted}
+	ErrFailedPrecondition = &RPCError{Code: CodeFailedPrecondition}
+	ErrUnavailable        = &RPCError{Code: CodeUnavailable}
+	ErrUnauthorized       = &RPCError{Code: CodeUnauthorized}
+	ErrMethodNotFound     = &RPCError{Code: CodeMethodNotFound}
+)
+
+// rpcErrorHints are the remediation hints shown for known error codes
+var rpcErrorHints = map[int]string{
+	CodeInvalidArgument:    "the device rejected a value; check the field against the device's API documentation and firmware version (newer fields need newer firmware)",
+	CodeDeadlineExceeded:   "the device is slow or overloaded; retry, or raise the client timeout",
+	CodeNotFound:           "the component or entry doesn't exist on the device; pull to refresh the repository, or check the model supports it",
+	CodeAlreadyExists:      "an entry with this ID or name already exists on the device; pull to refresh the repository",
+	CodeResourceExhausted:  "the device hit a resource limit (scripts, schedules, webhooks or KVS entries); remove unused entries or split them across devices",
+	CodeFailedPrecondition: "the device is in the wrong state for this change, e.g. a running script; stop it or reboot the device and retry",
+	CodeUnavailable:        "the device can't serve the call right now, often from low memory with scripts running; stop scripts or reboot and retry",
+	CodeUnauthorized:       "the device has authentication enabled; set its password for this device or the whole fleet",
+	CodeMethodNotFound:     "the firmware doesn't support this call; update the device firmware",
+}
+
+// RPCError is an error returned by the device for an RPC call
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements error
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
+}
+
+// Is reports whether target is an RPC error with the same code, so the
+// sentinel errors match any message
+func (e *RPCError) Is(target error) bool {
+	t, ok := target.(*RPCError)
+	return ok && t.Code == e.Code
+}
+
+// Hint returns what the user can do about the error, or "" for unknown codes
+func (e *RPCError) Hint() string {
+	return rpcErrorHints[e.Code]
+}
+
+// Hint returns the remediation hint of the RPC or certificate error in err's
+// chain, or "" if there is none
+func Hint(err error) string {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Hint()
+	}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var verifyErr *tls.CertificateVerificationError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return "trust the CA that signed the device certificate (TLSOptions.CAFile), or skip verification for self-signed certificates"
+	case errors.As(err, &hostnameErr):
+		return "the device certificate doesn't name the address it is called at; add it to the certificate or skip verification"
+	case errors.As(err, &verifyErr):
+		return "check the device certificate and TLSOptions"
+	}
+	return ""
+}
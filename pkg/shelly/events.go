@@ -0,0 +1,131 @@
+package shelly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Notification is an unsolicited frame sent by a device over the RPC websocket
+// (NotifyStatus, NotifyFullStatus or NotifyEvent)
+type Notification struct {
+	Src    string          `json:"src"`
+	Dst    string          `json:"dst"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// Event is a single event from a NotifyEvent notification
+type Event struct {
+	Component string  `json:"component"`
+	ID        *int    `json:"id,omitempty"`
+	Event     string  `json:"event"`
+	CfgRev    int     `json:"cfg_rev,omitempty"`
+	TS        float64 `json:"ts"`
+}
+
+// Events extracts the events of a NotifyEvent notification
+func (n *Notification) Events() ([]Event, error) {
+	if n.Method != "NotifyEvent" {
+		return nil, nil
+	}
+
+	var params struct {
+		Events []Event `json:"events"`
+	}
+	if err := json.Unmarshal(n.Params, &params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal events: %w", err)
+	}
+
+	return params.Events, nil
+}
+
+// SubscribeEvents opens the device's RPC websocket and calls handler for every
+// notification until ctx is cancelled or the connection fails
+func (c *Client) SubscribeEvents(ctx context.Context, deviceIP string, handler func(Notification)) error {
+	if c.relay(deviceIP) != nil {
+		return fmt.Errorf("%s is reached through a relay, which carries no event stream", deviceIP)
+	}
+
+	scheme := "ws"
+	if c.useHTTPS(deviceIP) {
+		scheme = "wss"
+	}
+	url := fmt.Sprintf("%s://%s/rpc", scheme, c.address(deviceIP))
+
+	dialCtx, httpClient := c.clientFor(ctx, deviceIP)
+	dialer := websocket.Dialer{HandshakeTimeout: httpClient.Timeout, TLSClientConfig: c.tlsConfig}
+	if c.dialFunc != nil {
+		dialer.NetDialContext = func(netCtx context.Context, network, addr string) (net.Conn, error) {
+			if timeout, ok := dialCtx.Value(dialTimeoutKey{}).(time.Duration); ok {
+				netCtx = context.WithValue(netCtx, dialTimeoutKey{}, timeout)
+			}
+			return c.dialContext(netCtx, network, addr)
+		}
+	}
+	conn, _, err := dialer.DialContext(ctx, url, http.Header{})
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", url, err)
+	}
+	defer conn.Close()
+
+	// Devices only send notifications to peers that identified themselves with
+	// a src; devices with authentication enabled only after it is answered
+	hello := RPCRequest{ID: 1, Src: "shelly-gitops", Method: "Shelly.GetDeviceInfo"}
+	if err := conn.WriteJSON(hello); err != nil {
+		return fmt.Errorf("failed to send subscribe request: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	authenticated := false
+	for {
+		var frame struct {
+			Notification
+			ID    *int      `json:"id"`
+			Error *RPCError `json:"error"`
+		}
+		if err := conn.ReadJSON(&frame); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("event stream from %s closed: %w", deviceIP, err)
+		}
+
+		if frame.ID != nil && frame.Error != nil && frame.Error.Code == CodeUnauthorized {
+			auth := c.authFor(deviceIP)
+			if auth == nil {
+				return fmt.Errorf("%s requires authentication: %w", deviceIP, &RPCError{Code: CodeUnauthorized, Message: "no credentials set"})
+			}
+			if authenticated {
+				return fmt.Errorf("authentication failed for %s: %w", deviceIP, &RPCError{Code: CodeUnauthorized, Message: "wrong password"})
+			}
+			challenge, err := challengeFromError(frame.Error)
+			if err != nil {
+				return err
+			}
+			hello.ID++
+			hello.Auth = buildAuth(auth, challenge)
+			if err := conn.WriteJSON(hello); err != nil {
+				return fmt.Errorf("failed to send subscribe request: %w", err)
+			}
+			authenticated = true
+			continue
+		}
+
+		// Skip responses to our own requests
+		if frame.ID != nil || frame.Method == "" {
+			continue
+		}
+
+		handler(frame.Notification)
+	}
+}
@@ -0,0 +1,101 @@
+package shelly
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// A create call that times out may still have succeeded on the device, and
+// retrying it then leaves a duplicate. Creates are therefore never retried
+// by the client itself; the Ensure methods look for an identical entry
+// before creating one and again after a failed create, and only create again
+// when the device doesn't have it.
+
+// EnsureSchedule creates schedule unless the device already has one with the
+// same content. It returns the ID of the matching or created schedule and
+// whether it was created.
+func (c *Client) EnsureSchedule(ctx context.Context, deviceIP string, schedule Schedule) (int, bool, error) {
+	hash := schedule.ContentHash()
+	find := func() (int, bool, error) {
+		existing, err := c.ListSchedules(ctx, deviceIP)
+		if err != nil {
+			return 0, false, err
+		}
+		for _, candidate := range existing {
+			if candidate.ContentHash() == hash {
+				return candidate.ID, true, nil
+			}
+		}
+		return 0, false, nil
+	}
+
+	return c.ensure(ctx, find, func() (int, error) {
+		return c.CreateSchedule(ctx, deviceIP, schedule)
+	})
+}
+
+// EnsureWebhook creates webhook unless the device already has one with the
+// same content. It returns the ID of the matching or created webhook and
+// whether it was created.
+func (c *Client) EnsureWebhook(ctx context.Context, deviceIP string, webhook Webhook) (int, bool, error) {
+	hash := webhook.ContentHash()
+	find := func() (int, bool, error) {
+		existing, err := c.ListWebhooks(ctx, deviceIP)
+		if err != nil {
+			return 0, false, err
+		}
+		for _, candidate := range existing {
+			if candidate.ContentHash() == hash {
+				return candidate.ID, true, nil
+			}
+		}
+		return 0, false, nil
+	}
+
+	return c.ensure(ctx, find, func() (int, error) {
+		return c.CreateWebhook(ctx, deviceIP, webhook)
+	})
+}
+
+// ensure calls create unless find locates the entry. A create that fails
+// without an answer from the device is retried per the client's retry
+// policy, but only after find shows it didn't go through.
+func (c *Client) ensure(ctx context.Context, find func() (int, bool, error), create func() (int, error)) (int, bool, error) {
+	id, found, err := find()
+	if err != nil {
+		return 0, false, err
+	}
+	if found {
+		return id, false, nil
+	}
+
+	backoff := c.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		id, err := create()
+		if err == nil {
+			return id, true, nil
+		}
+
+		// An RPC error means the device refused the create
+		var rpcErr *RPCError
+		retry := !errors.As(err, &rpcErr) && attempt < c.retry.Attempts
+		if retry {
+			select {
+			case <-ctx.Done():
+				return 0, false, err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		// The create may have gone through before the error
+		id, found, findErr := find()
+		if findErr == nil && found {
+			return id, true, nil
+		}
+		if !retry || findErr != nil {
+			return 0, false, err
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package shelly
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scheduleDevice serves Schedule.List and Schedule.Create. Its first create
+// either goes through but answers too late (timeout) or fails without
+// creating anything.
+type scheduleDevice struct {
+	timeout bool
+
+	mu      sync.Mutex
+	jobs    []Schedule
+	creates int
+}
+
+func (d *scheduleDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     int             `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d.mu.Lock()
+	var result interface{}
+	switch req.Method {
+	case "Schedule.List":
+		result = map[string]interface{}{"jobs": d.jobs, "rev": len(d.jobs)}
+	case "Schedule.Create":
+		d.creates++
+		if d.creates == 1 && !d.timeout {
+			d.mu.Unlock()
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		var schedule Schedule
+		json.Unmarshal(req.Params, &schedule)
+		schedule.ID = len(d.jobs) + 1
+		d.jobs = append(d.jobs, schedule)
+		result = map[string]interface{}{"id": schedule.ID, "rev": len(d.jobs)}
+	}
+	late := req.Method == "Schedule.Create" && d.creates == 1
+	d.mu.Unlock()
+
+	if late {
+		time.Sleep(300 * time.Millisecond)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": req.ID, "result": result})
+}
+
+// counts returns how many creates the device got and how many schedules it has
+func (d *scheduleDevice) counts() (int, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.creates, len(d.jobs)
+}
+
+func newScheduleDevice(t *testing.T, timeout bool) (*scheduleDevice, *Client, string) {
+	t.Helper()
+	device := &scheduleDevice{timeout: timeout}
+	server := httptest.NewServer(device)
+	t.Cleanup(server.Close)
+
+	client := NewClient(
+		WithTimeout(100*time.Millisecond),
+		WithRetry(RetryPolicy{Attempts: 3, Backoff: 10 * time.Millisecond}),
+	)
+	return device, client, strings.TrimPrefix(server.URL, "http://")
+}
+
+var testSchedule = Schedule{Enable: true, Timespec: "0 0 7 * * *", Calls: []ScheduleCall{{Method: "Switch.Set", Params: map[string]interface{}{"id": 0.0, "on": true}}}}
+
+func TestCreateIsNotRetriedAfterTimeout(t *testing.T) {
+	device, client, addr := newScheduleDevice(t, true)
+
+	if _, err := client.CreateSchedule(context.Background(), addr, testSchedule); err == nil {
+		t.Fatal("create that timed out returned no error")
+	}
+	if creates, jobs := device.counts(); creates != 1 || jobs != 1 {
+		t.Errorf("device got %d creates and has %d schedules, want 1 and 1", creates, jobs)
+	}
+}
+
+func TestEnsureScheduleAfterTimedOutCreate(t *testing.T) {
+	device, client, addr := newScheduleDevice(t, true)
+
+	id, created, err := client.EnsureSchedule(context.Background(), addr, testSchedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || id != 1 {
+		t.Errorf("EnsureSchedule returned id %d, created %t; want 1, true", id, created)
+	}
+	if creates, jobs := device.counts(); creates != 1 || jobs != 1 {
+		t.Errorf("device got %d creates and has %d schedules, want 1 and 1", creates, jobs)
+	}
+}
+
+func TestEnsureScheduleRetriesFailedCreate(t *testing.T) {
+	device, client, addr := newScheduleDevice(t, false)
+
+	if _, _, err := client.EnsureSchedule(context.Background(), addr, testSchedule); err != nil {
+		t.Fatal(err)
+	}
+	if creates, jobs := device.counts(); creates != 2 || jobs != 1 {
+		t.Errorf("device got %d creates and has %d schedules, want 2 and 1", creates, jobs)
+	}
+}
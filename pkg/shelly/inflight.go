@@ -0,0 +1,58 @@
+package shelly
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// inflightLimiter bounds the calls in flight to each device, so callers
+// running many operations at once don't overwhelm a device or its access point
+type inflightLimiter struct {
+	max   int
+	mu    sync.Mutex
+	slots map[string]chan struct{} // by device address
+}
+
+// acquire waits for a free slot to deviceIP and returns its release function
+func (l *inflightLimiter) acquire(ctx context.Context, deviceIP string) (func(), error) {
+	l.mu.Lock()
+	slots, ok := l.slots[deviceIP]
+	if !ok {
+		slots = make(chan struct{}, l.max)
+		l.slots[deviceIP] = slots
+	}
+	l.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for a free call slot to %s: %w", deviceIP, ctx.Err())
+	}
+}
+
+// SetMaxInFlight limits how many calls run against a single device at the
+// same time; further calls wait for one to finish. Values <= 0 remove the
+// limit. Set it before the client is used.
+func (c *Client) SetMaxInFlight(n int) {
+	if n <= 0 {
+		c.inflight = nil
+		return
+	}
+	c.inflight = &inflightLimiter{max: n, slots: make(map[string]chan struct{})}
+}
+
+// acquireSlot waits for a free call slot to deviceIP if a limit is set or
+// the device is paced
+func (c *Client) acquireSlot(ctx context.Context, deviceIP string) (func(), error) {
+	if c.pacingFunc != nil {
+		if pacing := c.pacingFunc(deviceIP); pacing.Serial || pacing.Delay > 0 {
+			return c.acquirePaced(ctx, deviceIP, pacing.Delay)
+		}
+	}
+	if c.inflight == nil {
+		return func() {}, nil
+	}
+	return c.inflight.acquire(ctx, deviceIP)
+}
@@ -6,14 +6,22 @@ import "encoding/json"
 type DeviceInfo struct {
 	ID         string `json:"id"`
 	Name       string `json:"name"`
+	MAC        string `json:"mac"`
 	Model      string `json:"model"`
 	Gen        int    `json:"gen"`
 	FW         string `json:"fw_id"`
+	Ver        string `json:"ver"`
 	App        string `json:"app"`
 	Auth       bool   `json:"auth_en"`
 	AuthDomain string `json:"auth_domain"`
 }
 
+// FirmwareVersion is a firmware release offered by Shelly.CheckForUpdate
+type FirmwareVersion struct {
+	Version string `json:"version"`
+	BuildID string `json:"build_id"`
+}
+
 // Script represents a Shelly script
 type Script struct {
 	ID      int    `json:"id"`
@@ -45,26 +53,26 @@ type ComponentInfo struct {
 
 // BooleanComponent represents a boolean virtual component
 type BooleanComponent struct {
-	ID     int    `json:"id"`
-	Name   string `json:"name"`
-	Value  bool   `json:"value"`
-	Meta   ComponentMeta `json:"meta"`
+	ID    int           `json:"id"`
+	Name  string        `json:"name"`
+	Value bool          `json:"value"`
+	Meta  ComponentMeta `json:"meta"`
 }
 
 // NumberComponent represents a number virtual component
 type NumberComponent struct {
-	ID     int     `json:"id"`
-	Name   string  `json:"name"`
-	Value  float64 `json:"value"`
-	Meta   ComponentMeta `json:"meta"`
+	ID    int           `json:"id"`
+	Name  string        `json:"name"`
+	Value float64       `json:"value"`
+	Meta  ComponentMeta `json:"meta"`
 }
 
 // TextComponent represents a text virtual component
 type TextComponent struct {
-	ID     int    `json:"id"`
-	Name   string `json:"name"`
-	Value  string `json:"value"`
-	Meta   ComponentMeta `json:"meta"`
+	ID    int           `json:"id"`
+	Name  string        `json:"name"`
+	Value string        `json:"value"`
+	Meta  ComponentMeta `json:"meta"`
 }
 
 // ComponentMeta represents component metadata
@@ -86,10 +94,10 @@ type KVSData map[string]interface{}
 
 // Schedule represents a Shelly schedule
 type Schedule struct {
-	ID      int             `json:"id"`
-	Enable  bool            `json:"enable"`
+	ID       int            `json:"id"`
+	Enable   bool           `json:"enable"`
 	Timespec string         `json:"timespec"`
-	Calls   []ScheduleCall  `json:"calls"`
+	Calls    []ScheduleCall `json:"calls"`
 }
 
 // ScheduleCall represents a call within a schedule
@@ -0,0 +1,105 @@
+package shelly
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Devices return schedules and webhooks with server-side defaults filled in
+// (null params, empty URL lists, ...) that never appear in files written by
+// hand. Both sides are normalized before comparing or saving so those
+// differences don't show up as permanent drift.
+
+// Normalize returns the canonical form of a schedule
+func (s Schedule) Normalize() Schedule {
+	normalized := Schedule{
+		ID:       s.ID,
+		Enable:   s.Enable,
+		Timespec: strings.Join(strings.Fields(s.Timespec), " "),
+		Calls:    make([]ScheduleCall, 0, len(s.Calls)),
+	}
+	for _, call := range s.Calls {
+		normalized.Calls = append(normalized.Calls, ScheduleCall{
+			Method: call.Method,
+			Params: normalizeParams(call.Params),
+		})
+	}
+	return normalized
+}
+
+// Normalize returns the canonical form of a webhook
+func (w Webhook) Normalize() Webhook {
+	normalized := Webhook{
+		ID:     w.ID,
+		CID:    w.CID,
+		Enable: w.Enable,
+		Event:  w.Event,
+		Name:   strings.TrimSpace(w.Name),
+	}
+	for _, url := range w.URLs {
+		if url = strings.TrimSpace(url); url != "" {
+			normalized.URLs = append(normalized.URLs, url)
+		}
+	}
+	for _, action := range w.Actions {
+		normalized.Actions = append(normalized.Actions, Action{
+			Method: action.Method,
+			Params: normalizeParams(action.Params),
+		})
+	}
+	return normalized
+}
+
+// SchedulesEqual reports whether two schedules are the same once normalized
+func SchedulesEqual(a, b Schedule) bool {
+	return reflect.DeepEqual(a.Normalize(), b.Normalize())
+}
+
+// WebhooksEqual reports whether two webhooks are the same once normalized
+func WebhooksEqual(a, b Webhook) bool {
+	return reflect.DeepEqual(a.Normalize(), b.Normalize())
+}
+
+// ContentHash identifies a schedule by its normalized content, ignoring its ID,
+// so duplicates created under different IDs hash the same
+func (s Schedule) ContentHash() string {
+	normalized := s.Normalize()
+	normalized.ID = 0
+	return contentHash(normalized)
+}
+
+// ContentHash identifies a webhook by its normalized content, ignoring its ID
+func (w Webhook) ContentHash() string {
+	normalized := w.Normalize()
+	normalized.ID = 0
+	return contentHash(normalized)
+}
+
+// contentHash returns a short SHA-256 of the JSON encoding of v
+func contentHash(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// normalizeParams drops null values and treats empty params as absent
+func normalizeParams(params map[string]interface{}) map[string]interface{} {
+	if len(params) == 0 {
+		return nil
+	}
+
+	normalized := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if value == nil {
+			continue
+		}
+		normalized[key] = value
+	}
+	if len(normalized) == 0 {
+		return nil
+	}
+	return normalized
+}
@@ -0,0 +1,143 @@
+package shelly
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout is the per-request timeout of a client created without WithTimeout
+const DefaultTimeout = 30 * time.Second
+
+// Option configures a Client created by NewClient
+type Option func(*Client)
+
+// RetryPolicy controls how calls are retried when the device can't be reached
+// or answers with a 5xx status. RPC errors returned by the device are never
+// retried, and neither are calls that create an entry, which may have gone
+// through before the failure (EnsureSchedule and EnsureWebhook retry safely).
+type RetryPolicy struct {
+	Attempts int           // total attempts including the first; <= 1 disables retries
+	Backoff  time.Duration // delay before the first retry, doubled for each further retry
+}
+
+// WithHTTPClient uses httpClient for all requests instead of a client owned
+// by the Client. Timeout and transport options then apply to httpClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTransport sets the HTTP transport, e.g. for proxies, custom TLS or tests
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.httpClient.Transport = transport
+	}
+}
+
+// WithTimeout sets the per-request timeout; it also bounds the websocket
+// handshake of SubscribeEvents
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithAuth sets credentials for devices with authentication enabled
+func WithAuth(username, password string) Option {
+	return func(c *Client) {
+		c.SetAuth(username, password)
+	}
+}
+
+// WithCredentialsFunc looks up per-device credentials, falling back to WithAuth
+func WithCredentialsFunc(credFunc CredentialsFunc) Option {
+	return func(c *Client) {
+		c.credFunc = credFunc
+	}
+}
+
+// WithRetry retries failed round trips according to policy
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithObserver registers a callback invoked after every RPC call
+func WithObserver(observer CallObserver) Option {
+	return func(c *Client) {
+		c.observer = observer
+	}
+}
+
+// WithAddressResolver translates device addresses before dialling, e.g. to
+// reach devices through a VPN tunnel or subnet router
+func WithAddressResolver(resolver AddressResolver) Option {
+	return func(c *Client) {
+		c.resolver = resolver
+	}
+}
+
+// WithRelayResolver carries calls to some devices over a relay instead of
+// local HTTP, e.g. the Shelly Cloud for devices at remote sites
+func WithRelayResolver(relays RelayResolver) Option {
+	return func(c *Client) {
+		c.relays = relays
+	}
+}
+
+// WithHTTPSFunc calls the devices https reports true for over HTTPS
+func WithHTTPSFunc(https HTTPSFunc) Option {
+	return func(c *Client) {
+		c.https = https
+	}
+}
+
+// WithTLSConfig sets how device certificates are verified, see NewTLSConfig.
+// Apply it after WithHTTPClient or WithTransport.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *Client) {
+		c.SetTLSConfig(config)
+	}
+}
+
+// WithMaxInFlight limits how many calls run against a single device at the
+// same time, see SetMaxInFlight
+func WithMaxInFlight(n int) Option {
+	return func(c *Client) {
+		c.SetMaxInFlight(n)
+	}
+}
+
+// WithTimeouts sets the connect and request timeouts, see SetTimeouts. Apply
+// it after WithHTTPClient or WithTransport.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(c *Client) {
+		c.SetTimeouts(timeouts)
+	}
+}
+
+// WithTimeoutFunc looks up per-device timeouts, falling back to the
+// client-wide ones
+func WithTimeoutFunc(timeoutFunc TimeoutFunc) Option {
+	return func(c *Client) {
+		c.SetTimeoutFunc(timeoutFunc)
+	}
+}
+
+// WithPacingFunc looks up devices whose calls must run one at a time
+func WithPacingFunc(pacingFunc PacingFunc) Option {
+	return func(c *Client) {
+		c.SetPacingFunc(pacingFunc)
+	}
+}
+
+// WithTransportOptions tunes connection pooling, see SetTransportOptions.
+// Apply it after WithHTTPClient or WithTransport.
+func WithTransportOptions(opts TransportOptions) Option {
+	return func(c *Client) {
+		c.SetTransportOptions(opts)
+	}
+}
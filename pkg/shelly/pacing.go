@@ -0,0 +1,36 @@
+package shelly
+
+import (
+	"context"
+	"time"
+)
+
+// Pacing slows down the calls to a single device, e.g. a flaky Gen1 or
+// battery device that drops requests arriving back to back
+type Pacing struct {
+	Serial bool          // one call at a time, whatever the client's in-flight limit
+	Delay  time.Duration // pause after each call before the next one starts
+}
+
+// PacingFunc returns the pacing of a device; the zero Pacing leaves its calls
+// unthrottled
+type PacingFunc func(deviceIP string) Pacing
+
+// SetPacingFunc sets a lookup for per-device pacing. Devices it paces get a
+// call slot of their own instead of the client's in-flight limit.
+func (c *Client) SetPacingFunc(pacingFunc PacingFunc) {
+	c.pacingFunc = pacingFunc
+	if pacingFunc != nil && c.serial == nil {
+		c.serial = &inflightLimiter{max: 1, slots: make(map[string]chan struct{})}
+	}
+}
+
+// acquirePaced waits for the serial slot of deviceIP; the slot is freed
+// delay after the call returns
+func (c *Client) acquirePaced(ctx context.Context, deviceIP string, delay time.Duration) (func(), error) {
+	release, err := c.serial.acquire(ctx, deviceIP)
+	if err != nil || delay <= 0 {
+		return release, err
+	}
+	return func() { time.AfterFunc(delay, release) }, nil
+}
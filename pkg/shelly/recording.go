@@ -0,0 +1,243 @@
+package shelly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Fixture is a recorded RPC response
+type Fixture struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"` // the full RPC response envelope
+}
+
+// fixtureKey identifies a call independently of its request ID and
+// authentication. Secret params are redacted so they don't end up in the
+// fixture files.
+func fixtureKey(method string, params json.RawMessage) string {
+	if len(params) == 0 {
+		return method
+	}
+	// Re-encode so key order and whitespace don't matter
+	var generic interface{}
+	if json.Unmarshal(params, &generic) != nil {
+		return method
+	}
+	canonical, _ := json.Marshal(redactGeneric(generic))
+	if string(canonical) == "null" {
+		return method
+	}
+	return method + " " + string(canonical)
+}
+
+// fixtureFile is the file holding the fixtures of a device address
+func fixtureFile(dir, host string) string {
+	return filepath.Join(dir, strings.NewReplacer(":", "_", "/", "_", "[", "", "]", "").Replace(host)+".json")
+}
+
+// readRPCRequest reads the method and params of an RPC request body and
+// restores the body for the next round tripper
+func readRPCRequest(req *http.Request) (string, json.RawMessage, error) {
+	if req.Body == nil {
+		return "", nil, fmt.Errorf("request has no body")
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var rpc struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(body, &rpc); err != nil {
+		return "", nil, fmt.Errorf("failed to parse RPC request: %w", err)
+	}
+	return rpc.Method, rpc.Params, nil
+}
+
+// Recorder is an http.RoundTripper that passes calls on to a real transport
+// and saves every successful RPC response as a fixture, one JSON file per
+// device address in dir, for a Replayer to serve later. Secret fields are
+// redacted as in traces. Install it with Client.SetTransport.
+type Recorder struct {
+	dir  string
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	fixtures map[string]map[string]Fixture // by host, then call
+}
+
+// NewRecorder creates a recorder writing to dir in front of next
+func NewRecorder(dir string, next http.RoundTripper) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{dir: dir, next: next, fixtures: make(map[string]map[string]Fixture)}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	method, params, err := readRPCRequest(req)
+	if err != nil {
+		return r.next.RoundTrip(req)
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var envelope interface{}
+	if json.Unmarshal(body, &envelope) != nil {
+		return resp, nil
+	}
+	recorded, err := json.Marshal(redactGeneric(envelope))
+	if err != nil {
+		return resp, nil
+	}
+	var recordedParams json.RawMessage
+	if len(params) > 0 && string(params) != "null" {
+		if data, err := json.Marshal(redactTraceValue(params)); err == nil {
+			recordedParams = data
+		}
+	}
+
+	if err := r.save(req.URL.Host, fixtureKey(method, params), Fixture{Method: method, Params: recordedParams, Status: resp.StatusCode, Body: recorded}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// save adds a fixture and rewrites the device's fixture file
+func (r *Recorder) save(host, key string, fixture Fixture) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fixtures, ok := r.fixtures[host]
+	if !ok {
+		fixtures = make(map[string]Fixture)
+		r.fixtures[host] = fixtures
+	}
+	fixtures[key] = fixture
+
+	data, err := json.MarshalIndent(fixtures, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal fixtures: %w", err)
+	}
+	if err := os.WriteFile(fixtureFile(r.dir, host), data, 0600); err != nil {
+		return fmt.Errorf("failed to write fixtures: %w", err)
+	}
+	return nil
+}
+
+// Replayer is an http.RoundTripper that answers RPC calls from the fixtures
+// of a Recorder, without any network access. A call that wasn't recorded
+// fails like an unreachable device. Install it with Client.SetTransport.
+type Replayer struct {
+	dir string
+
+	mu       sync.Mutex
+	fixtures map[string]map[string]Fixture // by host, loaded on first use
+}
+
+// NewReplayer creates a replayer serving the fixtures in dir
+func NewReplayer(dir string) (*Replayer, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fixture directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &Replayer{dir: dir, fixtures: make(map[string]map[string]Fixture)}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	method, params, err := readRPCRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	fixtures, err := r.load(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	fixture, ok := fixtures[fixtureKey(method, params)]
+	if !ok {
+		return nil, fmt.Errorf("no recorded response for %s on %s", method, req.URL.Host)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Status, http.StatusText(fixture.Status)),
+		StatusCode:    fixture.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(fixture.Body)),
+		ContentLength: int64(len(fixture.Body)),
+		Request:       req,
+	}, nil
+}
+
+// load returns the fixtures of a device address, reading them once
+func (r *Replayer) load(host string) (map[string]Fixture, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if fixtures, ok := r.fixtures[host]; ok {
+		return fixtures, nil
+	}
+
+	fixtures := make(map[string]Fixture)
+	data, err := os.ReadFile(fixtureFile(r.dir, host))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read fixtures: %w", err)
+		}
+		return nil, fmt.Errorf("no fixtures recorded for %s", host)
+	}
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures for %s: %w", host, err)
+	}
+	r.fixtures[host] = fixtures
+	return fixtures, nil
+}
+
+// Transport returns the client's HTTP round tripper
+func (c *Client) Transport() http.RoundTripper {
+	if c.httpClient.Transport == nil {
+		return http.DefaultTransport
+	}
+	return c.httpClient.Transport
+}
+
+// SetTransport replaces the client's HTTP round tripper, e.g. with a
+// Recorder or Replayer. SetTransportOptions, SetTLSConfig and SetTimeouts
+// have no effect on custom round trippers, so call them first.
+func (c *Client) SetTransport(transport http.RoundTripper) {
+	c.httpClient.Transport = transport
+}
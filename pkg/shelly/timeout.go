@@ -0,0 +1,106 @@
+package shelly
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Timeouts bounds the calls to a device. Zero fields keep the client's
+// defaults.
+type Timeouts struct {
+	Connect time.Duration // establishing the TCP (and TLS) connection
+	Request time.Duration // the whole request, from dialling to reading the response
+}
+
+// TimeoutFunc returns the timeouts of a single device, e.g. longer ones for
+// battery devices on poor Wi-Fi; zero fields fall back to the client's
+type TimeoutFunc func(deviceIP string) Timeouts
+
+// dialTimeoutKey carries a per-device connect timeout to the dialer
+type dialTimeoutKey struct{}
+
+// SetTimeouts sets the client-wide timeouts. The connect timeout replaces the
+// dialer of the client's HTTP transport, so it has no effect on a custom
+// http.RoundTripper set with WithTransport.
+func (c *Client) SetTimeouts(timeouts Timeouts) {
+	if timeouts.Request > 0 {
+		c.httpClient.Timeout = timeouts.Request
+	}
+	if timeouts.Connect > 0 {
+		c.connectTimeout = timeouts.Connect
+		c.installDialer()
+	}
+}
+
+// SetTimeoutFunc sets a lookup for per-device timeouts, consulted before the
+// client-wide ones
+func (c *Client) SetTimeoutFunc(timeoutFunc TimeoutFunc) {
+	c.timeoutFunc = timeoutFunc
+	if timeoutFunc != nil {
+		c.installDialer()
+	}
+}
+
+// DialFunc opens a connection to a device address, e.g. through an SSH jump
+// host or SOCKS5 proxy at the device's site
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// SetDialFunc routes every connection to a device, for RPC calls and event
+// streams, through dial; nil dials directly again. Connect timeouts still
+// apply. Like SetTimeouts, it has no effect on a custom http.RoundTripper.
+func (c *Client) SetDialFunc(dial DialFunc) {
+	c.dialFunc = dial
+	if dial != nil {
+		c.installDialer()
+	}
+}
+
+// installDialer makes the client's HTTP transport dial with the client's
+// connect timeout, or the one carried by the request context, through the
+// client's DialFunc if set
+func (c *Client) installDialer() {
+	c.updateTransport(func(transport *http.Transport) {
+		transport.DialContext = c.dialContext
+	})
+}
+
+// dialContext dials a device with the connect timeout in effect
+func (c *Client) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	timeout := c.connectTimeout
+	if perDevice, ok := ctx.Value(dialTimeoutKey{}).(time.Duration); ok {
+		timeout = perDevice
+	}
+
+	if c.dialFunc != nil {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return c.dialFunc(ctx, network, addr)
+	}
+
+	dialer := net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// clientFor returns the HTTP client and context to call deviceIP with, applying
+// its per-device timeouts
+func (c *Client) clientFor(ctx context.Context, deviceIP string) (context.Context, *http.Client) {
+	if c.timeoutFunc == nil {
+		return ctx, c.httpClient
+	}
+
+	timeouts := c.timeoutFunc(deviceIP)
+	if timeouts.Connect > 0 {
+		ctx = context.WithValue(ctx, dialTimeoutKey{}, timeouts.Connect)
+	}
+	if timeouts.Request <= 0 {
+		return ctx, c.httpClient
+	}
+	client := *c.httpClient
+	client.Timeout = timeouts.Request
+	return ctx, &client
+}
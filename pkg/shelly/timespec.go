@@ -0,0 +1,256 @@
+package shelly
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timespec is a parsed Shelly schedule timespec ("ss mm hh DD MM WW")
+type Timespec struct {
+	Raw      string
+	Solar    string // "sunrise" or "sunset" for solar timespecs, empty otherwise
+	seconds  [60]bool
+	minutes  [60]bool
+	hours    [24]bool
+	days     [32]bool
+	months   [13]bool
+	weekdays [7]bool
+	anyDay   bool
+	anyWeek  bool
+}
+
+var monthNames = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
+
+var weekdayNames = map[string]int{
+	"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+}
+
+// ParseTimespec parses a Shelly schedule timespec
+// Solar timespecs ("@sunrise+30 * * MON-FRI") are recognised but only their
+// day fields are parsed, since firing times depend on the device location.
+func ParseTimespec(spec string) (*Timespec, error) {
+	fields := strings.Fields(spec)
+	ts := &Timespec{Raw: spec}
+
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		switch {
+		case strings.HasPrefix(fields[0], "@sunrise"):
+			ts.Solar = "sunrise"
+		case strings.HasPrefix(fields[0], "@sunset"):
+			ts.Solar = "sunset"
+		default:
+			return nil, fmt.Errorf("unknown solar timespec %q", fields[0])
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("solar timespec %q must have 4 fields", spec)
+		}
+		// Solar timespecs have the form "@sunrise DD MM WW"
+		fields = append([]string{"0", "0", "0"}, fields[1:]...)
+	} else if len(fields) != 6 {
+		return nil, fmt.Errorf("timespec %q must have 6 fields (ss mm hh DD MM WW)", spec)
+	}
+
+	if err := parseField(fields[0], 0, 59, nil, ts.seconds[:]); err != nil {
+		return nil, fmt.Errorf("invalid seconds in %q: %w", spec, err)
+	}
+	if err := parseField(fields[1], 0, 59, nil, ts.minutes[:]); err != nil {
+		return nil, fmt.Errorf("invalid minutes in %q: %w", spec, err)
+	}
+	if err := parseField(fields[2], 0, 23, nil, ts.hours[:]); err != nil {
+		return nil, fmt.Errorf("invalid hours in %q: %w", spec, err)
+	}
+	if err := parseField(fields[3], 1, 31, nil, ts.days[:]); err != nil {
+		return nil, fmt.Errorf("invalid day of month in %q: %w", spec, err)
+	}
+	if err := parseField(fields[4], 1, 12, monthNames, ts.months[:]); err != nil {
+		return nil, fmt.Errorf("invalid month in %q: %w", spec, err)
+	}
+	if err := parseField(fields[5], 0, 6, weekdayNames, ts.weekdays[:]); err != nil {
+		return nil, fmt.Errorf("invalid weekday in %q: %w", spec, err)
+	}
+
+	ts.anyDay = fields[3] == "*"
+	ts.anyWeek = fields[5] == "*"
+
+	return ts, nil
+}
+
+// parseField parses one cron field (lists, ranges, steps and names) into a set
+func parseField(field string, min, max int, names map[string]int, set []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s <= 0 {
+				return fmt.Errorf("invalid step %q", part)
+			}
+			step = s
+			part = part[:idx]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = parseValue(bounds[0], names); err != nil {
+				return err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = parseValue(bounds[1], names); err != nil {
+					return err
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+
+	return nil
+}
+
+func parseValue(value string, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToUpper(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return n, nil
+}
+
+// dayMatches applies cron semantics: when both day-of-month and weekday are
+// restricted, a day matches if either field matches
+func (ts *Timespec) dayMatches(t time.Time) bool {
+	if !ts.months[int(t.Month())] {
+		return false
+	}
+
+	dayOK := ts.days[t.Day()]
+	weekOK := ts.weekdays[int(t.Weekday())]
+
+	switch {
+	case ts.anyDay && ts.anyWeek:
+		return true
+	case ts.anyDay:
+		return weekOK
+	case ts.anyWeek:
+		return dayOK
+	default:
+		return dayOK || weekOK
+	}
+}
+
+// Next returns the first firing time strictly after t in t's location, searching
+// up to the given horizon. ok is false if the timespec never fires in that window
+// or is a solar timespec.
+func (ts *Timespec) Next(t time.Time, horizon time.Duration) (next time.Time, ok bool) {
+	if ts.Solar != "" {
+		return time.Time{}, false
+	}
+
+	loc := t.Location()
+	limit := t.Add(horizon)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+	for !day.After(limit) {
+		if ts.dayMatches(day) {
+			for h := 0; h < 24; h++ {
+				if !ts.hours[h] {
+					continue
+				}
+				for m := 0; m < 60; m++ {
+					if !ts.minutes[m] {
+						continue
+					}
+					for s := 0; s < 60; s++ {
+						if !ts.seconds[s] {
+							continue
+						}
+						candidate := time.Date(day.Year(), day.Month(), day.Day(), h, m, s, 0, loc)
+						if candidate.After(t) {
+							return candidate, !candidate.After(limit)
+						}
+					}
+				}
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return time.Time{}, false
+}
+
+// DescribeTimespec renders a timespec in plain language, e.g.
+// "0 30 7 * * MON-FRI" -> "at 07:30 on weekdays". Timespecs that don't fit a
+// simple sentence are returned as-is in backticks.
+func DescribeTimespec(spec string) string {
+	if _, err := ParseTimespec(spec); err != nil {
+		return "`" + spec + "`"
+	}
+
+	fields := strings.Fields(spec)
+	var when string
+	if strings.HasPrefix(fields[0], "@") {
+		event := strings.TrimPrefix(fields[0], "@")
+		when = "at " + event
+		if name, offset, ok := strings.Cut(event, "+"); ok {
+			when = offset + " after " + name
+		} else if name, offset, ok := strings.Cut(event, "-"); ok {
+			when = offset + " before " + name
+		}
+		fields = append([]string{"0", "0", "0"}, fields[1:]...)
+	} else {
+		second, errS := strconv.Atoi(fields[0])
+		minute, errM := strconv.Atoi(fields[1])
+		hour, errH := strconv.Atoi(fields[2])
+		switch {
+		case errS == nil && errM == nil && errH == nil && second == 0:
+			when = fmt.Sprintf("at %02d:%02d", hour, minute)
+		case errS == nil && errM == nil && errH == nil:
+			when = fmt.Sprintf("at %02d:%02d:%02d", hour, minute, second)
+		case errS == nil && errM == nil && fields[2] == "*":
+			when = fmt.Sprintf("every hour at minute %d", minute)
+		default:
+			return "`" + spec + "`"
+		}
+	}
+
+	days, months, weekdays := fields[3], fields[4], fields[5]
+	parts := []string{when}
+
+	switch strings.ToUpper(weekdays) {
+	case "*":
+		if days == "*" {
+			parts = append(parts, "every day")
+		}
+	case "MON-FRI", "1-5":
+		parts = append(parts, "on weekdays")
+	case "SAT,SUN", "SUN,SAT", "0,6", "6,0":
+		parts = append(parts, "on weekends")
+	default:
+		parts = append(parts, "on "+strings.ReplaceAll(weekdays, ",", ", "))
+	}
+	if days != "*" {
+		parts = append(parts, "on day "+strings.ReplaceAll(days, ",", ", ")+" of the month")
+	}
+	if months != "*" {
+		parts = append(parts, "in "+strings.ReplaceAll(months, ",", ", "))
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,64 @@
+package shelly
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// HTTPSFunc reports whether a device is reached over HTTPS rather than HTTP
+type HTTPSFunc func(deviceIP string) bool
+
+// TLSOptions controls how device certificates are verified
+type TLSOptions struct {
+	CAFile             string // PEM bundle trusted in addition to the system roots, e.g. the CA that signed the device certificates
+	InsecureSkipVerify bool   // accept any certificate; only for devices with self-signed certificates on a trusted network
+}
+
+// NewTLSConfig builds the TLS configuration for opts
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+	if opts.CAFile == "" {
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(opts.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", opts.CAFile)
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+// SetHTTPSFunc sets which devices are called over HTTPS (and wss for event
+// streams); nil calls every device over plain HTTP
+func (c *Client) SetHTTPSFunc(https HTTPSFunc) {
+	c.https = https
+}
+
+// SetTLSConfig sets how device certificates are verified. It replaces the
+// TLS configuration of the client's HTTP transport, so it has no effect on a
+// custom http.RoundTripper set with WithTransport.
+func (c *Client) SetTLSConfig(config *tls.Config) {
+	c.tlsConfig = config
+	c.updateTransport(func(transport *http.Transport) {
+		transport.TLSClientConfig = config
+	})
+}
+
+// useHTTPS reports whether deviceIP is called over TLS
+func (c *Client) useHTTPS(deviceIP string) bool {
+	return c.https != nil && c.https(deviceIP)
+}
@@ -0,0 +1,115 @@
+package shelly
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/darkermage/shelly-git-ops/internal/secrets"
+)
+
+// TraceEntry is one RPC call as recorded in a trace file (one JSON object per line)
+type TraceEntry struct {
+	Time       time.Time   `json:"time"`
+	Operation  string      `json:"operation,omitempty"`
+	Device     string      `json:"device"`
+	Method     string      `json:"method"`
+	Params     interface{} `json:"params,omitempty"`
+	Response   interface{} `json:"response,omitempty"`
+	DurationMs float64     `json:"duration_ms"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// tracer serializes trace entries to a writer
+type tracer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type traceOperationKey struct{}
+
+// WithTraceOperation labels RPC calls made with ctx in the trace, e.g. "push" or "pull"
+func WithTraceOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, traceOperationKey{}, operation)
+}
+
+// SetTrace records every RPC request and response to w with secret values
+// redacted. Pass nil to stop tracing.
+func (c *Client) SetTrace(w io.Writer) {
+	if w == nil {
+		c.tracer = nil
+		return
+	}
+	c.tracer = &tracer{enc: json.NewEncoder(w)}
+}
+
+// trace records a finished call
+func (c *Client) trace(ctx context.Context, deviceIP, method string, params interface{}, result json.RawMessage, duration time.Duration, err error) {
+	t := c.tracer
+	if t == nil {
+		return
+	}
+
+	entry := TraceEntry{
+		Time:       time.Now().Add(-duration),
+		Device:     deviceIP,
+		Method:     method,
+		Params:     redactTraceValue(params),
+		DurationMs: float64(duration.Microseconds()) / 1000,
+	}
+	if operation, ok := ctx.Value(traceOperationKey{}).(string); ok {
+		entry.Operation = operation
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if len(result) > 0 {
+		var response interface{}
+		if json.Unmarshal(result, &response) == nil {
+			entry.Response = redactTraceValue(response)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.enc.Encode(entry)
+}
+
+// redactTraceValue returns a JSON-like copy of value with secret fields masked
+func redactTraceValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	// Round-trip typed params (structs, typed maps) into generic JSON values
+	var generic interface{}
+	data, err := json.Marshal(value)
+	if err != nil || json.Unmarshal(data, &generic) != nil {
+		return nil
+	}
+
+	return redactGeneric(generic)
+}
+
+func redactGeneric(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if s, ok := item.(string); ok && s != "" && secrets.IsSecretKey(key) {
+				v[key] = secrets.Redact(s)
+				continue
+			}
+			v[key] = redactGeneric(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactGeneric(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
@@ -0,0 +1,74 @@
+package shelly
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Connection pool defaults of a client created without WithHTTPClient or
+// WithTransport. Devices only accept a handful of connections, so few are
+// kept open per device and idle ones are released quickly.
+const (
+	DefaultMaxIdleConnsPerHost = 2
+	DefaultIdleConnTimeout     = 30 * time.Second
+)
+
+// maxDrain bounds how much of an unread response body is discarded so its
+// connection can be reused; larger remainders close the connection instead
+const maxDrain = 64 << 10
+
+// TransportOptions tunes how connections to devices are pooled. Zero fields
+// keep the current setting.
+type TransportOptions struct {
+	MaxIdleConnsPerHost int           // idle keep-alive connections kept per device
+	IdleConnTimeout     time.Duration // how long an idle connection is kept
+	DisableKeepAlives   bool          // open a new connection for every call
+}
+
+// newTransport returns the HTTP transport of a new client
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 0 // unlimited; bounded per device instead
+	transport.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	transport.IdleConnTimeout = DefaultIdleConnTimeout
+	return transport
+}
+
+// SetTransportOptions tunes the connection pool of the client's HTTP
+// transport. It has no effect on a custom http.RoundTripper set with
+// WithTransport.
+func (c *Client) SetTransportOptions(opts TransportOptions) {
+	c.updateTransport(func(transport *http.Transport) {
+		if opts.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		}
+		if opts.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = opts.IdleConnTimeout
+		}
+		transport.DisableKeepAlives = opts.DisableKeepAlives
+	})
+}
+
+// updateTransport applies update to a copy of the client's HTTP transport
+// and installs the copy; custom round trippers are left alone
+func (c *Client) updateTransport(update func(*http.Transport)) {
+	var transport *http.Transport
+	switch t := c.httpClient.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return
+	}
+	update(transport)
+	c.httpClient.Transport = transport
+}
+
+// closeBody discards what is left of a response body and closes it, so the
+// connection goes back to the pool instead of being torn down
+func closeBody(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, maxDrain))
+	body.Close()
+}